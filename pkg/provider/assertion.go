@@ -0,0 +1,113 @@
+package provider
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/zitadel/saml/pkg/provider/models"
+	"github.com/zitadel/saml/pkg/provider/serviceprovider"
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
+)
+
+// AssertionPolicy can customize the assertion issued to a service provider.
+// The config is a copy of the one of the service provider (or empty) and can be changed freely.
+// The authRequest is nil for assertions not issued for an authentication (e.g. attribute queries).
+type AssertionPolicy func(ctx context.Context, sp *serviceprovider.ServiceProvider, authRequest models.AuthRequestInt, config *serviceprovider.AssertionConfig) error
+
+// assertionConfig returns the config for assertions issued to the service provider, after applying the AssertionPolicy
+func (p *IdentityProvider) assertionConfig(ctx context.Context, sp *serviceprovider.ServiceProvider, authRequest models.AuthRequestInt) (*serviceprovider.AssertionConfig, error) {
+	config := &serviceprovider.AssertionConfig{}
+	if sp != nil && sp.Assertion != nil {
+		config = sp.Assertion.Copy()
+	}
+	if p.assertionPolicy != nil {
+		if err := p.assertionPolicy(ctx, sp, authRequest, config); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// assertionExpiration returns the lifetime of the assertion configured or else the default expiration
+func assertionExpiration(config *serviceprovider.AssertionConfig, expiration time.Duration) time.Duration {
+	if config != nil && config.Lifetime > 0 {
+		return config.Lifetime
+	}
+	return expiration
+}
+
+// applyAssertionConfig adds the session lifetime, audiences and conditions of the config to the assertion,
+// the session lifetime never extends the SessionNotOnOrAfter of the session itself
+func applyAssertionConfig(assertion *saml.AssertionType, config *serviceprovider.AssertionConfig, authInstant time.Time, timeFormat string) {
+	if config == nil {
+		return
+	}
+	if config.SessionLifetime > 0 {
+		sessionNotOnOrAfter := authInstant.Add(config.SessionLifetime)
+		for i := range assertion.AuthnStatement {
+			statement := &assertion.AuthnStatement[i]
+			if expiration, err := time.Parse(timeFormat, statement.SessionNotOnOrAfter); err == nil && expiration.Before(sessionNotOnOrAfter) {
+				continue
+			}
+			statement.SessionNotOnOrAfter = sessionNotOnOrAfter.Format(timeFormat)
+		}
+	}
+	if assertion.Conditions == nil {
+		return
+	}
+	if len(config.AdditionalAudiences) > 0 {
+		if len(assertion.Conditions.AudienceRestriction) == 0 {
+			assertion.Conditions.AudienceRestriction = []saml.AudienceRestrictionType{{}}
+		}
+		restriction := &assertion.Conditions.AudienceRestriction[0]
+		for _, audience := range config.AdditionalAudiences {
+			if !slices.Contains(restriction.Audience, audience) {
+				restriction.Audience = append(restriction.Audience, audience)
+			}
+		}
+	}
+	if config.OneTimeUse {
+		assertion.Conditions.OneTimeUse = []saml.OneTimeUseType{{}}
+	}
+	if config.ProxyRestriction != nil {
+		assertion.Conditions.ProxyRestriction = []saml.ProxyRestrictionType{{
+			Count:    config.ProxyRestriction.Count,
+			Audience: config.ProxyRestriction.Audiences,
+		}}
+	}
+}
+
+// applyProxyRestriction merges the restriction into the ProxyRestriction of the assertion
+func applyProxyRestriction(assertion *saml.AssertionType, restriction *saml.ProxyRestrictionType) {
+	if restriction == nil || assertion.Conditions == nil {
+		return
+	}
+	if len(assertion.Conditions.ProxyRestriction) == 0 {
+		assertion.Conditions.ProxyRestriction = []saml.ProxyRestrictionType{{}}
+	}
+	mergeProxyRestriction(&assertion.Conditions.ProxyRestriction[0], *restriction)
+}
+
+// mergeProxyRestriction keeps the lower Count and the Audiences allowed by both restrictions,
+// no further assertions are allowed if the Audiences of the restrictions are disjoint
+func mergeProxyRestriction(restriction *saml.ProxyRestrictionType, other saml.ProxyRestrictionType) {
+	if other.Count != nil && (restriction.Count == nil || *other.Count < *restriction.Count) {
+		count := *other.Count
+		restriction.Count = &count
+	}
+	switch {
+	case len(other.Audience) == 0:
+	case len(restriction.Audience) == 0:
+		restriction.Audience = slices.Clone(other.Audience)
+	default:
+		restriction.Audience = slices.DeleteFunc(restriction.Audience, func(audience string) bool {
+			return !slices.Contains(other.Audience, audience)
+		})
+		if len(restriction.Audience) == 0 {
+			count := 0
+			restriction.Count = &count
+			restriction.Audience = nil
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/zitadel/logging"
+
+	"github.com/zitadel/saml/pkg/provider/checker"
+	"github.com/zitadel/saml/pkg/provider/serviceprovider"
+	"github.com/zitadel/saml/pkg/provider/xml"
+	"github.com/zitadel/saml/pkg/provider/xml/md"
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
+	"github.com/zitadel/saml/pkg/provider/xml/samlp"
+	"github.com/zitadel/saml/pkg/provider/xml/soap"
+	"github.com/zitadel/saml/pkg/provider/xml/xml_dsig"
+)
+
+// AuthzDecisionPolicy decides the AuthzDecisionQueries of service providers,
+// if no statement is returned the query is answered without an assertion
+type AuthzDecisionPolicy interface {
+	AuthzDecision(ctx context.Context, sp *serviceprovider.ServiceProvider, query *samlp.AuthzDecisionQueryType) (*saml.AuthzDecisionStatementType, error)
+}
+
+// assertionQuery contains the elements common to all requests of the assertion query/request protocol
+type assertionQuery struct {
+	id          string
+	destination string
+	issuer      *saml.NameIDType
+	signature   *xml_dsig.SignatureType
+}
+
+func (p *IdentityProvider) assertionQueryHandleFunc(w http.ResponseWriter, r *http.Request) {
+	checkerInstance := checker.Checker{}
+	var queryRequest string
+	var err error
+	var sp *serviceprovider.ServiceProvider
+	var body *soap.AssertionQueryBody
+	var query *assertionQuery
+	var response *samlp.ResponseType
+
+	//parse body to string
+	checkerInstance.WithLogicStep(
+		func() error {
+			b, err := io.ReadAll(r.Body)
+			if err != nil {
+				return err
+			}
+			queryRequest = string(b)
+			return nil
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to parse body: %w", err).Error(), http.StatusInternalServerError)
+		},
+	)
+
+	// decode request from xml into golang struct
+	checkerInstance.WithLogicStep(
+		func() error {
+			body, err = xml.DecodeAssertionQuery(queryRequest)
+			if err != nil {
+				return err
+			}
+			query, err = assertionQueryOf(body)
+			return err
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to decode request: %w", err).Error(), http.StatusBadRequest)
+		},
+	)
+
+	// get persisted service provider from issuer out of the request
+	checkerInstance.WithLogicStep(
+		func() error {
+			sp, err = p.GetServiceProvider(r.Context(), query.issuer.Text)
+			if err != nil {
+				return err
+			}
+			if sp == nil {
+				err = fmt.Errorf("unknown service provider %s", query.issuer.Text)
+			}
+			return err
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to find registered serviceprovider: %w", err).Error(), http.StatusInternalServerError)
+		},
+	)
+
+	//validate used certificate for signing the request
+	checkerInstance.WithConditionalLogicStep(
+		certificateCheckNecessary(
+			func() *xml_dsig.SignatureType { return query.signature },
+			func() *md.EntityDescriptorType { return sp.Metadata },
+		),
+		checkCertificate(
+			func() *xml_dsig.SignatureType { return query.signature },
+			func() *md.EntityDescriptorType { return sp.Metadata },
+		),
+		func() {
+			http.Error(w, fmt.Errorf("failed to validate certificate from request: %w", err).Error(), http.StatusInternalServerError)
+		},
+	)
+
+	// verify the signature of the request inside the SOAP envelope
+	checkerInstance.WithConditionalLogicStep(
+		signaturePostProvided(
+			func() *xml_dsig.SignatureType { return query.signature },
+		),
+		func() error {
+			err = sp.ValidateSOAPSignature(queryRequest)
+			return err
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to verify signature of request: %w", err).Error(), http.StatusInternalServerError)
+		},
+	)
+
+	// verify that destination in request is this IDP
+	checkerInstance.WithLogicStep(
+		func() error {
+			if query.destination != "" && query.destination != p.endpoints.assertionQueryEndpoint.Absolute(IssuerFromContext(r.Context())) {
+				err = fmt.Errorf("destination of request is unknown")
+			}
+			return err
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to verify request destination: %w", err).Error(), http.StatusInternalServerError)
+		},
+	)
+
+	// answer the query
+	checkerInstance.WithLogicStep(
+		func() error {
+			// the requester is authorized by its issuer, which is only authenticated by the signature of the request
+			if query.signature == nil {
+				response = p.queryResponse(r.Context(), query.id, StatusCodeRequestDenied, "request is not signed")
+				return nil
+			}
+			response, err = p.assertionQueryResponse(r.Context(), sp, body, query.id)
+			return err
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to answer query: %w", err).Error(), http.StatusInternalServerError)
+		},
+	)
+
+	// create enveloped signature
+	checkerInstance.WithLogicStep(
+		func() error {
+			cert, key, err := p.getResponseCert(r.Context())
+			if err != nil {
+				return err
+			}
+			return createPostSignature(response, key, cert, p.conf.SignatureAlgorithm)
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to sign response: %w", err).Error(), http.StatusInternalServerError)
+		},
+	)
+
+	//check and log errors if necessary
+	if checkerInstance.CheckFailed() {
+		return
+	}
+
+	soapResponse := &soap.ResponseEnvelope{
+		Body: soap.ResponseBody{
+			Response: response,
+		},
+	}
+
+	if err := xml.WriteXMLMarshalled(w, soapResponse); err != nil {
+		logging.Error(err)
+		http.Error(w, fmt.Errorf("failed to send response: %w", err).Error(), http.StatusInternalServerError)
+	}
+}
+
+func assertionQueryOf(body *soap.AssertionQueryBody) (*assertionQuery, error) {
+	var query *assertionQuery
+	switch {
+	case body.AssertionIDRequest != nil:
+		request := body.AssertionIDRequest
+		query = &assertionQuery{id: request.Id, destination: request.Destination, issuer: request.Issuer, signature: request.Signature}
+	case body.AuthnQuery != nil:
+		request := body.AuthnQuery
+		query = &assertionQuery{id: request.Id, destination: request.Destination, issuer: request.Issuer, signature: request.Signature}
+	case body.AuthzDecisionQuery != nil:
+		request := body.AuthzDecisionQuery
+		query = &assertionQuery{id: request.Id, destination: request.Destination, issuer: request.Issuer, signature: request.Signature}
+	default:
+		return nil, fmt.Errorf("no AssertionIDRequest, AuthnQuery or AuthzDecisionQuery in request")
+	}
+	if query.issuer == nil || query.issuer.Text == "" {
+		return nil, fmt.Errorf("no issuer in request")
+	}
+	return query, nil
+}
+
+func (p *IdentityProvider) assertionQueryResponse(ctx context.Context, sp *serviceprovider.ServiceProvider, body *soap.AssertionQueryBody, requestID string) (*samlp.ResponseType, error) {
+	switch {
+	case body.AssertionIDRequest != nil:
+		return p.assertionIDRequestResponse(ctx, sp, body.AssertionIDRequest)
+	case body.AuthnQuery != nil:
+		return p.authnQueryResponse(ctx, sp, body.AuthnQuery)
+	case body.AuthzDecisionQuery != nil:
+		return p.authzDecisionQueryResponse(ctx, sp, body.AuthzDecisionQuery)
+	}
+	return p.queryResponse(ctx, requestID, StatusCodeRequestUnsupported, "unsupported request"), nil
+}
+
+// assertionIDRequestResponse returns the stored assertion, if the requester is in its audience
+func (p *IdentityProvider) assertionIDRequestResponse(ctx context.Context, sp *serviceprovider.ServiceProvider, request *samlp.AssertionIDRequestType) (*samlp.ResponseType, error) {
+	assertionStorage, ok := p.storage.(AssertionStorage)
+	if !ok {
+		return p.queryResponse(ctx, request.Id, StatusCodeRequestUnsupported, "assertions are not stored"), nil
+	}
+	if len(request.AssertionIDRef) != 1 {
+		return p.queryResponse(ctx, request.Id, StatusCodeRequestUnsupported, "exactly one AssertionIDRef is supported"), nil
+	}
+	assertion, err := assertionStorage.GetAssertionByID(ctx, sp.GetEntityID(), request.AssertionIDRef[0])
+	if err != nil {
+		return nil, err
+	}
+	response := p.queryResponse(ctx, request.Id, StatusCodeSuccess, "")
+	if assertion == nil {
+		return response, nil
+	}
+	if !inAudience(assertion, sp.GetEntityID()) {
+		return p.queryResponse(ctx, request.Id, StatusCodeRequestDenied, "requester is not in the audience of the assertion"), nil
+	}
+	response.Assertion = assertion
+	return response, nil
+}
+
+// authnQueryResponse returns an assertion with an AuthnStatement for each session of the subject matching the query
+func (p *IdentityProvider) authnQueryResponse(ctx context.Context, sp *serviceprovider.ServiceProvider, query *samlp.AuthnQueryType) (*samlp.ResponseType, error) {
+	authnQueryStorage, ok := p.storage.(AuthnQueryStorage)
+	if !ok {
+		return p.queryResponse(ctx, query.Id, StatusCodeRequestUnsupported, "authn queries are not supported"), nil
+	}
+	if query.Subject.NameID == nil || query.Subject.NameID.Text == "" {
+		return p.queryResponse(ctx, query.Id, StatusCodeRequester, "no subject in query"), nil
+	}
+	if query.RequestedAuthnContext != nil &&
+		(query.RequestedAuthnContext.Comparison != "" && query.RequestedAuthnContext.Comparison != samlp.AuthnContextComparisonTypeExact ||
+			len(query.RequestedAuthnContext.AuthnContextDeclRef) > 0) {
+		return p.queryResponse(ctx, query.Id, StatusCodeRequestUnsupported, "only exact comparison of AuthnContextClassRef is supported"), nil
+	}
+
+	sessions, err := authnQueryStorage.GetSessionsBySubject(ctx, sp.GetEntityID(), query.Subject.NameID.Text)
+	if err != nil {
+		return nil, err
+	}
+	statements := make([]saml.AuthnStatementType, 0, len(sessions))
+	for _, session := range sessions {
+		if session == nil || !p.sessionMatchesQuery(session, sp.GetEntityID(), query) {
+			continue
+		}
+		statement := saml.AuthnStatementType{
+			SessionIndex: p.SessionIndex(session.ID, sp.GetEntityID()),
+			AuthnContext: saml.AuthnContextType{
+				AuthnContextClassRef:    defaultAuthnContextClassRef,
+				AuthenticatingAuthority: session.AuthenticatingAuthority,
+			},
+		}
+		if session.AuthnContextClassRef != "" {
+			statement.AuthnContext.AuthnContextClassRef = session.AuthnContextClassRef
+		}
+		if !session.AuthInstant.IsZero() {
+			statement.AuthnInstant = session.AuthInstant.UTC().Format(p.TimeFormat)
+		}
+		if !session.Expiration.IsZero() {
+			statement.SessionNotOnOrAfter = session.Expiration.UTC().Format(p.TimeFormat)
+		}
+		statements = append(statements, statement)
+	}
+
+	response := p.queryResponse(ctx, query.Id, StatusCodeSuccess, "")
+	if len(statements) == 0 {
+		return response, nil
+	}
+	response.Assertion, err = p.queryAssertion(ctx, sp, query.Id, query.Subject.NameID)
+	if err != nil {
+		return nil, err
+	}
+	response.Assertion.AuthnStatement = statements
+	return response, nil
+}
+
+func (p *IdentityProvider) sessionMatchesQuery(session *Session, entityID string, query *samlp.AuthnQueryType) bool {
+	if query.SessionIndex != "" && p.SessionIndex(session.ID, entityID) != query.SessionIndex {
+		return false
+	}
+	if query.RequestedAuthnContext == nil || len(query.RequestedAuthnContext.AuthnContextClassRef) == 0 {
+		return true
+	}
+	classRef := session.AuthnContextClassRef
+	if classRef == "" {
+		classRef = defaultAuthnContextClassRef
+	}
+	return slices.Contains(query.RequestedAuthnContext.AuthnContextClassRef, classRef)
+}
+
+// authzDecisionQueryResponse returns an assertion with the decision of the AuthzDecisionPolicy
+func (p *IdentityProvider) authzDecisionQueryResponse(ctx context.Context, sp *serviceprovider.ServiceProvider, query *samlp.AuthzDecisionQueryType) (*samlp.ResponseType, error) {
+	if p.authzDecisionPolicy == nil {
+		return p.queryResponse(ctx, query.Id, StatusCodeRequestUnsupported, "authz decision queries are not supported"), nil
+	}
+	if query.Subject.NameID == nil || query.Subject.NameID.Text == "" {
+		return p.queryResponse(ctx, query.Id, StatusCodeRequester, "no subject in query"), nil
+	}
+	statement, err := p.authzDecisionPolicy.AuthzDecision(ctx, sp, query)
+	if err != nil {
+		return nil, err
+	}
+
+	response := p.queryResponse(ctx, query.Id, StatusCodeSuccess, "")
+	if statement == nil {
+		return response, nil
+	}
+	response.Assertion, err = p.queryAssertion(ctx, sp, query.Id, query.Subject.NameID)
+	if err != nil {
+		return nil, err
+	}
+	response.Assertion.AuthzDecisionStatement = []saml.AuthzDecisionStatementType{*statement}
+	return response, nil
+}
+
+// queryAssertion returns an assertion about the subject without statements for the requester
+func (p *IdentityProvider) queryAssertion(ctx context.Context, sp *serviceprovider.ServiceProvider, requestID string, nameID *saml.NameIDType) (*saml.AssertionType, error) {
+	assertionConfig, err := p.assertionConfig(ctx, sp, nil)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	assertion := makeAssertion(requestID, "", "", now.Format(p.TimeFormat), now.Add(assertionExpiration(assertionConfig, p.Expiration)).Format(p.TimeFormat), p.GetEntityID(ctx), nameID, nil, sp.GetEntityID(), false)
+	applyAssertionConfig(assertion, assertionConfig, now, p.TimeFormat)
+	return assertion, nil
+}
+
+func (p *IdentityProvider) queryResponse(ctx context.Context, requestID string, status string, message string) *samlp.ResponseType {
+	return makeResponse(NewID(), requestID, "", time.Now().UTC().Format(p.TimeFormat), status, message, p.GetEntityID(ctx))
+}
+
+func inAudience(assertion *saml.AssertionType, entityID string) bool {
+	if assertion.Conditions == nil {
+		return false
+	}
+	for _, restriction := range assertion.Conditions.AudienceRestriction {
+		if slices.Contains(restriction.Audience, entityID) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,346 @@
+package provider
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zitadel/saml/pkg/provider/key"
+	"github.com/zitadel/saml/pkg/provider/mock"
+	"github.com/zitadel/saml/pkg/provider/serviceprovider"
+	saml_xml "github.com/zitadel/saml/pkg/provider/xml"
+	"github.com/zitadel/saml/pkg/provider/xml/md"
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
+	"github.com/zitadel/saml/pkg/provider/xml/samlp"
+	"github.com/zitadel/saml/pkg/provider/xml/soap"
+)
+
+type assertionQueryStorage struct {
+	*mock.MockIDPStorage
+	assertions map[string]*saml.AssertionType
+	sessions   []*Session
+}
+
+func (s *assertionQueryStorage) StoreAssertion(_ context.Context, _ string, assertion *saml.AssertionType) error {
+	s.assertions[assertion.Id] = assertion
+	return nil
+}
+
+func (s *assertionQueryStorage) GetAssertionByID(_ context.Context, _ string, assertionID string) (*saml.AssertionType, error) {
+	return s.assertions[assertionID], nil
+}
+
+func (s *assertionQueryStorage) GetSessionsBySubject(_ context.Context, _ string, _ string) ([]*Session, error) {
+	return s.sessions, nil
+}
+
+type authzDecisionPolicy struct{}
+
+func (authzDecisionPolicy) AuthzDecision(_ context.Context, _ *serviceprovider.ServiceProvider, query *samlp.AuthzDecisionQueryType) (*saml.AuthzDecisionStatementType, error) {
+	if query.Resource == "unknown" {
+		return nil, nil
+	}
+	return &saml.AuthzDecisionStatementType{Resource: query.Resource, Decision: saml.DecisionTypePermit, Action: query.Action}, nil
+}
+
+func newAssertionQueryIDP(t *testing.T, storage IDPStorage) *IdentityProvider {
+	idp, err := newTestIdentityProvider(NewEndpoint("metadata"), &IdentityProviderConfig{}, storage)
+	require.NoError(t, err)
+	return idp
+}
+
+func TestAssertionQuery_assertionIDRequestResponse(t *testing.T) {
+	sp := &serviceprovider.ServiceProvider{Metadata: &md.EntityDescriptorType{EntityID: "sp"}}
+	storage := &assertionQueryStorage{
+		MockIDPStorage: mock.NewMockIDPStorage(gomock.NewController(t)),
+		assertions: map[string]*saml.AssertionType{
+			"assertion": {Id: "assertion", Conditions: &saml.ConditionsType{AudienceRestriction: []saml.AudienceRestrictionType{{Audience: []string{"sp"}}}}},
+			"other":     {Id: "other", Conditions: &saml.ConditionsType{AudienceRestriction: []saml.AudienceRestrictionType{{Audience: []string{"other"}}}}},
+		},
+	}
+	type res struct {
+		status    string
+		assertion string
+	}
+	tests := []struct {
+		name    string
+		storage IDPStorage
+		refs    []string
+		res     res
+	}{
+		{
+			"no assertion storage",
+			storage.MockIDPStorage,
+			[]string{"assertion"},
+			res{status: StatusCodeRequestUnsupported},
+		},
+		{
+			"multiple references",
+			storage,
+			[]string{"assertion", "other"},
+			res{status: StatusCodeRequestUnsupported},
+		},
+		{
+			"unknown assertion",
+			storage,
+			[]string{"unknown"},
+			res{status: StatusCodeSuccess},
+		},
+		{
+			"not in audience",
+			storage,
+			[]string{"other"},
+			res{status: StatusCodeRequestDenied},
+		},
+		{
+			"assertion",
+			storage,
+			[]string{"assertion"},
+			res{status: StatusCodeSuccess, assertion: "assertion"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newAssertionQueryIDP(t, tt.storage)
+			response, err := idp.assertionIDRequestResponse(context.Background(), sp, &samlp.AssertionIDRequestType{Id: "request", AssertionIDRef: tt.refs})
+			require.NoError(t, err)
+			assert.Equal(t, "request", response.InResponseTo)
+			assert.Equal(t, tt.res.status, response.Status.StatusCode.Value)
+			if tt.res.assertion == "" {
+				assert.Nil(t, response.Assertion)
+				return
+			}
+			require.NotNil(t, response.Assertion)
+			assert.Equal(t, tt.res.assertion, response.Assertion.Id)
+		})
+	}
+}
+
+func TestAssertionQuery_authnQueryResponse(t *testing.T) {
+	sp := &serviceprovider.ServiceProvider{Metadata: &md.EntityDescriptorType{EntityID: "sp"}}
+	authInstant := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	storage := &assertionQueryStorage{
+		MockIDPStorage: mock.NewMockIDPStorage(gomock.NewController(t)),
+		sessions: []*Session{
+			{ID: "session1", AuthInstant: authInstant},
+			{ID: "session2", AuthInstant: authInstant, AuthnContextClassRef: "urn:oasis:names:tc:SAML:2.0:ac:classes:X509"},
+		},
+	}
+	type res struct {
+		status         string
+		sessionIndexes []string
+	}
+	tests := []struct {
+		name    string
+		storage IDPStorage
+		query   *samlp.AuthnQueryType
+		res     res
+	}{
+		{
+			"no authn query storage",
+			storage.MockIDPStorage,
+			&samlp.AuthnQueryType{Id: "request", Subject: saml.SubjectType{NameID: &saml.NameIDType{Text: "user"}}},
+			res{status: StatusCodeRequestUnsupported},
+		},
+		{
+			"no subject",
+			storage,
+			&samlp.AuthnQueryType{Id: "request"},
+			res{status: StatusCodeRequester},
+		},
+		{
+			"all sessions",
+			storage,
+			&samlp.AuthnQueryType{Id: "request", Subject: saml.SubjectType{NameID: &saml.NameIDType{Text: "user"}}},
+			res{status: StatusCodeSuccess, sessionIndexes: []string{"session1", "session2"}},
+		},
+		{
+			"session index",
+			storage,
+			&samlp.AuthnQueryType{Id: "request", SessionIndex: "session2", Subject: saml.SubjectType{NameID: &saml.NameIDType{Text: "user"}}},
+			res{status: StatusCodeSuccess, sessionIndexes: []string{"session2"}},
+		},
+		{
+			"requested authn context",
+			storage,
+			&samlp.AuthnQueryType{
+				Id:                    "request",
+				Subject:               saml.SubjectType{NameID: &saml.NameIDType{Text: "user"}},
+				RequestedAuthnContext: &samlp.RequestedAuthnContextType{AuthnContextClassRef: []string{defaultAuthnContextClassRef}},
+			},
+			res{status: StatusCodeSuccess, sessionIndexes: []string{"session1"}},
+		},
+		{
+			"unsupported comparison",
+			storage,
+			&samlp.AuthnQueryType{
+				Id:                    "request",
+				Subject:               saml.SubjectType{NameID: &saml.NameIDType{Text: "user"}},
+				RequestedAuthnContext: &samlp.RequestedAuthnContextType{Comparison: samlp.AuthnContextComparisonTypeMinimum, AuthnContextClassRef: []string{defaultAuthnContextClassRef}},
+			},
+			res{status: StatusCodeRequestUnsupported},
+		},
+		{
+			"no matching session",
+			storage,
+			&samlp.AuthnQueryType{Id: "request", SessionIndex: "unknown", Subject: saml.SubjectType{NameID: &saml.NameIDType{Text: "user"}}},
+			res{status: StatusCodeSuccess},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newAssertionQueryIDP(t, tt.storage)
+			response, err := idp.authnQueryResponse(context.Background(), sp, tt.query)
+			require.NoError(t, err)
+			assert.Equal(t, tt.res.status, response.Status.StatusCode.Value)
+			if len(tt.res.sessionIndexes) == 0 {
+				assert.Nil(t, response.Assertion)
+				return
+			}
+			require.NotNil(t, response.Assertion)
+			assert.Equal(t, "user", response.Assertion.Subject.NameID.Text)
+			assert.Equal(t, []string{"sp"}, response.Assertion.Conditions.AudienceRestriction[0].Audience)
+			sessionIndexes := make([]string, len(response.Assertion.AuthnStatement))
+			for i, statement := range response.Assertion.AuthnStatement {
+				sessionIndexes[i] = statement.SessionIndex
+				assert.Equal(t, "2024-01-01T00:00:00Z", statement.AuthnInstant)
+			}
+			assert.Equal(t, tt.res.sessionIndexes, sessionIndexes)
+		})
+	}
+}
+
+func TestAssertionQuery_authzDecisionQueryResponse(t *testing.T) {
+	sp := &serviceprovider.ServiceProvider{Metadata: &md.EntityDescriptorType{EntityID: "sp"}}
+	subject := saml.SubjectType{NameID: &saml.NameIDType{Text: "user"}}
+	tests := []struct {
+		name     string
+		policy   AuthzDecisionPolicy
+		query    *samlp.AuthzDecisionQueryType
+		status   string
+		decision saml.DecisionType
+	}{
+		{
+			"no policy",
+			nil,
+			&samlp.AuthzDecisionQueryType{Id: "request", Resource: "resource", Subject: subject},
+			StatusCodeRequestUnsupported,
+			"",
+		},
+		{
+			"no decision",
+			authzDecisionPolicy{},
+			&samlp.AuthzDecisionQueryType{Id: "request", Resource: "unknown", Subject: subject},
+			StatusCodeSuccess,
+			"",
+		},
+		{
+			"decision",
+			authzDecisionPolicy{},
+			&samlp.AuthzDecisionQueryType{Id: "request", Resource: "resource", Subject: subject, Action: []saml.ActionType{{Text: "read"}}},
+			StatusCodeSuccess,
+			saml.DecisionTypePermit,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newAssertionQueryIDP(t, mock.NewMockIDPStorage(gomock.NewController(t)))
+			idp.authzDecisionPolicy = tt.policy
+			response, err := idp.authzDecisionQueryResponse(context.Background(), sp, tt.query)
+			require.NoError(t, err)
+			assert.Equal(t, tt.status, response.Status.StatusCode.Value)
+			if tt.decision == "" {
+				assert.Nil(t, response.Assertion)
+				return
+			}
+			require.NotNil(t, response.Assertion)
+			require.Len(t, response.Assertion.AuthzDecisionStatement, 1)
+			assert.Equal(t, tt.decision, response.Assertion.AuthzDecisionStatement[0].Decision)
+			assert.Equal(t, "resource", response.Assertion.AuthzDecisionStatement[0].Resource)
+		})
+	}
+}
+
+func TestAssertionQuery_DecodeAssertionQuery(t *testing.T) {
+	request := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+	<soap:Body>
+		<samlp:AssertionIDRequest xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="request" Version="2.0" IssueInstant="2024-01-01T00:00:00Z">
+			<saml:Issuer>sp</saml:Issuer>
+			<saml:AssertionIDRef>assertion</saml:AssertionIDRef>
+		</samlp:AssertionIDRequest>
+	</soap:Body>
+</soap:Envelope>`
+
+	body, err := saml_xml.DecodeAssertionQuery(request)
+	require.NoError(t, err)
+	query, err := assertionQueryOf(body)
+	require.NoError(t, err)
+	assert.Equal(t, "request", query.id)
+	assert.Equal(t, "sp", query.issuer.Text)
+	assert.Nil(t, body.AuthnQuery)
+	assert.Nil(t, body.AuthzDecisionQuery)
+	assert.Equal(t, []string{"assertion"}, body.AssertionIDRequest.AssertionIDRef)
+}
+
+func TestAssertionQuery_assertionQueryHandleFunc(t *testing.T) {
+	idpKey, idpCert := newKeyAndCertificate(t)
+	mockStorage := mock.NewMockIDPStorage(gomock.NewController(t))
+	mockStorage.EXPECT().GetEntityByID(gomock.Any(), "sp").Return(&serviceprovider.ServiceProvider{
+		Metadata: &md.EntityDescriptorType{EntityID: "sp", SPSSODescriptor: &md.SPSSODescriptorType{}},
+	}, nil).AnyTimes()
+	storage := &assertionQueryStorage{
+		MockIDPStorage: mockStorage,
+		assertions:     map[string]*saml.AssertionType{},
+		sessions:       []*Session{{ID: "session"}},
+	}
+	idp, err := newTestIdentityProvider(NewEndpoint("metadata"), &IdentityProviderConfig{SignatureAlgorithm: dsig.RSASHA256SignatureMethod}, storage)
+	require.NoError(t, err)
+	idp.responseSigningKey = &key.CertificateAndKey{Certificate: idpCert.Raw, Key: idpKey}
+	idp.authzDecisionPolicy = authzDecisionPolicy{}
+
+	// unsigned queries could read the sessions and decisions of any subject in the name of any service provider
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{
+			"assertion id request",
+			`<samlp:AssertionIDRequest xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_request" Version="2.0" IssueInstant="2024-01-01T00:00:00Z">` +
+				`<saml:Issuer>sp</saml:Issuer><saml:AssertionIDRef>assertion</saml:AssertionIDRef></samlp:AssertionIDRequest>`,
+		},
+		{
+			"authn query",
+			`<samlp:AuthnQuery xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_request" Version="2.0" IssueInstant="2024-01-01T00:00:00Z">` +
+				`<saml:Issuer>sp</saml:Issuer><saml:Subject><saml:NameID>user</saml:NameID></saml:Subject></samlp:AuthnQuery>`,
+		},
+		{
+			"authz decision query",
+			`<samlp:AuthzDecisionQuery xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_request" Version="2.0" IssueInstant="2024-01-01T00:00:00Z" Resource="resource">` +
+				`<saml:Issuer>sp</saml:Issuer><saml:Subject><saml:NameID>user</saml:NameID></saml:Subject><saml:Action>read</saml:Action></samlp:AuthzDecisionQuery>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` + tt.query + `</soap:Body></soap:Envelope>`
+			w := httptest.NewRecorder()
+			idp.assertionQueryHandleFunc(w, httptest.NewRequest(http.MethodPost, "https://idp.example.com/query", strings.NewReader(body)))
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+			envelope := new(soap.ResponseEnvelope)
+			require.NoError(t, xml.Unmarshal(w.Body.Bytes(), envelope))
+			response := envelope.Body.Response
+			require.NotNil(t, response)
+			assert.Equal(t, StatusCodeRequestDenied, response.Status.StatusCode.Value)
+			assert.Nil(t, response.Assertion)
+		})
+	}
+}
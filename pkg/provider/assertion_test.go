@@ -0,0 +1,162 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zitadel/saml/pkg/provider/models"
+	"github.com/zitadel/saml/pkg/provider/serviceprovider"
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
+)
+
+func TestAssertion_applyAssertionConfig(t *testing.T) {
+	count := 0
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	type res struct {
+		sessionNotOnOrAfter string
+		audiences           []string
+		oneTimeUse          []saml.OneTimeUseType
+		proxyRestriction    []saml.ProxyRestrictionType
+	}
+	tests := []struct {
+		name string
+		// sessionNotOnOrAfter is the expiration of the session already set on the assertion
+		sessionNotOnOrAfter string
+		config              *serviceprovider.AssertionConfig
+		res                 res
+	}{
+		{
+			"no config",
+			"",
+			nil,
+			res{
+				audiences: []string{"audience"},
+			},
+		},
+		{
+			"session lifetime",
+			"",
+			&serviceprovider.AssertionConfig{SessionLifetime: time.Hour},
+			res{
+				sessionNotOnOrAfter: "2024-01-01T01:00:00Z",
+				audiences:           []string{"audience"},
+			},
+		},
+		{
+			"session lifetime before session expiration",
+			"2024-01-01T02:00:00Z",
+			&serviceprovider.AssertionConfig{SessionLifetime: time.Hour},
+			res{
+				sessionNotOnOrAfter: "2024-01-01T01:00:00Z",
+				audiences:           []string{"audience"},
+			},
+		},
+		{
+			"session expiration before session lifetime",
+			"2024-01-01T00:30:00Z",
+			&serviceprovider.AssertionConfig{SessionLifetime: time.Hour},
+			res{
+				sessionNotOnOrAfter: "2024-01-01T00:30:00Z",
+				audiences:           []string{"audience"},
+			},
+		},
+		{
+			"additional audiences",
+			"",
+			&serviceprovider.AssertionConfig{AdditionalAudiences: []string{"audience", "other"}},
+			res{
+				audiences: []string{"audience", "other"},
+			},
+		},
+		{
+			"conditions",
+			"",
+			&serviceprovider.AssertionConfig{
+				OneTimeUse:       true,
+				ProxyRestriction: &serviceprovider.ProxyRestriction{Count: &count, Audiences: []string{"proxied"}},
+			},
+			res{
+				audiences:        []string{"audience"},
+				oneTimeUse:       []saml.OneTimeUseType{{}},
+				proxyRestriction: []saml.ProxyRestrictionType{{Count: &count, Audience: []string{"proxied"}}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertion := makeAssertion("request", "acs", "", now.Format(DefaultTimeFormat), now.Add(time.Minute).Format(DefaultTimeFormat), "issuer", &saml.NameIDType{}, nil, "audience", true)
+			assertion.AuthnStatement[0].SessionNotOnOrAfter = tt.sessionNotOnOrAfter
+			applyAssertionConfig(assertion, tt.config, now, DefaultTimeFormat)
+
+			assert.Equal(t, tt.res.sessionNotOnOrAfter, assertion.AuthnStatement[0].SessionNotOnOrAfter)
+			assert.Equal(t, tt.res.audiences, assertion.Conditions.AudienceRestriction[0].Audience)
+			assert.Equal(t, tt.res.oneTimeUse, assertion.Conditions.OneTimeUse)
+			assert.Equal(t, tt.res.proxyRestriction, assertion.Conditions.ProxyRestriction)
+		})
+	}
+}
+
+func TestAssertion_assertionConfig(t *testing.T) {
+	sp := &serviceprovider.ServiceProvider{
+		Assertion: &serviceprovider.AssertionConfig{Lifetime: time.Minute, AdditionalAudiences: []string{"audience"}},
+	}
+	idp := &IdentityProvider{
+		assertionPolicy: func(_ context.Context, _ *serviceprovider.ServiceProvider, _ models.AuthRequestInt, config *serviceprovider.AssertionConfig) error {
+			config.Lifetime = 30 * time.Second
+			config.AdditionalAudiences = append(config.AdditionalAudiences, "policy")
+			return nil
+		},
+	}
+
+	config, err := idp.assertionConfig(context.Background(), sp, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, assertionExpiration(config, DefaultExpiration))
+	assert.Equal(t, []string{"audience", "policy"}, config.AdditionalAudiences)
+	assert.Equal(t, []string{"audience"}, sp.Assertion.AdditionalAudiences)
+	assert.Equal(t, DefaultExpiration, assertionExpiration(nil, DefaultExpiration))
+}
+
+func TestAssertion_applyProxyRestriction(t *testing.T) {
+	zero, one, two := 0, 1, 2
+	tests := []struct {
+		name        string
+		configured  []saml.ProxyRestrictionType
+		restriction *saml.ProxyRestrictionType
+		want        []saml.ProxyRestrictionType
+	}{
+		{
+			"no restriction",
+			[]saml.ProxyRestrictionType{{Count: &one}},
+			nil,
+			[]saml.ProxyRestrictionType{{Count: &one}},
+		},
+		{
+			"not configured",
+			nil,
+			&saml.ProxyRestrictionType{Count: &one, Audience: []string{"a"}},
+			[]saml.ProxyRestrictionType{{Count: &one, Audience: []string{"a"}}},
+		},
+		{
+			"lower count and common audiences",
+			[]saml.ProxyRestrictionType{{Count: &two, Audience: []string{"a", "b"}}},
+			&saml.ProxyRestrictionType{Count: &one, Audience: []string{"b", "c"}},
+			[]saml.ProxyRestrictionType{{Count: &one, Audience: []string{"b"}}},
+		},
+		{
+			"disjoint audiences",
+			[]saml.ProxyRestrictionType{{Audience: []string{"a"}}},
+			&saml.ProxyRestrictionType{Audience: []string{"b"}},
+			[]saml.ProxyRestrictionType{{Count: &zero}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertion := &saml.AssertionType{Conditions: &saml.ConditionsType{ProxyRestriction: tt.configured}}
+			applyProxyRestriction(assertion, tt.restriction)
+			assert.Equal(t, tt.want, assertion.Conditions.ProxyRestriction)
+		})
+	}
+}
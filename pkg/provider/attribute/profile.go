@@ -0,0 +1,150 @@
+package attribute
+
+import "strings"
+
+const (
+	Email int = iota
+	FullName
+	GivenName
+	Surname
+	Username
+	UserID
+)
+
+const (
+	NameFormatBasic       = "urn:oasis:names:tc:SAML:2.0:attrname-format:basic"
+	NameFormatURI         = "urn:oasis:names:tc:SAML:2.0:attrname-format:uri"
+	NameFormatUnspecified = "urn:oasis:names:tc:SAML:2.0:attrname-format:unspecified"
+)
+
+// profilePrefixOASIS is the prefix of the URIs of the attribute profiles defined by the OASIS
+const profilePrefixOASIS = "urn:oasis:names:tc:SAML:2.0:profiles:attribute:"
+
+const (
+	ProfileBasic = "urn:oasis:names:tc:SAML:2.0:profiles:attribute:basic"
+	ProfileX500  = "urn:oasis:names:tc:SAML:2.0:profiles:attribute:X500"
+	// ProfileMicrosoftClaims is the namespace of the claim URIs, there is no attribute profile of the OASIS for them
+	ProfileMicrosoftClaims = "http://schemas.xmlsoap.org/ws/2005/05/identity/claims"
+)
+
+// Definition describes how an attribute is named in an assertion.
+type Definition struct {
+	Name         string
+	FriendlyName string
+	NameFormat   string
+}
+
+// Profile maps the user attributes (e.g. Email) to the names expected by a service provider.
+// Attributes without a definition in the profile are not released.
+type Profile struct {
+	// ID is the URI of the attribute profile (e.g. ProfileBasic), which is published in the metadata
+	// if it is an attribute profile of the OASIS
+	ID string
+	// Attributes maps the user attributes to their definition
+	Attributes map[int]Definition
+	// CustomAttributes optionally renames custom attributes by their name;
+	// custom attributes without an entry are released as set
+	CustomAttributes map[string]Definition
+}
+
+// Definition returns the definition of the user attribute and whether it is released in this profile.
+func (p *Profile) Definition(id int) (Definition, bool) {
+	def, ok := p.Attributes[id]
+	return def, ok
+}
+
+// IsOASIS returns whether the ID is the URI of an attribute profile defined by the OASIS,
+// only those are published as AttributeProfile in the metadata.
+func (p *Profile) IsOASIS() bool {
+	return strings.HasPrefix(p.ID, profilePrefixOASIS)
+}
+
+// CustomDefinition returns the definition of a custom attribute,
+// either renamed by the profile or as provided.
+func (p *Profile) CustomDefinition(name, friendlyName, nameFormat string) Definition {
+	if def, ok := p.CustomAttributes[name]; ok {
+		return def
+	}
+	return Definition{Name: name, FriendlyName: friendlyName, NameFormat: nameFormat}
+}
+
+// BasicProfile names the attributes with simple names in the basic nameformat.
+var BasicProfile = &Profile{
+	ID: ProfileBasic,
+	Attributes: map[int]Definition{
+		Email:     {Name: "Email", NameFormat: NameFormatBasic},
+		FullName:  {Name: "FullName", NameFormat: NameFormatBasic},
+		GivenName: {Name: "FirstName", NameFormat: NameFormatBasic},
+		Surname:   {Name: "SurName", NameFormat: NameFormatBasic},
+		Username:  {Name: "UserName", NameFormat: NameFormatBasic},
+		UserID:    {Name: "UserID", NameFormat: NameFormatBasic},
+	},
+}
+
+// Attribute definitions of the X.500/LDAP attribute profile,
+// see https://docs.oasis-open.org/security/saml/v2.0/saml-profiles-2.0-os.pdf chapter 8.2
+var (
+	Mail        = Definition{Name: "urn:oid:0.9.2342.19200300.100.1.3", FriendlyName: "mail", NameFormat: NameFormatURI}
+	SN          = Definition{Name: "urn:oid:2.5.4.4", FriendlyName: "sn", NameFormat: NameFormatURI}
+	GivenNameDN = Definition{Name: "urn:oid:2.5.4.42", FriendlyName: "givenName", NameFormat: NameFormatURI}
+	DisplayName = Definition{Name: "urn:oid:2.16.840.1.113730.3.1.241", FriendlyName: "displayName", NameFormat: NameFormatURI}
+	CN          = Definition{Name: "urn:oid:2.5.4.3", FriendlyName: "cn", NameFormat: NameFormatURI}
+	UID         = Definition{Name: "urn:oid:0.9.2342.19200300.100.1.1", FriendlyName: "uid", NameFormat: NameFormatURI}
+)
+
+// Attribute definitions of eduPerson (https://refeds.org/eduperson) and SCHAC (https://wiki.refeds.org/display/STAN/SCHAC),
+// which can be used to set custom attributes.
+var (
+	EduPersonPrincipalName         = Definition{Name: "urn:oid:1.3.6.1.4.1.5923.1.1.1.6", FriendlyName: "eduPersonPrincipalName", NameFormat: NameFormatURI}
+	EduPersonUniqueID              = Definition{Name: "urn:oid:1.3.6.1.4.1.5923.1.1.1.13", FriendlyName: "eduPersonUniqueId", NameFormat: NameFormatURI}
+	EduPersonAffiliation           = Definition{Name: "urn:oid:1.3.6.1.4.1.5923.1.1.1.1", FriendlyName: "eduPersonAffiliation", NameFormat: NameFormatURI}
+	EduPersonScopedAffiliation     = Definition{Name: "urn:oid:1.3.6.1.4.1.5923.1.1.1.9", FriendlyName: "eduPersonScopedAffiliation", NameFormat: NameFormatURI}
+	EduPersonEntitlement           = Definition{Name: "urn:oid:1.3.6.1.4.1.5923.1.1.1.7", FriendlyName: "eduPersonEntitlement", NameFormat: NameFormatURI}
+	EduPersonTargetedID            = Definition{Name: "urn:oid:1.3.6.1.4.1.5923.1.1.1.10", FriendlyName: "eduPersonTargetedID", NameFormat: NameFormatURI}
+	EduPersonAssurance             = Definition{Name: "urn:oid:1.3.6.1.4.1.5923.1.1.1.11", FriendlyName: "eduPersonAssurance", NameFormat: NameFormatURI}
+	SchacHomeOrganization          = Definition{Name: "urn:oid:1.3.6.1.4.1.25178.1.2.9", FriendlyName: "schacHomeOrganization", NameFormat: NameFormatURI}
+	SchacHomeOrganizationType      = Definition{Name: "urn:oid:1.3.6.1.4.1.25178.1.2.10", FriendlyName: "schacHomeOrganizationType", NameFormat: NameFormatURI}
+	SchacPersonalUniqueCode        = Definition{Name: "urn:oid:1.3.6.1.4.1.25178.1.2.14", FriendlyName: "schacPersonalUniqueCode", NameFormat: NameFormatURI}
+	SchacPersonalUniqueID          = Definition{Name: "urn:oid:1.3.6.1.4.1.25178.1.2.15", FriendlyName: "schacPersonalUniqueID", NameFormat: NameFormatURI}
+	SchacUserPresenceID            = Definition{Name: "urn:oid:1.3.6.1.4.1.25178.1.2.12", FriendlyName: "schacUserPresenceID", NameFormat: NameFormatURI}
+	SchacHomeOrganizationScopedOID = Definition{Name: "urn:oid:1.3.6.1.4.1.25178.1.0.2.3", FriendlyName: "schacHomeOrganizationScopedOID", NameFormat: NameFormatURI}
+)
+
+// URIProfile names the attributes by their OID in the uri nameformat (X.500/LDAP attribute profile).
+var URIProfile = &Profile{
+	ID: ProfileX500,
+	Attributes: map[int]Definition{
+		Email:     Mail,
+		FullName:  DisplayName,
+		GivenName: GivenNameDN,
+		Surname:   SN,
+		Username:  UID,
+	},
+}
+
+// EduPersonProfile names the attributes like the URIProfile,
+// but releases the username as eduPersonPrincipalName and the userID as eduPersonUniqueId.
+var EduPersonProfile = &Profile{
+	ID: ProfileX500,
+	Attributes: map[int]Definition{
+		Email:     Mail,
+		FullName:  DisplayName,
+		GivenName: GivenNameDN,
+		Surname:   SN,
+		Username:  EduPersonPrincipalName,
+		UserID:    EduPersonUniqueID,
+	},
+}
+
+// MicrosoftClaimsProfile names the attributes with the claim URIs used by Microsoft Entra ID (Azure AD) and ADFS.
+var MicrosoftClaimsProfile = &Profile{
+	ID: ProfileMicrosoftClaims,
+	Attributes: map[int]Definition{
+		Email:     {Name: "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress", FriendlyName: "emailaddress", NameFormat: NameFormatURI},
+		FullName:  {Name: "http://schemas.microsoft.com/identity/claims/displayname", FriendlyName: "displayname", NameFormat: NameFormatURI},
+		GivenName: {Name: "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/givenname", FriendlyName: "givenname", NameFormat: NameFormatURI},
+		Surname:   {Name: "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/surname", FriendlyName: "surname", NameFormat: NameFormatURI},
+		Username:  {Name: "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name", FriendlyName: "name", NameFormat: NameFormatURI},
+		UserID:    {Name: "http://schemas.microsoft.com/identity/claims/objectidentifier", FriendlyName: "objectidentifier", NameFormat: NameFormatURI},
+	},
+}
@@ -0,0 +1,119 @@
+package attribute
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfile_builtIn(t *testing.T) {
+	type res struct {
+		id         string
+		nameFormat string
+		names      map[int]string
+		missing    []int
+	}
+	tests := []struct {
+		name    string
+		profile *Profile
+		res     res
+	}{
+		{
+			"basic",
+			BasicProfile,
+			res{
+				id:         ProfileBasic,
+				nameFormat: NameFormatBasic,
+				names: map[int]string{
+					Email:     "Email",
+					FullName:  "FullName",
+					GivenName: "FirstName",
+					Surname:   "SurName",
+					Username:  "UserName",
+					UserID:    "UserID",
+				},
+			},
+		},
+		{
+			"uri",
+			URIProfile,
+			res{
+				id:         ProfileX500,
+				nameFormat: NameFormatURI,
+				names: map[int]string{
+					Email:     "urn:oid:0.9.2342.19200300.100.1.3",
+					FullName:  "urn:oid:2.16.840.1.113730.3.1.241",
+					GivenName: "urn:oid:2.5.4.42",
+					Surname:   "urn:oid:2.5.4.4",
+					Username:  "urn:oid:0.9.2342.19200300.100.1.1",
+				},
+				missing: []int{UserID},
+			},
+		},
+		{
+			"eduPerson",
+			EduPersonProfile,
+			res{
+				id:         ProfileX500,
+				nameFormat: NameFormatURI,
+				names: map[int]string{
+					Email:     "urn:oid:0.9.2342.19200300.100.1.3",
+					FullName:  "urn:oid:2.16.840.1.113730.3.1.241",
+					GivenName: "urn:oid:2.5.4.42",
+					Surname:   "urn:oid:2.5.4.4",
+					Username:  "urn:oid:1.3.6.1.4.1.5923.1.1.1.6",
+					UserID:    "urn:oid:1.3.6.1.4.1.5923.1.1.1.13",
+				},
+			},
+		},
+		{
+			"microsoft claims",
+			MicrosoftClaimsProfile,
+			res{
+				id:         ProfileMicrosoftClaims,
+				nameFormat: NameFormatURI,
+				names: map[int]string{
+					Email:     "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+					FullName:  "http://schemas.microsoft.com/identity/claims/displayname",
+					GivenName: "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/givenname",
+					Surname:   "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/surname",
+					Username:  "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name",
+					UserID:    "http://schemas.microsoft.com/identity/claims/objectidentifier",
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.res.id, tt.profile.ID)
+			for id, name := range tt.res.names {
+				def, ok := tt.profile.Definition(id)
+				if assert.True(t, ok, "attribute %d not released", id) {
+					assert.Equal(t, name, def.Name)
+					assert.Equal(t, tt.res.nameFormat, def.NameFormat)
+				}
+			}
+			for _, id := range tt.res.missing {
+				_, ok := tt.profile.Definition(id)
+				assert.False(t, ok, "attribute %d released", id)
+			}
+		})
+	}
+}
+
+func TestProfile_CustomDefinition(t *testing.T) {
+	profile := &Profile{
+		ID:               ProfileX500,
+		CustomAttributes: map[string]Definition{"affiliation": EduPersonAffiliation},
+	}
+	assert.Equal(t, EduPersonAffiliation, profile.CustomDefinition("affiliation", "", NameFormatBasic))
+	assert.Equal(t, Definition{Name: "department", FriendlyName: "dep", NameFormat: NameFormatBasic}, profile.CustomDefinition("department", "dep", NameFormatBasic))
+}
+
+func TestProfile_IsOASIS(t *testing.T) {
+	assert.True(t, BasicProfile.IsOASIS())
+	assert.True(t, URIProfile.IsOASIS())
+	assert.True(t, EduPersonProfile.IsOASIS())
+	assert.False(t, MicrosoftClaimsProfile.IsOASIS())
+	assert.False(t, (&Profile{ID: "urn:example:profile"}).IsOASIS())
+}
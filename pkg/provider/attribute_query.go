@@ -115,20 +115,27 @@ func (p *IdentityProvider) attributeQueryHandleFunc(w http.ResponseWriter, r *ht
 	)
 
 	// read userinfo and fill queried attributes into reponse
-	attrs := &Attributes{}
+	attrs := &Attributes{profile: p.attributeProfile(sp)}
 	checkerInstance.WithLogicStep(
 		func() error {
-			if err := p.storage.SetUserinfoWithLoginName(r.Context(), attrs, attrQuery.Subject.NameID.Text, []int{}); err != nil {
-				return err
-			}
-
 			queriedAttrs := make([]saml.AttributeType, 0)
+			requested := make([]md.RequestedAttributeType, 0)
 			if attrQuery.Attribute != nil {
 				for _, queriedAttr := range attrQuery.Attribute {
 					queriedAttrs = append(queriedAttrs, queriedAttr)
+					requested = append(requested, md.RequestedAttributeType{Name: queriedAttr.Name, NameFormat: queriedAttr.NameFormat})
 				}
 			}
-			response = makeAttributeQueryResponse(attrQuery.Id, p.GetEntityID(r.Context()), sp.GetEntityID(), attrs, queriedAttrs, p.TimeFormat, p.Expiration)
+
+			if err = p.storage.SetUserinfoWithLoginName(r.Context(), attrs, attrQuery.Subject.NameID.Text, requestedAttributeIDs(attrs.profile, requested)); err != nil {
+				return err
+			}
+			var assertionConfig *serviceprovider.AssertionConfig
+			assertionConfig, err = p.assertionConfig(r.Context(), sp, nil)
+			if err != nil {
+				return err
+			}
+			response = makeAttributeQueryResponse(attrQuery.Id, p.GetEntityID(r.Context()), sp.GetEntityID(), attrs, queriedAttrs, p.TimeFormat, p.Expiration, assertionConfig)
 			return nil
 		},
 		func() {
@@ -139,7 +146,7 @@ func (p *IdentityProvider) attributeQueryHandleFunc(w http.ResponseWriter, r *ht
 	// create enveloped signature
 	checkerInstance.WithLogicStep(
 		func() error {
-			cert, key, err := getResponseCert(r.Context(), p.storage)
+			cert, key, err := p.getResponseCert(r.Context())
 			if err != nil {
 				return err
 			}
@@ -1,38 +1,73 @@
 package provider
 
 import (
+	"fmt"
+	"sort"
+
+	"github.com/zitadel/saml/pkg/provider/attribute"
 	"github.com/zitadel/saml/pkg/provider/models"
+	"github.com/zitadel/saml/pkg/provider/xml/md"
 	"github.com/zitadel/saml/pkg/provider/xml/saml"
 )
 
 const (
-	AttributeEmail int = iota
-	AttributeFullName
-	AttributeGivenName
-	AttributeSurname
-	AttributeUsername
-	AttributeUserID
+	AttributeEmail     = attribute.Email
+	AttributeFullName  = attribute.FullName
+	AttributeGivenName = attribute.GivenName
+	AttributeSurname   = attribute.Surname
+	AttributeUsername  = attribute.Username
+	AttributeUserID    = attribute.UserID
+)
+
+const (
+	AttributeNameFormatBasic       = attribute.NameFormatBasic
+	AttributeNameFormatUnspecified = attribute.NameFormatUnspecified
 )
 
 type CustomAttribute struct {
+	Name           string
 	FriendlyName   string
 	NameFormat     string
-	AttributeValue []string
+	AttributeValue []saml.AttributeValueType
+	// Statement is the index of the AttributeStatement the attribute is released in,
+	// 0 is the statement also containing the user attributes
+	Statement int
 }
 
 type Attributes struct {
-	email            string
-	fullName         string
-	givenName        string
-	surname          string
-	userID           string
-	username         string
-	customAttributes map[string]*CustomAttribute
+	email     string
+	fullName  string
+	givenName string
+	surname   string
+	userID    string
+	username  string
+	// spProvidedID is the identifier the service provider registered for the user with the ManageNameID protocol
+	spProvidedID string
+	// customAttributes are kept in the order they were set
+	customAttributes []*CustomAttribute
+	attributeOrder   []string
+
+	profile             *attribute.Profile
+	requestedAttributes []md.RequestedAttributeType
 }
 
-var _ models.AttributeSetter = &Attributes{}
+var (
+	_ models.AttributeSetter          = &Attributes{}
+	_ models.AttributeValuesSetter    = &Attributes{}
+	_ models.AttributeStatementSetter = &Attributes{}
+	_ models.AttributeOrderSetter     = &Attributes{}
+)
 
+// GetNameID returns the username as emailAddress NameID,
+// or the user ID as persistent NameID with the SPProvidedID if the service provider registered an identifier for the user
 func (a *Attributes) GetNameID() *saml.NameIDType {
+	if a.spProvidedID != "" {
+		return &saml.NameIDType{
+			Format:       nameIDFormatPersistent,
+			SPProvidedID: a.spProvidedID,
+			Text:         a.userID,
+		}
+	}
 	return &saml.NameIDType{
 		Format: "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress",
 		Text:   a.username,
@@ -64,67 +99,219 @@ func (a *Attributes) SetUserID(value string) {
 }
 
 func (a *Attributes) SetCustomAttribute(name, friendlyName, nameFormat string, attributeValue []string) {
-	if a.customAttributes == nil {
-		a.customAttributes = make(map[string]*CustomAttribute)
+	a.SetCustomAttributeValues(name, friendlyName, nameFormat, saml.StringAttributeValues(attributeValue...))
+}
+
+func (a *Attributes) SetCustomAttributeValues(name, friendlyName, nameFormat string, attributeValue []saml.AttributeValueType) {
+	if attr := a.customAttribute(name); attr != nil {
+		attr.FriendlyName = friendlyName
+		attr.NameFormat = nameFormat
+		attr.AttributeValue = attributeValue
+		return
 	}
-	a.customAttributes[name] = &CustomAttribute{
+	a.customAttributes = append(a.customAttributes, &CustomAttribute{
+		Name:           name,
 		FriendlyName:   friendlyName,
 		NameFormat:     nameFormat,
 		AttributeValue: attributeValue,
+	})
+}
+
+func (a *Attributes) AppendCustomAttributeValues(name, friendlyName, nameFormat string, attributeValue []saml.AttributeValueType) {
+	if attr := a.customAttribute(name); attr != nil {
+		attr.AttributeValue = append(attr.AttributeValue, attributeValue...)
+		return
+	}
+	a.SetCustomAttributeValues(name, friendlyName, nameFormat, attributeValue)
+}
+
+func (a *Attributes) SetCustomAttributeStatement(name string, statement int) {
+	if attr := a.customAttribute(name); attr != nil {
+		attr.Statement = statement
 	}
 }
 
+func (a *Attributes) SetAttributeOrder(names ...string) {
+	a.attributeOrder = names
+}
+
+func (a *Attributes) customAttribute(name string) *CustomAttribute {
+	for _, attr := range a.customAttributes {
+		if attr.Name == name {
+			return attr
+		}
+	}
+	return nil
+}
+
+// GetSAML returns all released attributes in a stable order:
+// the attributes named in the attribute order first, then the user attributes and the custom attributes in the order they were set
 func (a *Attributes) GetSAML() []*saml.AttributeType {
+	statements := a.getSAMLStatements()
 	attrs := make([]*saml.AttributeType, 0)
+	for _, statement := range statements {
+		attrs = append(attrs, statement.Attribute...)
+	}
+	a.sortAttributes(attrs)
+	return attrs
+}
+
+// getSAMLStatements returns the released attributes grouped into their AttributeStatements, empty statements are omitted
+func (a *Attributes) getSAMLStatements() []saml.AttributeStatementType {
+	attrs := make([]*saml.AttributeType, 0)
+	statementIndex := make(map[*saml.AttributeType]int)
 	if a.email != "" {
-		attrs = append(attrs, &saml.AttributeType{
-			Name:           "Email",
-			NameFormat:     "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
-			AttributeValue: []string{a.email},
-		})
+		attrs = a.appendAttribute(attrs, AttributeEmail, a.email)
 	}
 	if a.surname != "" {
-		attrs = append(attrs, &saml.AttributeType{
-			Name:           "SurName",
-			NameFormat:     "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
-			AttributeValue: []string{a.surname},
-		})
+		attrs = a.appendAttribute(attrs, AttributeSurname, a.surname)
 	}
 	if a.givenName != "" {
-		attrs = append(attrs, &saml.AttributeType{
-			Name:           "FirstName",
-			NameFormat:     "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
-			AttributeValue: []string{a.givenName},
-		})
+		attrs = a.appendAttribute(attrs, AttributeGivenName, a.givenName)
 	}
 	if a.fullName != "" {
-		attrs = append(attrs, &saml.AttributeType{
-			Name:           "FullName",
-			NameFormat:     "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
-			AttributeValue: []string{a.fullName},
-		})
+		attrs = a.appendAttribute(attrs, AttributeFullName, a.fullName)
 	}
 	if a.username != "" {
-		attrs = append(attrs, &saml.AttributeType{
-			Name:           "UserName",
-			NameFormat:     "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
-			AttributeValue: []string{a.username},
-		})
+		attrs = a.appendAttribute(attrs, AttributeUsername, a.username)
 	}
 	if a.userID != "" {
-		attrs = append(attrs, &saml.AttributeType{
-			Name:           "UserID",
-			NameFormat:     "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
-			AttributeValue: []string{a.userID},
-		})
-	}
-	for name, attr := range a.customAttributes {
-		attrs = append(attrs, &saml.AttributeType{
-			Name:           name,
-			FriendlyName:   attr.FriendlyName,
-			NameFormat:     attr.NameFormat,
+		attrs = a.appendAttribute(attrs, AttributeUserID, a.userID)
+	}
+	for _, attr := range a.customAttributes {
+		def := a.getProfile().CustomDefinition(attr.Name, attr.FriendlyName, attr.NameFormat)
+		samlAttr := &saml.AttributeType{
+			Name:           def.Name,
+			FriendlyName:   def.FriendlyName,
+			NameFormat:     def.NameFormat,
 			AttributeValue: attr.AttributeValue,
-		})
+		}
+		statementIndex[samlAttr] = attr.Statement
+		attrs = append(attrs, samlAttr)
 	}
-	return attrs
+
+	statements := make(map[int][]*saml.AttributeType)
+	indexes := make([]int, 0)
+	for _, attr := range attrs {
+		if len(a.requestedAttributes) > 0 && !isAttributeRequested(a.requestedAttributes, attr) {
+			continue
+		}
+		index := statementIndex[attr]
+		if _, ok := statements[index]; !ok {
+			indexes = append(indexes, index)
+		}
+		statements[index] = append(statements[index], attr)
+	}
+	sort.Ints(indexes)
+
+	ret := make([]saml.AttributeStatementType, 0, len(indexes))
+	for _, index := range indexes {
+		a.sortAttributes(statements[index])
+		ret = append(ret, saml.AttributeStatementType{Attribute: statements[index]})
+	}
+	return ret
+}
+
+// sortAttributes moves the attributes named in the attribute order to the front, the others keep their order
+func (a *Attributes) sortAttributes(attrs []*saml.AttributeType) {
+	if len(a.attributeOrder) == 0 {
+		return
+	}
+	rank := func(attr *saml.AttributeType) int {
+		for i, name := range a.attributeOrder {
+			if name == attr.Name {
+				return i
+			}
+		}
+		return len(a.attributeOrder)
+	}
+	sort.SliceStable(attrs, func(i, j int) bool {
+		return rank(attrs[i]) < rank(attrs[j])
+	})
+}
+
+// getProfile returns the attribute profile used to name the attributes, which defaults to the basic profile
+func (a *Attributes) getProfile() *attribute.Profile {
+	if a.profile == nil {
+		return attribute.BasicProfile
+	}
+	return a.profile
+}
+
+func (a *Attributes) appendAttribute(attrs []*saml.AttributeType, id int, value string) []*saml.AttributeType {
+	def, ok := a.getProfile().Definition(id)
+	if !ok {
+		return attrs
+	}
+	return append(attrs, &saml.AttributeType{
+		Name:           def.Name,
+		FriendlyName:   def.FriendlyName,
+		NameFormat:     def.NameFormat,
+		AttributeValue: saml.StringAttributeValues(value),
+	})
+}
+
+// setRequestedAttributes restricts the attributes returned by GetSAML to the requested ones
+// and returns an error if an attribute marked as required is not available.
+func (a *Attributes) setRequestedAttributes(requested []md.RequestedAttributeType) error {
+	a.requestedAttributes = nil
+	available := a.GetSAML()
+	a.requestedAttributes = requested
+
+	for _, req := range requested {
+		if req.IsRequired != "true" && req.IsRequired != "1" {
+			continue
+		}
+		found := false
+		for _, attr := range available {
+			if requestedAttributeMatches(req, attr) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("required attribute %s is not available", req.Name)
+		}
+	}
+	return nil
+}
+
+func isAttributeRequested(requested []md.RequestedAttributeType, attr *saml.AttributeType) bool {
+	for _, req := range requested {
+		if requestedAttributeMatches(req, attr) {
+			return true
+		}
+	}
+	return false
+}
+
+func requestedAttributeMatches(requested md.RequestedAttributeType, attr *saml.AttributeType) bool {
+	if requested.Name != attr.Name {
+		return false
+	}
+	return requested.NameFormat == "" || requested.NameFormat == AttributeNameFormatUnspecified ||
+		attr.NameFormat == "" || attr.NameFormat == AttributeNameFormatUnspecified ||
+		requested.NameFormat == attr.NameFormat
+}
+
+// requestedAttributeIDs maps the requested attributes to the attribute constants (e.g. AttributeEmail)
+// using the attribute profile, which are passed to the UserStorage. Custom attributes can not be mapped and are ignored.
+func requestedAttributeIDs(profile *attribute.Profile, requested []md.RequestedAttributeType) []int {
+	if profile == nil {
+		profile = attribute.BasicProfile
+	}
+	ids := make([]int, 0, len(requested))
+	for id := AttributeEmail; id <= AttributeUserID; id++ {
+		def, ok := profile.Definition(id)
+		if !ok {
+			continue
+		}
+		for _, req := range requested {
+			if requestedAttributeMatches(req, &saml.AttributeType{Name: def.Name, NameFormat: def.NameFormat}) {
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+	return ids
 }
@@ -5,6 +5,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/zitadel/saml/pkg/provider/attribute"
+	"github.com/zitadel/saml/pkg/provider/xml/md"
 	"github.com/zitadel/saml/pkg/provider/xml/saml"
 )
 
@@ -16,7 +18,7 @@ func TestSSO_Attributes(t *testing.T) {
 		surname          string
 		userID           string
 		username         string
-		customAttributes map[string]*CustomAttribute
+		customAttributes []*CustomAttribute
 	}
 	tests := []struct {
 		name string
@@ -43,32 +45,32 @@ func TestSSO_Attributes(t *testing.T) {
 				{
 					Name:           "Email",
 					NameFormat:     "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
-					AttributeValue: []string{"email"},
+					AttributeValue: saml.StringAttributeValues("email"),
 				},
 				{
 					Name:           "SurName",
 					NameFormat:     "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
-					AttributeValue: []string{"surname"},
+					AttributeValue: saml.StringAttributeValues("surname"),
 				},
 				{
 					Name:           "FirstName",
 					NameFormat:     "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
-					AttributeValue: []string{"givenname"},
+					AttributeValue: saml.StringAttributeValues("givenname"),
 				},
 				{
 					Name:           "FullName",
 					NameFormat:     "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
-					AttributeValue: []string{"fullname"},
+					AttributeValue: saml.StringAttributeValues("fullname"),
 				},
 				{
 					Name:           "UserName",
 					NameFormat:     "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
-					AttributeValue: []string{"username"},
+					AttributeValue: saml.StringAttributeValues("username"),
 				},
 				{
 					Name:           "UserID",
 					NameFormat:     "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
-					AttributeValue: []string{"userid"},
+					AttributeValue: saml.StringAttributeValues("userid"),
 				},
 			},
 		},
@@ -81,26 +83,30 @@ func TestSSO_Attributes(t *testing.T) {
 				surname:   "surname",
 				userID:    "userid",
 				username:  "username",
-				customAttributes: map[string]*CustomAttribute{
-					"empty": {
+				customAttributes: []*CustomAttribute{
+					{
+						Name:           "empty",
 						FriendlyName:   "fname",
 						NameFormat:     "nameformat",
-						AttributeValue: []string{""},
+						AttributeValue: saml.StringAttributeValues(""),
 					},
-					"key1": {
+					{
+						Name:           "key1",
 						FriendlyName:   "fname1",
 						NameFormat:     "nameformat1",
-						AttributeValue: []string{"first"},
+						AttributeValue: saml.StringAttributeValues("first"),
 					},
-					"key2": {
+					{
+						Name:           "key2",
 						FriendlyName:   "fname2",
 						NameFormat:     "nameformat2",
-						AttributeValue: []string{"first", "second"},
+						AttributeValue: saml.StringAttributeValues("first", "second"),
 					},
-					"key3": {
+					{
+						Name:           "key3",
 						FriendlyName:   "fname3",
 						NameFormat:     "nameformat3",
-						AttributeValue: []string{"first", "second", "third"},
+						AttributeValue: saml.StringAttributeValues("first", "second", "third"),
 					},
 				},
 			},
@@ -108,56 +114,56 @@ func TestSSO_Attributes(t *testing.T) {
 				{
 					Name:           "Email",
 					NameFormat:     "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
-					AttributeValue: []string{"email"},
+					AttributeValue: saml.StringAttributeValues("email"),
 				},
 				{
 					Name:           "SurName",
 					NameFormat:     "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
-					AttributeValue: []string{"surname"},
+					AttributeValue: saml.StringAttributeValues("surname"),
 				},
 				{
 					Name:           "FirstName",
 					NameFormat:     "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
-					AttributeValue: []string{"givenname"},
+					AttributeValue: saml.StringAttributeValues("givenname"),
 				},
 				{
 					Name:           "FullName",
 					NameFormat:     "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
-					AttributeValue: []string{"fullname"},
+					AttributeValue: saml.StringAttributeValues("fullname"),
 				},
 				{
 					Name:           "UserName",
 					NameFormat:     "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
-					AttributeValue: []string{"username"},
+					AttributeValue: saml.StringAttributeValues("username"),
 				},
 				{
 					Name:           "UserID",
 					NameFormat:     "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
-					AttributeValue: []string{"userid"},
+					AttributeValue: saml.StringAttributeValues("userid"),
 				},
 				{
 					Name:           "empty",
 					NameFormat:     "nameformat",
 					FriendlyName:   "fname",
-					AttributeValue: []string{""},
+					AttributeValue: saml.StringAttributeValues(""),
 				},
 				{
 					Name:           "key1",
 					NameFormat:     "nameformat1",
 					FriendlyName:   "fname1",
-					AttributeValue: []string{"first"},
+					AttributeValue: saml.StringAttributeValues("first"),
 				},
 				{
 					Name:           "key2",
 					NameFormat:     "nameformat2",
 					FriendlyName:   "fname2",
-					AttributeValue: []string{"first", "second"},
+					AttributeValue: saml.StringAttributeValues("first", "second"),
 				},
 				{
 					Name:           "key3",
 					NameFormat:     "nameformat3",
 					FriendlyName:   "fname3",
-					AttributeValue: []string{"first", "second", "third"},
+					AttributeValue: saml.StringAttributeValues("first", "second", "third"),
 				},
 			},
 		},
@@ -181,3 +187,182 @@ func TestSSO_Attributes(t *testing.T) {
 		})
 	}
 }
+
+func TestSSO_AttributesRequested(t *testing.T) {
+	type args struct {
+		email            string
+		username         string
+		customAttributes []*CustomAttribute
+		profile          *attribute.Profile
+		requested        []md.RequestedAttributeType
+	}
+	type res struct {
+		attributes []*saml.AttributeType
+		ids        []int
+		err        bool
+	}
+	tests := []struct {
+		name string
+		args args
+		res  res
+	}{
+		{
+			"no requested attributes",
+			args{
+				email:    "email",
+				username: "username",
+			},
+			res{
+				attributes: []*saml.AttributeType{
+					{Name: "Email", NameFormat: AttributeNameFormatBasic, AttributeValue: saml.StringAttributeValues("email")},
+					{Name: "UserName", NameFormat: AttributeNameFormatBasic, AttributeValue: saml.StringAttributeValues("username")},
+				},
+				ids: []int{},
+			},
+		},
+		{
+			"requested attributes",
+			args{
+				email:    "email",
+				username: "username",
+				customAttributes: []*CustomAttribute{
+					{Name: "custom", NameFormat: "nameformat", AttributeValue: saml.StringAttributeValues("value")},
+				},
+				requested: []md.RequestedAttributeType{
+					{Name: "Email"},
+					{Name: "custom", NameFormat: "nameformat"},
+				},
+			},
+			res{
+				attributes: []*saml.AttributeType{
+					{Name: "Email", NameFormat: AttributeNameFormatBasic, AttributeValue: saml.StringAttributeValues("email")},
+					{Name: "custom", NameFormat: "nameformat", AttributeValue: saml.StringAttributeValues("value")},
+				},
+				ids: []int{AttributeEmail},
+			},
+		},
+		{
+			"requested attribute with other nameformat",
+			args{
+				email: "email",
+				requested: []md.RequestedAttributeType{
+					{Name: "Email", NameFormat: "urn:oasis:names:tc:SAML:2.0:attrname-format:uri"},
+				},
+			},
+			res{
+				attributes: []*saml.AttributeType{},
+				ids:        []int{},
+			},
+		},
+		{
+			"requested attributes with uri profile",
+			args{
+				email:    "email",
+				username: "username",
+				customAttributes: []*CustomAttribute{
+					{Name: "affiliation", AttributeValue: saml.StringAttributeValues("member")},
+				},
+				profile: &attribute.Profile{
+					ID:         attribute.ProfileX500,
+					Attributes: attribute.URIProfile.Attributes,
+					CustomAttributes: map[string]attribute.Definition{
+						"affiliation": attribute.EduPersonAffiliation,
+					},
+				},
+				requested: []md.RequestedAttributeType{
+					{Name: attribute.Mail.Name, NameFormat: attribute.NameFormatURI},
+					{Name: attribute.EduPersonAffiliation.Name, NameFormat: attribute.NameFormatURI},
+				},
+			},
+			res{
+				attributes: []*saml.AttributeType{
+					{Name: attribute.Mail.Name, FriendlyName: "mail", NameFormat: attribute.NameFormatURI, AttributeValue: saml.StringAttributeValues("email")},
+					{Name: attribute.EduPersonAffiliation.Name, FriendlyName: "eduPersonAffiliation", NameFormat: attribute.NameFormatURI, AttributeValue: saml.StringAttributeValues("member")},
+				},
+				ids: []int{AttributeEmail},
+			},
+		},
+		{
+			"required attribute available",
+			args{
+				email: "email",
+				requested: []md.RequestedAttributeType{
+					{Name: "Email", IsRequired: "true"},
+					{Name: "UserName"},
+				},
+			},
+			res{
+				attributes: []*saml.AttributeType{
+					{Name: "Email", NameFormat: AttributeNameFormatBasic, AttributeValue: saml.StringAttributeValues("email")},
+				},
+				ids: []int{AttributeEmail, AttributeUsername},
+			},
+		},
+		{
+			"required attribute missing",
+			args{
+				email: "email",
+				requested: []md.RequestedAttributeType{
+					{Name: "UserName", IsRequired: "true"},
+				},
+			},
+			res{
+				ids: []int{AttributeUsername},
+				err: true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.res.ids, requestedAttributeIDs(tt.args.profile, tt.args.requested))
+
+			attrs := &Attributes{
+				email:            tt.args.email,
+				username:         tt.args.username,
+				customAttributes: tt.args.customAttributes,
+				profile:          tt.args.profile,
+			}
+			err := attrs.setRequestedAttributes(tt.args.requested)
+			if tt.res.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, tt.res.attributes, attrs.GetSAML())
+		})
+	}
+}
+
+func TestSSO_AttributesOrderAndStatements(t *testing.T) {
+	attrs := &Attributes{}
+	attrs.SetEmail("email")
+	attrs.SetUsername("username")
+	attrs.SetCustomAttribute("b", "", "", []string{"b1"})
+	attrs.SetCustomAttribute("a", "", "", []string{"a1"})
+	attrs.AppendCustomAttributeValues("b", "", "", saml.StringAttributeValues("b2"))
+	attrs.AppendCustomAttributeValues("c", "", "", saml.StringAttributeValues("c1"))
+	attrs.SetCustomAttributeStatement("c", 1)
+
+	names := func(attrs []*saml.AttributeType) []string {
+		ret := make([]string, len(attrs))
+		for i, attr := range attrs {
+			ret[i] = attr.Name
+		}
+		return ret
+	}
+
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, []string{"Email", "UserName", "b", "a", "c"}, names(attrs.GetSAML()))
+	}
+	assert.Equal(t, []string{"b1", "b2"}, attrs.GetSAML()[2].Values())
+
+	statements := attrs.getSAMLStatements()
+	if assert.Len(t, statements, 2) {
+		assert.Equal(t, []string{"Email", "UserName", "b", "a"}, names(statements[0].Attribute))
+		assert.Equal(t, []string{"c"}, names(statements[1].Attribute))
+	}
+
+	attrs.SetAttributeOrder("a", "UserName")
+	assert.Equal(t, []string{"a", "UserName", "Email", "b", "c"}, names(attrs.GetSAML()))
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/zitadel/saml/pkg/provider"
+	"github.com/zitadel/saml/pkg/provider/key"
+)
+
+// LoadCertificate reads the PEM encoded certificate and its RSA private key (PKCS #1 or PKCS #8),
+// the certificate is verified against the CA certificates if a CaPath is configured
+func LoadCertificate(conf *provider.Certificate) (*key.CertificateAndKey, error) {
+	cert, err := readCertificate(conf.Path)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := readPrivateKey(conf.PrivateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	if !privateKey.PublicKey.Equal(cert.PublicKey) {
+		return nil, errors.New("private key does not match the certificate")
+	}
+	if conf.CaPath != "" {
+		if err := verifyCertificate(cert, conf.CaPath); err != nil {
+			return nil, err
+		}
+	}
+	return &key.CertificateAndKey{Certificate: cert.Raw, Key: privateKey}, nil
+}
+
+func readPEM(path, kind string) ([]*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", kind, err)
+	}
+	var blocks []*pem.Block
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		blocks = append(blocks, block)
+	}
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("no PEM encoded %s in %s", kind, path)
+	}
+	return blocks, nil
+}
+
+func readCertificate(path string) (*x509.Certificate, error) {
+	blocks, err := readPEM(path, "certificate")
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(blocks[0].Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate %s: %w", path, err)
+	}
+	return cert, nil
+}
+
+func readPrivateKey(path string) (*rsa.PrivateKey, error) {
+	blocks, err := readPEM(path, "private key")
+	if err != nil {
+		return nil, err
+	}
+	switch blocks[0].Type {
+	case "RSA PRIVATE KEY":
+		privateKey, err := x509.ParsePKCS1PrivateKey(blocks[0].Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key %s: %w", path, err)
+		}
+		return privateKey, nil
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(blocks[0].Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key %s: %w", path, err)
+		}
+		privateKey, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("private key %s is no RSA key", path)
+		}
+		return privateKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %s in %s", blocks[0].Type, path)
+	}
+}
+
+func verifyCertificate(cert *x509.Certificate, caPath string) error {
+	blocks, err := readPEM(caPath, "CA certificates")
+	if err != nil {
+		return err
+	}
+	roots := x509.NewCertPool()
+	for _, block := range blocks {
+		ca, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("failed to parse CA certificate %s: %w", caPath, err)
+		}
+		roots.AddCert(ca)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+		return fmt.Errorf("failed to verify certificate: %w", err)
+	}
+	return nil
+}
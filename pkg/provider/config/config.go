@@ -0,0 +1,127 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/zitadel/saml/pkg/provider"
+	"github.com/zitadel/saml/pkg/provider/key"
+)
+
+// EnvPrefix is the prefix of the environment variables overriding the loaded configuration,
+// e.g. SAML_IDPCONFIG_SIGNATUREALGORITHM overrides the SignatureAlgorithm of the IDPConfig
+const EnvPrefix = "SAML"
+
+// Config is the configuration of a Provider loaded from a YAML or JSON file,
+// the fields of the provider.Config are on the top level next to the issuer and the certificates
+type Config struct {
+	// Issuer is the static issuer of the Provider, the issuer is derived from the host of the requests if empty
+	Issuer string `yaml:"Issuer"`
+	// IssuerPath is the path of the issuer derived from the host of the requests
+	IssuerPath    string `yaml:"IssuerPath"`
+	AllowInsecure bool   `yaml:"AllowInsecure"`
+	// SigningCertificate signs the responses and, if no MetadataCertificate is configured, the metadata,
+	// the keys of the storage are used if not set
+	SigningCertificate  *provider.Certificate `yaml:"SigningCertificate"`
+	MetadataCertificate *provider.Certificate `yaml:"MetadataCertificate"`
+
+	provider.Config `yaml:",inline"`
+
+	signingKey  *key.CertificateAndKey
+	metadataKey *key.CertificateAndKey
+}
+
+// Load reads the configuration from the YAML or JSON file, see Parse
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse decodes the YAML or JSON configuration, applies the overrides of the environment (see EnvPrefix),
+// validates it and loads the configured certificates and keys.
+// All issues of the configuration are returned at once.
+func Parse(data []byte) (*Config, error) {
+	return parse(data, os.LookupEnv)
+}
+
+func parse(data []byte, lookupEnv func(string) (string, bool)) (*Config, error) {
+	conf := new(Config)
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(conf); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	if err := applyEnv(conf, EnvPrefix, lookupEnv); err != nil {
+		return nil, err
+	}
+	if conf.IDPConfig == nil {
+		conf.IDPConfig = new(provider.IdentityProviderConfig)
+	}
+	if err := errors.Join(conf.Validate(), conf.loadKeys()); err != nil {
+		return nil, fmt.Errorf("invalid config:\n%w", err)
+	}
+	return conf, nil
+}
+
+func (c *Config) loadKeys() (err error) {
+	if c.SigningCertificate != nil {
+		c.signingKey, err = LoadCertificate(c.SigningCertificate)
+		if err != nil {
+			return fmt.Errorf("SigningCertificate: %w", err)
+		}
+	}
+	if c.MetadataCertificate != nil {
+		c.metadataKey, err = LoadCertificate(c.MetadataCertificate)
+		if err != nil {
+			return fmt.Errorf("MetadataCertificate: %w", err)
+		}
+	}
+	return nil
+}
+
+// NewProvider creates the Provider of the configuration,
+// the options are applied after the ones derived from the configuration
+func (c *Config) NewProvider(storage provider.Storage, opts ...provider.Option) (*provider.Provider, error) {
+	issuer := provider.IssuerFromHost(c.IssuerPath)
+	if c.Issuer != "" {
+		issuer = provider.StaticIssuer(c.Issuer)
+	}
+	return provider.NewProvider(storage, issuer, &c.Config, append(c.options(), opts...)...)
+}
+
+// Reload applies the configuration to the Provider, e.g. after a change of the file or the certificates,
+// the Issuer and IssuerPath of the Provider are kept, see provider.Provider.Reload
+func (c *Config) Reload(p *provider.Provider, opts ...provider.Option) error {
+	return p.Reload(&c.Config, append(c.options(), opts...)...)
+}
+
+func (c *Config) options() []provider.Option {
+	var options []provider.Option
+	if c.AllowInsecure {
+		options = append(options, provider.WithAllowInsecure())
+	}
+	if c.signingKey != nil {
+		options = append(options, provider.WithSigningKeys(c.signingKey, c.metadataKey))
+	}
+	return options
+}
+
+// files returns the configured certificate and key files
+func (c *Config) files() []string {
+	var files []string
+	for _, cert := range []*provider.Certificate{c.SigningCertificate, c.MetadataCertificate} {
+		if cert != nil {
+			files = append(files, cert.Path, cert.PrivateKeyPath, cert.CaPath)
+		}
+	}
+	return slices.DeleteFunc(files, func(file string) bool { return file == "" })
+}
@@ -0,0 +1,217 @@
+package config
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zitadel/saml/pkg/provider"
+	"github.com/zitadel/saml/pkg/provider/mock"
+)
+
+// writeKeyAndCertificate writes a self-signed certificate and its PKCS #8 private key to the directory
+func writeKeyAndCertificate(t *testing.T, dir string) (certPath, keyPath string, cert *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	certPath = filepath.Join(dir, "cert.pem")
+	keyPath = filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), 0o600))
+	return certPath, keyPath, cert
+}
+
+func TestConfig_parse(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath, _ := writeKeyAndCertificate(t, dir)
+
+	type args struct {
+		data string
+		env  map[string]string
+	}
+	type res struct {
+		err    []string
+		verify func(t *testing.T, conf *Config)
+	}
+	tests := []struct {
+		name string
+		args args
+		res  res
+	}{
+		{
+			"yaml",
+			args{data: `
+Issuer: https://idp.example.com
+SigningCertificate:
+  Path: ` + certPath + `
+  PrivateKeyPath: ` + keyPath + `
+Metadata: saml/metadata
+MetadataConfig:
+  SignatureAlgorithm: http://www.w3.org/2001/04/xmldsig-more#rsa-sha256
+  RefreshInterval: 1h
+IDPConfig:
+  SignatureAlgorithm: http://www.w3.org/2001/04/xmldsig-more#rsa-sha256
+  MetadataIDPConfig:
+    ValidUntil: 24h
+  Endpoints:
+    SingleSignOn:
+      Path: sso
+      URL: https://sso.example.com/sso
+Organisation:
+  Name: example
+  URL: https://example.com
+`},
+			res{verify: func(t *testing.T, conf *Config) {
+				assert.Equal(t, "https://idp.example.com", conf.Issuer)
+				assert.Equal(t, "/saml/metadata", conf.Metadata.Relative())
+				assert.Equal(t, time.Hour, conf.MetadataConfig.RefreshInterval)
+				assert.Equal(t, 24*time.Hour, conf.IDPConfig.MetadataIDPConfig.ValidUntil)
+				assert.Equal(t, "https://sso.example.com/sso", conf.IDPConfig.Endpoints.SingleSignOn.Absolute(conf.Issuer))
+				assert.Equal(t, "example", conf.Organisation.Name)
+				require.NotNil(t, conf.signingKey)
+				assert.Nil(t, conf.metadataKey)
+			}},
+		},
+		{
+			"json",
+			args{data: `{"Issuer": "https://idp.example.com", "IDPConfig": {"Endpoints": {"Callback": "callback"}}, "ContactPersons": [{"ContactType": "technical", "EmailAddress": "admin@example.com"}]}`},
+			res{verify: func(t *testing.T, conf *Config) {
+				assert.Equal(t, "/callback", conf.IDPConfig.Endpoints.Callback.Relative())
+				assert.Equal(t, "admin@example.com", conf.ContactPersons[0].EmailAddress)
+				assert.Nil(t, conf.signingKey)
+			}},
+		},
+		{
+			"environment",
+			args{
+				data: `Issuer: https://idp.example.com`,
+				env: map[string]string{
+					"SAML_ISSUER": "https://env.example.com",
+					"SAML_IDPCONFIG_METADATAIDPCONFIG_VALIDUNTIL": "2h",
+					"SAML_IDPCONFIG_ENDPOINTS_SINGLESIGNON":       "env/sso",
+					"SAML_ORGANISATION_NAME":                      "env",
+					"SAML_SIGNINGMETHODS":                         "a, b",
+					"SAML_SIGNINGCERTIFICATE_PATH":                certPath,
+					"SAML_SIGNINGCERTIFICATE_PRIVATEKEYPATH":      keyPath,
+				},
+			},
+			res{verify: func(t *testing.T, conf *Config) {
+				assert.Equal(t, "https://env.example.com", conf.Issuer)
+				assert.Equal(t, 2*time.Hour, conf.IDPConfig.MetadataIDPConfig.ValidUntil)
+				assert.Equal(t, "/env/sso", conf.IDPConfig.Endpoints.SingleSignOn.Relative())
+				assert.Equal(t, "env", conf.Organisation.Name)
+				assert.Equal(t, []string{"a", "b"}, conf.SigningMethods)
+				assert.NotNil(t, conf.signingKey)
+				assert.Nil(t, conf.MetadataConfig)
+			}},
+		},
+		{
+			"unknown field",
+			args{data: `Issuer: https://idp.example.com
+Unknown: true`},
+			res{err: []string{"field Unknown not found"}},
+		},
+		{
+			"invalid environment",
+			args{data: ``, env: map[string]string{"SAML_METADATACONFIG_REFRESHINTERVAL": "often"}},
+			res{err: []string{"SAML_METADATACONFIG_REFRESHINTERVAL"}},
+		},
+		{
+			"invalid",
+			args{data: `
+Issuer: http://idp.example.com
+SigningCertificate:
+  Path: ` + filepath.Join(dir, "missing.pem") + `
+MetadataConfig:
+  SignatureAlgorithm: md5
+  RefreshInterval: -1h
+IDPConfig:
+  EncryptionAlgorithm: des
+  WantAuthRequestsSigned: maybe
+  MetadataIDPConfig:
+    ErrorURL: /error
+ContactPersons:
+  - ContactType: nobody
+`},
+			res{err: []string{
+				"Issuer: scheme for issuer must be `https`",
+				"SigningCertificate.PrivateKeyPath: missing",
+				"MetadataConfig.SignatureAlgorithm: unsupported algorithm md5",
+				"MetadataConfig.RefreshInterval: negative duration -1h0m0s",
+				"IDPConfig.EncryptionAlgorithm: unsupported algorithm des",
+				"IDPConfig.WantAuthRequestsSigned: maybe is no boolean",
+				"IDPConfig.MetadataIDPConfig.ErrorURL: /error is no absolute URL",
+				"ContactPersons[0].ContactType: unknown contact type nobody",
+				"SigningCertificate: failed to read certificate",
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, err := parse([]byte(tt.args.data), func(name string) (string, bool) {
+				value, ok := tt.args.env[name]
+				return value, ok
+			})
+			if len(tt.res.err) > 0 {
+				require.Error(t, err)
+				for _, message := range tt.res.err {
+					assert.ErrorContains(t, err, message)
+				}
+				return
+			}
+			require.NoError(t, err)
+			tt.res.verify(t, conf)
+		})
+	}
+}
+
+func TestConfig_NewProvider(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath, cert := writeKeyAndCertificate(t, dir)
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+Issuer: https://idp.example.com
+SigningCertificate:
+  Path: `+certPath+`
+  PrivateKeyPath: `+keyPath+`
+MetadataConfig:
+  Path: saml/metadata
+`), 0o600))
+
+	conf, err := Load(path)
+	require.NoError(t, err)
+	// the storage is not asked for keys, the configured certificate is used instead
+	p, err := conf.NewProvider(mock.NewMockStorage(gomock.NewController(t)))
+	require.NoError(t, err)
+
+	metadata, err := p.GetMetadata(provider.ContextWithIssuer(context.Background(), conf.Issuer))
+	require.NoError(t, err)
+	assert.Equal(t, "https://idp.example.com/saml/metadata", string(metadata.EntityID))
+	require.NotEmpty(t, metadata.IDPSSODescriptor.KeyDescriptor)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(cert.Raw), metadata.IDPSSODescriptor.KeyDescriptor[0].KeyInfo.X509Data[0].X509Certificate)
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+)
+
+// applyEnv overrides the fields of the struct with the environment variables named after the yaml path of the field,
+// e.g. SAML_METADATACONFIG_PATH. Slices of strings are comma separated, other slices can't be overridden.
+func applyEnv(conf any, prefix string, lookupEnv func(string) (string, bool)) error {
+	_, err := applyEnvValue(reflect.ValueOf(conf).Elem(), prefix, lookupEnv)
+	return err
+}
+
+// applyEnvValue returns if any environment variable was applied to the value
+func applyEnvValue(value reflect.Value, name string, lookupEnv func(string) (string, bool)) (bool, error) {
+	if isLeaf(value.Type()) {
+		env, ok := lookupEnv(name)
+		if !ok {
+			return false, nil
+		}
+		if err := setEnv(value, env); err != nil {
+			return false, fmt.Errorf("invalid value of %s: %w", name, err)
+		}
+		return true, nil
+	}
+	switch value.Kind() {
+	case reflect.Pointer:
+		elem := reflect.New(value.Type().Elem())
+		if !value.IsNil() {
+			elem = value
+		}
+		applied, err := applyEnvValue(elem.Elem(), name, lookupEnv)
+		if applied {
+			value.Set(elem)
+		}
+		return applied, err
+	case reflect.Struct:
+		applied := false
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			tag, inline := yamlName(field)
+			if !field.IsExported() || tag == "-" {
+				continue
+			}
+			fieldName := name
+			if !inline {
+				fieldName = name + "_" + strings.ToUpper(tag)
+			}
+			fieldApplied, err := applyEnvValue(value.Field(i), fieldName, lookupEnv)
+			if err != nil {
+				return false, err
+			}
+			applied = applied || fieldApplied
+		}
+		return applied, nil
+	}
+	return false, nil
+}
+
+// isLeaf checks if the value of the type is set from a single environment variable
+func isLeaf(t reflect.Type) bool {
+	if t == timeType || reflect.PointerTo(t).Implements(unmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Struct:
+		return false
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+	return true
+}
+
+func setEnv(value reflect.Value, env string) error {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(env)
+		return nil
+	case reflect.Slice:
+		values := reflect.MakeSlice(value.Type(), 0, 0)
+		for _, v := range strings.Split(env, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = reflect.Append(values, reflect.ValueOf(v).Convert(value.Type().Elem()))
+			}
+		}
+		value.Set(values)
+		return nil
+	}
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: env}
+	return node.Decode(value.Addr().Interface())
+}
+
+// yamlName returns the name of the field in the yaml, which is the lowercase name of the field if not tagged
+func yamlName(field reflect.StructField) (name string, inline bool) {
+	tag, options, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if tag == "" {
+		tag = strings.ToLower(field.Name)
+	}
+	return tag, options == "inline"
+}
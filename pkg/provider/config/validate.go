@@ -0,0 +1,164 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	dsig "github.com/russellhaering/goxmldsig"
+
+	"github.com/zitadel/saml/pkg/provider"
+	"github.com/zitadel/saml/pkg/provider/encryption"
+	"github.com/zitadel/saml/pkg/provider/xml/md"
+)
+
+var (
+	signatureAlgorithms = []string{dsig.RSASHA1SignatureMethod, dsig.RSASHA256SignatureMethod, dsig.RSASHA512SignatureMethod}
+	digestAlgorithms    = []string{
+		"http://www.w3.org/2000/09/xmldsig#sha1",
+		"http://www.w3.org/2001/04/xmlenc#sha256",
+		"http://www.w3.org/2001/04/xmlenc#sha512",
+	}
+	encryptionAlgorithms = []string{encryption.AES128CBC, encryption.AES256CBC, encryption.AES128GCM, encryption.AES256GCM}
+	contactTypes         = []md.ContactTypeType{
+		md.ContactTypeTypeTechnical,
+		md.ContactTypeTypeSupport,
+		md.ContactTypeTypeAdministrative,
+		md.ContactTypeTypeBilling,
+		md.ContactTypeTypeOther,
+	}
+)
+
+// validator collects the issues of the configuration, prefixed with the path of the field
+type validator struct {
+	errs []error
+}
+
+func (v *validator) add(path, format string, args ...any) {
+	v.errs = append(v.errs, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...)))
+}
+
+func (v *validator) algorithm(path, algorithm string, supported []string) {
+	if algorithm != "" && !slices.Contains(supported, algorithm) {
+		v.add(path, "unsupported algorithm %s", algorithm)
+	}
+}
+
+func (v *validator) url(path, value string) {
+	if value == "" {
+		return
+	}
+	if u, err := url.Parse(value); err != nil || !u.IsAbs() {
+		v.add(path, "%s is no absolute URL", value)
+	}
+}
+
+func (v *validator) localizedURLs(path string, values []provider.LocalizedValue) {
+	for i, value := range values {
+		v.url(fmt.Sprintf("%s[%d]", path, i), value.Value)
+	}
+}
+
+func (v *validator) endpoint(path string, endpoint *provider.Endpoint) {
+	if endpoint != nil {
+		v.url(path, endpoint.URL())
+	}
+}
+
+func (v *validator) duration(path string, duration time.Duration) {
+	if duration < 0 {
+		v.add(path, "negative duration %s", duration)
+	}
+}
+
+func (v *validator) certificate(path string, cert *provider.Certificate) {
+	if cert == nil {
+		return
+	}
+	if cert.Path == "" {
+		v.add(path+".Path", "missing")
+	}
+	if cert.PrivateKeyPath == "" {
+		v.add(path+".PrivateKeyPath", "missing")
+	}
+}
+
+// Validate checks the algorithms, URLs and durations of the configuration
+// and returns all issues joined into one error
+func (c *Config) Validate() error {
+	v := new(validator)
+	if c.Issuer != "" {
+		if err := provider.ValidateIssuer(c.Issuer, c.AllowInsecure); err != nil {
+			v.add("Issuer", "%v", err)
+		}
+	}
+	v.certificate("SigningCertificate", c.SigningCertificate)
+	v.certificate("MetadataCertificate", c.MetadataCertificate)
+	if c.MetadataCertificate != nil && c.SigningCertificate == nil {
+		v.add("MetadataCertificate", "requires a SigningCertificate")
+	}
+
+	v.endpoint("Metadata", c.Metadata)
+	v.endpoint("MetadataQuery", c.MetadataQuery)
+	if conf := c.MetadataConfig; conf != nil {
+		v.algorithm("MetadataConfig.SignatureAlgorithm", conf.SignatureAlgorithm, signatureAlgorithms)
+		v.duration("MetadataConfig.RefreshInterval", conf.RefreshInterval)
+	}
+	if conf := c.IDPConfig; conf != nil {
+		validateIDPConfig(v, conf)
+	}
+
+	if org := c.Organisation; org != nil {
+		v.url("Organisation.URL", org.URL)
+		v.localizedURLs("Organisation.URLs", org.URLs)
+	}
+	if c.ContactPerson != nil {
+		validateContactPerson(v, "ContactPerson", c.ContactPerson)
+	}
+	for i := range c.ContactPersons {
+		validateContactPerson(v, fmt.Sprintf("ContactPersons[%d]", i), &c.ContactPersons[i])
+	}
+	if info := c.UIInfo; info != nil {
+		v.localizedURLs("UIInfo.InformationURLs", info.InformationURLs)
+		v.localizedURLs("UIInfo.PrivacyStatementURLs", info.PrivacyStatementURLs)
+		for i, logo := range info.Logos {
+			v.url(fmt.Sprintf("UIInfo.Logos[%d].URL", i), logo.URL)
+		}
+	}
+	return errors.Join(v.errs...)
+}
+
+func validateIDPConfig(v *validator, conf *provider.IdentityProviderConfig) {
+	v.algorithm("IDPConfig.SignatureAlgorithm", conf.SignatureAlgorithm, signatureAlgorithms)
+	v.algorithm("IDPConfig.DigestAlgorithm", conf.DigestAlgorithm, digestAlgorithms)
+	v.algorithm("IDPConfig.EncryptionAlgorithm", conf.EncryptionAlgorithm, encryptionAlgorithms)
+	switch conf.WantAuthRequestsSigned {
+	case "", "true", "false", "1", "0":
+	default:
+		v.add("IDPConfig.WantAuthRequestsSigned", "%s is no boolean", conf.WantAuthRequestsSigned)
+	}
+	if metadata := conf.MetadataIDPConfig; metadata != nil {
+		v.duration("IDPConfig.MetadataIDPConfig.ValidUntil", metadata.ValidUntil)
+		v.duration("IDPConfig.MetadataIDPConfig.CacheDuration", metadata.CacheDuration)
+		v.url("IDPConfig.MetadataIDPConfig.ErrorURL", metadata.ErrorURL)
+	}
+	if endpoints := conf.Endpoints; endpoints != nil {
+		v.endpoint("IDPConfig.Endpoints.Certificate", endpoints.Certificate)
+		v.endpoint("IDPConfig.Endpoints.Callback", endpoints.Callback)
+		v.endpoint("IDPConfig.Endpoints.SingleSignOn", endpoints.SingleSignOn)
+		v.endpoint("IDPConfig.Endpoints.SingleLogOut", endpoints.SingleLogOut)
+		v.endpoint("IDPConfig.Endpoints.Attribute", endpoints.Attribute)
+		v.endpoint("IDPConfig.Endpoints.AssertionQuery", endpoints.AssertionQuery)
+		v.endpoint("IDPConfig.Endpoints.NameIDMapping", endpoints.NameIDMapping)
+		v.endpoint("IDPConfig.Endpoints.ManageNameID", endpoints.ManageNameID)
+		v.endpoint("IDPConfig.Endpoints.AssertionConsumer", endpoints.AssertionConsumer)
+	}
+}
+
+func validateContactPerson(v *validator, path string, contact *provider.ContactPerson) {
+	if contact.ContactType != "" && !slices.Contains(contactTypes, contact.ContactType) {
+		v.add(path+".ContactType", "unknown contact type %s", contact.ContactType)
+	}
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/zitadel/logging"
+
+	"github.com/zitadel/saml/pkg/provider"
+)
+
+// Watch reloads the Provider whenever the content of the configuration file or of the configured certificates
+// and keys changes, checked every interval until the context is done.
+// Invalid configurations are logged on every check and the previous configuration stays active until the files are fixed.
+func Watch(ctx context.Context, path string, p *provider.Provider, interval time.Duration, opts ...provider.Option) {
+	w := &watcher{path: path, provider: p, opts: opts}
+	if conf, err := Load(path); err == nil {
+		w.files = conf.files()
+	}
+	w.sum = w.checksum()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.reloadIfChanged(); err != nil {
+				logging.Error(err)
+			}
+		}
+	}
+}
+
+type watcher struct {
+	path     string
+	provider *provider.Provider
+	opts     []provider.Option
+	files    []string
+	sum      [sha256.Size]byte
+}
+
+// reloadIfChanged reloads the Provider if the checksum of the files changed since the last successful reload,
+// so that a failed reload, e.g. of a certificate written before its key, is retried with the next check
+func (w *watcher) reloadIfChanged() error {
+	if w.checksum() == w.sum {
+		return nil
+	}
+	conf, err := Load(w.path)
+	if err != nil {
+		return fmt.Errorf("failed to reload config %s: %w", w.path, err)
+	}
+	if err := conf.Reload(w.provider, w.opts...); err != nil {
+		return fmt.Errorf("failed to reload config %s: %w", w.path, err)
+	}
+	w.files = conf.files()
+	// the certificates referenced by the new configuration are part of the next checksum
+	w.sum = w.checksum()
+	return nil
+}
+
+// checksum hashes the configuration file and the certificates, missing files are hashed as empty
+func (w *watcher) checksum() [sha256.Size]byte {
+	hash := sha256.New()
+	for _, file := range append([]string{w.path}, w.files...) {
+		data, _ := os.ReadFile(file)
+		fmt.Fprintf(hash, "%s:%d:", file, len(data))
+		hash.Write(data)
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], hash.Sum(nil))
+	return sum
+}
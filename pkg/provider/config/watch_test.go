@@ -0,0 +1,68 @@
+package config
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zitadel/saml/pkg/provider"
+	"github.com/zitadel/saml/pkg/provider/mock"
+)
+
+func TestWatch_reloadIfChanged(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath, _ := writeKeyAndCertificate(t, dir)
+	path := filepath.Join(dir, "config.yaml")
+	writeConfig := func(name string) {
+		require.NoError(t, os.WriteFile(path, []byte(`
+Issuer: https://idp.example.com
+SigningCertificate:
+  Path: `+certPath+`
+  PrivateKeyPath: `+keyPath+`
+Organisation:
+  Name: `+name+`
+`), 0o600))
+	}
+	writeConfig("before")
+	conf, err := Load(path)
+	require.NoError(t, err)
+	p, err := conf.NewProvider(mock.NewMockStorage(gomock.NewController(t)))
+	require.NoError(t, err)
+
+	w := &watcher{path: path, provider: p, files: conf.files()}
+	w.sum = w.checksum()
+	organisation := func() string {
+		metadata, err := p.GetMetadata(provider.ContextWithIssuer(context.Background(), conf.Issuer))
+		require.NoError(t, err)
+		return metadata.Organization.OrganizationName[0].Text
+	}
+
+	require.NoError(t, w.reloadIfChanged())
+	assert.Equal(t, "before", organisation())
+
+	writeConfig("after")
+	require.NoError(t, w.reloadIfChanged())
+	assert.Equal(t, "after", organisation())
+
+	// an invalid configuration is retried until it is fixed and the previous one stays active meanwhile
+	require.NoError(t, os.WriteFile(path, []byte(`Issuer: http://idp.example.com`), 0o600))
+	assert.Error(t, w.reloadIfChanged())
+	assert.Error(t, w.reloadIfChanged())
+	assert.Equal(t, "after", organisation())
+	writeConfig("fixed")
+	require.NoError(t, w.reloadIfChanged())
+	assert.Equal(t, "fixed", organisation())
+
+	// renewed certificates are applied
+	_, _, cert := writeKeyAndCertificate(t, dir)
+	require.NoError(t, w.reloadIfChanged())
+	metadata, err := p.GetMetadata(provider.ContextWithIssuer(context.Background(), conf.Issuer))
+	require.NoError(t, err)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(cert.Raw), metadata.IDPSSODescriptor.KeyDescriptor[0].KeyInfo.X509Data[0].X509Certificate)
+}
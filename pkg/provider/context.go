@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
@@ -13,12 +14,16 @@ import (
 
 type valueKey int
 
-var (
-	issuerKey valueKey = 1
+const (
+	issuerKey valueKey = iota + 1
+	tenantKey
+	clientAddressKey
 )
 
 type IssuerInterceptor struct {
 	issuerFromRequest IssuerFromRequest
+	// clientAddressFromRequest sets the address of the client into the context if not nil, see WithClientAddressFromForwarded
+	clientAddressFromRequest func(r *http.Request) string
 }
 
 // NewIssuerInterceptor will set the issuer into the context
@@ -53,9 +58,17 @@ func ContextWithIssuer(ctx context.Context, issuer string) context.Context {
 	return context.WithValue(ctx, issuerKey, issuer)
 }
 
+// ContextWithClientAddress returns a new context with the address of the client set to it.
+func ContextWithClientAddress(ctx context.Context, address string) context.Context {
+	return context.WithValue(ctx, clientAddressKey, address)
+}
+
 func (i *IssuerInterceptor) setIssuerCtx(w http.ResponseWriter, r *http.Request, next http.Handler) {
-	r = r.WithContext(ContextWithIssuer(r.Context(), i.issuerFromRequest(r)))
-	next.ServeHTTP(w, r)
+	ctx := ContextWithIssuer(r.Context(), i.issuerFromRequest(r))
+	if i.clientAddressFromRequest != nil {
+		ctx = ContextWithClientAddress(ctx, i.clientAddressFromRequest(r))
+	}
+	next.ServeHTTP(w, r.WithContext(ctx))
 }
 
 var (
@@ -85,8 +98,18 @@ func WithIssuerFromCustomHeaders(headers ...string) IssuerFromOption {
 	}
 }
 
+// WithTrustedProxies sets the number of trusted proxies in front of the Provider, which append the for parameter to the headers,
+// defaults to 1. The address appended by the outermost trusted proxy is used as the address of the client,
+// the addresses before it are set by the client itself. Only used by WithClientAddressFromForwarded.
+func WithTrustedProxies(count int) IssuerFromOption {
+	return func(c *issuerConfig) {
+		c.trustedProxies = count
+	}
+}
+
 type issuerConfig struct {
-	headers []string
+	headers        []string
+	trustedProxies int
 }
 
 // IssuerFromForwardedOrHost tries to establish the Issuer based
@@ -139,6 +162,55 @@ func hostFromForwarded(r *http.Request, headers []string) (host string, ok bool)
 	return "", false
 }
 
+// ClientAddressFromRequest returns the address of the client set into the context by the IssuerInterceptor
+// (see WithClientAddressFromForwarded) or else the remote address of the request.
+func ClientAddressFromRequest(r *http.Request) string {
+	if address, _ := r.Context().Value(clientAddressKey).(string); address != "" {
+		return address
+	}
+	return hostWithoutPort(r.RemoteAddr)
+}
+
+// clientAddressFromForwarded returns the address of the client from the for parameters of the headers
+// appended by the outermost trusted proxy (see WithTrustedProxies), the values of X-Forwarded-For are read as list of addresses.
+// Obfuscated and unknown identifiers are ignored and the remote address of the request is used as a fallback.
+func clientAddressFromForwarded(c *issuerConfig) func(r *http.Request) string {
+	hops := max(c.trustedProxies, 1)
+	return func(r *http.Request) string {
+		for _, header := range c.headers {
+			var addresses []string
+			if header == http.CanonicalHeaderKey("x-forwarded-for") {
+				for _, value := range r.Header[header] {
+					addresses = append(addresses, strings.Split(value, ",")...)
+				}
+			} else {
+				var err error
+				addresses, err = httpforwarded.ParseParameter("for", r.Header[header])
+				if err != nil {
+					log.Printf("Err: client address from forwarded header: %v", err) // TODO change to slog on next branch
+					continue
+				}
+			}
+			// the request did not pass all trusted proxies
+			if len(addresses) < hops {
+				continue
+			}
+			address := strings.TrimSpace(addresses[len(addresses)-hops])
+			if address != "" && !strings.HasPrefix(address, "_") && address != "unknown" {
+				return hostWithoutPort(address)
+			}
+		}
+		return hostWithoutPort(r.RemoteAddr)
+	}
+}
+
+func hostWithoutPort(address string) string {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+}
+
 func StaticIssuer(issuer string) func(bool) (IssuerFromRequest, error) {
 	return func(allowInsecure bool) (IssuerFromRequest, error) {
 		if err := ValidateIssuer(issuer, allowInsecure); err != nil {
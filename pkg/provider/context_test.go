@@ -0,0 +1,85 @@
+package provider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContext_ClientAddressFromRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []IssuerFromOption
+		forwarded  bool
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"remote address", nil, false, "192.0.2.1:1234", nil, "192.0.2.1"},
+		{"forwarded not trusted", nil, false, "192.0.2.1:1234", map[string]string{"Forwarded": "for=198.51.100.17"}, "192.0.2.1"},
+		{"forwarded", nil, true, "192.0.2.1:1234", map[string]string{"Forwarded": "for=198.51.100.17;proto=https"}, "198.51.100.17"},
+		{"forwarded ipv6", nil, true, "192.0.2.1:1234", map[string]string{"Forwarded": `for="[2001:db8:cafe::17]:4711"`}, "2001:db8:cafe::17"},
+		{"forwarded obfuscated", nil, true, "192.0.2.1:1234", map[string]string{"Forwarded": "for=_hidden"}, "192.0.2.1"},
+		{"forwarded missing", nil, true, "192.0.2.1:1234", nil, "192.0.2.1"},
+		{
+			"custom header ignores forwarded",
+			[]IssuerFromOption{WithIssuerFromCustomHeaders("x-custom")},
+			true,
+			"192.0.2.1:1234",
+			map[string]string{"Forwarded": "for=198.51.100.17", "X-Custom": "for=203.0.113.5"},
+			"203.0.113.5",
+		},
+		{
+			"x-forwarded-for",
+			[]IssuerFromOption{WithIssuerFromCustomHeaders("x-forwarded-for")},
+			true,
+			"192.0.2.1:1234",
+			map[string]string{"X-Forwarded-For": "203.0.113.5, 10.0.0.1"},
+			"10.0.0.1",
+		},
+		{
+			"forwarded spoofed by client",
+			nil,
+			true,
+			"192.0.2.1:1234",
+			map[string]string{"Forwarded": "for=203.0.113.66, for=198.51.100.17"},
+			"198.51.100.17",
+		},
+		{
+			"trusted proxies",
+			[]IssuerFromOption{WithIssuerFromCustomHeaders("x-forwarded-for"), WithTrustedProxies(2)},
+			true,
+			"192.0.2.1:1234",
+			map[string]string{"X-Forwarded-For": "203.0.113.66, 203.0.113.5, 10.0.0.1"},
+			"203.0.113.5",
+		},
+		{
+			"fewer hops than trusted proxies",
+			[]IssuerFromOption{WithIssuerFromCustomHeaders("x-forwarded-for"), WithTrustedProxies(2)},
+			true,
+			"192.0.2.1:1234",
+			map[string]string{"X-Forwarded-For": "203.0.113.5"},
+			"192.0.2.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Provider{issuerFromRequest: func(*http.Request) string { return "https://idp.example.com" }}
+			if tt.forwarded {
+				assert.NoError(t, WithClientAddressFromForwarded(tt.opts...)(p))
+			}
+			r := httptest.NewRequest(http.MethodGet, "https://idp.example.com/sso", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for header, value := range tt.headers {
+				r.Header.Set(header, value)
+			}
+			var got string
+			p.issuerInterceptor().HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = ClientAddressFromRequest(r)
+			})(httptest.NewRecorder(), r)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,330 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/zitadel/logging"
+
+	"github.com/zitadel/saml/pkg/provider/checker"
+	"github.com/zitadel/saml/pkg/provider/models"
+	"github.com/zitadel/saml/pkg/provider/serviceprovider"
+	"github.com/zitadel/saml/pkg/provider/xml"
+	"github.com/zitadel/saml/pkg/provider/xml/md"
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
+	"github.com/zitadel/saml/pkg/provider/xml/samlp"
+	"github.com/zitadel/saml/pkg/provider/xml/soap"
+	"github.com/zitadel/saml/pkg/provider/xml/xml_dsig"
+)
+
+const soapActorNext = "http://schemas.xmlsoap.org/soap/actor/next"
+
+// ECPCredentials are the HTTP Basic or bearer credentials of a request of an enhanced client or proxy (ECP)
+type ECPCredentials struct {
+	Username    string
+	Password    string
+	BearerToken string
+}
+
+// ECPAuthenticator authenticates the users of the ECP profile, which log in without a browser
+type ECPAuthenticator interface {
+	// Authenticate returns the ID of the user authenticated by the credentials for the auth request,
+	// or an empty ID if the credentials are invalid
+	Authenticate(ctx context.Context, authRequest models.AuthRequestInt, credentials *ECPCredentials) (string, error)
+}
+
+// ecpAuthRequest is the persisted auth request completed by the ECPAuthenticator,
+// it forwards the optional interfaces of the persisted auth request (e.g. models.AuthenticatingAuthorityGetter)
+type ecpAuthRequest struct {
+	models.AuthRequestInt
+	userID string
+}
+
+func (a *ecpAuthRequest) GetUserID() string {
+	return a.userID
+}
+
+func (a *ecpAuthRequest) Done() bool {
+	return true
+}
+
+func (a *ecpAuthRequest) GetAttributeConsumingServiceIndex() string {
+	if getter, ok := a.AuthRequestInt.(models.AttributeConsumingServiceIndexGetter); ok {
+		return getter.GetAttributeConsumingServiceIndex()
+	}
+	return ""
+}
+
+func (a *ecpAuthRequest) GetAuthenticatingAuthority() []string {
+	if getter, ok := a.AuthRequestInt.(models.AuthenticatingAuthorityGetter); ok {
+		return getter.GetAuthenticatingAuthority()
+	}
+	return nil
+}
+
+func (a *ecpAuthRequest) GetProxyRestriction() *saml.ProxyRestrictionType {
+	if getter, ok := a.AuthRequestInt.(models.ProxyRestrictionGetter); ok {
+		return getter.GetProxyRestriction()
+	}
+	return nil
+}
+
+// isSOAPRequest checks if the request to the SSO endpoint is a SOAP-wrapped AuthnRequest of the ECP profile
+func isSOAPRequest(r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "text/xml" || mediaType == "application/soap+xml"
+}
+
+func (p *IdentityProvider) ecpHandleFunc(w http.ResponseWriter, r *http.Request) {
+	checkerInstance := checker.Checker{}
+	var ecpRequest string
+	var authNRequest *samlp.AuthnRequestType
+	var sp *serviceprovider.ServiceProvider
+	var authRequest models.AuthRequestInt
+	var credentials *ECPCredentials
+	var userID string
+	var err error
+
+	response := &Response{
+		ProtocolBinding: PAOSBinding,
+		Issuer:          p.GetEntityID(r.Context()),
+		ClientAddress:   ClientAddressFromRequest(r),
+	}
+	sendError := func(reason string, message string) {
+		p.sendECPResponse(w, response, response.makeFailedResponse(reason, message, p.TimeFormat))
+	}
+
+	// the ECP profile is only available with an authenticator
+	checkerInstance.WithLogicStep(
+		func() error {
+			if p.ecpAuthenticator == nil {
+				err = fmt.Errorf("ECP profile is not supported")
+			}
+			return err
+		},
+		func() {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		},
+	)
+
+	//parse body to string
+	checkerInstance.WithLogicStep(
+		func() error {
+			b, err := io.ReadAll(r.Body)
+			if err != nil {
+				return err
+			}
+			ecpRequest = string(b)
+			return nil
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to parse body: %w", err).Error(), http.StatusInternalServerError)
+		},
+	)
+
+	// decode request from xml into golang struct
+	checkerInstance.WithLogicStep(
+		func() error {
+			authNRequest, err = xml.DecodeAuthNRequestEnvelope(ecpRequest)
+			if err != nil {
+				return err
+			}
+			if authNRequest == nil || authNRequest.Issuer == nil || authNRequest.Issuer.Text == "" {
+				err = fmt.Errorf("no AuthnRequest with issuer in request")
+				return err
+			}
+			response.RequestID = authNRequest.Id
+			return nil
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to decode request: %w", err).Error(), http.StatusBadRequest)
+		},
+	)
+
+	// get persisted service provider from issuer out of the request
+	checkerInstance.WithLogicStep(
+		func() error {
+			sp, err = p.GetServiceProvider(r.Context(), authNRequest.Issuer.Text)
+			if err != nil {
+				return err
+			}
+			if sp == nil {
+				err = fmt.Errorf("unknown service provider %s", authNRequest.Issuer.Text)
+				return err
+			}
+			response.Audience = sp.GetEntityID()
+			return nil
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to find registered serviceprovider: %w", err).Error(), http.StatusBadRequest)
+		},
+	)
+
+	// work out the acs url of the PAOS binding for the response
+	checkerInstance.WithLogicStep(
+		func() error {
+			response.AcsUrl, err = ecpAcsURL(sp, authNRequest)
+			return err
+		},
+		func() {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		},
+	)
+
+	//validate used certificate for signing the request
+	checkerInstance.WithConditionalLogicStep(
+		certificateCheckNecessary(
+			func() *xml_dsig.SignatureType { return authNRequest.Signature },
+			func() *md.EntityDescriptorType { return sp.Metadata },
+		),
+		checkCertificate(
+			func() *xml_dsig.SignatureType { return authNRequest.Signature },
+			func() *md.EntityDescriptorType { return sp.Metadata },
+		),
+		func() {
+			sendError(StatusCodeRequestDenied, fmt.Errorf("failed to validate certificate from request: %w", err).Error())
+		},
+	)
+
+	// verify the signature inside the SOAP envelope if provided or required
+	checkerInstance.WithConditionalLogicStep(
+		func() bool {
+			return signaturePostProvided(func() *xml_dsig.SignatureType { return authNRequest.Signature })() ||
+				p.conf.WantAuthRequestsSigned == "true" ||
+				(sp.Metadata.SPSSODescriptor != nil && sp.Metadata.SPSSODescriptor.AuthnRequestsSigned == "true")
+		},
+		func() error {
+			err = sp.ValidateSOAPSignature(ecpRequest)
+			return err
+		},
+		func() {
+			sendError(StatusCodeRequestDenied, fmt.Errorf("failed to verify signature: %w", err).Error())
+		},
+	)
+
+	// read the credentials of the user
+	checkerInstance.WithLogicStep(
+		func() error {
+			credentials, err = ecpCredentialsFromRequest(r)
+			return err
+		},
+		func() {
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+response.Issuer+`"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		},
+	)
+
+	// persist authrequest
+	checkerInstance.WithLogicStep(
+		func() error {
+			authRequest, err = p.storage.CreateAuthRequest(
+				r.Context(),
+				authNRequest,
+				response.AcsUrl,
+				response.ProtocolBinding,
+				"",
+				sp.ID,
+			)
+			return err
+		},
+		func() {
+			sendError(StatusCodeResponder, fmt.Errorf("failed to persist request: %w", err).Error())
+		},
+	)
+
+	// authenticate the user with the credentials
+	checkerInstance.WithLogicStep(
+		func() error {
+			userID, err = p.ecpAuthenticator.Authenticate(r.Context(), authRequest, credentials)
+			if err != nil {
+				return err
+			}
+			if userID == "" {
+				err = fmt.Errorf("invalid credentials")
+			}
+			return err
+		},
+		func() {
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+response.Issuer+`"`)
+			http.Error(w, fmt.Errorf("failed to authenticate: %w", err).Error(), http.StatusUnauthorized)
+		},
+	)
+
+	//check and log errors if necessary
+	if checkerInstance.CheckFailed() {
+		return
+	}
+
+	samlResponse, err := p.loginResponse(r.Context(), &ecpAuthRequest{AuthRequestInt: authRequest, userID: userID}, response)
+	if err != nil {
+		sendError(err.Error(), "failed to create response")
+		return
+	}
+	p.sendECPResponse(w, response, samlResponse)
+}
+
+// ecpAcsURL returns the AssertionConsumerService of the service provider with the PAOS binding matching the request
+func ecpAcsURL(sp *serviceprovider.ServiceProvider, request *samlp.AuthnRequestType) (string, error) {
+	if sp.Metadata == nil || sp.Metadata.SPSSODescriptor == nil {
+		return "", fmt.Errorf("no metadata of service provider")
+	}
+	var acsIndex *int
+	if request.AssertionConsumerServiceIndex != "" {
+		if i, err := strconv.Atoi(request.AssertionConsumerServiceIndex); err == nil {
+			acsIndex = &i
+		}
+	}
+	acsURL, binding := GetAcsUrlAndBindingForResponse(
+		sp.Metadata.SPSSODescriptor.AssertionConsumerService,
+		PAOSBinding,
+		request.AssertionConsumerServiceURL,
+		acsIndex,
+	)
+	if binding != PAOSBinding || acsURL == "" {
+		return "", fmt.Errorf("missing assertion consumer url of service provider for binding %s", PAOSBinding)
+	}
+	return acsURL, nil
+}
+
+// ecpCredentialsFromRequest reads the HTTP Basic or bearer credentials of the Authorization header
+func ecpCredentialsFromRequest(r *http.Request) (*ECPCredentials, error) {
+	if username, password, ok := r.BasicAuth(); ok {
+		return &ECPCredentials{Username: username, Password: password}, nil
+	}
+	authorization := r.Header.Get("Authorization")
+	if len(authorization) > len("Bearer ") && strings.EqualFold(authorization[:len("Bearer ")], "Bearer ") {
+		return &ECPCredentials{BearerToken: authorization[len("Bearer "):]}, nil
+	}
+	return nil, fmt.Errorf("no credentials provided")
+}
+
+func (p *IdentityProvider) sendECPResponse(w http.ResponseWriter, response *Response, samlResponse *samlp.ResponseType) {
+	envelope := &soap.ECPResponseEnvelope{
+		Header: soap.ECPResponseHeader{
+			Response: &soap.ECPResponseType{
+				MustUnderstand:              "1",
+				Actor:                       soapActorNext,
+				AssertionConsumerServiceURL: response.AcsUrl,
+			},
+		},
+		Body: soap.ResponseBody{
+			Response: samlResponse,
+		},
+	}
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	if err := xml.WriteXMLMarshalled(w, envelope); err != nil {
+		logging.Error(err)
+		http.Error(w, fmt.Errorf("failed to send response: %w", err).Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,195 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
+	"github.com/zitadel/saml/pkg/provider/xml/xenc"
+	"github.com/zitadel/saml/pkg/provider/xml/xml_dsig"
+)
+
+const (
+	NamespaceXENC   = "http://www.w3.org/2001/04/xmlenc#"
+	NamespaceXENC11 = "http://www.w3.org/2009/xmlenc11#"
+
+	AES128CBC = NamespaceXENC + "aes128-cbc"
+	AES256CBC = NamespaceXENC + "aes256-cbc"
+	AES128GCM = NamespaceXENC11 + "aes128-gcm"
+	AES256GCM = NamespaceXENC11 + "aes256-gcm"
+
+	RSAOAEPMGF1P = NamespaceXENC + "rsa-oaep-mgf1p"
+
+	TypeElement = NamespaceXENC + "Element"
+
+	// DefaultAlgorithm is used if no algorithm is provided
+	DefaultAlgorithm = AES256GCM
+)
+
+// Encrypt encrypts the XML element for the certificate of the recipient with a random key of the algorithm,
+// the key is transported with RSA-OAEP in an EncryptedKey next to the EncryptedData
+func Encrypt(element []byte, cert *x509.Certificate, algorithm string) (*saml.EncryptedElementType, error) {
+	if algorithm == "" {
+		algorithm = DefaultAlgorithm
+	}
+	publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("encryption is only supported for RSA certificates")
+	}
+	keySize, err := keySize(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	cipherValue, err := encryptData(algorithm, key, element)
+	if err != nil {
+		return nil, err
+	}
+	encryptedKey, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, publicKey, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &saml.EncryptedElementType{
+		EncryptedData: xenc.EncryptedDataType{
+			XMLName:          xml.Name{Space: NamespaceXENC, Local: "EncryptedData"},
+			Type:             TypeElement,
+			EncryptionMethod: &xenc.EncryptionMethodType{XMLName: xml.Name{Space: NamespaceXENC, Local: "EncryptionMethod"}, Algorithm: algorithm},
+			CipherData: xenc.CipherDataType{
+				XMLName:     xml.Name{Space: NamespaceXENC, Local: "CipherData"},
+				CipherValue: base64.StdEncoding.EncodeToString(cipherValue),
+			},
+		},
+		EncryptedKey: []xenc.EncryptedKeyType{{
+			XMLName:          xml.Name{Space: NamespaceXENC, Local: "EncryptedKey"},
+			EncryptionMethod: &xenc.EncryptionMethodType{XMLName: xml.Name{Space: NamespaceXENC, Local: "EncryptionMethod"}, Algorithm: RSAOAEPMGF1P},
+			KeyInfo: &xml_dsig.KeyInfoType{
+				X509Data: []xml_dsig.X509DataType{{X509Certificate: base64.StdEncoding.EncodeToString(cert.Raw)}},
+			},
+			CipherData: xenc.CipherDataType{
+				XMLName:     xml.Name{Space: NamespaceXENC, Local: "CipherData"},
+				CipherValue: base64.StdEncoding.EncodeToString(encryptedKey),
+			},
+		}},
+	}, nil
+}
+
+// Decrypt decrypts the element with the private key, the key has to be transported with RSA-OAEP
+// in an EncryptedKey next to the EncryptedData
+func Decrypt(element *saml.EncryptedElementType, privateKey *rsa.PrivateKey) ([]byte, error) {
+	if element.EncryptedData.EncryptionMethod == nil {
+		return nil, fmt.Errorf("no encryption method provided")
+	}
+	var lastErr error = fmt.Errorf("no encrypted key provided")
+	for _, encryptedKey := range element.EncryptedKey {
+		if encryptedKey.EncryptionMethod == nil || encryptedKey.EncryptionMethod.Algorithm != RSAOAEPMGF1P {
+			lastErr = fmt.Errorf("unsupported key transport algorithm")
+			continue
+		}
+		keyValue, err := base64.StdEncoding.DecodeString(encryptedKey.CipherData.CipherValue)
+		if err != nil {
+			return nil, err
+		}
+		key, err := rsa.DecryptOAEP(sha1.New(), rand.Reader, privateKey, keyValue, nil)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		cipherValue, err := base64.StdEncoding.DecodeString(element.EncryptedData.CipherData.CipherValue)
+		if err != nil {
+			return nil, err
+		}
+		return decryptData(element.EncryptedData.EncryptionMethod.Algorithm, key, cipherValue)
+	}
+	return nil, lastErr
+}
+
+// Supported checks if the algorithm can be used to encrypt elements
+func Supported(algorithm string) bool {
+	_, err := keySize(algorithm)
+	return err == nil
+}
+
+func keySize(algorithm string) (int, error) {
+	switch algorithm {
+	case AES128CBC, AES128GCM:
+		return 16, nil
+	case AES256CBC, AES256GCM:
+		return 32, nil
+	}
+	return 0, fmt.Errorf("unsupported encryption algorithm %s", algorithm)
+}
+
+// encryptData returns the IV followed by the cipher text (and the tag for GCM)
+func encryptData(algorithm string, key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	switch algorithm {
+	case AES128GCM, AES256GCM:
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+		return gcm.Seal(nonce, nonce, data, nil), nil
+	case AES128CBC, AES256CBC:
+		iv := make([]byte, aes.BlockSize)
+		if _, err := rand.Read(iv); err != nil {
+			return nil, err
+		}
+		padding := aes.BlockSize - len(data)%aes.BlockSize
+		plain := append(bytes.Clone(data), bytes.Repeat([]byte{byte(padding)}, padding)...)
+		encrypted := make([]byte, len(plain))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, plain)
+		return append(iv, encrypted...), nil
+	}
+	return nil, fmt.Errorf("unsupported encryption algorithm %s", algorithm)
+}
+
+func decryptData(algorithm string, key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	switch algorithm {
+	case AES128GCM, AES256GCM:
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < gcm.NonceSize() {
+			return nil, fmt.Errorf("invalid cipher value")
+		}
+		return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	case AES128CBC, AES256CBC:
+		if len(data) < 2*aes.BlockSize || len(data)%aes.BlockSize != 0 {
+			return nil, fmt.Errorf("invalid cipher value")
+		}
+		plain := make([]byte, len(data)-aes.BlockSize)
+		cipher.NewCBCDecrypter(block, data[:aes.BlockSize]).CryptBlocks(plain, data[aes.BlockSize:])
+		// XML encryption only defines the last byte as length of the padding
+		padding := int(plain[len(plain)-1])
+		if padding == 0 || padding > aes.BlockSize {
+			return nil, fmt.Errorf("invalid padding")
+		}
+		return plain[:len(plain)-padding], nil
+	}
+	return nil, fmt.Errorf("unsupported encryption algorithm %s", algorithm)
+}
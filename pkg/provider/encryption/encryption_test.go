@@ -0,0 +1,88 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/xml"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
+)
+
+func newCertificate(t *testing.T) (*x509.Certificate, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sp"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+func TestEncryption_EncryptDecrypt(t *testing.T) {
+	cert, key := newCertificate(t)
+	_, otherKey := newCertificate(t)
+	element := []byte(`<NameID xmlns="urn:oasis:names:tc:SAML:2.0:assertion">id</NameID>`)
+
+	tests := []struct {
+		name      string
+		algorithm string
+		err       bool
+	}{
+		{"default", "", false},
+		{"aes128-cbc", AES128CBC, false},
+		{"aes256-cbc", AES256CBC, false},
+		{"aes128-gcm", AES128GCM, false},
+		{"aes256-gcm", AES256GCM, false},
+		{"unsupported", "http://www.w3.org/2001/04/xmlenc#tripledes-cbc", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encrypted, err := Encrypt(element, cert, tt.algorithm)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			decrypted, err := Decrypt(encrypted, key)
+			require.NoError(t, err)
+			assert.Equal(t, element, decrypted)
+
+			_, err = Decrypt(encrypted, otherKey)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestEncryption_Marshal(t *testing.T) {
+	cert, key := newCertificate(t)
+	encrypted, err := Encrypt([]byte(`<NameID xmlns="urn:oasis:names:tc:SAML:2.0:assertion">id</NameID>`), cert, AES256CBC)
+	require.NoError(t, err)
+	encrypted.XMLName = xml.Name{Space: "urn:oasis:names:tc:SAML:2.0:assertion", Local: "EncryptedID"}
+
+	data, err := xml.Marshal(encrypted)
+	require.NoError(t, err)
+	assert.True(t, strings.Contains(string(data), `<EncryptedData xmlns="http://www.w3.org/2001/04/xmlenc#" Type="http://www.w3.org/2001/04/xmlenc#Element">`))
+	assert.True(t, strings.Contains(string(data), `<EncryptionMethod xmlns="http://www.w3.org/2001/04/xmlenc#" Algorithm="http://www.w3.org/2001/04/xmlenc#rsa-oaep-mgf1p">`))
+
+	decoded := new(saml.EncryptedElementType)
+	require.NoError(t, xml.Unmarshal(data, decoded))
+	decrypted, err := Decrypt(decoded, key)
+	require.NoError(t, err)
+	assert.Equal(t, `<NameID xmlns="urn:oasis:names:tc:SAML:2.0:assertion">id</NameID>`, string(decrypted))
+}
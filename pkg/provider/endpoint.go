@@ -1,6 +1,11 @@
 package provider
 
-import "strings"
+import (
+	"encoding/json"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
 
 type Endpoint struct {
 	path string
@@ -19,6 +24,11 @@ func (e Endpoint) Relative() string {
 	return relativeEndpoint(e.path)
 }
 
+// URL is the absolute URL of the endpoint if configured, empty if the endpoint is relative to the issuer
+func (e Endpoint) URL() string {
+	return e.url
+}
+
 func (e Endpoint) Absolute(host string) string {
 	if e.url != "" {
 		return e.url
@@ -26,6 +36,41 @@ func (e Endpoint) Absolute(host string) string {
 	return absoluteEndpoint(host, e.path)
 }
 
+// endpointConfig is the decoded form of an Endpoint, which is either only the path or the path and the URL
+type endpointConfig struct {
+	Path string `yaml:"Path" json:"Path"`
+	URL  string `yaml:"URL" json:"URL"`
+}
+
+// UnmarshalYAML decodes the endpoint from the path, e.g. "SSO", or from Path and URL
+func (e *Endpoint) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*e = NewEndpoint(value.Value)
+		return nil
+	}
+	var conf endpointConfig
+	if err := value.Decode(&conf); err != nil {
+		return err
+	}
+	*e = NewEndpointWithURL(conf.Path, conf.URL)
+	return nil
+}
+
+// UnmarshalJSON decodes the endpoint from the path, e.g. "SSO", or from Path and URL
+func (e *Endpoint) UnmarshalJSON(data []byte) error {
+	var path string
+	if err := json.Unmarshal(data, &path); err == nil {
+		*e = NewEndpoint(path)
+		return nil
+	}
+	var conf endpointConfig
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return err
+	}
+	*e = NewEndpointWithURL(conf.Path, conf.URL)
+	return nil
+}
+
 func absoluteEndpoint(host, endpoint string) string {
 	return strings.TrimSuffix(host, "/") + relativeEndpoint(endpoint)
 }
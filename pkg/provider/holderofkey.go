@@ -0,0 +1,69 @@
+package provider
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
+	"github.com/zitadel/saml/pkg/provider/xml/xml_dsig"
+)
+
+const (
+	SubjectConfirmationMethodBearer      = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	SubjectConfirmationMethodHolderOfKey = "urn:oasis:names:tc:SAML:2.0:cm:holder-of-key"
+)
+
+// ClientCertificateFromRequest returns the TLS client certificate of the request.
+// If TLS is terminated in front of the provider, the certificate can be passed in the header,
+// either PEM (optionally URL-encoded, e.g. nginx $ssl_client_escaped_cert) or base64 encoded DER.
+// The header must only be used if it is set by a trusted proxy.
+func ClientCertificateFromRequest(r *http.Request, header string) (*x509.Certificate, error) {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return r.TLS.PeerCertificates[0], nil
+	}
+	if header == "" {
+		return nil, nil
+	}
+	value := r.Header.Get(header)
+	if value == "" {
+		return nil, nil
+	}
+	if strings.Contains(value, "%") {
+		if unescaped, err := url.PathUnescape(value); err == nil {
+			value = unescaped
+		}
+	}
+	if block, _ := pem.Decode([]byte(value)); block != nil {
+		return x509.ParseCertificate(block.Bytes)
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode client certificate: %w", err)
+	}
+	return x509.ParseCertificate(der)
+}
+
+// applyHolderOfKey changes the subject confirmations of the assertion to holder-of-key with the certificate as KeyInfo
+func applyHolderOfKey(assertion *saml.AssertionType, cert *x509.Certificate) {
+	if assertion.Subject == nil || cert == nil {
+		return
+	}
+	for i := range assertion.Subject.SubjectConfirmation {
+		confirmation := &assertion.Subject.SubjectConfirmation[i]
+		confirmation.Method = SubjectConfirmationMethodHolderOfKey
+		if confirmation.SubjectConfirmationData == nil {
+			confirmation.SubjectConfirmationData = &saml.SubjectConfirmationDataType{}
+		}
+		confirmation.SubjectConfirmationData.SetKeyInfoConfirmationDataType()
+		confirmation.SubjectConfirmationData.KeyInfo = []xml_dsig.KeyInfoType{{
+			X509Data: []xml_dsig.X509DataType{{
+				X509Certificate: base64.StdEncoding.EncodeToString(cert.Raw),
+			}},
+		}}
+	}
+}
@@ -0,0 +1,68 @@
+package provider
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
+)
+
+func TestHolderOfKey_ClientCertificateFromRequest(t *testing.T) {
+	_, cert := newKeyAndCertificate(t)
+	certPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+
+	tests := []struct {
+		name    string
+		tls     *tls.ConnectionState
+		header  string
+		value   string
+		want    *x509.Certificate
+		wantErr bool
+	}{
+		{"no certificate", nil, "", "", nil, false},
+		{"tls", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}, "", "", cert, false},
+		{"header not configured", nil, "", certPEM, nil, false},
+		{"header pem", nil, "X-Client-Cert", certPEM, cert, false},
+		{"header escaped pem", nil, "X-Client-Cert", url.PathEscape(certPEM), cert, false},
+		{"header der", nil, "X-Client-Cert", base64.StdEncoding.EncodeToString(cert.Raw), cert, false},
+		{"header invalid", nil, "X-Client-Cert", "invalid", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{TLS: tt.tls, Header: http.Header{}}
+			if tt.value != "" {
+				r.Header.Set("X-Client-Cert", tt.value)
+			}
+			got, err := ClientCertificateFromRequest(r, tt.header)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ClientCertificateFromRequest() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHolderOfKey_applyHolderOfKey(t *testing.T) {
+	_, cert := newKeyAndCertificate(t)
+	assertion := makeAssertion("request", "acs", "", "now", "until", "issuer", &saml.NameIDType{}, nil, "audience", true)
+	applyHolderOfKey(assertion, cert)
+
+	confirmation := assertion.Subject.SubjectConfirmation[0]
+	assert.Equal(t, SubjectConfirmationMethodHolderOfKey, confirmation.Method)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(cert.Raw), confirmation.SubjectConfirmationData.KeyInfo[0].X509Data[0].X509Certificate)
+
+	data, err := xml.Marshal(confirmation)
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(string(data), `xsi:type="saml:KeyInfoConfirmationDataType"`))
+	assert.True(t, strings.Contains(string(data), `<KeyInfo xmlns="http://www.w3.org/2000/09/xmldsig#">`))
+}
@@ -12,17 +12,23 @@ import (
 	"reflect"
 	"time"
 
+	"github.com/zitadel/saml/pkg/provider/attribute"
+	"github.com/zitadel/saml/pkg/provider/key"
 	"github.com/zitadel/saml/pkg/provider/serviceprovider"
 	"github.com/zitadel/saml/pkg/provider/xml/md"
 	"github.com/zitadel/saml/pkg/provider/xml/samlp"
 )
 
 const (
-	DefaultCertificateEndpoint  = "certificate"
-	DefaultCallbackEndpoint     = "login"
-	DefaultSingleSignOnEndpoint = "SSO"
-	DefaultSingleLogOutEndpoint = "SLO"
-	DefaultAttributeEndpoint    = "attribute"
+	DefaultCertificateEndpoint       = "certificate"
+	DefaultCallbackEndpoint          = "login"
+	DefaultSingleSignOnEndpoint      = "SSO"
+	DefaultSingleLogOutEndpoint      = "SLO"
+	DefaultAttributeEndpoint         = "attribute"
+	DefaultAssertionEndpoint         = "assertion"
+	DefaultNameIDMappingEndpoint     = "mapping"
+	DefaultManageNameIDEndpoint      = "manage"
+	DefaultAssertionConsumerEndpoint = "acs"
 )
 
 type IDPStorage interface {
@@ -33,23 +39,32 @@ type IDPStorage interface {
 }
 
 type MetadataIDPConfig struct {
-	ValidUntil    time.Duration
-	CacheDuration string
-	ErrorURL      string
+	ValidUntil time.Duration `yaml:"ValidUntil"`
+	// CacheDuration is published as cacheDuration (xs:duration) of the role descriptors, omitted if 0
+	CacheDuration time.Duration `yaml:"CacheDuration"`
+	ErrorURL      string        `yaml:"ErrorURL"`
 }
 
 type IdentityProviderConfig struct {
-	MetadataIDPConfig *MetadataIDPConfig
+	MetadataIDPConfig *MetadataIDPConfig `yaml:"MetadataIDPConfig"`
 
-	PostTemplate   *template.Template
-	LogoutTemplate *template.Template
+	PostTemplate   *template.Template `yaml:"-"`
+	LogoutTemplate *template.Template `yaml:"-"`
 
-	SignatureAlgorithm  string
-	DigestAlgorithm     string
-	EncryptionAlgorithm string
+	SignatureAlgorithm  string `yaml:"SignatureAlgorithm"`
+	DigestAlgorithm     string `yaml:"DigestAlgorithm"`
+	EncryptionAlgorithm string `yaml:"EncryptionAlgorithm"`
 
-	WantAuthRequestsSigned string
-	Insecure               bool
+	WantAuthRequestsSigned string `yaml:"WantAuthRequestsSigned"`
+	Insecure               bool   `yaml:"Insecure"`
+
+	// SessionIndexPerServiceProvider derives the SessionIndex from the session provided by the SessionStorage
+	// per service provider instead of using the session ID directly
+	SessionIndexPerServiceProvider bool `yaml:"SessionIndexPerServiceProvider"`
+
+	// AttributeProfile names the released attributes for service providers without an own profile,
+	// defaults to attribute.BasicProfile
+	AttributeProfile *attribute.Profile `yaml:"-"`
 
 	Endpoints *EndpointConfig `yaml:"Endpoints"`
 }
@@ -60,6 +75,14 @@ type EndpointConfig struct {
 	SingleSignOn *Endpoint `yaml:"SingleSignOn"`
 	SingleLogOut *Endpoint `yaml:"SingleLogOut"`
 	Attribute    *Endpoint `yaml:"Attribute"`
+	// AssertionQuery is the SOAP endpoint of the assertion query/request protocol
+	AssertionQuery *Endpoint `yaml:"AssertionQuery"`
+	// NameIDMapping is the SOAP endpoint of the NameID mapping service
+	NameIDMapping *Endpoint `yaml:"NameIDMapping"`
+	// ManageNameID is the SOAP, Redirect and POST endpoint of the ManageNameID protocol
+	ManageNameID *Endpoint `yaml:"ManageNameID"`
+	// AssertionConsumer is the POST endpoint receiving the responses of the upstream identity providers in the proxy mode
+	AssertionConsumer *Endpoint `yaml:"AssertionConsumer"`
 }
 
 type IdentityProvider struct {
@@ -73,14 +96,28 @@ type IdentityProvider struct {
 
 	TimeFormat string
 	Expiration time.Duration
+
+	assertionPolicy         AssertionPolicy
+	clientCertificateHeader string
+	authzDecisionPolicy     AuthzDecisionPolicy
+	ecpAuthenticator        ECPAuthenticator
+	proxyDiscovery          ProxyDiscovery
+	// httpClient is used for the requests of the identity provider to the service providers
+	httpClient *http.Client
+	// responseSigningKey is used instead of the key of the storage, see WithSigningKeys
+	responseSigningKey *key.CertificateAndKey
 }
 
 type Endpoints struct {
-	certificateEndpoint  Endpoint
-	callbackEndpoint     Endpoint
-	singleSignOnEndpoint Endpoint
-	singleLogoutEndpoint Endpoint
-	attributeEndpoint    Endpoint
+	certificateEndpoint       Endpoint
+	callbackEndpoint          Endpoint
+	singleSignOnEndpoint      Endpoint
+	singleLogoutEndpoint      Endpoint
+	attributeEndpoint         Endpoint
+	assertionQueryEndpoint    Endpoint
+	nameIDMappingEndpoint     Endpoint
+	manageNameIDEndpoint      Endpoint
+	assertionConsumerEndpoint Endpoint
 }
 
 func NewIdentityProvider(metadata Endpoint, conf *IdentityProviderConfig, storage IDPStorage) (_ *IdentityProvider, err error) {
@@ -93,6 +130,7 @@ func NewIdentityProvider(metadata Endpoint, conf *IdentityProviderConfig, storag
 		endpoints:        endpointConfigToEndpoints(conf.Endpoints),
 		TimeFormat:       DefaultTimeFormat,
 		Expiration:       DefaultExpiration,
+		httpClient:       http.DefaultClient,
 	}
 
 	if conf.PostTemplate == nil {
@@ -125,11 +163,15 @@ func (p *IdentityProvider) GetEntityID(ctx context.Context) string {
 
 func endpointConfigToEndpoints(conf *EndpointConfig) *Endpoints {
 	endpoints := &Endpoints{
-		certificateEndpoint:  NewEndpoint(DefaultCertificateEndpoint),
-		callbackEndpoint:     NewEndpoint(DefaultCallbackEndpoint),
-		singleSignOnEndpoint: NewEndpoint(DefaultSingleSignOnEndpoint),
-		singleLogoutEndpoint: NewEndpoint(DefaultSingleLogOutEndpoint),
-		attributeEndpoint:    NewEndpoint(DefaultAttributeEndpoint),
+		certificateEndpoint:       NewEndpoint(DefaultCertificateEndpoint),
+		callbackEndpoint:          NewEndpoint(DefaultCallbackEndpoint),
+		singleSignOnEndpoint:      NewEndpoint(DefaultSingleSignOnEndpoint),
+		singleLogoutEndpoint:      NewEndpoint(DefaultSingleLogOutEndpoint),
+		attributeEndpoint:         NewEndpoint(DefaultAttributeEndpoint),
+		assertionQueryEndpoint:    NewEndpoint(DefaultAssertionEndpoint),
+		nameIDMappingEndpoint:     NewEndpoint(DefaultNameIDMappingEndpoint),
+		manageNameIDEndpoint:      NewEndpoint(DefaultManageNameIDEndpoint),
+		assertionConsumerEndpoint: NewEndpoint(DefaultAssertionConsumerEndpoint),
 	}
 
 	if conf != nil {
@@ -152,32 +194,126 @@ func endpointConfigToEndpoints(conf *EndpointConfig) *Endpoints {
 		if conf.Attribute != nil {
 			endpoints.attributeEndpoint = *conf.Attribute
 		}
+
+		if conf.AssertionQuery != nil {
+			endpoints.assertionQueryEndpoint = *conf.AssertionQuery
+		}
+
+		if conf.NameIDMapping != nil {
+			endpoints.nameIDMappingEndpoint = *conf.NameIDMapping
+		}
+
+		if conf.ManageNameID != nil {
+			endpoints.manageNameIDEndpoint = *conf.ManageNameID
+		}
+
+		if conf.AssertionConsumer != nil {
+			endpoints.assertionConsumerEndpoint = *conf.AssertionConsumer
+		}
 	}
 	return endpoints
 }
 
 func (p *IdentityProvider) GetMetadata(ctx context.Context) (*md.IDPSSODescriptorType, *md.AttributeAuthorityDescriptorType, error) {
-	cert, _, err := getResponseCert(ctx, p.storage)
+	cert, _, err := p.getResponseCert(ctx)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	metadata, aaMetadata := p.conf.getMetadata(p.GetEntityID(ctx), IssuerFromContext(ctx), cert, p.TimeFormat)
+	if _, ok := p.storage.(AssertionStorage); ok {
+		metadata.AssertionIDRequestService = p.conf.assertionQueryServices(IssuerFromContext(ctx))
+		aaMetadata.AssertionIDRequestService = p.conf.assertionQueryServices(IssuerFromContext(ctx))
+	}
+	if _, ok := p.storage.(NameIDMappingStorage); ok {
+		metadata.NameIDMappingService = []md.EndpointType{{
+			Binding:  SOAPBinding,
+			Location: p.endpoints.nameIDMappingEndpoint.Absolute(IssuerFromContext(ctx)),
+		}}
+	}
+	if p.ecpAuthenticator != nil {
+		metadata.SingleSignOnService = append(metadata.SingleSignOnService, md.EndpointType{
+			Binding:  SOAPBinding,
+			Location: p.endpoints.singleSignOnEndpoint.Absolute(IssuerFromContext(ctx)),
+		})
+	}
+	if _, ok := p.storage.(ManageNameIDStorage); ok {
+		location := p.endpoints.manageNameIDEndpoint.Absolute(IssuerFromContext(ctx))
+		metadata.ManageNameIDService = []md.EndpointType{
+			{Binding: SOAPBinding, Location: location},
+			{Binding: RedirectBinding, Location: location},
+			{Binding: PostBinding, Location: location},
+		}
+	}
 	return metadata, aaMetadata, nil
 }
 
+// GetAuthorityMetadata returns the descriptors of the AuthnQueryService, if the storage implements the AuthnQueryStorage,
+// and of the AuthzService, if an AuthzDecisionPolicy is set
+func (p *IdentityProvider) GetAuthorityMetadata(ctx context.Context) (*md.AuthnAuthorityDescriptorType, *md.PDPDescriptorType, error) {
+	_, authnQuery := p.storage.(AuthnQueryStorage)
+	if !authnQuery && p.authzDecisionPolicy == nil {
+		return nil, nil, nil
+	}
+	cert, _, err := p.getResponseCert(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var authnAuthorityMetadata *md.AuthnAuthorityDescriptorType
+	if authnQuery {
+		authnAuthorityMetadata = p.conf.getAuthnAuthorityMetadata(p.GetEntityID(ctx), IssuerFromContext(ctx), cert, p.TimeFormat)
+		if _, ok := p.storage.(AssertionStorage); ok {
+			authnAuthorityMetadata.AssertionIDRequestService = p.conf.assertionQueryServices(IssuerFromContext(ctx))
+		}
+	}
+	var pdpMetadata *md.PDPDescriptorType
+	if p.authzDecisionPolicy != nil {
+		pdpMetadata = p.conf.getPDPMetadata(p.GetEntityID(ctx), IssuerFromContext(ctx), cert, p.TimeFormat)
+	}
+	return authnAuthorityMetadata, pdpMetadata, nil
+}
+
+// GetProxyMetadata returns the descriptor of the service provider used in the proxy mode,
+// if the storage implements the ProxyStorage
+func (p *IdentityProvider) GetProxyMetadata(ctx context.Context) (*md.SPSSODescriptorType, error) {
+	if _, ok := p.storage.(ProxyStorage); !ok {
+		return nil, nil
+	}
+	cert, _, err := p.getResponseCert(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return p.conf.getProxyMetadata(p.GetEntityID(ctx), IssuerFromContext(ctx), cert, p.TimeFormat), nil
+}
+
+// Route describes an endpoint, so that it can be mounted on any router, e.g. http.ServeMux, chi or echo
 type Route struct {
-	Endpoint   string
+	// Name of the endpoint, e.g. SingleSignOn as in the EndpointConfig
+	Name     string
+	Endpoint string
+	// Prefix routes serve all paths below the Endpoint, e.g. the entities of the metadata query protocol
+	Prefix bool
+	// Methods are the allowed HTTP methods, all methods are allowed if empty
+	Methods []string
+	// Bindings are the SAML bindings served by the endpoint, e.g. RedirectBinding
+	Bindings   []string
 	HandleFunc http.HandlerFunc
 }
 
 func (p *IdentityProvider) GetRoutes() []*Route {
+	getPost := []string{http.MethodGet, http.MethodPost}
+	post := []string{http.MethodPost}
 	return []*Route{
-		{p.endpoints.certificateEndpoint.Relative(), p.certificateHandleFunc},
-		{p.endpoints.callbackEndpoint.Relative(), p.callbackHandleFunc},
-		{p.endpoints.singleSignOnEndpoint.Relative(), p.ssoHandleFunc},
-		{p.endpoints.singleLogoutEndpoint.Relative(), p.logoutHandleFunc},
-		{p.endpoints.attributeEndpoint.Relative(), p.attributeQueryHandleFunc},
+		{Name: "Certificate", Endpoint: p.endpoints.certificateEndpoint.Relative(), Methods: []string{http.MethodGet}, HandleFunc: p.certificateHandleFunc},
+		{Name: "Callback", Endpoint: p.endpoints.callbackEndpoint.Relative(), Methods: getPost, HandleFunc: p.callbackHandleFunc},
+		{Name: "SingleSignOn", Endpoint: p.endpoints.singleSignOnEndpoint.Relative(), Methods: getPost, Bindings: []string{RedirectBinding, PostBinding, PAOSBinding}, HandleFunc: p.ssoHandleFunc},
+		{Name: "SingleLogOut", Endpoint: p.endpoints.singleLogoutEndpoint.Relative(), Methods: getPost, Bindings: []string{RedirectBinding, PostBinding}, HandleFunc: p.logoutHandleFunc},
+		{Name: "Attribute", Endpoint: p.endpoints.attributeEndpoint.Relative(), Methods: post, Bindings: []string{SOAPBinding}, HandleFunc: p.attributeQueryHandleFunc},
+		{Name: "AssertionQuery", Endpoint: p.endpoints.assertionQueryEndpoint.Relative(), Methods: post, Bindings: []string{SOAPBinding}, HandleFunc: p.assertionQueryHandleFunc},
+		{Name: "NameIDMapping", Endpoint: p.endpoints.nameIDMappingEndpoint.Relative(), Methods: post, Bindings: []string{SOAPBinding}, HandleFunc: p.nameIDMappingHandleFunc},
+		{Name: "ManageNameID", Endpoint: p.endpoints.manageNameIDEndpoint.Relative(), Methods: getPost, Bindings: []string{SOAPBinding, RedirectBinding, PostBinding}, HandleFunc: p.manageNameIDHandleFunc},
+		{Name: "AssertionConsumer", Endpoint: p.endpoints.assertionConsumerEndpoint.Relative(), Methods: post, Bindings: []string{PostBinding}, HandleFunc: p.proxyAssertionConsumerHandleFunc},
 	}
 }
 
@@ -219,8 +355,18 @@ func verifyRequestDestinationOfAttrQuery(metadata *md.IDPSSODescriptorType, requ
 	return nil
 }
 
-func getResponseCert(ctx context.Context, storage IdentityProviderStorage) ([]byte, *rsa.PrivateKey, error) {
-	certAndKey, err := storage.GetResponseSigningKey(ctx)
+// getResponseCert returns the response signing key of the tenant, else the configured one, else the one of the storage
+func (p *IdentityProvider) getResponseCert(ctx context.Context) ([]byte, *rsa.PrivateKey, error) {
+	if tenant := TenantFromContext(ctx); tenant != nil && tenant.ResponseSigningKey != nil {
+		return checkResponseCert(tenant.ResponseSigningKey, nil)
+	}
+	if p.responseSigningKey != nil {
+		return checkResponseCert(p.responseSigningKey, nil)
+	}
+	return checkResponseCert(p.storage.GetResponseSigningKey(ctx))
+}
+
+func checkResponseCert(certAndKey *key.CertificateAndKey, err error) ([]byte, *rsa.PrivateKey, error) {
 	if err != nil {
 		return nil, nil, err
 	}
@@ -243,7 +389,7 @@ func getResponseCert(ctx context.Context, storage IdentityProviderStorage) ([]by
 }
 
 func (i *IdentityProvider) certificateHandleFunc(w http.ResponseWriter, r *http.Request) {
-	cert, _, err := getResponseCert(r.Context(), i.storage)
+	cert, _, err := i.getResponseCert(r.Context())
 	if err != nil {
 		http.Error(w, fmt.Errorf("failed to read certificate: %w", err).Error(), http.StatusInternalServerError)
 		return
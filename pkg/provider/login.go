@@ -5,10 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/zitadel/logging"
 
+	"github.com/zitadel/saml/pkg/provider/attribute"
 	"github.com/zitadel/saml/pkg/provider/models"
+	"github.com/zitadel/saml/pkg/provider/serviceprovider"
+	"github.com/zitadel/saml/pkg/provider/xml/md"
 	"github.com/zitadel/saml/pkg/provider/xml/samlp"
 )
 
@@ -18,8 +22,14 @@ func (p *IdentityProvider) callbackHandleFunc(w http.ResponseWriter, r *http.Req
 		ErrorFunc: func(err error) {
 			http.Error(w, fmt.Errorf("failed to send response: %w", err).Error(), http.StatusInternalServerError)
 		},
-		Issuer: p.GetEntityID(r.Context()),
+		Issuer:        p.GetEntityID(r.Context()),
+		ClientAddress: ClientAddressFromRequest(r),
 	}
+	clientCert, err := ClientCertificateFromRequest(r, p.clientCertificateHeader)
+	if err != nil {
+		logging.Error(err)
+	}
+	response.ClientCertificate = clientCert
 
 	if err := r.ParseForm(); err != nil {
 		logging.Error(err)
@@ -70,13 +80,56 @@ func (p *IdentityProvider) loginResponse(ctx context.Context, authRequest models
 		return nil, errors.New(StatusCodeAuthNFailed)
 	}
 
-	attrs := &Attributes{}
-	if err := p.storage.SetUserinfoWithUserID(ctx, authRequest.GetApplicationID(), attrs, authRequest.GetUserID(), []int{}); err != nil {
+	sp, err := p.serviceProviderOfResponse(ctx, response.Audience)
+	if err != nil {
+		logging.Error(err)
+		return nil, errors.New(StatusCodeRequestDenied)
+	}
+	requested := requestedAttributes(sp, authRequest)
+
+	response.assertionConfig, err = p.assertionConfig(ctx, sp, authRequest)
+	if err != nil {
+		logging.Error(err)
+		return nil, errors.New(StatusCodeRequestDenied)
+	}
+	if response.assertionConfig.HolderOfKey && response.ClientCertificate == nil {
+		logging.Error("no client certificate for holder-of-key subject confirmation")
+		return nil, errors.New(StatusCodeRequestDenied)
+	}
+
+	response.session, err = p.session(ctx, authRequest)
+	if err != nil {
+		logging.Error(err)
+		return nil, errors.New(StatusCodeAuthNFailed)
+	}
+	if response.session != nil && response.session.ID != "" {
+		response.sessionIndex = p.SessionIndex(response.session.ID, response.Audience)
+	}
+	if getter, ok := authRequest.(models.AuthenticatingAuthorityGetter); ok {
+		response.authenticatingAuthority = getter.GetAuthenticatingAuthority()
+	}
+	if getter, ok := authRequest.(models.ProxyRestrictionGetter); ok {
+		response.proxyRestriction = getter.GetProxyRestriction()
+	}
+
+	attrs := &Attributes{profile: p.attributeProfile(sp)}
+	if err := p.storage.SetUserinfoWithUserID(ctx, authRequest.GetApplicationID(), attrs, authRequest.GetUserID(), requestedAttributeIDs(attrs.profile, requested)); err != nil {
 		logging.Error(err)
 		return nil, errors.New(StatusCodeInvalidAttrNameOrValue)
 	}
+	if err := attrs.setRequestedAttributes(requested); err != nil {
+		logging.Error(err)
+		return nil, errors.New(StatusCodeInvalidAttrNameOrValue)
+	}
+	if manageStorage, ok := p.storage.(ManageNameIDStorage); ok {
+		attrs.spProvidedID, err = manageStorage.GetSPProvidedID(ctx, response.Audience, authRequest.GetUserID())
+		if err != nil {
+			logging.Error(err)
+			return nil, errors.New(StatusCodeResponder)
+		}
+	}
 
-	cert, key, err := getResponseCert(ctx, p.storage)
+	cert, key, err := p.getResponseCert(ctx)
 	if err != nil {
 		logging.Error(err)
 		return nil, errors.New(StatusCodeInvalidAttrNameOrValue)
@@ -87,9 +140,60 @@ func (p *IdentityProvider) loginResponse(ctx context.Context, authRequest models
 		logging.Error(err)
 		return nil, errors.New(StatusCodeResponder)
 	}
+	if assertionStorage, ok := p.storage.(AssertionStorage); ok {
+		if err := assertionStorage.StoreAssertion(ctx, response.Audience, samlResponse.Assertion); err != nil {
+			logging.Error(err)
+			return nil, errors.New(StatusCodeResponder)
+		}
+	}
 	return samlResponse, nil
 }
 
 func (p *IdentityProvider) errorResponse(response *Response, reason string, description string) *samlp.ResponseType {
 	return response.makeFailedResponse(reason, description, p.TimeFormat)
 }
+
+// serviceProviderOfResponse returns the service provider the response is issued to, nil if it is unknown
+func (p *IdentityProvider) serviceProviderOfResponse(ctx context.Context, entityID string) (*serviceprovider.ServiceProvider, error) {
+	if entityID == "" {
+		return nil, nil
+	}
+	sp, err := p.GetServiceProvider(ctx, entityID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get serviceprovider: %w", err)
+	}
+	return sp, nil
+}
+
+// attributeProfile returns the attribute profile of the service provider, or else the one configured for the identity provider
+func (p *IdentityProvider) attributeProfile(sp *serviceprovider.ServiceProvider) *attribute.Profile {
+	if sp != nil && sp.AttributeProfile != nil {
+		return sp.AttributeProfile
+	}
+	if p.conf.AttributeProfile != nil {
+		return p.conf.AttributeProfile
+	}
+	return attribute.BasicProfile
+}
+
+// requestedAttributes returns the attributes requested in the AttributeConsumingService of the service provider,
+// selected by the AttributeConsumingServiceIndex of the request or else the default one.
+// No requested attributes means that all attributes are released.
+func requestedAttributes(sp *serviceprovider.ServiceProvider, authRequest models.AuthRequestInt) []md.RequestedAttributeType {
+	if sp == nil {
+		return nil
+	}
+
+	var index *int
+	if getter, ok := authRequest.(models.AttributeConsumingServiceIndexGetter); ok {
+		if i, err := strconv.Atoi(getter.GetAttributeConsumingServiceIndex()); err == nil {
+			index = &i
+		}
+	}
+
+	service := sp.AttributeConsumingService(index)
+	if service == nil {
+		return nil
+	}
+	return service.RequestedAttribute
+}
@@ -90,7 +90,7 @@ func (p *IdentityProvider) logoutHandleFunc(w http.ResponseWriter, r *http.Reque
 	// get logoutURL from provided service provider metadata
 	checkerInstance.WithValueStep(
 		func() {
-			if sp.Metadata.SPSSODescriptor.SingleLogoutService != nil {
+			if sp.Metadata != nil && sp.Metadata.SPSSODescriptor != nil && sp.Metadata.SPSSODescriptor.SingleLogoutService != nil {
 				for _, url := range sp.Metadata.SPSSODescriptor.SingleLogoutService {
 					response.LogoutURL = url.Location
 					break
@@ -0,0 +1,514 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/zitadel/logging"
+
+	"github.com/zitadel/saml/pkg/provider/checker"
+	"github.com/zitadel/saml/pkg/provider/encryption"
+	"github.com/zitadel/saml/pkg/provider/serviceprovider"
+	"github.com/zitadel/saml/pkg/provider/signature"
+	saml_xml "github.com/zitadel/saml/pkg/provider/xml"
+	"github.com/zitadel/saml/pkg/provider/xml/md"
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
+	"github.com/zitadel/saml/pkg/provider/xml/samlp"
+	"github.com/zitadel/saml/pkg/provider/xml/soap"
+	"github.com/zitadel/saml/pkg/provider/xml/xml_dsig"
+)
+
+// maxNewIDLength is the maximum length of a NewID defined by the specification
+const maxNewIDLength = 256
+
+type ManageNameIDRequestForm struct {
+	ManageNameIDRequest string
+	Encoding            string
+	RelayState          string
+	SigAlg              string
+	Sig                 string
+	Binding             string
+}
+
+func (p *IdentityProvider) manageNameIDHandleFunc(w http.ResponseWriter, r *http.Request) {
+	checkerInstance := checker.Checker{}
+	var requestForm *ManageNameIDRequestForm
+	var err error
+	var sp *serviceprovider.ServiceProvider
+	var request *samlp.ManageNameIDRequestType
+	var response *samlp.ManageNameIDResponseType
+	var cert []byte
+	var key *rsa.PrivateKey
+
+	// parse request depending on the binding
+	checkerInstance.WithLogicStep(
+		func() error {
+			requestForm, err = getManageNameIDRequestFromRequest(r)
+			return err
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to parse request: %w", err).Error(), http.StatusBadRequest)
+		},
+	)
+
+	// decode request from xml into golang struct
+	checkerInstance.WithLogicStep(
+		func() error {
+			if requestForm.Binding == SOAPBinding {
+				request, err = saml_xml.DecodeManageNameIDRequestEnvelope(requestForm.ManageNameIDRequest)
+			} else {
+				request, err = saml_xml.DecodeManageNameIDRequest(requestForm.Encoding, requestForm.ManageNameIDRequest)
+			}
+			if err != nil {
+				return err
+			}
+			if request == nil || request.Issuer == nil || request.Issuer.Text == "" {
+				err = fmt.Errorf("no ManageNameIDRequest with issuer in request")
+			}
+			return err
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to decode request: %w", err).Error(), http.StatusBadRequest)
+		},
+	)
+
+	// get persisted service provider from issuer out of the request
+	checkerInstance.WithLogicStep(
+		func() error {
+			sp, err = p.GetServiceProvider(r.Context(), request.Issuer.Text)
+			if err != nil {
+				return err
+			}
+			if sp == nil {
+				err = fmt.Errorf("unknown service provider %s", request.Issuer.Text)
+			}
+			return err
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to find registered serviceprovider: %w", err).Error(), http.StatusInternalServerError)
+		},
+	)
+
+	//validate used certificate for signing the request
+	checkerInstance.WithConditionalLogicStep(
+		certificateCheckNecessary(
+			func() *xml_dsig.SignatureType { return request.Signature },
+			func() *md.EntityDescriptorType { return sp.Metadata },
+		),
+		checkCertificate(
+			func() *xml_dsig.SignatureType { return request.Signature },
+			func() *md.EntityDescriptorType { return sp.Metadata },
+		),
+		func() {
+			http.Error(w, fmt.Errorf("failed to validate certificate from request: %w", err).Error(), http.StatusInternalServerError)
+		},
+	)
+
+	// verify the signature of the request inside the SOAP envelope, unsigned requests are denied with the response
+	checkerInstance.WithConditionalLogicStep(
+		func() bool {
+			return requestForm.Binding == SOAPBinding && signaturePostProvided(func() *xml_dsig.SignatureType { return request.Signature })()
+		},
+		func() error {
+			err = sp.ValidateSOAPSignature(requestForm.ManageNameIDRequest)
+			return err
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to verify signature of request: %w", err).Error(), http.StatusInternalServerError)
+		},
+	)
+
+	// verify the signature of the request with the redirect binding, which is required for the front channel
+	checkerInstance.WithConditionalLogicStep(
+		func() bool { return requestForm.Binding == RedirectBinding },
+		verifyRedirectSignature(
+			func() string { return requestForm.ManageNameIDRequest },
+			func() string { return requestForm.RelayState },
+			func() string { return requestForm.Sig },
+			func() string { return requestForm.SigAlg },
+			func() *serviceprovider.ServiceProvider { return sp },
+			func(e error) { err = e },
+		),
+		func() {
+			http.Error(w, fmt.Errorf("failed to verify signature of request: %w", err).Error(), http.StatusInternalServerError)
+		},
+	)
+
+	// verify the signature of the request with the post binding, which is required for the front channel
+	checkerInstance.WithConditionalLogicStep(
+		func() bool { return requestForm.Binding == PostBinding },
+		verifyPostSignature(
+			func() string { return requestForm.ManageNameIDRequest },
+			func() *serviceprovider.ServiceProvider { return sp },
+			func(e error) { err = e },
+		),
+		func() {
+			http.Error(w, fmt.Errorf("failed to verify signature of request: %w", err).Error(), http.StatusInternalServerError)
+		},
+	)
+
+	// verify that destination in request is this IDP
+	checkerInstance.WithLogicStep(
+		func() error {
+			if request.Destination != "" && request.Destination != p.endpoints.manageNameIDEndpoint.Absolute(IssuerFromContext(r.Context())) {
+				err = fmt.Errorf("destination of request is unknown")
+			}
+			return err
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to verify request destination: %w", err).Error(), http.StatusInternalServerError)
+		},
+	)
+
+	// change or terminate the identifier
+	checkerInstance.WithLogicStep(
+		func() error {
+			cert, key, err = p.getResponseCert(r.Context())
+			if err != nil {
+				return err
+			}
+			// the issuer of a SOAP request is only authenticated by its signature
+			if requestForm.Binding == SOAPBinding && request.Signature == nil {
+				response = p.makeManageNameIDResponse(r.Context(), request.Id, StatusCodeRequestDenied, "request is not signed")
+				return nil
+			}
+			response, err = p.manageNameIDResponse(r.Context(), sp, request, key)
+			return err
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to manage identifier: %w", err).Error(), http.StatusInternalServerError)
+		},
+	)
+
+	//check and log errors if necessary
+	if checkerInstance.CheckFailed() {
+		return
+	}
+
+	if requestForm.Binding != SOAPBinding {
+		p.sendManageNameIDResponse(w, r, sp, requestForm, response, cert, key)
+		return
+	}
+
+	signer, err := signature.GetSigner(cert, key, p.conf.SignatureAlgorithm)
+	if err != nil {
+		logging.Error(err)
+		http.Error(w, fmt.Errorf("failed to sign response: %w", err).Error(), http.StatusInternalServerError)
+		return
+	}
+	response.Signature, err = signature.Create(signer, response)
+	if err != nil {
+		logging.Error(err)
+		http.Error(w, fmt.Errorf("failed to sign response: %w", err).Error(), http.StatusInternalServerError)
+		return
+	}
+
+	soapResponse := &soap.ManageNameIDResponseEnvelope{
+		Body: soap.ManageNameIDResponseBody{
+			ManageNameIDResponse: response,
+		},
+	}
+	if err := saml_xml.WriteXMLMarshalled(w, soapResponse); err != nil {
+		logging.Error(err)
+		http.Error(w, fmt.Errorf("failed to send response: %w", err).Error(), http.StatusInternalServerError)
+	}
+}
+
+// getManageNameIDRequestFromRequest reads the request of the Redirect, POST or else the SOAP binding
+func getManageNameIDRequestFromRequest(r *http.Request) (*ManageNameIDRequestForm, error) {
+	if _, ok := r.URL.Query()["SAMLRequest"]; ok {
+		query := r.URL.Query()
+		request := &ManageNameIDRequestForm{
+			ManageNameIDRequest: query.Get("SAMLRequest"),
+			Encoding:            query.Get("SAMLEncoding"),
+			RelayState:          query.Get("RelayState"),
+			SigAlg:              query.Get("SigAlg"),
+			Sig:                 query.Get("Signature"),
+			Binding:             RedirectBinding,
+		}
+		if request.Encoding == "" {
+			request.Encoding = saml_xml.EncodingDeflate
+		}
+		return request, nil
+	}
+
+	// a SOAP body is not parsed as form and stays readable
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	if samlRequest := r.PostForm.Get("SAMLRequest"); samlRequest != "" {
+		return &ManageNameIDRequestForm{
+			ManageNameIDRequest: samlRequest,
+			Encoding:            r.PostForm.Get("SAMLEncoding"),
+			RelayState:          r.PostForm.Get("RelayState"),
+			Binding:             PostBinding,
+		}, nil
+	}
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &ManageNameIDRequestForm{
+		ManageNameIDRequest: string(b),
+		Binding:             SOAPBinding,
+	}, nil
+}
+
+// manageNameIDResponse registers the NewID of the service provider for the user or terminates their federation
+func (p *IdentityProvider) manageNameIDResponse(
+	ctx context.Context,
+	sp *serviceprovider.ServiceProvider,
+	request *samlp.ManageNameIDRequestType,
+	key *rsa.PrivateKey,
+) (*samlp.ManageNameIDResponseType, error) {
+	manageStorage, ok := p.storage.(ManageNameIDStorage)
+	if !ok {
+		return p.makeManageNameIDResponse(ctx, request.Id, StatusCodeRequestUnsupported, "ManageNameID is not supported"), nil
+	}
+	nameID, err := requestedNameID(request.NameID, request.EncryptedID, key)
+	if err != nil {
+		return p.makeManageNameIDResponse(ctx, request.Id, StatusCodeRequester, err.Error()), nil
+	}
+
+	var found bool
+	if request.Terminate != nil {
+		if request.NewID != "" || request.NewEncryptedID != nil {
+			return p.makeManageNameIDResponse(ctx, request.Id, StatusCodeRequester, "Terminate and NewID in request"), nil
+		}
+		found, err = manageStorage.TerminateNameID(ctx, sp.GetEntityID(), nameID)
+	} else {
+		newID, idErr := requestedNewID(request, key)
+		if idErr != nil {
+			return p.makeManageNameIDResponse(ctx, request.Id, StatusCodeRequester, idErr.Error()), nil
+		}
+		found, err = manageStorage.ChangeNameID(ctx, sp.GetEntityID(), nameID, newID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return p.makeManageNameIDResponse(ctx, request.Id, StatusCodeUnknownPrincipal, "unknown user"), nil
+	}
+	return p.makeManageNameIDResponse(ctx, request.Id, StatusCodeSuccess, ""), nil
+}
+
+// requestedNewID returns the NewID of the request, which is decrypted with the key of the identity provider if encrypted
+func requestedNewID(request *samlp.ManageNameIDRequestType, key *rsa.PrivateKey) (string, error) {
+	newID := request.NewID
+	if request.NewEncryptedID != nil {
+		if newID != "" {
+			return "", fmt.Errorf("NewID and NewEncryptedID in request")
+		}
+		data, err := encryption.Decrypt(request.NewEncryptedID, key)
+		if err != nil {
+			logging.Error(fmt.Errorf("failed to decrypt NewEncryptedID: %w", err))
+			return "", errDecryptIdentifier
+		}
+		decrypted := struct {
+			Text string `xml:",chardata"`
+		}{}
+		if err := xml.Unmarshal(data, &decrypted); err != nil {
+			logging.Error(fmt.Errorf("failed to decode NewEncryptedID: %w", err))
+			return "", errDecryptIdentifier
+		}
+		newID = decrypted.Text
+	}
+	if newID == "" {
+		return "", fmt.Errorf("no NewID, NewEncryptedID or Terminate in request")
+	}
+	if len(newID) > maxNewIDLength {
+		return "", fmt.Errorf("NewID exceeds %d characters", maxNewIDLength)
+	}
+	return newID, nil
+}
+
+// sendManageNameIDResponse sends the response to the ManageNameIDService of the service provider with the binding of the request
+func (p *IdentityProvider) sendManageNameIDResponse(
+	w http.ResponseWriter,
+	r *http.Request,
+	sp *serviceprovider.ServiceProvider,
+	requestForm *ManageNameIDRequestForm,
+	response *samlp.ManageNameIDResponseType,
+	cert []byte,
+	key *rsa.PrivateKey,
+) {
+	location := manageNameIDServiceLocation(sp, requestForm.Binding, true)
+	if location == "" {
+		err := fmt.Errorf("no ManageNameIDService of service provider for binding %s", requestForm.Binding)
+		logging.Error(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	response.Destination = location
+
+	switch requestForm.Binding {
+	case PostBinding:
+		signer, err := signature.GetSigner(cert, key, p.conf.SignatureAlgorithm)
+		if err != nil {
+			logging.Error(err)
+			http.Error(w, fmt.Errorf("failed to sign response: %w", err).Error(), http.StatusInternalServerError)
+			return
+		}
+		response.Signature, err = signature.Create(signer, response)
+		if err != nil {
+			logging.Error(err)
+			http.Error(w, fmt.Errorf("failed to sign response: %w", err).Error(), http.StatusInternalServerError)
+			return
+		}
+		respData, err := saml_xml.Marshal(response)
+		if err != nil {
+			logging.Error(err)
+			http.Error(w, fmt.Errorf("failed to send response: %w", err).Error(), http.StatusInternalServerError)
+			return
+		}
+		data := authResponseForm{
+			requestForm.RelayState,
+			base64.StdEncoding.EncodeToString(respData),
+			location,
+		}
+		if err := p.postTemplate.Execute(w, data); err != nil {
+			logging.Error(err)
+			http.Error(w, fmt.Errorf("failed to send response: %w", err).Error(), http.StatusInternalServerError)
+		}
+	case RedirectBinding:
+		sig, sigAlg, err := createRedirectSignature(response, key, cert, p.conf.SignatureAlgorithm, requestForm.RelayState)
+		if err != nil {
+			logging.Error(err)
+			http.Error(w, fmt.Errorf("failed to sign response: %w", err).Error(), http.StatusInternalServerError)
+			return
+		}
+		resp, err := saml_xml.Marshal(response)
+		if err != nil {
+			logging.Error(err)
+			http.Error(w, fmt.Errorf("failed to send response: %w", err).Error(), http.StatusInternalServerError)
+			return
+		}
+		respData, err := saml_xml.DeflateAndBase64(resp)
+		if err != nil {
+			logging.Error(err)
+			http.Error(w, fmt.Errorf("failed to send response: %w", err).Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("%s?%s", location, BuildRedirectQuery(string(respData), requestForm.RelayState, sigAlg, sig)), http.StatusFound)
+	}
+}
+
+// manageNameIDServiceLocation returns the location of the ManageNameIDService of the service provider with the binding,
+// the ResponseLocation is preferred for responses if set
+func manageNameIDServiceLocation(sp *serviceprovider.ServiceProvider, binding string, response bool) string {
+	if sp.Metadata == nil || sp.Metadata.SPSSODescriptor == nil {
+		return ""
+	}
+	for _, service := range sp.Metadata.SPSSODescriptor.ManageNameIDService {
+		if service.Binding != binding {
+			continue
+		}
+		if response && service.ResponseLocation != "" {
+			return service.ResponseLocation
+		}
+		return service.Location
+	}
+	return ""
+}
+
+// TerminateNameID notifies the service provider with a ManageNameIDRequest over SOAP,
+// that the federation of the user identified by the nameID is terminated by the identity provider.
+// The context has to contain the issuer, see ContextWithIssuer.
+func (p *IdentityProvider) TerminateNameID(ctx context.Context, entityID string, nameID *saml.NameIDType) error {
+	sp, err := p.GetServiceProvider(ctx, entityID)
+	if err != nil {
+		return err
+	}
+	if sp == nil {
+		return fmt.Errorf("unknown service provider %s", entityID)
+	}
+	location := manageNameIDServiceLocation(sp, SOAPBinding, false)
+	if location == "" {
+		return fmt.Errorf("no ManageNameIDService of service provider %s for binding %s", entityID, SOAPBinding)
+	}
+
+	cert, key, err := p.getResponseCert(ctx)
+	if err != nil {
+		return err
+	}
+	request := &samlp.ManageNameIDRequestType{
+		Id:           NewID(),
+		Version:      "2.0",
+		IssueInstant: time.Now().UTC().Format(p.TimeFormat),
+		Destination:  location,
+		Issuer:       getIssuer(p.GetEntityID(ctx)),
+		NameID:       nameID,
+		Terminate:    &samlp.TerminateType{},
+	}
+	signer, err := signature.GetSigner(cert, key, p.conf.SignatureAlgorithm)
+	if err != nil {
+		return err
+	}
+	request.Signature, err = signature.Create(signer, request)
+	if err != nil {
+		return err
+	}
+
+	body, err := saml_xml.Marshal(&soap.ManageNameIDRequestEnvelope{
+		Body: soap.ManageNameIDRequestBody{
+			ManageNameIDRequest: request,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, location, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpRequest.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	httpRequest.Header.Set("SOAPAction", "http://www.oasis-open.org/committees/security")
+
+	httpResponse, err := p.httpClient.Do(httpRequest)
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close()
+	if httpResponse.StatusCode != http.StatusOK {
+		return fmt.Errorf("ManageNameIDService of service provider %s responded with status %d", entityID, httpResponse.StatusCode)
+	}
+	b, err := io.ReadAll(httpResponse.Body)
+	if err != nil {
+		return err
+	}
+	response, err := saml_xml.DecodeManageNameIDResponseEnvelope(string(b))
+	if err != nil {
+		return err
+	}
+	if response == nil || response.InResponseTo != request.Id {
+		return fmt.Errorf("no ManageNameIDResponse to the request from service provider %s", entityID)
+	}
+	if response.Status.StatusCode.Value != StatusCodeSuccess {
+		return fmt.Errorf("service provider %s failed to terminate identifier: %s %s", entityID, response.Status.StatusCode.Value, response.Status.StatusMessage)
+	}
+	return nil
+}
+
+func (p *IdentityProvider) makeManageNameIDResponse(ctx context.Context, requestID string, status string, message string) *samlp.ManageNameIDResponseType {
+	return &samlp.ManageNameIDResponseType{
+		Version:      "2.0",
+		Id:           NewID(),
+		IssueInstant: time.Now().UTC().Format(p.TimeFormat),
+		InResponseTo: requestID,
+		Issuer:       getIssuer(p.GetEntityID(ctx)),
+		Status: samlp.StatusType{
+			StatusCode: samlp.StatusCodeType{
+				Value: status,
+			},
+			StatusMessage: message,
+		},
+	}
+}
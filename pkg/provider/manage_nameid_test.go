@@ -0,0 +1,285 @@
+package provider
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zitadel/saml/pkg/provider/encryption"
+	"github.com/zitadel/saml/pkg/provider/key"
+	"github.com/zitadel/saml/pkg/provider/mock"
+	"github.com/zitadel/saml/pkg/provider/models"
+	"github.com/zitadel/saml/pkg/provider/serviceprovider"
+	saml_xml "github.com/zitadel/saml/pkg/provider/xml"
+	"github.com/zitadel/saml/pkg/provider/xml/md"
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
+	"github.com/zitadel/saml/pkg/provider/xml/samlp"
+	"github.com/zitadel/saml/pkg/provider/xml/soap"
+)
+
+type manageNameIDStorage struct {
+	*mock.MockIDPStorage
+	newIDs     map[string]string
+	terminated map[string]bool
+}
+
+func (s *manageNameIDStorage) ChangeNameID(_ context.Context, entityID string, nameID *saml.NameIDType, newID string) (bool, error) {
+	if nameID.Text == "unknown" {
+		return false, nil
+	}
+	s.newIDs[entityID+nameID.Text] = newID
+	return true, nil
+}
+
+func (s *manageNameIDStorage) TerminateNameID(_ context.Context, entityID string, nameID *saml.NameIDType) (bool, error) {
+	if nameID.Text == "unknown" {
+		return false, nil
+	}
+	s.terminated[entityID+nameID.Text] = true
+	return true, nil
+}
+
+func (s *manageNameIDStorage) GetSPProvidedID(_ context.Context, entityID string, userID string) (string, error) {
+	return s.newIDs[entityID+userID], nil
+}
+
+func TestManageNameID_manageNameIDResponse(t *testing.T) {
+	idpKey, idpCert := newKeyAndCertificate(t)
+	encryptedNewID := func() *saml.EncryptedElementType {
+		encrypted, err := encryption.Encrypt([]byte(`<NewID xmlns="urn:oasis:names:tc:SAML:2.0:protocol">encrypted</NewID>`), idpCert, "")
+		require.NoError(t, err)
+		return encrypted
+	}
+
+	type res struct {
+		status     string
+		newID      string
+		terminated bool
+	}
+	tests := []struct {
+		name    string
+		storage bool
+		request *samlp.ManageNameIDRequestType
+		res     res
+	}{
+		{
+			"no manage storage",
+			false,
+			&samlp.ManageNameIDRequestType{NameID: &saml.NameIDType{Text: "user"}, NewID: "new"},
+			res{status: StatusCodeRequestUnsupported},
+		},
+		{
+			"no identifier",
+			true,
+			&samlp.ManageNameIDRequestType{NewID: "new"},
+			res{status: StatusCodeRequester},
+		},
+		{
+			"no operation",
+			true,
+			&samlp.ManageNameIDRequestType{NameID: &saml.NameIDType{Text: "user"}},
+			res{status: StatusCodeRequester},
+		},
+		{
+			"terminate and new id",
+			true,
+			&samlp.ManageNameIDRequestType{NameID: &saml.NameIDType{Text: "user"}, NewID: "new", Terminate: &samlp.TerminateType{}},
+			res{status: StatusCodeRequester},
+		},
+		{
+			"new id too long",
+			true,
+			&samlp.ManageNameIDRequestType{NameID: &saml.NameIDType{Text: "user"}, NewID: strings.Repeat("a", maxNewIDLength+1)},
+			res{status: StatusCodeRequester},
+		},
+		{
+			"unknown user",
+			true,
+			&samlp.ManageNameIDRequestType{NameID: &saml.NameIDType{Text: "unknown"}, NewID: "new"},
+			res{status: StatusCodeUnknownPrincipal},
+		},
+		{
+			"new id",
+			true,
+			&samlp.ManageNameIDRequestType{NameID: &saml.NameIDType{Text: "user"}, NewID: "new"},
+			res{status: StatusCodeSuccess, newID: "new"},
+		},
+		{
+			"new encrypted id",
+			true,
+			&samlp.ManageNameIDRequestType{NameID: &saml.NameIDType{Text: "user"}, NewEncryptedID: encryptedNewID()},
+			res{status: StatusCodeSuccess, newID: "encrypted"},
+		},
+		{
+			"terminate",
+			true,
+			&samlp.ManageNameIDRequestType{NameID: &saml.NameIDType{Text: "user"}, Terminate: &samlp.TerminateType{}},
+			res{status: StatusCodeSuccess, terminated: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStorage := mock.NewMockIDPStorage(gomock.NewController(t))
+			storage := &manageNameIDStorage{MockIDPStorage: mockStorage, newIDs: map[string]string{}, terminated: map[string]bool{}}
+			var idpStorage IDPStorage = mockStorage
+			if tt.storage {
+				idpStorage = storage
+			}
+			idp, err := newTestIdentityProvider(NewEndpoint("metadata"), &IdentityProviderConfig{}, idpStorage)
+			require.NoError(t, err)
+			sp := &serviceprovider.ServiceProvider{Metadata: &md.EntityDescriptorType{EntityID: "sp"}}
+
+			response, err := idp.manageNameIDResponse(context.Background(), sp, tt.request, idpKey)
+			require.NoError(t, err)
+			assert.Equal(t, tt.res.status, response.Status.StatusCode.Value)
+			assert.Equal(t, tt.res.newID, storage.newIDs["spuser"])
+			assert.Equal(t, tt.res.terminated, storage.terminated["spuser"])
+		})
+	}
+}
+
+func TestManageNameID_TerminateNameID(t *testing.T) {
+	idpKey, idpCert := newKeyAndCertificate(t)
+
+	tests := []struct {
+		name    string
+		status  string
+		binding string
+		wantErr bool
+	}{
+		{"terminated", StatusCodeSuccess, SOAPBinding, false},
+		{"failed", StatusCodeUnknownPrincipal, SOAPBinding, true},
+		{"no SOAP service", StatusCodeSuccess, RedirectBinding, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				envelope := new(soap.ManageNameIDRequestEnvelope)
+				require.NoError(t, xml.Unmarshal(b, envelope))
+				request := envelope.Body.ManageNameIDRequest
+				require.NotNil(t, request)
+				assert.NotNil(t, request.Terminate)
+				assert.NotNil(t, request.Signature)
+				assert.Equal(t, "user", request.NameID.Text)
+
+				require.NoError(t, saml_xml.WriteXMLMarshalled(w, &soap.ManageNameIDResponseEnvelope{
+					Body: soap.ManageNameIDResponseBody{
+						ManageNameIDResponse: &samlp.ManageNameIDResponseType{
+							Id:           NewID(),
+							InResponseTo: request.Id,
+							Version:      "2.0",
+							Status:       samlp.StatusType{StatusCode: samlp.StatusCodeType{Value: tt.status}},
+						},
+					},
+				}))
+			}))
+			defer server.Close()
+
+			mockStorage := mock.NewMockIDPStorage(gomock.NewController(t))
+			mockStorage.EXPECT().GetEntityByID(gomock.Any(), "sp").Return(&serviceprovider.ServiceProvider{Metadata: &md.EntityDescriptorType{
+				EntityID: "sp",
+				SPSSODescriptor: &md.SPSSODescriptorType{
+					ManageNameIDService: []md.EndpointType{{Binding: tt.binding, Location: server.URL}},
+				},
+			}}, nil)
+			mockStorage.EXPECT().GetResponseSigningKey(gomock.Any()).Return(&key.CertificateAndKey{Certificate: idpCert.Raw, Key: idpKey}, nil).MinTimes(0).MaxTimes(1)
+			idp, err := newTestIdentityProvider(NewEndpoint("metadata"), &IdentityProviderConfig{SignatureAlgorithm: dsig.RSASHA256SignatureMethod}, mockStorage)
+			require.NoError(t, err)
+
+			err = idp.TerminateNameID(ContextWithIssuer(context.Background(), "https://idp.example.com"), "sp", &saml.NameIDType{Text: "user"})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestManageNameID_manageNameIDHandleFunc(t *testing.T) {
+	idpKey, idpCert := newKeyAndCertificate(t)
+	mockStorage := mock.NewMockIDPStorage(gomock.NewController(t))
+	mockStorage.EXPECT().GetEntityByID(gomock.Any(), "sp").Return(&serviceprovider.ServiceProvider{
+		Metadata: &md.EntityDescriptorType{EntityID: "sp", SPSSODescriptor: &md.SPSSODescriptorType{}},
+	}, nil)
+	storage := &manageNameIDStorage{MockIDPStorage: mockStorage, newIDs: map[string]string{}, terminated: map[string]bool{}}
+	idp, err := newTestIdentityProvider(NewEndpoint("metadata"), &IdentityProviderConfig{SignatureAlgorithm: dsig.RSASHA256SignatureMethod}, storage)
+	require.NoError(t, err)
+	idp.responseSigningKey = &key.CertificateAndKey{Certificate: idpCert.Raw, Key: idpKey}
+
+	// an unsigned request could change or terminate the identifiers of any service provider
+	body := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+		`<samlp:ManageNameIDRequest xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_request" Version="2.0" IssueInstant="2024-01-01T00:00:00Z">` +
+		`<saml:Issuer>sp</saml:Issuer><saml:NameID>user</saml:NameID><samlp:NewID>new</samlp:NewID>` +
+		`</samlp:ManageNameIDRequest></soap:Body></soap:Envelope>`
+	w := httptest.NewRecorder()
+	idp.manageNameIDHandleFunc(w, httptest.NewRequest(http.MethodPost, "https://idp.example.com/manage", strings.NewReader(body)))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	envelope := new(soap.ManageNameIDResponseEnvelope)
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), envelope))
+	response := envelope.Body.ManageNameIDResponse
+	require.NotNil(t, response)
+	assert.Equal(t, StatusCodeRequestDenied, response.Status.StatusCode.Value)
+	assert.Empty(t, storage.newIDs)
+}
+
+func TestManageNameID_changedIDInAssertion(t *testing.T) {
+	idpKey, idpCert := newKeyAndCertificate(t)
+	mockStorage := mock.NewMockIDPStorage(gomock.NewController(t))
+	mockStorage.EXPECT().GetEntityByID(gomock.Any(), "sp").Return(&serviceprovider.ServiceProvider{
+		Metadata: &md.EntityDescriptorType{EntityID: "sp", SPSSODescriptor: &md.SPSSODescriptorType{}},
+	}, nil).AnyTimes()
+	mockStorage.EXPECT().SetUserinfoWithUserID(gomock.Any(), "app", gomock.Any(), "user", gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ string, attrs models.AttributeSetter, userID string, _ []int) error {
+			attrs.SetUserID(userID)
+			attrs.SetUsername("user@example.com")
+			return nil
+		},
+	).AnyTimes()
+	storage := &manageNameIDStorage{MockIDPStorage: mockStorage, newIDs: map[string]string{}, terminated: map[string]bool{}}
+	idp, err := newTestIdentityProvider(NewEndpoint("metadata"), &IdentityProviderConfig{SignatureAlgorithm: dsig.RSASHA256SignatureMethod}, storage)
+	require.NoError(t, err)
+	idp.responseSigningKey = &key.CertificateAndKey{Certificate: idpCert.Raw, Key: idpKey}
+
+	authRequest := mock.NewMockAuthRequestInt(gomock.NewController(t))
+	authRequest.EXPECT().Done().Return(true).AnyTimes()
+	authRequest.EXPECT().GetApplicationID().Return("app").AnyTimes()
+	authRequest.EXPECT().GetUserID().Return("user").AnyTimes()
+	nameIDOfAssertion := func() *saml.NameIDType {
+		response, err := idp.loginResponse(context.Background(), authRequest, &Response{
+			RequestID: "request",
+			Issuer:    "https://idp.example.com/metadata",
+			Audience:  "sp",
+			AcsUrl:    "https://sp.example.com/acs",
+		})
+		require.NoError(t, err)
+		require.NotNil(t, response.Assertion)
+		return response.Assertion.Subject.NameID
+	}
+
+	nameID := nameIDOfAssertion()
+	assert.Equal(t, "user@example.com", nameID.Text)
+	assert.Empty(t, nameID.SPProvidedID)
+
+	response, err := idp.manageNameIDResponse(context.Background(), &serviceprovider.ServiceProvider{Metadata: &md.EntityDescriptorType{EntityID: "sp"}},
+		&samlp.ManageNameIDRequestType{NameID: &saml.NameIDType{Text: "user"}, NewID: "changed"}, idpKey)
+	require.NoError(t, err)
+	require.Equal(t, StatusCodeSuccess, response.Status.StatusCode.Value)
+
+	nameID = nameIDOfAssertion()
+	assert.Equal(t, nameIDFormatPersistent, nameID.Format)
+	assert.Equal(t, "user", nameID.Text)
+	assert.Equal(t, "changed", nameID.SPProvidedID)
+}
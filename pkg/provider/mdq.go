@@ -0,0 +1,99 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/zitadel/logging"
+
+	"github.com/zitadel/saml/pkg/provider/serviceprovider"
+	saml_xml "github.com/zitadel/saml/pkg/provider/xml"
+	"github.com/zitadel/saml/pkg/provider/xml/md"
+)
+
+// metadataQueryHandle serves the metadata of the entity with the identifier of the metadata query protocol,
+// the url encoded entityID or its SHA1Identifier
+func (p *Provider) metadataQueryHandle(w http.ResponseWriter, r *http.Request) {
+	// the identifier is the url encoded last path segment below the entities
+	escapedPath := r.URL.EscapedPath()
+	index := strings.LastIndex(escapedPath, serviceprovider.MetadataQueryPath)
+	if index < 0 {
+		http.NotFound(w, r)
+		return
+	}
+	escapedIdentifier := escapedPath[index+len(serviceprovider.MetadataQueryPath):]
+	if escapedIdentifier == "" || strings.Contains(escapedIdentifier, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	identifier, err := url.PathUnescape(escapedIdentifier)
+	if err != nil {
+		http.Error(w, fmt.Errorf("invalid identifier: %w", err).Error(), http.StatusBadRequest)
+		return
+	}
+	metadata, err := p.queryMetadata(r.Context(), identifier)
+	if err != nil {
+		err := fmt.Errorf("error while getting metadata: %w", err)
+		logging.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if metadata == nil {
+		http.Error(w, "unknown entity", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	if err := saml_xml.WriteXMLMarshalled(w, metadata); err != nil {
+		http.Error(w, fmt.Errorf("failed to respond with metadata").Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// queryMetadata returns the metadata of the identity provider or, if the storage implements the MetadataQueryStorage,
+// of the registered service provider with the identifier, nil if the entity is unknown.
+// The metadata of a service provider is marshalled from its parsed EntityDescriptor, which lacks the elements of the original metadata
+// unknown to the md package, so its original signature is removed. It is only signed by the identity provider
+// if MetadataConfig.SignServiceProviderMetadata is set.
+func (p *Provider) queryMetadata(ctx context.Context, identifier string) (*md.EntityDescriptorType, error) {
+	entityID := p.GetEntityID(ctx)
+	if identifier == entityID || identifier == serviceprovider.SHA1Identifier(entityID) {
+		return p.GetMetadata(ctx)
+	}
+
+	storage, ok := p.storage.(MetadataQueryStorage)
+	if !ok {
+		return nil, nil
+	}
+	entityID = identifier
+	if strings.HasPrefix(identifier, "{sha1}") {
+		var err error
+		entityID, err = storage.GetEntityIDBySHA1(ctx, identifier)
+		if err != nil || entityID == "" {
+			return nil, err
+		}
+	}
+	sp, err := p.storage.GetEntityByID(ctx, entityID)
+	if err != nil {
+		return nil, err
+	}
+	if sp == nil || sp.Metadata == nil {
+		return nil, nil
+	}
+
+	metadata := *sp.Metadata
+	metadata.Signature = nil
+	if metadata.Id == "" {
+		metadata.Id = NewID()
+	}
+	if p.conf.MetadataConfig == nil || !p.conf.MetadataConfig.SignServiceProviderMetadata {
+		return &metadata, nil
+	}
+	if err := p.signMetadata(ctx, &metadata); err != nil {
+		return nil, err
+	}
+	return &metadata, nil
+}
@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zitadel/saml/pkg/provider/key"
+	"github.com/zitadel/saml/pkg/provider/mock"
+	"github.com/zitadel/saml/pkg/provider/serviceprovider"
+	"github.com/zitadel/saml/pkg/provider/xml"
+)
+
+const testSPEntityID = "https://sp.example.com/metadata"
+
+type metadataQueryStorage struct {
+	*mock.MockStorage
+}
+
+func (s *metadataQueryStorage) GetEntityIDBySHA1(_ context.Context, identifier string) (string, error) {
+	if identifier == serviceprovider.SHA1Identifier(testSPEntityID) {
+		return testSPEntityID, nil
+	}
+	return "", nil
+}
+
+func newTestMetadataQueryProvider(t *testing.T, withServiceProviders, signServiceProviders bool) (*Provider, *x509.Certificate) {
+	idpKey, idpCert := newKeyAndCertificate(t)
+	_, spCert := newKeyAndCertificate(t)
+	spMetadata, err := serviceprovider.NewMetadata(&serviceprovider.MetadataConfig{
+		EntityID:                  testSPEntityID,
+		AssertionConsumerServices: []serviceprovider.AssertionConsumerService{{Binding: PostBinding, Location: "https://sp.example.com/acs"}},
+		SigningCertificates:       [][]byte{spCert.Raw},
+	})
+	require.NoError(t, err)
+	data, err := xml.Marshal(spMetadata)
+	require.NoError(t, err)
+	sp, err := serviceprovider.NewServiceProvider("sp", &serviceprovider.Config{Metadata: data}, nil)
+	require.NoError(t, err)
+
+	mockStorage := mock.NewMockStorage(gomock.NewController(t))
+	signingKey := &key.CertificateAndKey{Certificate: idpCert.Raw, Key: idpKey}
+	mockStorage.EXPECT().GetResponseSigningKey(gomock.Any()).Return(signingKey, nil).AnyTimes()
+	mockStorage.EXPECT().GetMetadataSigningKey(gomock.Any()).Return(signingKey, nil).AnyTimes()
+	mockStorage.EXPECT().GetEntityByID(gomock.Any(), testSPEntityID).Return(sp, nil).AnyTimes()
+	mockStorage.EXPECT().GetEntityByID(gomock.Any(), "https://failing.example.com").Return(nil, errors.New("storage failed")).AnyTimes()
+	mockStorage.EXPECT().GetEntityByID(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	var storage Storage = mockStorage
+	if withServiceProviders {
+		storage = &metadataQueryStorage{MockStorage: mockStorage}
+	}
+
+	provider, err := NewProvider(storage, IssuerFromHost(""), &Config{
+		MetadataConfig: &MetadataConfig{SignatureAlgorithm: dsig.RSASHA256SignatureMethod, SignServiceProviderMetadata: signServiceProviders},
+		IDPConfig:      &IdentityProviderConfig{},
+	})
+	require.NoError(t, err)
+	return provider, idpCert
+}
+
+func TestMDQ_metadataQueryHandle(t *testing.T) {
+	idpEntityID := "https://idp.example.com/metadata"
+	tests := []struct {
+		name                 string
+		identifier           string
+		withServiceProviders bool
+		signServiceProviders bool
+		status               int
+		entityID             string
+		signed               bool
+	}{
+		{"identity provider", url.PathEscape(idpEntityID), false, false, http.StatusOK, idpEntityID, true},
+		{"identity provider sha1", url.PathEscape(serviceprovider.SHA1Identifier(idpEntityID)), false, false, http.StatusOK, idpEntityID, true},
+		{"service provider not published", url.PathEscape(testSPEntityID), false, false, http.StatusNotFound, "", false},
+		{"service provider", url.PathEscape(testSPEntityID), true, false, http.StatusOK, testSPEntityID, false},
+		{"service provider signed", url.PathEscape(testSPEntityID), true, true, http.StatusOK, testSPEntityID, true},
+		{"service provider sha1", url.PathEscape(serviceprovider.SHA1Identifier(testSPEntityID)), true, true, http.StatusOK, testSPEntityID, true},
+		{"unknown", url.PathEscape("https://unknown.example.com"), true, true, http.StatusNotFound, "", false},
+		{"unknown sha1", url.PathEscape(serviceprovider.SHA1Identifier("https://unknown.example.com")), true, true, http.StatusNotFound, "", false},
+		{"storage error", url.PathEscape("https://failing.example.com"), true, true, http.StatusInternalServerError, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, idpCert := newTestMetadataQueryProvider(t, tt.withServiceProviders, tt.signServiceProviders)
+			w := httptest.NewRecorder()
+			provider.HttpHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://idp.example.com/entities/"+tt.identifier, nil))
+			require.Equal(t, tt.status, w.Code)
+			if tt.status != http.StatusOK {
+				return
+			}
+			assert.Equal(t, "application/samlmetadata+xml", w.Header().Get("Content-Type"))
+			metadata, err := xml.ParseMetadataXmlIntoStruct(w.Body.Bytes())
+			require.NoError(t, err)
+			assert.Equal(t, tt.entityID, string(metadata.EntityID))
+			assert.Equal(t, tt.signed, metadata.Signature != nil)
+
+			var certificates []*x509.Certificate
+			if tt.signed {
+				certificates = []*x509.Certificate{idpCert}
+			}
+			client := serviceprovider.NewMetadataQueryClient(&serviceprovider.MetadataQueryConfig{
+				BaseURL:      "https://idp.example.com",
+				Client:       &http.Client{Transport: handlerTransport{provider.HttpHandler()}},
+				Certificates: certificates,
+			})
+			if tt.entityID == testSPEntityID {
+				sp, err := client.GetServiceProvider(context.Background(), testSPEntityID)
+				require.NoError(t, err)
+				require.NotNil(t, sp)
+				assert.Equal(t, testSPEntityID, sp.GetEntityID())
+			}
+		})
+	}
+}
+
+// handlerTransport serves the requests of a client with the handler
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	w := httptest.NewRecorder()
+	t.handler.ServeHTTP(w, r)
+	return w.Result(), nil
+}
@@ -6,12 +6,14 @@ import (
 	"encoding/xml"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/zitadel/logging"
 
 	saml_xml "github.com/zitadel/saml/pkg/provider/xml"
 	"github.com/zitadel/saml/pkg/provider/xml/md"
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
 	"github.com/zitadel/saml/pkg/provider/xml/xenc"
 	"github.com/zitadel/saml/pkg/provider/xml/xml_dsig"
 )
@@ -21,6 +23,10 @@ const (
 )
 
 func (p *Provider) metadataHandle(w http.ResponseWriter, r *http.Request) {
+	if p.refreshInterval() > 0 {
+		p.cachedMetadataHandle(w, r)
+		return
+	}
 	metadata, err := p.GetMetadata(r.Context())
 	if err != nil {
 		err := fmt.Errorf("error while getting metadata: %w", err)
@@ -42,51 +48,28 @@ func (p *IdentityProviderConfig) getMetadata(
 	timeFormat string,
 ) (*md.IDPSSODescriptorType, *md.AttributeAuthorityDescriptorType) {
 	endpoints := endpointConfigToEndpoints(p.Endpoints)
-
-	idpKeyDescriptors := []md.KeyDescriptorType{
-		{
-			Use: md.KeyTypesSigning,
-			KeyInfo: xml_dsig.KeyInfoType{
-				KeyName: []string{entityID + " IDP " + string(md.KeyTypesSigning)},
-				X509Data: []xml_dsig.X509DataType{{
-					X509Certificate: base64.StdEncoding.EncodeToString(idpCertData),
-				}},
-			},
-		},
-	}
-
-	if p.EncryptionAlgorithm != "" {
-		idpKeyDescriptors = append(idpKeyDescriptors, md.KeyDescriptorType{
-			Use: md.KeyTypesEncryption,
-			KeyInfo: xml_dsig.KeyInfoType{
-				KeyName: []string{entityID + " IDP " + string(md.KeyTypesEncryption)},
-				X509Data: []xml_dsig.X509DataType{{
-					X509Certificate: base64.StdEncoding.EncodeToString(idpCertData),
-				}},
-			},
-			EncryptionMethod: []xenc.EncryptionMethodType{{
-				Algorithm: p.EncryptionAlgorithm,
-			}},
-		})
-	}
+	idpKeyDescriptors := p.keyDescriptors(entityID, idpCertData)
 
 	attrs := &Attributes{
-		"empty", "empty", "empty", "empty", "empty", "empty", nil,
+		email:     "empty",
+		fullName:  "empty",
+		givenName: "empty",
+		surname:   "empty",
+		userID:    "empty",
+		username:  "empty",
+		profile:   p.AttributeProfile,
 	}
 	attrsSaml := attrs.GetSAML()
 	for _, attr := range attrsSaml {
 		for i := range attr.AttributeValue {
-			attr.AttributeValue[i] = ""
+			attr.AttributeValue[i] = saml.AttributeValueType{}
 		}
 	}
-	validUntil := ""
-	if p.MetadataIDPConfig.ValidUntil != 0 {
-		validUntil = time.Now().Add(p.MetadataIDPConfig.ValidUntil).UTC().Format(timeFormat)
-	}
-	cacheDuration := ""
-	if p.MetadataIDPConfig.CacheDuration != "" {
-		cacheDuration = p.MetadataIDPConfig.CacheDuration
+	var attributeProfiles []string
+	if profile := attrs.getProfile(); profile.IsOASIS() {
+		attributeProfiles = []string{profile.ID}
 	}
+	validUntil, cacheDuration := p.validity(timeFormat)
 
 	return &md.IDPSSODescriptorType{
 			XMLName:                    xml.Name{},
@@ -105,11 +88,8 @@ func (p *IdentityProviderConfig) getMetadata(
 					Location: endpoints.singleSignOnEndpoint.Absolute(issuer),
 				},
 			},
-			//TODO definition for more profiles
-			AttributeProfile: []string{
-				"urn:oasis:names:tc:SAML:2.0:profiles:attribute:basic",
-			},
-			Attribute: attrsSaml,
+			AttributeProfile: attributeProfiles,
+			Attribute:        attrsSaml,
 			SingleLogoutService: []md.EndpointType{
 				{
 					Binding:  RedirectBinding,
@@ -135,23 +115,144 @@ func (p *IdentityProviderConfig) getMetadata(
 			ProtocolSupportEnumeration: "urn:oasis:names:tc:SAML:2.0:protocol",
 			ErrorURL:                   p.MetadataIDPConfig.ErrorURL,
 			AttributeService: []md.EndpointType{{
-				Binding:  "urn:oasis:names:tc:SAML:2.0:bindings:SOAP",
+				Binding:  SOAPBinding,
 				Location: endpoints.attributeEndpoint.Absolute(issuer),
 			}},
-			NameIDFormat: []string{"urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"},
-			//TODO definition for more profiles
-			AttributeProfile: []string{
-				"urn:oasis:names:tc:SAML:2.0:profiles:attribute:basic",
-			},
-			Attribute:     attrsSaml,
-			Signature:     nil,
-			KeyDescriptor: idpKeyDescriptors,
+			NameIDFormat:     []string{"urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"},
+			AttributeProfile: attributeProfiles,
+			Attribute:        attrsSaml,
+			Signature:        nil,
+			KeyDescriptor:    idpKeyDescriptors,
 
 			Organization:  nil,
 			ContactPerson: nil,
 		}
 }
 
+// getAuthnAuthorityMetadata returns the descriptor of the AuthnQueryService of the assertion query/request protocol
+func (p *IdentityProviderConfig) getAuthnAuthorityMetadata(
+	entityID string,
+	issuer string,
+	idpCertData []byte,
+	timeFormat string,
+) *md.AuthnAuthorityDescriptorType {
+	validUntil, cacheDuration := p.validity(timeFormat)
+	return &md.AuthnAuthorityDescriptorType{
+		Id:                         NewID(),
+		ValidUntil:                 validUntil,
+		CacheDuration:              cacheDuration,
+		ProtocolSupportEnumeration: "urn:oasis:names:tc:SAML:2.0:protocol",
+		ErrorURL:                   p.MetadataIDPConfig.ErrorURL,
+		AuthnQueryService:          p.assertionQueryServices(issuer),
+		NameIDFormat:               []string{"urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"},
+		KeyDescriptor:              p.keyDescriptors(entityID, idpCertData),
+	}
+}
+
+// getPDPMetadata returns the descriptor of the AuthzService of the assertion query/request protocol
+func (p *IdentityProviderConfig) getPDPMetadata(
+	entityID string,
+	issuer string,
+	idpCertData []byte,
+	timeFormat string,
+) *md.PDPDescriptorType {
+	validUntil, cacheDuration := p.validity(timeFormat)
+	return &md.PDPDescriptorType{
+		Id:                         NewID(),
+		ValidUntil:                 validUntil,
+		CacheDuration:              cacheDuration,
+		ProtocolSupportEnumeration: "urn:oasis:names:tc:SAML:2.0:protocol",
+		ErrorURL:                   p.MetadataIDPConfig.ErrorURL,
+		AuthzService:               p.assertionQueryServices(issuer),
+		NameIDFormat:               []string{"urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"},
+		KeyDescriptor:              p.keyDescriptors(entityID, idpCertData),
+	}
+}
+
+// getProxyMetadata returns the descriptor of the service provider used to authenticate at the upstream identity providers
+func (p *IdentityProviderConfig) getProxyMetadata(
+	entityID string,
+	issuer string,
+	idpCertData []byte,
+	timeFormat string,
+) *md.SPSSODescriptorType {
+	endpoints := endpointConfigToEndpoints(p.Endpoints)
+	validUntil, cacheDuration := p.validity(timeFormat)
+	return &md.SPSSODescriptorType{
+		AuthnRequestsSigned:        "true",
+		WantAssertionsSigned:       "true",
+		Id:                         NewID(),
+		ValidUntil:                 validUntil,
+		CacheDuration:              cacheDuration,
+		ProtocolSupportEnumeration: "urn:oasis:names:tc:SAML:2.0:protocol",
+		ErrorURL:                   p.MetadataIDPConfig.ErrorURL,
+		AssertionConsumerService: []md.IndexedEndpointType{{
+			Binding:   PostBinding,
+			Location:  endpoints.assertionConsumerEndpoint.Absolute(issuer),
+			Index:     "0",
+			IsDefault: "true",
+		}},
+		KeyDescriptor: []md.KeyDescriptorType{{
+			Use: md.KeyTypesSigning,
+			KeyInfo: xml_dsig.KeyInfoType{
+				KeyName: []string{entityID + " SP " + string(md.KeyTypesSigning)},
+				X509Data: []xml_dsig.X509DataType{{
+					X509Certificate: base64.StdEncoding.EncodeToString(idpCertData),
+				}},
+			},
+		}},
+	}
+}
+
+// assertionQueryServices returns the SOAP endpoint of the assertion query/request protocol
+func (p *IdentityProviderConfig) assertionQueryServices(issuer string) []md.EndpointType {
+	endpoints := endpointConfigToEndpoints(p.Endpoints)
+	return []md.EndpointType{{
+		Binding:  SOAPBinding,
+		Location: endpoints.assertionQueryEndpoint.Absolute(issuer),
+	}}
+}
+
+func (p *IdentityProviderConfig) keyDescriptors(entityID string, idpCertData []byte) []md.KeyDescriptorType {
+	idpKeyDescriptors := []md.KeyDescriptorType{
+		{
+			Use: md.KeyTypesSigning,
+			KeyInfo: xml_dsig.KeyInfoType{
+				KeyName: []string{entityID + " IDP " + string(md.KeyTypesSigning)},
+				X509Data: []xml_dsig.X509DataType{{
+					X509Certificate: base64.StdEncoding.EncodeToString(idpCertData),
+				}},
+			},
+		},
+	}
+
+	if p.EncryptionAlgorithm != "" {
+		idpKeyDescriptors = append(idpKeyDescriptors, md.KeyDescriptorType{
+			Use: md.KeyTypesEncryption,
+			KeyInfo: xml_dsig.KeyInfoType{
+				KeyName: []string{entityID + " IDP " + string(md.KeyTypesEncryption)},
+				X509Data: []xml_dsig.X509DataType{{
+					X509Certificate: base64.StdEncoding.EncodeToString(idpCertData),
+				}},
+			},
+			EncryptionMethod: []xenc.EncryptionMethodType{{
+				Algorithm: p.EncryptionAlgorithm,
+			}},
+		})
+	}
+	return idpKeyDescriptors
+}
+
+func (p *IdentityProviderConfig) validity(timeFormat string) (validUntil string, cacheDuration string) {
+	if p.MetadataIDPConfig.ValidUntil != 0 {
+		validUntil = time.Now().Add(p.MetadataIDPConfig.ValidUntil).UTC().Format(timeFormat)
+	}
+	if p.MetadataIDPConfig.CacheDuration != 0 {
+		cacheDuration = saml_xml.FormatDuration(p.MetadataIDPConfig.CacheDuration)
+	}
+	return validUntil, cacheDuration
+}
+
 func (c *Config) getMetadata(
 	ctx context.Context,
 	idp *IdentityProvider,
@@ -173,41 +274,89 @@ func (c *Config) getMetadata(
 		}
 		entity.IDPSSODescriptor = idpMetadata
 		entity.AttributeAuthorityDescriptor = idpAAMetadata
-	}
 
-	if c.Organisation != nil {
-		org := &md.OrganizationType{
-			XMLName:    xml.Name{},
-			Extensions: nil,
-			OrganizationName: []md.LocalizedNameType{
-				{Text: c.Organisation.Name},
-			},
-			OrganizationDisplayName: []md.LocalizedNameType{
-				{Text: c.Organisation.DisplayName},
-			},
-			OrganizationURL: []md.LocalizedURIType{
-				{Text: c.Organisation.URL},
-			},
+		authnAuthorityMetadata, pdpMetadata, err := idp.GetAuthorityMetadata(ctx)
+		if err != nil {
+			return nil, err
 		}
-		entity.AttributeAuthorityDescriptor.Organization = org
-		entity.IDPSSODescriptor.Organization = org
+		entity.AuthnAuthorityDescriptor = authnAuthorityMetadata
+		entity.PDPDescriptor = pdpMetadata
+
+		proxyMetadata, err := idp.GetProxyMetadata(ctx)
+		if err != nil {
+			return nil, err
+		}
+		entity.SPSSODescriptor = proxyMetadata
+
+		entity.IDPSSODescriptor.Extensions, entity.AttributeAuthorityDescriptor.Extensions = c.getRoleExtensions()
+	}
+	entity.Extensions = c.getEntityExtensions()
+
+	entity.Organization = c.getOrganization()
+	entity.ContactPerson = c.getContactPersons()
+	return entity, nil
+}
+
+// getOrganization returns the Organization of the entity, with the name, display name and URL in every configured language
+func (c *Config) getOrganization() *md.OrganizationType {
+	if c.Organisation == nil {
+		return nil
+	}
+	org := &md.OrganizationType{
+		OrganizationName:        localizedNames(c.Organisation.Names),
+		OrganizationDisplayName: localizedNames(c.Organisation.DisplayNames),
+		OrganizationURL:         localizedURIs(c.Organisation.URLs),
+	}
+	lang := c.Organisation.Lang
+	if lang == "" {
+		lang = DefaultLang
 	}
+	if c.Organisation.Name != "" {
+		org.OrganizationName = append([]md.LocalizedNameType{{XmlLang: lang, Text: c.Organisation.Name}}, org.OrganizationName...)
+	}
+	if c.Organisation.DisplayName != "" {
+		org.OrganizationDisplayName = append([]md.LocalizedNameType{{XmlLang: lang, Text: c.Organisation.DisplayName}}, org.OrganizationDisplayName...)
+	}
+	if c.Organisation.URL != "" {
+		org.OrganizationURL = append([]md.LocalizedURIType{{XmlLang: lang, Text: c.Organisation.URL}}, org.OrganizationURL...)
+	}
+	return org
+}
 
+// getContactPersons returns the ContactPerson of the entity, the single ContactPerson first
+func (c *Config) getContactPersons() []md.ContactType {
+	contacts := c.ContactPersons
 	if c.ContactPerson != nil {
-		contactPerson := []md.ContactType{
-			{
-				XMLName:         xml.Name{},
-				ContactType:     c.ContactPerson.ContactType,
-				Company:         c.ContactPerson.Company,
-				GivenName:       c.ContactPerson.GivenName,
-				SurName:         c.ContactPerson.SurName,
-				EmailAddress:    []string{c.ContactPerson.EmailAddress},
-				TelephoneNumber: []string{c.ContactPerson.TelephoneNumber},
-			},
+		contacts = append([]ContactPerson{*c.ContactPerson}, contacts...)
+	}
+	if len(contacts) == 0 {
+		return nil
+	}
+	contactPersons := make([]md.ContactType, len(contacts))
+	for i, contact := range contacts {
+		contactType := contact.ContactType
+		if contactType == "" && contact.RemdContactType != "" {
+			contactType = md.ContactTypeTypeOther
+		}
+		contactPersons[i] = md.ContactType{
+			ContactType:     contactType,
+			RemdContactType: contact.RemdContactType,
+			Company:         contact.Company,
+			GivenName:       contact.GivenName,
+			SurName:         contact.SurName,
+			EmailAddress:    mailtos(contact.emailAddresses()),
+			TelephoneNumber: contact.telephoneNumbers(),
 		}
-		entity.AttributeAuthorityDescriptor.ContactPerson = contactPerson
-		entity.IDPSSODescriptor.ContactPerson = contactPerson
 	}
+	return contactPersons
+}
 
-	return entity, nil
+// mailtos prefixes the email addresses with the mailto scheme required by the metadata
+func mailtos(addresses []string) []string {
+	for i, address := range addresses {
+		if !strings.HasPrefix(address, "mailto:") {
+			addresses[i] = "mailto:" + address
+		}
+	}
+	return addresses
 }
@@ -0,0 +1,147 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zitadel/logging"
+
+	saml_xml "github.com/zitadel/saml/pkg/provider/xml"
+	"github.com/zitadel/saml/pkg/provider/xml/md"
+)
+
+// maxMetadataCacheEntries bounds the issuers cached at once, as the issuers can be derived from the host of the requests
+const maxMetadataCacheEntries = 100
+
+// metadataCache holds the stable metadata per issuer of the current refresh interval, see MetadataConfig.RefreshInterval
+type metadataCache struct {
+	mu      sync.Mutex
+	entries map[string]*cachedMetadata
+}
+
+type cachedMetadata struct {
+	data      []byte
+	etag      string
+	generated time.Time
+	expires   time.Time
+}
+
+func newMetadataCache() *metadataCache {
+	return &metadataCache{entries: make(map[string]*cachedMetadata)}
+}
+
+func (p *Provider) refreshInterval() time.Duration {
+	if p.conf.MetadataConfig == nil {
+		return 0
+	}
+	return p.conf.MetadataConfig.RefreshInterval
+}
+
+// cachedMetadata returns the signed metadata of the current refresh interval,
+// which is built on the first request of the interval
+func (p *Provider) cachedMetadata(ctx context.Context) (*cachedMetadata, error) {
+	interval := p.refreshInterval()
+	generated := time.Now().Truncate(interval).UTC()
+	issuer := IssuerFromContext(ctx)
+
+	p.metadataCache.mu.Lock()
+	defer p.metadataCache.mu.Unlock()
+	if cached, ok := p.metadataCache.entries[issuer]; ok && cached.generated.Equal(generated) {
+		return cached, nil
+	}
+
+	metadata, err := p.conf.getMetadata(ctx, p.identityProvider)
+	if err != nil {
+		return nil, err
+	}
+	p.stabilizeMetadata(metadata, generated)
+	if err := p.signMetadata(ctx, metadata); err != nil {
+		return nil, err
+	}
+	data, err := saml_xml.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	cached := &cachedMetadata{
+		data:      data,
+		etag:      `"` + hex.EncodeToString(sum[:]) + `"`,
+		generated: generated,
+		expires:   generated.Add(interval),
+	}
+	p.metadataCache.add(issuer, cached)
+	return cached, nil
+}
+
+// add caches the metadata of the issuer, evicting the metadata of past intervals
+// and arbitrary issuers if the cache is full
+func (c *metadataCache) add(issuer string, cached *cachedMetadata) {
+	for key, entry := range c.entries {
+		if entry.generated.Before(cached.generated) {
+			delete(c.entries, key)
+		}
+	}
+	for key := range c.entries {
+		if len(c.entries) < maxMetadataCacheEntries {
+			break
+		}
+		delete(c.entries, key)
+	}
+	c.entries[issuer] = cached
+}
+
+// stabilizeMetadata replaces the random IDs and the validUntil relative to the request time
+// with values derived from the start of the refresh interval, so that every build of the interval is identical.
+// The validUntil is the configured ValidUntil after the end of the interval.
+func (p *Provider) stabilizeMetadata(metadata *md.EntityDescriptorType, generated time.Time) {
+	id := func(element string) string {
+		sum := sha1.Sum([]byte(string(metadata.EntityID) + "|" + element + "|" + strconv.FormatInt(generated.Unix(), 10)))
+		return "_" + hex.EncodeToString(sum[:])
+	}
+	var validUntil string
+	if conf := p.identityProvider.conf.MetadataIDPConfig; conf != nil && conf.ValidUntil != 0 {
+		validUntil = generated.Add(p.refreshInterval() + conf.ValidUntil).Format(p.identityProvider.TimeFormat)
+	}
+
+	metadata.Id = id("EntityDescriptor")
+	metadata.ValidUntil = validUntil
+	if descriptor := metadata.IDPSSODescriptor; descriptor != nil {
+		descriptor.Id, descriptor.ValidUntil = id("IDPSSODescriptor"), validUntil
+	}
+	if descriptor := metadata.AttributeAuthorityDescriptor; descriptor != nil {
+		descriptor.Id, descriptor.ValidUntil = id("AttributeAuthorityDescriptor"), validUntil
+	}
+	if descriptor := metadata.AuthnAuthorityDescriptor; descriptor != nil {
+		descriptor.Id, descriptor.ValidUntil = id("AuthnAuthorityDescriptor"), validUntil
+	}
+	if descriptor := metadata.PDPDescriptor; descriptor != nil {
+		descriptor.Id, descriptor.ValidUntil = id("PDPDescriptor"), validUntil
+	}
+	if descriptor := metadata.SPSSODescriptor; descriptor != nil {
+		descriptor.Id, descriptor.ValidUntil = id("SPSSODescriptor"), validUntil
+	}
+}
+
+// cachedMetadataHandle serves the stable metadata with ETag and Last-Modified,
+// answering conditional requests with 304 Not Modified
+func (p *Provider) cachedMetadataHandle(w http.ResponseWriter, r *http.Request) {
+	cached, err := p.cachedMetadata(r.Context())
+	if err != nil {
+		err := fmt.Errorf("error while getting metadata: %w", err)
+		logging.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.Header().Set("ETag", cached.etag)
+	w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(int(time.Until(cached.expires).Seconds())))
+	http.ServeContent(w, r, "", cached.generated, bytes.NewReader(cached.data))
+}
@@ -0,0 +1,140 @@
+package provider
+
+import (
+	"time"
+
+	"github.com/zitadel/saml/pkg/provider/xml/md"
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
+)
+
+const attributeNameFormatURI = "urn:oasis:names:tc:SAML:2.0:attrname-format:uri"
+
+// LocalizedValue is a name or URL in a language, e.g. "en"
+type LocalizedValue struct {
+	Lang  string `yaml:"Lang"`
+	Value string `yaml:"Value"`
+}
+
+// UIInfo is published as mdui:UIInfo in the extensions of the IDPSSODescriptor, e.g. for discovery services
+type UIInfo struct {
+	DisplayNames         []LocalizedValue `yaml:"DisplayNames"`
+	Descriptions         []LocalizedValue `yaml:"Descriptions"`
+	Keywords             []LocalizedValue `yaml:"Keywords"`
+	Logos                []Logo           `yaml:"Logos"`
+	InformationURLs      []LocalizedValue `yaml:"InformationURLs"`
+	PrivacyStatementURLs []LocalizedValue `yaml:"PrivacyStatementURLs"`
+}
+
+type Logo struct {
+	URL    string `yaml:"URL"`
+	Height int    `yaml:"Height"`
+	Width  int    `yaml:"Width"`
+	Lang   string `yaml:"Lang"`
+}
+
+// EntityAttribute is published in the mdattr:EntityAttributes of the entity, e.g. the entity categories
+type EntityAttribute struct {
+	Name string `yaml:"Name"`
+	// NameFormat defaults to urn:oasis:names:tc:SAML:2.0:attrname-format:uri
+	NameFormat string   `yaml:"NameFormat"`
+	Values     []string `yaml:"Values"`
+}
+
+// RegistrationInfo is published as mdrpi:RegistrationInfo of the entity, describing its registration at a federation
+type RegistrationInfo struct {
+	Authority string           `yaml:"Authority"`
+	Instant   time.Time        `yaml:"Instant"`
+	Policies  []LocalizedValue `yaml:"Policies"`
+}
+
+// Scope is published as shibmd:Scope of the IDPSSODescriptor and AttributeAuthorityDescriptor,
+// the scope of the scoped attributes released by the identity provider
+type Scope struct {
+	Value  string `yaml:"Value"`
+	Regexp bool   `yaml:"Regexp"`
+}
+
+// getEntityExtensions returns the extensions of the entity, nil if none are configured
+func (c *Config) getEntityExtensions() *md.ExtensionsType {
+	if len(c.EntityAttributes) == 0 && c.RegistrationInfo == nil && len(c.DigestMethods) == 0 && len(c.SigningMethods) == 0 {
+		return nil
+	}
+	extensions := &md.ExtensionsType{}
+	if len(c.EntityAttributes) > 0 {
+		extensions.EntityAttributes = &md.EntityAttributesType{}
+		for _, attribute := range c.EntityAttributes {
+			nameFormat := attribute.NameFormat
+			if nameFormat == "" {
+				nameFormat = attributeNameFormatURI
+			}
+			extensions.EntityAttributes.Attribute = append(extensions.EntityAttributes.Attribute, saml.AttributeType{
+				Name:           attribute.Name,
+				NameFormat:     nameFormat,
+				AttributeValue: saml.StringAttributeValues(attribute.Values...),
+			})
+		}
+	}
+	if c.RegistrationInfo != nil {
+		extensions.RegistrationInfo = &md.RegistrationInfoType{
+			RegistrationAuthority: c.RegistrationInfo.Authority,
+			RegistrationPolicy:    localizedURIs(c.RegistrationInfo.Policies),
+		}
+		if !c.RegistrationInfo.Instant.IsZero() {
+			extensions.RegistrationInfo.RegistrationInstant = c.RegistrationInfo.Instant.UTC().Format(time.RFC3339)
+		}
+	}
+	for _, algorithm := range c.DigestMethods {
+		extensions.DigestMethod = append(extensions.DigestMethod, md.DigestMethodType{Algorithm: algorithm})
+	}
+	for _, algorithm := range c.SigningMethods {
+		extensions.SigningMethod = append(extensions.SigningMethod, md.SigningMethodType{Algorithm: algorithm})
+	}
+	return extensions
+}
+
+// getRoleExtensions returns the extensions of the IDPSSODescriptor with the UIInfo and the scopes,
+// and of the AttributeAuthorityDescriptor with the scopes, nil if none are configured
+func (c *Config) getRoleExtensions() (idp *md.ExtensionsType, aa *md.ExtensionsType) {
+	var scopes []md.ScopeType
+	for _, scope := range c.Scopes {
+		scopes = append(scopes, md.ScopeType{Regexp: scope.Regexp, Text: scope.Value})
+	}
+	if len(scopes) > 0 {
+		aa = &md.ExtensionsType{Scope: scopes}
+	}
+	if c.UIInfo == nil && len(scopes) == 0 {
+		return nil, aa
+	}
+	idp = &md.ExtensionsType{Scope: scopes}
+	if c.UIInfo != nil {
+		idp.UIInfo = &md.UIInfoType{
+			DisplayName:         localizedNames(c.UIInfo.DisplayNames),
+			Description:         localizedNames(c.UIInfo.Descriptions),
+			InformationURL:      localizedURIs(c.UIInfo.InformationURLs),
+			PrivacyStatementURL: localizedURIs(c.UIInfo.PrivacyStatementURLs),
+		}
+		for _, keywords := range c.UIInfo.Keywords {
+			idp.UIInfo.Keywords = append(idp.UIInfo.Keywords, md.KeywordsType{XmlLang: keywords.Lang, Text: keywords.Value})
+		}
+		for _, logo := range c.UIInfo.Logos {
+			idp.UIInfo.Logo = append(idp.UIInfo.Logo, md.LogoType{Height: logo.Height, Width: logo.Width, XmlLang: logo.Lang, Text: logo.URL})
+		}
+	}
+	return idp, aa
+}
+
+func localizedNames(values []LocalizedValue) []md.LocalizedNameType {
+	names := make([]md.LocalizedNameType, len(values))
+	for i, value := range values {
+		names[i] = md.LocalizedNameType{XmlLang: value.Lang, Text: value.Value}
+	}
+	return names
+}
+
+func localizedURIs(values []LocalizedValue) []md.LocalizedURIType {
+	uris := make([]md.LocalizedURIType, len(values))
+	for i, value := range values {
+		uris[i] = md.LocalizedURIType{XmlLang: value.Lang, Text: value.Value}
+	}
+	return uris
+}
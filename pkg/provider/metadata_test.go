@@ -0,0 +1,279 @@
+package provider
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/golang/mock/gomock"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zitadel/saml/pkg/provider/attribute"
+	"github.com/zitadel/saml/pkg/provider/key"
+	"github.com/zitadel/saml/pkg/provider/mock"
+	"github.com/zitadel/saml/pkg/provider/serviceprovider"
+	"github.com/zitadel/saml/pkg/provider/signature"
+	"github.com/zitadel/saml/pkg/provider/xml"
+	"github.com/zitadel/saml/pkg/provider/xml/md"
+)
+
+func TestMetadata_extensions(t *testing.T) {
+	idpKey, idpCert := newKeyAndCertificate(t)
+	mockStorage := mock.NewMockStorage(gomock.NewController(t))
+	signingKey := &key.CertificateAndKey{Certificate: idpCert.Raw, Key: idpKey}
+	mockStorage.EXPECT().GetResponseSigningKey(gomock.Any()).Return(signingKey, nil).AnyTimes()
+	mockStorage.EXPECT().GetMetadataSigningKey(gomock.Any()).Return(signingKey, nil).AnyTimes()
+
+	provider, err := NewProvider(mockStorage, IssuerFromHost(""), &Config{
+		MetadataConfig: &MetadataConfig{SignatureAlgorithm: dsig.RSASHA256SignatureMethod},
+		IDPConfig:      &IdentityProviderConfig{},
+		UIInfo: &UIInfo{
+			DisplayNames:         []LocalizedValue{{Lang: "en", Value: "Identity Provider"}},
+			Logos:                []Logo{{URL: "https://idp.example.com/logo.png", Height: 16, Width: 16}},
+			PrivacyStatementURLs: []LocalizedValue{{Lang: "en", Value: "https://idp.example.com/privacy"}},
+		},
+		EntityAttributes: []EntityAttribute{{Name: serviceprovider.EntityCategoryAttributeName, Values: []string{"http://refeds.org/category/hide-from-discovery"}}},
+		RegistrationInfo: &RegistrationInfo{Authority: "https://federation.example.org", Instant: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		Scopes:           []Scope{{Value: "example.com"}},
+		DigestMethods:    []string{"http://www.w3.org/2001/04/xmlenc#sha256"},
+		SigningMethods:   []string{dsig.RSASHA256SignatureMethod},
+	})
+	require.NoError(t, err)
+
+	entity, err := provider.GetMetadata(ContextWithIssuer(context.Background(), "https://idp.example.com"))
+	require.NoError(t, err)
+	data, err := xml.Marshal(entity)
+	require.NoError(t, err)
+
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromBytes(data))
+	require.NoError(t, signature.ValidatePost([]*x509.Certificate{idpCert}, doc.Root()))
+
+	metadata, err := xml.ParseMetadataXmlIntoStruct(data)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://refeds.org/category/hide-from-discovery"}, serviceprovider.EntityCategories(metadata))
+	assert.Equal(t, "https://federation.example.org", metadata.Extensions.RegistrationInfo.RegistrationAuthority)
+	assert.Equal(t, "2020-01-01T00:00:00Z", metadata.Extensions.RegistrationInfo.RegistrationInstant)
+	assert.Equal(t, "http://www.w3.org/2001/04/xmlenc#sha256", metadata.Extensions.DigestMethod[0].Algorithm)
+	assert.Equal(t, dsig.RSASHA256SignatureMethod, metadata.Extensions.SigningMethod[0].Algorithm)
+
+	idpExtensions := metadata.IDPSSODescriptor.Extensions
+	require.NotNil(t, idpExtensions)
+	assert.Equal(t, "Identity Provider", idpExtensions.UIInfo.DisplayName[0].Text)
+	assert.Equal(t, "https://idp.example.com/logo.png", idpExtensions.UIInfo.Logo[0].Text)
+	assert.Equal(t, "https://idp.example.com/privacy", idpExtensions.UIInfo.PrivacyStatementURL[0].Text)
+	assert.Equal(t, "example.com", idpExtensions.Scope[0].Text)
+	require.NotNil(t, metadata.AttributeAuthorityDescriptor.Extensions)
+	assert.Nil(t, metadata.AttributeAuthorityDescriptor.Extensions.UIInfo)
+	assert.Equal(t, "example.com", metadata.AttributeAuthorityDescriptor.Extensions.Scope[0].Text)
+}
+
+func TestMetadata_refreshInterval(t *testing.T) {
+	idpKey, idpCert := newKeyAndCertificate(t)
+	mockStorage := mock.NewMockStorage(gomock.NewController(t))
+	signingKey := &key.CertificateAndKey{Certificate: idpCert.Raw, Key: idpKey}
+	mockStorage.EXPECT().GetResponseSigningKey(gomock.Any()).Return(signingKey, nil).AnyTimes()
+	mockStorage.EXPECT().GetMetadataSigningKey(gomock.Any()).Return(signingKey, nil).AnyTimes()
+
+	provider, err := NewProvider(mockStorage, IssuerFromHost(""), &Config{
+		MetadataConfig: &MetadataConfig{SignatureAlgorithm: dsig.RSASHA256SignatureMethod, RefreshInterval: time.Hour},
+		IDPConfig: &IdentityProviderConfig{
+			MetadataIDPConfig: &MetadataIDPConfig{ValidUntil: 24 * time.Hour, CacheDuration: 6 * time.Hour},
+		},
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	provider.HttpHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://idp.example.com/metadata", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.NotEmpty(t, w.Header().Get("Last-Modified"))
+
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromBytes(w.Body.Bytes()))
+	require.NoError(t, signature.ValidatePost([]*x509.Certificate{idpCert}, doc.Root()))
+	metadata, err := xml.ParseMetadataXmlIntoStruct(w.Body.Bytes())
+	require.NoError(t, err)
+	generated := time.Now().Truncate(time.Hour).UTC()
+	assert.Equal(t, generated.Add(25*time.Hour).Format(DefaultTimeFormat), metadata.ValidUntil)
+	assert.Equal(t, metadata.ValidUntil, metadata.IDPSSODescriptor.ValidUntil)
+	assert.Equal(t, "PT6H", metadata.IDPSSODescriptor.CacheDuration)
+
+	// a new build of the interval is identical
+	provider.metadataCache = newMetadataCache()
+	again := httptest.NewRecorder()
+	provider.HttpHandler().ServeHTTP(again, httptest.NewRequest(http.MethodGet, "https://idp.example.com/metadata", nil))
+	assert.Equal(t, etag, again.Header().Get("ETag"))
+	assert.Equal(t, w.Body.String(), again.Body.String())
+
+	r := httptest.NewRequest(http.MethodGet, "https://idp.example.com/metadata", nil)
+	r.Header.Set("If-None-Match", etag)
+	notModified := httptest.NewRecorder()
+	provider.HttpHandler().ServeHTTP(notModified, r)
+	assert.Equal(t, http.StatusNotModified, notModified.Code)
+	assert.Empty(t, notModified.Body.Bytes())
+
+	entity, err := provider.GetMetadata(ContextWithIssuer(context.Background(), "https://idp.example.com"))
+	require.NoError(t, err)
+	assert.Equal(t, metadata.Id, entity.Id)
+}
+
+func TestMetadata_organisationAndContactPersons(t *testing.T) {
+	idpKey, idpCert := newKeyAndCertificate(t)
+	mockStorage := mock.NewMockStorage(gomock.NewController(t))
+	signingKey := &key.CertificateAndKey{Certificate: idpCert.Raw, Key: idpKey}
+	mockStorage.EXPECT().GetResponseSigningKey(gomock.Any()).Return(signingKey, nil).AnyTimes()
+	mockStorage.EXPECT().GetMetadataSigningKey(gomock.Any()).Return(signingKey, nil).AnyTimes()
+
+	config := &Config{
+		MetadataConfig: &MetadataConfig{SignatureAlgorithm: dsig.RSASHA256SignatureMethod},
+		IDPConfig:      &IdentityProviderConfig{},
+		Organisation: &Organisation{
+			Name:         "Example",
+			DisplayName:  "Example Ltd.",
+			URL:          "https://example.com",
+			Names:        []LocalizedValue{{Lang: "de", Value: "Beispiel"}},
+			DisplayNames: []LocalizedValue{{Lang: "de", Value: "Beispiel AG"}},
+		},
+		ContactPerson: &ContactPerson{ContactType: md.ContactTypeTypeTechnical, EmailAddress: "tech@example.com"},
+		ContactPersons: []ContactPerson{
+			{ContactType: md.ContactTypeTypeSupport, GivenName: "Support", EmailAddresses: []string{"mailto:support@example.com", "help@example.com"}},
+			{RemdContactType: RefedsSecurityContactType, EmailAddress: "security@example.com"},
+		},
+	}
+	provider, err := NewProvider(mockStorage, IssuerFromHost(""), config)
+	require.NoError(t, err)
+
+	entity, err := provider.GetMetadata(ContextWithIssuer(context.Background(), "https://idp.example.com"))
+	require.NoError(t, err)
+	data, err := xml.Marshal(entity)
+	require.NoError(t, err)
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromBytes(data))
+	require.NoError(t, signature.ValidatePost([]*x509.Certificate{idpCert}, doc.Root()))
+
+	metadata, err := xml.ParseMetadataXmlIntoStruct(data)
+	require.NoError(t, err)
+	require.NotNil(t, metadata.Organization)
+	assert.Equal(t, []md.LocalizedNameType{{XmlLang: "en", Text: "Example"}, {XmlLang: "de", Text: "Beispiel"}}, stripXMLNames(metadata.Organization.OrganizationName))
+	assert.Equal(t, []md.LocalizedNameType{{XmlLang: "en", Text: "Example Ltd."}, {XmlLang: "de", Text: "Beispiel AG"}}, stripXMLNames(metadata.Organization.OrganizationDisplayName))
+	assert.Equal(t, "https://example.com", metadata.Organization.OrganizationURL[0].Text)
+	assert.Nil(t, metadata.IDPSSODescriptor.Organization)
+	assert.Nil(t, metadata.IDPSSODescriptor.ContactPerson)
+
+	require.Len(t, metadata.ContactPerson, 3)
+	assert.Equal(t, md.ContactTypeTypeTechnical, metadata.ContactPerson[0].ContactType)
+	assert.Equal(t, []string{"mailto:tech@example.com"}, metadata.ContactPerson[0].EmailAddress)
+	assert.Empty(t, metadata.ContactPerson[0].TelephoneNumber)
+	assert.Equal(t, md.ContactTypeTypeSupport, metadata.ContactPerson[1].ContactType)
+	assert.Equal(t, []string{"mailto:support@example.com", "mailto:help@example.com"}, metadata.ContactPerson[1].EmailAddress)
+	assert.Equal(t, md.ContactTypeTypeOther, metadata.ContactPerson[2].ContactType)
+	assert.Equal(t, RefedsSecurityContactType, metadata.ContactPerson[2].RemdContactType)
+
+	// the organisation and contacts are published without an identity provider configured
+	config.IDPConfig = nil
+	entity, err = config.getMetadata(ContextWithIssuer(context.Background(), "https://idp.example.com"), provider.identityProvider)
+	require.NoError(t, err)
+	assert.NotNil(t, entity.Organization)
+	assert.Len(t, entity.ContactPerson, 3)
+	assert.Nil(t, entity.IDPSSODescriptor)
+}
+
+func stripXMLNames(names []md.LocalizedNameType) []md.LocalizedNameType {
+	stripped := make([]md.LocalizedNameType, len(names))
+	for i, name := range names {
+		stripped[i] = md.LocalizedNameType{XmlLang: name.XmlLang, Text: name.Text}
+	}
+	return stripped
+}
+
+func TestMetadata_refreshIntervalCache(t *testing.T) {
+	idpKey, idpCert := newKeyAndCertificate(t)
+	provider, err := NewProvider(mock.NewMockStorage(gomock.NewController(t)), IssuerFromHost(""), &Config{
+		MetadataConfig: &MetadataConfig{RefreshInterval: time.Hour},
+		IDPConfig:      &IdentityProviderConfig{},
+	}, WithSigningKeys(&key.CertificateAndKey{Certificate: idpCert.Raw, Key: idpKey}, nil))
+	require.NoError(t, err)
+	ctx := ContextWithIssuer(context.Background(), "https://idp.example.com")
+
+	// the returned metadata does not share the descriptors with the cache
+	entity, err := provider.GetMetadata(ctx)
+	require.NoError(t, err)
+	entity.IDPSSODescriptor.SingleSignOnService = nil
+	entity, err = provider.GetMetadata(ctx)
+	require.NoError(t, err)
+	assert.NotEmpty(t, entity.IDPSSODescriptor.SingleSignOnService)
+
+	// the metadata of past intervals is evicted and the issuers derived from the requests are bounded
+	provider.metadataCache.entries["https://past.example.com"] = &cachedMetadata{generated: time.Now().Add(-2 * time.Hour)}
+	for i := range maxMetadataCacheEntries + 10 {
+		_, err := provider.GetMetadata(ContextWithIssuer(context.Background(), fmt.Sprintf("https://idp%d.example.com", i)))
+		require.NoError(t, err)
+	}
+	assert.NotContains(t, provider.metadataCache.entries, "https://past.example.com")
+	assert.Len(t, provider.metadataCache.entries, maxMetadataCacheEntries)
+}
+
+func TestMetadata_schemaOrder(t *testing.T) {
+	idpKey, idpCert := newKeyAndCertificate(t)
+	storage := &manageNameIDStorage{MockIDPStorage: mock.NewMockIDPStorage(gomock.NewController(t))}
+	idp, err := newTestIdentityProvider(NewEndpoint("metadata"), &IdentityProviderConfig{}, storage)
+	require.NoError(t, err)
+	idp.responseSigningKey = &key.CertificateAndKey{Certificate: idpCert.Raw, Key: idpKey}
+
+	metadata, _, err := idp.GetMetadata(ContextWithIssuer(context.Background(), "https://idp.example.com"))
+	require.NoError(t, err)
+	require.NotEmpty(t, metadata.ManageNameIDService)
+	data, err := xml.Marshal(metadata)
+	require.NoError(t, err)
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromBytes(data))
+
+	// sequence of the IDPSSODescriptorType, see saml-schema-metadata-2.0.xsd
+	order := []string{
+		"Signature", "Extensions", "KeyDescriptor", "Organization", "ContactPerson",
+		"ArtifactResolutionService", "SingleLogoutService", "ManageNameIDService", "NameIDFormat",
+		"SingleSignOnService", "NameIDMappingService", "AssertionIDRequestService", "AttributeProfile", "Attribute",
+	}
+	position := 0
+	for _, child := range doc.Root().ChildElements() {
+		index := slices.Index(order, child.Tag)
+		require.GreaterOrEqual(t, index, 0, "unknown element %s", child.Tag)
+		require.GreaterOrEqual(t, index, position, "element %s is out of order", child.Tag)
+		position = index
+	}
+}
+
+func TestMetadata_attributeProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile *attribute.Profile
+		res     []string
+	}{
+		{"default", nil, []string{attribute.ProfileBasic}},
+		{"x500", attribute.URIProfile, []string{attribute.ProfileX500}},
+		{"microsoft claims", attribute.MicrosoftClaimsProfile, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idpKey, idpCert := newKeyAndCertificate(t)
+			idp, err := newTestIdentityProvider(NewEndpoint("metadata"), &IdentityProviderConfig{AttributeProfile: tt.profile}, mock.NewMockIDPStorage(gomock.NewController(t)))
+			require.NoError(t, err)
+			idp.responseSigningKey = &key.CertificateAndKey{Certificate: idpCert.Raw, Key: idpKey}
+
+			idpMetadata, aaMetadata, err := idp.GetMetadata(ContextWithIssuer(context.Background(), "https://idp.example.com"))
+			require.NoError(t, err)
+			assert.Equal(t, tt.res, idpMetadata.AttributeProfile)
+			assert.Equal(t, tt.res, aaMetadata.AttributeProfile)
+		})
+	}
+}
@@ -1,5 +1,7 @@
 package models
 
+import "github.com/zitadel/saml/pkg/provider/xml/saml"
+
 type AuthRequestInt interface {
 	GetID() string
 	GetApplicationID() string
@@ -22,3 +24,50 @@ type AttributeSetter interface {
 	SetUsername(string)
 	SetCustomAttribute(name string, friendlyName string, nameFormat string, attributeValue []string)
 }
+
+// AttributeValuesSetter is implemented by the AttributeSetter passed to the storage
+// to set custom attributes with typed or structured values, e.g. saml.NewBooleanAttributeValue.
+type AttributeValuesSetter interface {
+	// SetCustomAttributeValues sets a custom attribute with typed or structured values
+	SetCustomAttributeValues(name string, friendlyName string, nameFormat string, attributeValue []saml.AttributeValueType)
+	// AppendCustomAttributeValues adds the values to an already set custom attribute with the same name or sets it
+	AppendCustomAttributeValues(name string, friendlyName string, nameFormat string, attributeValue []saml.AttributeValueType)
+}
+
+// AttributeStatementSetter is implemented by the AttributeSetter passed to the storage
+// to release custom attributes in separate AttributeStatements.
+type AttributeStatementSetter interface {
+	// SetCustomAttributeStatement releases the custom attribute in a separate AttributeStatement with the index,
+	// 0 is the statement containing the user attributes
+	SetCustomAttributeStatement(name string, statement int)
+}
+
+// AttributeOrderSetter is implemented by the AttributeSetter passed to the storage
+// to order the released attributes.
+type AttributeOrderSetter interface {
+	// SetAttributeOrder sets the order of the released attributes by their names in the assertion,
+	// attributes not named keep the order they were set in after the named ones
+	SetAttributeOrder(names ...string)
+}
+
+// AttributeConsumingServiceIndexGetter can optionally be implemented by an AuthRequestInt
+// to provide the AttributeConsumingServiceIndex of the original AuthnRequest,
+// so that the requested attributes of the matching AttributeConsumingService of the service provider are released.
+// If not implemented, the default AttributeConsumingService of the service provider is used.
+type AttributeConsumingServiceIndexGetter interface {
+	GetAttributeConsumingServiceIndex() string
+}
+
+// AuthenticatingAuthorityGetter can optionally be implemented by an AuthRequestInt completed by the ProxyStorage
+// to provide the entityIDs of the upstream identity providers which authenticated the user,
+// which are added as AuthenticatingAuthority to the AuthnStatements of the assertion.
+type AuthenticatingAuthorityGetter interface {
+	GetAuthenticatingAuthority() []string
+}
+
+// ProxyRestrictionGetter can optionally be implemented by an AuthRequestInt completed by the ProxyStorage
+// to provide the ProxyRestriction derived from the assertion of the upstream identity provider,
+// which is added to the conditions of the assertion.
+type ProxyRestrictionGetter interface {
+	GetProxyRestriction() *saml.ProxyRestrictionType
+}
@@ -0,0 +1,314 @@
+package provider
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/zitadel/logging"
+
+	"github.com/zitadel/saml/pkg/provider/checker"
+	"github.com/zitadel/saml/pkg/provider/encryption"
+	"github.com/zitadel/saml/pkg/provider/serviceprovider"
+	"github.com/zitadel/saml/pkg/provider/signature"
+	saml_xml "github.com/zitadel/saml/pkg/provider/xml"
+	"github.com/zitadel/saml/pkg/provider/xml/md"
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
+	"github.com/zitadel/saml/pkg/provider/xml/samlp"
+	"github.com/zitadel/saml/pkg/provider/xml/soap"
+	"github.com/zitadel/saml/pkg/provider/xml/xml_dsig"
+)
+
+const nameIDFormatPersistent = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+
+// errDecryptIdentifier is returned to the requester for every failed decryption,
+// the details are only logged as they would reveal the padding or key transport failures
+var errDecryptIdentifier = errors.New("failed to decrypt identifier")
+
+func (p *IdentityProvider) nameIDMappingHandleFunc(w http.ResponseWriter, r *http.Request) {
+	checkerInstance := checker.Checker{}
+	var mappingRequest string
+	var err error
+	var sp *serviceprovider.ServiceProvider
+	var request *samlp.NameIDMappingRequestType
+	var response *samlp.NameIDMappingResponseType
+	var cert []byte
+	var key *rsa.PrivateKey
+
+	//parse body to string
+	checkerInstance.WithLogicStep(
+		func() error {
+			b, err := io.ReadAll(r.Body)
+			if err != nil {
+				return err
+			}
+			mappingRequest = string(b)
+			return nil
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to parse body: %w", err).Error(), http.StatusInternalServerError)
+		},
+	)
+
+	// decode request from xml into golang struct
+	checkerInstance.WithLogicStep(
+		func() error {
+			request, err = saml_xml.DecodeNameIDMappingRequest(mappingRequest)
+			if err != nil {
+				return err
+			}
+			if request == nil || request.Issuer == nil || request.Issuer.Text == "" {
+				err = fmt.Errorf("no NameIDMappingRequest with issuer in request")
+			}
+			return err
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to decode request: %w", err).Error(), http.StatusBadRequest)
+		},
+	)
+
+	// get persisted service provider from issuer out of the request
+	checkerInstance.WithLogicStep(
+		func() error {
+			sp, err = p.GetServiceProvider(r.Context(), request.Issuer.Text)
+			if err != nil {
+				return err
+			}
+			if sp == nil {
+				err = fmt.Errorf("unknown service provider %s", request.Issuer.Text)
+			}
+			return err
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to find registered serviceprovider: %w", err).Error(), http.StatusInternalServerError)
+		},
+	)
+
+	//validate used certificate for signing the request
+	checkerInstance.WithConditionalLogicStep(
+		certificateCheckNecessary(
+			func() *xml_dsig.SignatureType { return request.Signature },
+			func() *md.EntityDescriptorType { return sp.Metadata },
+		),
+		checkCertificate(
+			func() *xml_dsig.SignatureType { return request.Signature },
+			func() *md.EntityDescriptorType { return sp.Metadata },
+		),
+		func() {
+			http.Error(w, fmt.Errorf("failed to validate certificate from request: %w", err).Error(), http.StatusInternalServerError)
+		},
+	)
+
+	// verify the signature of the request inside the SOAP envelope
+	checkerInstance.WithConditionalLogicStep(
+		signaturePostProvided(
+			func() *xml_dsig.SignatureType { return request.Signature },
+		),
+		func() error {
+			err = sp.ValidateSOAPSignature(mappingRequest)
+			return err
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to verify signature of request: %w", err).Error(), http.StatusInternalServerError)
+		},
+	)
+
+	// verify that destination in request is this IDP
+	checkerInstance.WithLogicStep(
+		func() error {
+			if request.Destination != "" && request.Destination != p.endpoints.nameIDMappingEndpoint.Absolute(IssuerFromContext(r.Context())) {
+				err = fmt.Errorf("destination of request is unknown")
+			}
+			return err
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to verify request destination: %w", err).Error(), http.StatusInternalServerError)
+		},
+	)
+
+	// map the identifier
+	checkerInstance.WithLogicStep(
+		func() error {
+			cert, key, err = p.getResponseCert(r.Context())
+			if err != nil {
+				return err
+			}
+			// the requester is authorized by its issuer, which is only authenticated by the signature of the request
+			if request.Signature == nil {
+				response = p.makeNameIDMappingResponse(r.Context(), request.Id, StatusCodeRequestDenied, "request is not signed")
+				return nil
+			}
+			response, err = p.nameIDMappingResponse(r.Context(), sp, request, key)
+			return err
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to map identifier: %w", err).Error(), http.StatusInternalServerError)
+		},
+	)
+
+	// create enveloped signature
+	checkerInstance.WithLogicStep(
+		func() error {
+			signer, err := signature.GetSigner(cert, key, p.conf.SignatureAlgorithm)
+			if err != nil {
+				return err
+			}
+			response.Signature, err = signature.Create(signer, response)
+			return err
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to sign response: %w", err).Error(), http.StatusInternalServerError)
+		},
+	)
+
+	//check and log errors if necessary
+	if checkerInstance.CheckFailed() {
+		return
+	}
+
+	soapResponse := &soap.NameIDMappingResponseEnvelope{
+		Body: soap.NameIDMappingResponseBody{
+			NameIDMappingResponse: response,
+		},
+	}
+
+	if err := saml_xml.WriteXMLMarshalled(w, soapResponse); err != nil {
+		logging.Error(err)
+		http.Error(w, fmt.Errorf("failed to send response: %w", err).Error(), http.StatusInternalServerError)
+	}
+}
+
+// nameIDMappingResponse returns the identifier of the user for the service provider of the SPNameQualifier,
+// if the requester is authorized for it by its NameIDMappingConfig
+func (p *IdentityProvider) nameIDMappingResponse(
+	ctx context.Context,
+	sp *serviceprovider.ServiceProvider,
+	request *samlp.NameIDMappingRequestType,
+	key *rsa.PrivateKey,
+) (*samlp.NameIDMappingResponseType, error) {
+	mappingStorage, ok := p.storage.(NameIDMappingStorage)
+	if !ok {
+		return p.makeNameIDMappingResponse(ctx, request.Id, StatusCodeRequestUnsupported, "NameID mapping is not supported"), nil
+	}
+	target := request.NameIDPolicy.SPNameQualifier
+	if target == "" {
+		return p.makeNameIDMappingResponse(ctx, request.Id, StatusCodeInvalidNameIDPolicy, "no SPNameQualifier in NameIDPolicy"), nil
+	}
+	if target != sp.GetEntityID() && !sp.NameIDMapping.Allowed(target) {
+		return p.makeNameIDMappingResponse(ctx, request.Id, StatusCodeRequestDenied, "mapping to the service provider is not allowed"), nil
+	}
+	nameID, err := requestedNameID(request.NameID, request.EncryptedID, key)
+	if err != nil {
+		return p.makeNameIDMappingResponse(ctx, request.Id, StatusCodeRequester, err.Error()), nil
+	}
+
+	format := request.NameIDPolicy.Format
+	if format == "" {
+		format = nameIDFormatPersistent
+	}
+	id, err := mappingStorage.MapNameID(ctx, sp.GetEntityID(), nameID, target, format)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return p.makeNameIDMappingResponse(ctx, request.Id, StatusCodeUnknownPrincipal, "unknown user"), nil
+	}
+
+	mapped := &saml.NameIDType{
+		XMLName:         xml.Name{Space: "urn:oasis:names:tc:SAML:2.0:assertion", Local: "NameID"},
+		Format:          format,
+		NameQualifier:   p.GetEntityID(ctx),
+		SPNameQualifier: target,
+		Text:            id,
+	}
+	response := p.makeNameIDMappingResponse(ctx, request.Id, StatusCodeSuccess, "")
+	if sp.NameIDMapping == nil || !sp.NameIDMapping.Encrypt {
+		response.NameID = mapped
+		return response, nil
+	}
+
+	targetSP, err := p.GetServiceProvider(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	if targetSP == nil {
+		return nil, fmt.Errorf("unknown service provider %s", target)
+	}
+	response.EncryptedID, err = encryptNameID(mapped, targetSP)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// requestedNameID returns the identifier of a request, which is decrypted with the key of the identity provider if encrypted
+func requestedNameID(nameID *saml.NameIDType, encryptedID *saml.EncryptedElementType, key *rsa.PrivateKey) (*saml.NameIDType, error) {
+	if nameID != nil && nameID.Text != "" {
+		return nameID, nil
+	}
+	if encryptedID == nil {
+		return nil, fmt.Errorf("no NameID or EncryptedID in request")
+	}
+	data, err := encryption.Decrypt(encryptedID, key)
+	if err != nil {
+		logging.Error(fmt.Errorf("failed to decrypt EncryptedID: %w", err))
+		return nil, errDecryptIdentifier
+	}
+	decrypted := new(saml.NameIDType)
+	if err := xml.Unmarshal(data, decrypted); err != nil {
+		logging.Error(fmt.Errorf("failed to decode EncryptedID: %w", err))
+		return nil, errDecryptIdentifier
+	}
+	return decrypted, nil
+}
+
+// encryptNameID encrypts the identifier for the service provider with the first algorithm of its metadata supported
+func encryptNameID(nameID *saml.NameIDType, sp *serviceprovider.ServiceProvider) (*saml.EncryptedElementType, error) {
+	cert, err := sp.EncryptionCertificate()
+	if err != nil {
+		return nil, err
+	}
+	data, err := xml.Marshal(nameID)
+	if err != nil {
+		return nil, err
+	}
+	return encryption.Encrypt(data, cert, encryptionAlgorithm(sp))
+}
+
+func encryptionAlgorithm(sp *serviceprovider.ServiceProvider) string {
+	if sp.Metadata == nil || sp.Metadata.SPSSODescriptor == nil {
+		return encryption.DefaultAlgorithm
+	}
+	for _, keyDescriptor := range sp.Metadata.SPSSODescriptor.KeyDescriptor {
+		if keyDescriptor.Use != "" && keyDescriptor.Use != md.KeyTypesEncryption {
+			continue
+		}
+		for _, method := range keyDescriptor.EncryptionMethod {
+			if encryption.Supported(method.Algorithm) {
+				return method.Algorithm
+			}
+		}
+	}
+	return encryption.DefaultAlgorithm
+}
+
+func (p *IdentityProvider) makeNameIDMappingResponse(ctx context.Context, requestID string, status string, message string) *samlp.NameIDMappingResponseType {
+	return &samlp.NameIDMappingResponseType{
+		Version:      "2.0",
+		Id:           NewID(),
+		IssueInstant: time.Now().UTC().Format(p.TimeFormat),
+		InResponseTo: requestID,
+		Issuer:       getIssuer(p.GetEntityID(ctx)),
+		Status: samlp.StatusType{
+			StatusCode: samlp.StatusCodeType{
+				Value: status,
+			},
+			StatusMessage: message,
+		},
+	}
+}
@@ -0,0 +1,215 @@
+package provider
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zitadel/saml/pkg/provider/encryption"
+	"github.com/zitadel/saml/pkg/provider/key"
+	"github.com/zitadel/saml/pkg/provider/mock"
+	"github.com/zitadel/saml/pkg/provider/serviceprovider"
+	"github.com/zitadel/saml/pkg/provider/xml/md"
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
+	"github.com/zitadel/saml/pkg/provider/xml/samlp"
+	"github.com/zitadel/saml/pkg/provider/xml/soap"
+	"github.com/zitadel/saml/pkg/provider/xml/xml_dsig"
+)
+
+type nameIDMappingStorage struct {
+	*mock.MockIDPStorage
+}
+
+func (s *nameIDMappingStorage) MapNameID(_ context.Context, requesterID string, nameID *saml.NameIDType, spNameQualifier string, _ string) (string, error) {
+	if nameID.Text == "unknown" {
+		return "", nil
+	}
+	return nameID.Text + "@" + spNameQualifier, nil
+}
+
+func TestNameIDMapping_nameIDMappingResponse(t *testing.T) {
+	targetKey, targetCert := newKeyAndCertificate(t)
+	idpKey, idpCert := newKeyAndCertificate(t)
+	target := &serviceprovider.ServiceProvider{Metadata: &md.EntityDescriptorType{
+		EntityID: "target",
+		SPSSODescriptor: &md.SPSSODescriptorType{
+			KeyDescriptor: []md.KeyDescriptorType{{
+				Use: md.KeyTypesEncryption,
+				KeyInfo: xml_dsig.KeyInfoType{
+					X509Data: []xml_dsig.X509DataType{{X509Certificate: base64.StdEncoding.EncodeToString(targetCert.Raw)}},
+				},
+			}},
+		},
+	}}
+	encryptedNameIDFor := func(cert *x509.Certificate) *saml.EncryptedElementType {
+		data, err := xml.Marshal(&saml.NameIDType{XMLName: xml.Name{Space: "urn:oasis:names:tc:SAML:2.0:assertion", Local: "NameID"}, Text: "user"})
+		require.NoError(t, err)
+		encrypted, err := encryption.Encrypt(data, cert, "")
+		require.NoError(t, err)
+		return encrypted
+	}
+	encryptedNameID := func() *saml.EncryptedElementType { return encryptedNameIDFor(idpCert) }
+
+	type res struct {
+		status    string
+		message   string
+		nameID    string
+		encrypted bool
+	}
+	tests := []struct {
+		name    string
+		storage bool
+		config  *serviceprovider.NameIDMappingConfig
+		request *samlp.NameIDMappingRequestType
+		res     res
+	}{
+		{
+			"no mapping storage",
+			false,
+			&serviceprovider.NameIDMappingConfig{ServiceProviders: []string{"target"}},
+			&samlp.NameIDMappingRequestType{NameIDPolicy: samlp.NameIDPolicyType{SPNameQualifier: "target"}, NameID: &saml.NameIDType{Text: "user"}},
+			res{status: StatusCodeRequestUnsupported},
+		},
+		{
+			"no SPNameQualifier",
+			true,
+			&serviceprovider.NameIDMappingConfig{ServiceProviders: []string{"target"}},
+			&samlp.NameIDMappingRequestType{NameID: &saml.NameIDType{Text: "user"}},
+			res{status: StatusCodeInvalidNameIDPolicy},
+		},
+		{
+			"not allowed",
+			true,
+			&serviceprovider.NameIDMappingConfig{ServiceProviders: []string{"other"}},
+			&samlp.NameIDMappingRequestType{NameIDPolicy: samlp.NameIDPolicyType{SPNameQualifier: "target"}, NameID: &saml.NameIDType{Text: "user"}},
+			res{status: StatusCodeRequestDenied},
+		},
+		{
+			"no config",
+			true,
+			nil,
+			&samlp.NameIDMappingRequestType{NameIDPolicy: samlp.NameIDPolicyType{SPNameQualifier: "target"}, NameID: &saml.NameIDType{Text: "user"}},
+			res{status: StatusCodeRequestDenied},
+		},
+		{
+			"no identifier",
+			true,
+			&serviceprovider.NameIDMappingConfig{ServiceProviders: []string{"target"}},
+			&samlp.NameIDMappingRequestType{NameIDPolicy: samlp.NameIDPolicyType{SPNameQualifier: "target"}},
+			res{status: StatusCodeRequester},
+		},
+		{
+			"unknown user",
+			true,
+			&serviceprovider.NameIDMappingConfig{ServiceProviders: []string{"target"}},
+			&samlp.NameIDMappingRequestType{NameIDPolicy: samlp.NameIDPolicyType{SPNameQualifier: "target"}, NameID: &saml.NameIDType{Text: "unknown"}},
+			res{status: StatusCodeUnknownPrincipal},
+		},
+		{
+			"identifier encrypted for other key",
+			true,
+			&serviceprovider.NameIDMappingConfig{ServiceProviders: []string{"target"}},
+			&samlp.NameIDMappingRequestType{NameIDPolicy: samlp.NameIDPolicyType{SPNameQualifier: "target"}, EncryptedID: encryptedNameIDFor(targetCert)},
+			res{status: StatusCodeRequester, message: errDecryptIdentifier.Error()},
+		},
+		{
+			"mapped",
+			true,
+			&serviceprovider.NameIDMappingConfig{ServiceProviders: []string{"target"}},
+			&samlp.NameIDMappingRequestType{NameIDPolicy: samlp.NameIDPolicyType{SPNameQualifier: "target"}, NameID: &saml.NameIDType{Text: "user"}},
+			res{status: StatusCodeSuccess, nameID: "user@target"},
+		},
+		{
+			"mapped from encrypted identifier",
+			true,
+			&serviceprovider.NameIDMappingConfig{ServiceProviders: []string{"target"}},
+			&samlp.NameIDMappingRequestType{NameIDPolicy: samlp.NameIDPolicyType{SPNameQualifier: "target"}, EncryptedID: encryptedNameID()},
+			res{status: StatusCodeSuccess, nameID: "user@target"},
+		},
+		{
+			"mapped encrypted",
+			true,
+			&serviceprovider.NameIDMappingConfig{ServiceProviders: []string{"target"}, Encrypt: true},
+			&samlp.NameIDMappingRequestType{NameIDPolicy: samlp.NameIDPolicyType{SPNameQualifier: "target"}, NameID: &saml.NameIDType{Text: "user"}},
+			res{status: StatusCodeSuccess, nameID: "user@target", encrypted: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStorage := mock.NewMockIDPStorage(gomock.NewController(t))
+			mockStorage.EXPECT().GetEntityByID(gomock.Any(), "target").Return(target, nil).MinTimes(0).MaxTimes(1)
+			var storage IDPStorage = mockStorage
+			if tt.storage {
+				storage = &nameIDMappingStorage{mockStorage}
+			}
+			idp, err := newTestIdentityProvider(NewEndpoint("metadata"), &IdentityProviderConfig{}, storage)
+			require.NoError(t, err)
+			sp := &serviceprovider.ServiceProvider{Metadata: &md.EntityDescriptorType{EntityID: "requester"}, NameIDMapping: tt.config}
+
+			response, err := idp.nameIDMappingResponse(context.Background(), sp, tt.request, idpKey)
+			require.NoError(t, err)
+			assert.Equal(t, tt.res.status, response.Status.StatusCode.Value)
+			if tt.res.message != "" {
+				assert.Equal(t, tt.res.message, response.Status.StatusMessage)
+			}
+			if tt.res.nameID == "" {
+				assert.Nil(t, response.NameID)
+				assert.Nil(t, response.EncryptedID)
+				return
+			}
+
+			nameID := response.NameID
+			if tt.res.encrypted {
+				require.Nil(t, response.NameID)
+				require.NotNil(t, response.EncryptedID)
+				data, err := encryption.Decrypt(response.EncryptedID, targetKey)
+				require.NoError(t, err)
+				nameID = new(saml.NameIDType)
+				require.NoError(t, xml.Unmarshal(data, nameID))
+			}
+			require.NotNil(t, nameID)
+			assert.Equal(t, tt.res.nameID, nameID.Text)
+			assert.Equal(t, "target", nameID.SPNameQualifier)
+			assert.Equal(t, nameIDFormatPersistent, nameID.Format)
+		})
+	}
+}
+
+func TestNameIDMapping_nameIDMappingHandleFunc(t *testing.T) {
+	idpKey, idpCert := newKeyAndCertificate(t)
+	sp := &serviceprovider.ServiceProvider{
+		Metadata:      &md.EntityDescriptorType{EntityID: "requester", SPSSODescriptor: &md.SPSSODescriptorType{}},
+		NameIDMapping: &serviceprovider.NameIDMappingConfig{ServiceProviders: []string{"target"}},
+	}
+	mockStorage := mock.NewMockIDPStorage(gomock.NewController(t))
+	mockStorage.EXPECT().GetEntityByID(gomock.Any(), "requester").Return(sp, nil)
+	idp, err := newTestIdentityProvider(NewEndpoint("metadata"), &IdentityProviderConfig{SignatureAlgorithm: dsig.RSASHA256SignatureMethod}, &nameIDMappingStorage{mockStorage})
+	require.NoError(t, err)
+	idp.responseSigningKey = &key.CertificateAndKey{Certificate: idpCert.Raw, Key: idpKey}
+
+	// an unsigned request could pose as any service provider authorized for the mapping
+	body := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+		`<samlp:NameIDMappingRequest xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_request" Version="2.0" IssueInstant="2024-01-01T00:00:00Z">` +
+		`<saml:Issuer>requester</saml:Issuer><saml:NameID>user</saml:NameID><samlp:NameIDPolicy SPNameQualifier="target"/>` +
+		`</samlp:NameIDMappingRequest></soap:Body></soap:Envelope>`
+	w := httptest.NewRecorder()
+	idp.nameIDMappingHandleFunc(w, httptest.NewRequest(http.MethodPost, "https://idp.example.com/mapping", strings.NewReader(body)))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	envelope := new(soap.NameIDMappingResponseEnvelope)
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), envelope))
+	response := envelope.Body.NameIDMappingResponse
+	require.NotNil(t, response)
+	assert.Equal(t, StatusCodeRequestDenied, response.Status.StatusCode.Value)
+	assert.Nil(t, response.NameID)
+}
@@ -73,13 +73,15 @@ func createPostSignature(
 		return err
 	}
 
-	asig, err := signature.Create(signer, samlResponse.Assertion)
-	if err != nil {
-		return err
+	// assertions returned by ID are already signed
+	if samlResponse.Assertion != nil && samlResponse.Assertion.Signature == nil {
+		asig, err := signature.Create(signer, samlResponse.Assertion)
+		if err != nil {
+			return err
+		}
+		samlResponse.Assertion.Signature = asig
 	}
 
-	samlResponse.Assertion.Signature = asig
-
 	rsig, err := signature.Create(signer, samlResponse)
 	if err != nil {
 		return err
@@ -5,15 +5,19 @@ import (
 	"crypto/rsa"
 	"fmt"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 
+	"github.com/zitadel/saml/pkg/provider/key"
 	"github.com/zitadel/saml/pkg/provider/models"
 	"github.com/zitadel/saml/pkg/provider/signature"
+	saml_xml "github.com/zitadel/saml/pkg/provider/xml"
 	"github.com/zitadel/saml/pkg/provider/xml/md"
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
 	"github.com/zitadel/saml/pkg/provider/xml/samlp"
 )
 
@@ -22,7 +26,15 @@ const (
 	DefaultExpiration       = 5 * time.Minute
 	PostBinding             = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
 	RedirectBinding         = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	SOAPBinding             = "urn:oasis:names:tc:SAML:2.0:bindings:SOAP"
+	PAOSBinding             = "urn:oasis:names:tc:SAML:2.0:bindings:PAOS"
 	DefaultMetadataEndpoint = "/metadata"
+	// DefaultLang is the language of the Organisation, if none is configured
+	DefaultLang = "en"
+	// RefedsSecurityContactType is the REFEDS contact type of the security contact (remd:contactType)
+	RefedsSecurityContactType = "http://refeds.org/metadata/contactType/security"
+	// DefaultMetadataQueryEndpoint is the base of the metadata query protocol (MDQ), serving the entities below /entities/
+	DefaultMetadataQueryEndpoint = "/"
 )
 
 type Storage interface {
@@ -34,38 +46,89 @@ type Storage interface {
 }
 
 type Config struct {
-	MetadataConfig *MetadataConfig
-	IDPConfig      *IdentityProviderConfig
-	Metadata       *Endpoint `yaml:"Metadata"`
-
-	Organisation  *Organisation
-	ContactPerson *ContactPerson
+	MetadataConfig *MetadataConfig         `yaml:"MetadataConfig"`
+	IDPConfig      *IdentityProviderConfig `yaml:"IDPConfig"`
+	Metadata       *Endpoint               `yaml:"Metadata"`
+	// MetadataQuery is the base of the metadata query protocol (MDQ)
+	MetadataQuery *Endpoint `yaml:"MetadataQuery"`
+
+	// Organisation and ContactPerson are published on the EntityDescriptor,
+	// ContactPersons are additional contacts, e.g. of other types
+	Organisation   *Organisation   `yaml:"Organisation"`
+	ContactPerson  *ContactPerson  `yaml:"ContactPerson"`
+	ContactPersons []ContactPerson `yaml:"ContactPersons"`
+
+	// UIInfo is published in the extensions of the IDPSSODescriptor
+	UIInfo *UIInfo `yaml:"UIInfo"`
+	// EntityAttributes are published in the extensions of the entity, e.g. the entity categories
+	EntityAttributes []EntityAttribute `yaml:"EntityAttributes"`
+	RegistrationInfo *RegistrationInfo `yaml:"RegistrationInfo"`
+	// Scopes of the scoped attributes are published in the extensions of the IDPSSODescriptor and AttributeAuthorityDescriptor
+	Scopes []Scope `yaml:"Scopes"`
+	// DigestMethods and SigningMethods are the supported algorithms published in the extensions of the entity
+	DigestMethods  []string `yaml:"DigestMethods"`
+	SigningMethods []string `yaml:"SigningMethods"`
 }
 
 type MetadataConfig struct {
-	Path               string
-	SignatureAlgorithm string
+	// Path of the metadata endpoint, used if the Config has no Metadata endpoint
+	Path               string `yaml:"Path"`
+	SignatureAlgorithm string `yaml:"SignatureAlgorithm"`
+	// RefreshInterval enables the stable metadata: the signed document is built once per interval
+	// with deterministic IDs and validUntil, cached and served with ETag and Last-Modified.
+	// The metadata is built on every request if 0.
+	RefreshInterval time.Duration `yaml:"RefreshInterval"`
+	// SignServiceProviderMetadata signs the metadata of the service providers published with the metadata query protocol
+	// (see MetadataQueryStorage), so the identity provider vouches for it. The metadata is published unsigned if false.
+	SignServiceProviderMetadata bool `yaml:"SignServiceProviderMetadata"`
 }
 
 type Certificate struct {
-	Path           string
-	PrivateKeyPath string
-	CaPath         string
+	Path           string `yaml:"Path"`
+	PrivateKeyPath string `yaml:"PrivateKeyPath"`
+	CaPath         string `yaml:"CaPath"`
 }
 
 type Organisation struct {
-	Name        string
-	DisplayName string
-	URL         string
+	Name        string `yaml:"Name"`
+	DisplayName string `yaml:"DisplayName"`
+	URL         string `yaml:"URL"`
+	// Lang is the language of Name, DisplayName and URL, defaults to DefaultLang
+	Lang string `yaml:"Lang"`
+	// Names, DisplayNames and URLs are published additionally, e.g. in other languages
+	Names        []LocalizedValue `yaml:"Names"`
+	DisplayNames []LocalizedValue `yaml:"DisplayNames"`
+	URLs         []LocalizedValue `yaml:"URLs"`
 }
 
 type ContactPerson struct {
-	ContactType     md.ContactTypeType
-	Company         string
-	GivenName       string
-	SurName         string
-	EmailAddress    string
-	TelephoneNumber string
+	ContactType md.ContactTypeType `yaml:"ContactType"`
+	// RemdContactType is the REFEDS contact type, e.g. RefedsSecurityContactType,
+	// the ContactType defaults to other if it is set
+	RemdContactType string `yaml:"RemdContactType"`
+	Company         string `yaml:"Company"`
+	GivenName       string `yaml:"GivenName"`
+	SurName         string `yaml:"SurName"`
+	EmailAddress    string `yaml:"EmailAddress"`
+	TelephoneNumber string `yaml:"TelephoneNumber"`
+	// EmailAddresses and TelephoneNumbers are published additionally to EmailAddress and TelephoneNumber
+	EmailAddresses   []string `yaml:"EmailAddresses"`
+	TelephoneNumbers []string `yaml:"TelephoneNumbers"`
+}
+
+func (c ContactPerson) emailAddresses() []string {
+	return prependIfSet(c.EmailAddress, c.EmailAddresses)
+}
+
+func (c ContactPerson) telephoneNumbers() []string {
+	return prependIfSet(c.TelephoneNumber, c.TelephoneNumbers)
+}
+
+func prependIfSet(value string, values []string) []string {
+	if value == "" {
+		return slices.Clone(values)
+	}
+	return append([]string{value}, values...)
 }
 
 const (
@@ -79,10 +142,24 @@ type Provider struct {
 	interceptors      []HttpInterceptor
 	insecure          bool
 	issuerFromRequest IssuerFromRequest
-
-	metadataEndpoint *Endpoint
-	conf             *Config
-	identityProvider *IdentityProvider
+	// clientAddressFromRequest is set by WithClientAddressFromForwarded, the remote address is used otherwise
+	clientAddressFromRequest func(r *http.Request) string
+
+	metadataEndpoint      *Endpoint
+	metadataQueryEndpoint *Endpoint
+	conf                  *Config
+	identityProvider      *IdentityProvider
+	metadataCache         *metadataCache
+	// metadataSigningKey is used instead of the key of the storage, see WithSigningKeys
+	metadataSigningKey *key.CertificateAndKey
+
+	tenantResolver TenantResolver
+	tenants        *tenants
+	reload         *reloadable
+
+	withoutHealthRoutes bool
+	// routeHandlers are the handlers of the routes by their names, see Routes
+	routeHandlers map[string]http.HandlerFunc
 }
 
 func NewProvider(
@@ -94,6 +171,12 @@ func NewProvider(
 	metadataEndpoint := NewEndpoint(DefaultMetadataEndpoint)
 	if conf.Metadata != nil {
 		metadataEndpoint = *conf.Metadata
+	} else if conf.MetadataConfig != nil && conf.MetadataConfig.Path != "" {
+		metadataEndpoint = NewEndpoint(conf.MetadataConfig.Path)
+	}
+	metadataQueryEndpoint := NewEndpoint(DefaultMetadataQueryEndpoint)
+	if conf.MetadataQuery != nil {
+		metadataQueryEndpoint = *conf.MetadataQuery
 	}
 
 	idp, err := NewIdentityProvider(
@@ -106,10 +189,12 @@ func NewProvider(
 	}
 
 	prov := &Provider{
-		metadataEndpoint: &metadataEndpoint,
-		storage:          storage,
-		conf:             conf,
-		identityProvider: idp,
+		metadataEndpoint:      &metadataEndpoint,
+		metadataQueryEndpoint: &metadataQueryEndpoint,
+		storage:               storage,
+		conf:                  conf,
+		identityProvider:      idp,
+		metadataCache:         newMetadataCache(),
 	}
 
 	for _, optFunc := range providerOpts {
@@ -123,17 +208,38 @@ func NewProvider(
 		return nil, err
 	}
 
+	prov.reload = &reloadable{
+		newProvider: func(conf *Config, opts []Option) (*Provider, error) {
+			return NewProvider(storage, issuer, conf, append(slices.Clone(providerOpts), opts...)...)
+		},
+	}
+	prov.reload.current.Store(prov)
+
+	if prov.tenantResolver != nil {
+		prov.tenants = &tenants{
+			resolver:  prov.tenantResolver,
+			providers: make(map[string]*tenantProvider),
+			newProvider: func(conf *Config) (*Provider, error) {
+				return NewProvider(storage, issuer, conf, append(slices.Clone(providerOpts), withoutTenants())...)
+			},
+		}
+	}
+	prov.routeHandlers = routeHandlers(prov.routes())
+	if prov.tenants != nil {
+		prov.httpHandler = createTenantRouter(prov)
+		return prov, nil
+	}
 	prov.httpHandler = CreateRouter(prov, prov.interceptors...)
 
 	return prov, nil
 }
 
 func (p *Provider) GetEntityID(ctx context.Context) string {
-	return p.identityProvider.GetEntityID(ctx)
+	return p.current().identityProvider.GetEntityID(ctx)
 }
 
 func (p *Provider) IssuerFromRequest(r *http.Request) string {
-	return p.issuerFromRequest(r)
+	return p.current().issuerFromRequest(r)
 }
 
 func NewID() string {
@@ -150,7 +256,10 @@ func WithHttpInterceptors(interceptors ...HttpInterceptor) Option {
 }
 
 func (p *Provider) HttpHandler() http.Handler {
-	return p.httpHandler
+	if p.reload == nil {
+		return p.httpHandler
+	}
+	return http.HandlerFunc(p.reloadHandle)
 }
 
 func (p *Provider) Health(ctx context.Context) error {
@@ -164,30 +273,51 @@ func (p *Provider) Probes() []ProbesFn {
 }
 
 func (p *Provider) GetMetadata(ctx context.Context) (*md.EntityDescriptorType, error) {
+	p = p.current()
+	if p.refreshInterval() > 0 {
+		cached, err := p.cachedMetadata(ctx)
+		if err != nil {
+			return nil, err
+		}
+		// the cached document is decoded for every call, so that callers cannot modify the cache
+		return saml_xml.ParseMetadataXmlIntoStruct(cached.data)
+	}
 	metadata, err := p.conf.getMetadata(ctx, p.identityProvider)
 	if err != nil {
 		return nil, err
 	}
 
-	cert, key, err := getMetadataCert(ctx, p.storage)
-	if p.conf.MetadataConfig != nil && p.conf.MetadataConfig.SignatureAlgorithm != "" {
-		signer, err := signature.GetSigner(cert, key, p.conf.MetadataConfig.SignatureAlgorithm)
-		if err != nil {
-			return nil, err
-		}
-
-		idpSig, err := signature.Create(signer, metadata)
-		if err != nil {
-			return nil, err
-		}
-		metadata.Signature = idpSig
-
+	if err := p.signMetadata(ctx, metadata); err != nil {
+		return nil, err
 	}
 	return metadata, nil
 }
 
-func getMetadataCert(ctx context.Context, storage EntityStorage) ([]byte, *rsa.PrivateKey, error) {
-	certAndKey, err := storage.GetMetadataSigningKey(ctx)
+// signMetadata signs the metadata with the metadata signing key, if a signature algorithm is configured
+func (p *Provider) signMetadata(ctx context.Context, metadata *md.EntityDescriptorType) error {
+	if p.conf.MetadataConfig == nil || p.conf.MetadataConfig.SignatureAlgorithm == "" {
+		return nil
+	}
+	cert, key, err := p.getMetadataCert(ctx)
+	if err != nil {
+		return err
+	}
+	signer, err := signature.GetSigner(cert, key, p.conf.MetadataConfig.SignatureAlgorithm)
+	if err != nil {
+		return err
+	}
+	metadata.Signature, err = signature.Create(signer, metadata)
+	return err
+}
+
+// getMetadataCert returns the metadata signing key of the tenant, else the configured one, else the one of the storage
+func (p *Provider) getMetadataCert(ctx context.Context) ([]byte, *rsa.PrivateKey, error) {
+	certAndKey, err := p.metadataSigningKey, error(nil)
+	if tenant := TenantFromContext(ctx); tenant != nil && tenant.MetadataSigningKey != nil {
+		certAndKey = tenant.MetadataSigningKey
+	} else if certAndKey == nil {
+		certAndKey, err = p.storage.GetMetadataSigningKey(ctx)
+	}
 	if err != nil {
 		return nil, nil, err
 	}
@@ -203,18 +333,31 @@ type HttpInterceptor func(http.Handler) http.Handler
 
 func CreateRouter(p *Provider, interceptors ...HttpInterceptor) *mux.Router {
 	router := mux.NewRouter()
+	// the entityIDs of the metadata query protocol are url encoded path segments
+	router.UseEncodedPath()
 
-	router.Use(intercept(p.issuerFromRequest, interceptors...))
-	router.HandleFunc(healthEndpoint, healthHandler)
-	router.HandleFunc(readinessEndpoint, readyHandler(p.Probes()))
-	router.HandleFunc(p.metadataEndpoint.Relative(), p.metadataHandle)
+	router.Use(intercept(p.issuerInterceptor(), interceptors...))
+	registerMuxRoutes(router, p.routes())
+	return router
+}
 
-	if p.identityProvider != nil {
-		for _, route := range p.identityProvider.GetRoutes() {
-			router.Handle(route.Endpoint, route.HandleFunc)
+// registerMuxRoutes mounts the routes with the same methods as RegisterRoutes,
+// HEAD is allowed with GET as by the http.ServeMux
+func registerMuxRoutes(router *mux.Router, routes []*Route) {
+	for _, route := range routes {
+		var r *mux.Route
+		if route.Prefix {
+			r = router.PathPrefix(route.Endpoint).Handler(route.HandleFunc)
+		} else {
+			r = router.Handle(route.Endpoint, route.HandleFunc)
+		}
+		if methods := routeMethods(route); len(methods) > 0 {
+			if slices.Contains(methods, http.MethodGet) {
+				methods = append(methods, http.MethodHead)
+			}
+			r.Methods(methods...)
 		}
 	}
-	return router
 }
 
 var allowAllOrigins = func(_ string) bool {
@@ -224,37 +367,41 @@ var allowAllOrigins = func(_ string) bool {
 // AuthCallbackURL builds the url for the redirect (with the requestID) after a successful login
 func (p *Provider) AuthCallbackURL() func(context.Context, string) string {
 	return func(ctx context.Context, requestID string) string {
-		return p.identityProvider.endpoints.callbackEndpoint.Absolute(IssuerFromContext(ctx)) + "?id=" + requestID
+		return p.current().identityProvider.endpoints.callbackEndpoint.Absolute(IssuerFromContext(ctx)) + "?id=" + requestID
 	}
 }
 
 // AuthCallbackResponse returns the SAMLResponse from as successful SAMLRequest
 func (p *Provider) AuthCallbackResponse(ctx context.Context, authRequest models.AuthRequestInt, response *Response) (*samlp.ResponseType, error) {
-	return p.identityProvider.loginResponse(ctx, authRequest, response)
+	return p.current().identityProvider.loginResponse(ctx, authRequest, response)
 }
 
 // AuthCallbackErrorResponse returns the SAMLResponse from as failed SAMLRequest
 func (p *Provider) AuthCallbackErrorResponse(response *Response, reason string, description string) *samlp.ResponseType {
-	return p.identityProvider.errorResponse(response, reason, description)
+	return p.current().identityProvider.errorResponse(response, reason, description)
+}
+
+// TerminateNameID notifies the service provider that the federation of the user identified by the nameID is terminated
+func (p *Provider) TerminateNameID(ctx context.Context, entityID string, nameID *saml.NameIDType) error {
+	return p.current().identityProvider.TerminateNameID(ctx, entityID, nameID)
 }
 
 // Timeformat return the used timeformat in messages
 func (p *Provider) Timeformat() string {
-	return p.identityProvider.TimeFormat
+	return p.current().identityProvider.TimeFormat
 }
 
 // Expiration return the used expiration in messages
 func (p *Provider) Expiration() time.Duration {
-	return p.identityProvider.Expiration
+	return p.current().identityProvider.Expiration
 }
 
-func intercept(i IssuerFromRequest, interceptors ...HttpInterceptor) func(handler http.Handler) http.Handler {
+func intercept(issuerInterceptor *IssuerInterceptor, interceptors ...HttpInterceptor) func(handler http.Handler) http.Handler {
 	cors := handlers.CORS(
 		handlers.AllowCredentials(),
 		handlers.AllowedHeaders([]string{"authorization", "content-type"}),
 		handlers.AllowedOriginValidator(allowAllOrigins),
 	)
-	issuerInterceptor := NewIssuerInterceptor(i)
 	return func(handler http.Handler) http.Handler {
 		for i := len(interceptors) - 1; i >= 0; i-- {
 			handler = interceptors[i](handler)
@@ -263,6 +410,47 @@ func intercept(i IssuerFromRequest, interceptors ...HttpInterceptor) func(handle
 	}
 }
 
+// WithSigningKeys signs the responses and the metadata with the keys instead of the keys of the storage,
+// the metadata is signed with the response signing key if no metadata signing key is provided
+func WithSigningKeys(responseSigningKey, metadataSigningKey *key.CertificateAndKey) Option {
+	return func(p *Provider) error {
+		if responseSigningKey == nil {
+			return fmt.Errorf("response signing key is required")
+		}
+		if metadataSigningKey == nil {
+			metadataSigningKey = responseSigningKey
+		}
+		p.identityProvider.responseSigningKey = responseSigningKey
+		p.metadataSigningKey = metadataSigningKey
+		return nil
+	}
+}
+
+// WithClientAddressFromForwarded takes the address of the client from the for parameter of the Forwarded header
+// instead of the remote address of the request, e.g. behind a proxy with the same options as IssuerFromForwardedOrHost.
+// The headers of WithIssuerFromCustomHeaders are used instead of the Forwarded header, X-Forwarded-For is read as list of addresses.
+// The address appended by the outermost trusted proxy is used, see WithTrustedProxies.
+// The address is added as SubjectLocality and bound to the assertions, so the headers must be set by a trusted proxy.
+func WithClientAddressFromForwarded(opts ...IssuerFromOption) Option {
+	return func(p *Provider) error {
+		c := &issuerConfig{
+			headers: []string{http.CanonicalHeaderKey("forwarded")},
+		}
+		for _, opt := range opts {
+			opt(c)
+		}
+		p.clientAddressFromRequest = clientAddressFromForwarded(c)
+		return nil
+	}
+}
+
+// issuerInterceptor sets the issuer and, if configured, the address of the client into the context of the requests
+func (p *Provider) issuerInterceptor() *IssuerInterceptor {
+	interceptor := NewIssuerInterceptor(p.issuerFromRequest)
+	interceptor.clientAddressFromRequest = p.clientAddressFromRequest
+	return interceptor
+}
+
 // WithAllowInsecure allows the use of http (instead of https) for issuers
 // this is not recommended for production use and violates the SAML specification
 func WithAllowInsecure() Option {
@@ -272,6 +460,59 @@ func WithAllowInsecure() Option {
 	}
 }
 
+// WithAssertionPolicy allows to customize the lifetime, audiences and conditions of the assertions per request
+func WithAssertionPolicy(policy AssertionPolicy) Option {
+	return func(p *Provider) error {
+		p.identityProvider.assertionPolicy = policy
+		return nil
+	}
+}
+
+// WithAuthzDecisionPolicy answers AuthzDecisionQueries with the decisions of the policy,
+// without a policy they are answered as unsupported
+func WithAuthzDecisionPolicy(policy AuthzDecisionPolicy) Option {
+	return func(p *Provider) error {
+		p.identityProvider.authzDecisionPolicy = policy
+		return nil
+	}
+}
+
+// WithECPAuthenticator enables the ECP profile at the SSO endpoint, the users are authenticated by the authenticator
+// with the HTTP Basic or bearer credentials of the requests
+func WithECPAuthenticator(authenticator ECPAuthenticator) Option {
+	return func(p *Provider) error {
+		p.identityProvider.ecpAuthenticator = authenticator
+		return nil
+	}
+}
+
+// WithProxyDiscovery chooses the upstream identity provider in the proxy mode with the discovery
+// instead of the IDPList of the AuthnRequests, the proxy mode requires the storage to implement the ProxyStorage
+func WithProxyDiscovery(discovery ProxyDiscovery) Option {
+	return func(p *Provider) error {
+		p.identityProvider.proxyDiscovery = discovery
+		return nil
+	}
+}
+
+// WithHTTPClient sets the client used for requests to the service providers, e.g. to terminate identifiers,
+// defaults to http.DefaultClient
+func WithHTTPClient(client *http.Client) Option {
+	return func(p *Provider) error {
+		p.identityProvider.httpClient = client
+		return nil
+	}
+}
+
+// WithClientCertificateHeader reads the TLS client certificate for holder-of-key subject confirmation from the header,
+// if TLS is terminated in front of the provider; the header must only be set by a trusted proxy
+func WithClientCertificateHeader(header string) Option {
+	return func(p *Provider) error {
+		p.identityProvider.clientCertificateHeader = header
+		return nil
+	}
+}
+
 // WithCustomTimeFormat allows the use of a custom timeformat instead of the default
 func WithCustomTimeFormat(timeFormat string) Option {
 	return func(p *Provider) error {
@@ -0,0 +1,326 @@
+package provider
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/zitadel/logging"
+
+	"github.com/zitadel/saml/pkg/provider/checker"
+	"github.com/zitadel/saml/pkg/provider/models"
+	"github.com/zitadel/saml/pkg/provider/serviceprovider"
+	"github.com/zitadel/saml/pkg/provider/xml"
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
+	"github.com/zitadel/saml/pkg/provider/xml/samlp"
+)
+
+// UpstreamIdentityProvider is an identity provider the authentication is delegated to in the proxy mode
+type UpstreamIdentityProvider struct {
+	EntityID string
+	// SingleSignOnURL is the location of the SingleSignOnService with the HTTP-Redirect binding
+	SingleSignOnURL string
+	// Certificates are used to verify the signatures of the responses
+	Certificates []*x509.Certificate
+}
+
+// ProxyDiscovery chooses the entityID of the upstream identity provider for the AuthnRequest of the service provider,
+// instead of the IDPList of the request; an empty entityID authenticates the user locally
+type ProxyDiscovery func(ctx context.Context, sp *serviceprovider.ServiceProvider, request *samlp.AuthnRequestType) (string, error)
+
+// upstreamRequestID returns the ID of the AuthnRequest sent to the upstream identity provider for the auth request
+func upstreamRequestID(authRequestID string) string {
+	return "_" + authRequestID
+}
+
+// upstreamIdentityProvider returns the upstream identity provider the authentication of the request is delegated to,
+// nil if the user is authenticated locally; the error contains the status code of the failed response
+func (p *IdentityProvider) upstreamIdentityProvider(ctx context.Context, sp *serviceprovider.ServiceProvider, request *samlp.AuthnRequestType) (*UpstreamIdentityProvider, error) {
+	proxyStorage, ok := p.storage.(ProxyStorage)
+	if !ok {
+		return nil, nil
+	}
+
+	var candidates []string
+	if p.proxyDiscovery != nil {
+		entityID, err := p.proxyDiscovery(ctx, sp, request)
+		if err != nil {
+			logging.Error(err)
+			return nil, errors.New(StatusCodeResponder)
+		}
+		if entityID != "" {
+			candidates = []string{entityID}
+		}
+	} else if request.Scoping != nil && request.Scoping.IDPList != nil {
+		for _, entry := range request.Scoping.IDPList.IDPEntry {
+			candidates = append(candidates, entry.ProviderID)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	for _, entityID := range candidates {
+		// the service provider allows the authentication by this identity provider
+		if entityID == p.GetEntityID(ctx) {
+			return nil, nil
+		}
+		upstream, err := proxyStorage.GetUpstreamIdentityProvider(ctx, entityID)
+		if err != nil {
+			logging.Error(err)
+			return nil, errors.New(StatusCodeResponder)
+		}
+		if upstream == nil {
+			continue
+		}
+		if request.Scoping != nil && request.Scoping.ProxyCount != nil && *request.Scoping.ProxyCount <= 0 {
+			return nil, errors.New(StatusCodeProxyCountExceeded)
+		}
+		return upstream, nil
+	}
+	return nil, errors.New(StatusCodeNoSupportedIDP)
+}
+
+// makeUpstreamAuthnRequest creates the AuthnRequest to the upstream identity provider for the auth request,
+// with the ProxyCount decremented and the service provider appended to the RequesterIDs
+func (p *IdentityProvider) makeUpstreamAuthnRequest(
+	ctx context.Context,
+	upstream *UpstreamIdentityProvider,
+	sp *serviceprovider.ServiceProvider,
+	request *samlp.AuthnRequestType,
+	authRequestID string,
+) *samlp.AuthnRequestType {
+	scoping := &samlp.ScopingType{}
+	if request.Scoping != nil {
+		if request.Scoping.ProxyCount != nil {
+			proxyCount := *request.Scoping.ProxyCount - 1
+			scoping.ProxyCount = &proxyCount
+		}
+		scoping.IDPList = request.Scoping.IDPList
+		scoping.RequesterID = append(scoping.RequesterID, request.Scoping.RequesterID...)
+	}
+	scoping.RequesterID = append(scoping.RequesterID, sp.GetEntityID())
+
+	return &samlp.AuthnRequestType{
+		Id:                          upstreamRequestID(authRequestID),
+		Version:                     "2.0",
+		IssueInstant:                time.Now().UTC().Format(p.TimeFormat),
+		Destination:                 upstream.SingleSignOnURL,
+		ForceAuthn:                  request.ForceAuthn,
+		IsPassive:                   request.IsPassive,
+		ProtocolBinding:             PostBinding,
+		AssertionConsumerServiceURL: p.endpoints.assertionConsumerEndpoint.Absolute(IssuerFromContext(ctx)),
+		Issuer: &saml.NameIDType{
+			Format: "urn:oasis:names:tc:SAML:2.0:nameid-format:entity",
+			Text:   p.GetEntityID(ctx),
+		},
+		RequestedAuthnContext: request.RequestedAuthnContext,
+		Scoping:               scoping,
+	}
+}
+
+// upstreamRedirectURL returns the location of the signed AuthnRequest to the upstream identity provider
+// with the HTTP-Redirect binding, the ID of the auth request is used as RelayState
+func (p *IdentityProvider) upstreamRedirectURL(
+	ctx context.Context,
+	upstream *UpstreamIdentityProvider,
+	sp *serviceprovider.ServiceProvider,
+	request *samlp.AuthnRequestType,
+	authRequestID string,
+) (string, error) {
+	cert, key, err := p.getResponseCert(ctx)
+	if err != nil {
+		return "", err
+	}
+	return redirectRequestURL(
+		upstream.SingleSignOnURL,
+		p.makeUpstreamAuthnRequest(ctx, upstream, sp, request, authRequestID),
+		authRequestID,
+		key,
+		cert,
+		p.conf.SignatureAlgorithm,
+	)
+}
+
+// proxyAssertionConsumerHandleFunc receives the responses of the upstream identity providers with the HTTP-POST binding
+// and completes the auth requests with the authenticated users
+func (p *IdentityProvider) proxyAssertionConsumerHandleFunc(w http.ResponseWriter, r *http.Request) {
+	checkerInstance := checker.Checker{}
+	var proxyStorage ProxyStorage
+	var rawResponse []byte
+	var upstreamResponse *samlp.ResponseType
+	var authRequest models.AuthRequestInt
+	var upstream *UpstreamIdentityProvider
+	var err error
+
+	// the proxy mode is only available with the storage
+	checkerInstance.WithLogicStep(
+		func() error {
+			var ok bool
+			proxyStorage, ok = p.storage.(ProxyStorage)
+			if !ok {
+				err = fmt.Errorf("proxy mode is not supported")
+			}
+			return err
+		},
+		func() {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		},
+	)
+
+	// parse form and decode the response
+	checkerInstance.WithLogicStep(
+		func() error {
+			if err = r.ParseForm(); err != nil {
+				return err
+			}
+			rawResponse, err = xml.InflateAndDecode("", true, r.PostFormValue("SAMLResponse"))
+			if err != nil {
+				return err
+			}
+			upstreamResponse, err = xml.DecodeResponse("", false, string(rawResponse))
+			return err
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to decode response: %w", err).Error(), http.StatusBadRequest)
+		},
+	)
+
+	// get the auth request from the RelayState and check that the response belongs to it
+	checkerInstance.WithLogicStep(
+		func() error {
+			authRequest, err = p.storage.AuthRequestByID(r.Context(), r.PostFormValue("RelayState"))
+			if err != nil {
+				return err
+			}
+			if upstreamResponse.InResponseTo != upstreamRequestID(authRequest.GetID()) {
+				err = fmt.Errorf("response does not belong to the auth request")
+			}
+			return err
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to get request: %w", err).Error(), http.StatusBadRequest)
+		},
+	)
+
+	// get the upstream identity provider from the issuer of the response
+	checkerInstance.WithLogicStep(
+		func() error {
+			if upstreamResponse.Issuer == nil || upstreamResponse.Issuer.Text == "" {
+				err = fmt.Errorf("issuer is missing in response")
+				return err
+			}
+			upstream, err = proxyStorage.GetUpstreamIdentityProvider(r.Context(), upstreamResponse.Issuer.Text)
+			if err != nil {
+				return err
+			}
+			if upstream == nil {
+				err = fmt.Errorf("unknown upstream identity provider %s", upstreamResponse.Issuer.Text)
+			}
+			return err
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to find upstream identity provider: %w", err).Error(), http.StatusBadRequest)
+		},
+	)
+
+	// verify the signature of the response or the assertion, only the verified content is used afterwards
+	checkerInstance.WithLogicStep(
+		func() error {
+			upstreamResponse, err = serviceprovider.DecodeVerifiedResponse(upstream.Certificates, rawResponse)
+			return err
+		},
+		func() {
+			http.Error(w, fmt.Errorf("failed to verify signature: %w", err).Error(), http.StatusBadRequest)
+		},
+	)
+
+	//check and log errors if necessary
+	if checkerInstance.CheckFailed() {
+		return
+	}
+
+	callbackURL := p.endpoints.callbackEndpoint.Absolute(IssuerFromContext(r.Context())) + "?id=" + authRequest.GetID()
+
+	// a failed upstream authentication is answered to the service provider as failed by the callback
+	if upstreamResponse.Status.StatusCode.Value != StatusCodeSuccess {
+		logging.Errorf("authentication failed at upstream identity provider %s: %s", upstream.EntityID, upstreamResponse.Status.StatusCode.Value)
+		http.Redirect(w, r, callbackURL, http.StatusSeeOther)
+		return
+	}
+
+	assertion := upstreamResponse.Assertion
+	if err := p.verifyUpstreamAssertion(r.Context(), upstream, assertion, upstreamRequestID(authRequest.GetID()), authRequest.GetIssuer()); err != nil {
+		http.Error(w, fmt.Errorf("failed to verify assertion: %w", err).Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := proxyStorage.CompleteProxiedAuthRequest(r.Context(), authRequest.GetID(), assertion, authenticatingAuthority(assertion, upstream.EntityID), proxyRestriction(assertion)); err != nil {
+		logging.Error(err)
+		http.Error(w, fmt.Errorf("failed to complete request: %w", err).Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, callbackURL, http.StatusSeeOther)
+}
+
+// verifyUpstreamAssertion checks that the assertion was issued by the upstream identity provider for this identity provider
+// as answer to the request, is still valid and may be used to issue further assertions to the service provider
+func (p *IdentityProvider) verifyUpstreamAssertion(ctx context.Context, upstream *UpstreamIdentityProvider, assertion *saml.AssertionType, requestID string, spEntityID string) error {
+	if err := serviceprovider.ValidateAssertion(assertion, &serviceprovider.AssertionRequirements{
+		Issuer:       upstream.EntityID,
+		Audience:     p.GetEntityID(ctx),
+		Recipient:    p.endpoints.assertionConsumerEndpoint.Absolute(IssuerFromContext(ctx)),
+		InResponseTo: requestID,
+		ClockSkew:    serviceprovider.DefaultClockSkew,
+	}); err != nil {
+		return err
+	}
+	if assertion.Conditions != nil {
+		for _, restriction := range assertion.Conditions.ProxyRestriction {
+			if restriction.Count != nil && *restriction.Count <= 0 {
+				return fmt.Errorf("assertion must not be used to issue further assertions")
+			}
+			if len(restriction.Audience) > 0 && !slices.Contains(restriction.Audience, spEntityID) {
+				return fmt.Errorf("assertion must not be used to issue assertions to %s", spEntityID)
+			}
+		}
+	}
+	return nil
+}
+
+// proxyRestriction returns the ProxyRestriction of the assertions issued on the basis of the upstream assertion,
+// with the Count decremented and the Audiences allowed by all restrictions, nil if the upstream assertion is not restricted
+func proxyRestriction(assertion *saml.AssertionType) *saml.ProxyRestrictionType {
+	if assertion.Conditions == nil || len(assertion.Conditions.ProxyRestriction) == 0 {
+		return nil
+	}
+	restriction := &saml.ProxyRestrictionType{}
+	for _, upstream := range assertion.Conditions.ProxyRestriction {
+		mergeProxyRestriction(restriction, upstream)
+	}
+	if restriction.Count != nil {
+		count := *restriction.Count - 1
+		restriction.Count = &count
+	}
+	return restriction
+}
+
+// authenticatingAuthority returns the authenticating authorities of the assertion followed by the upstream identity provider
+func authenticatingAuthority(assertion *saml.AssertionType, upstreamEntityID string) []string {
+	authorities := make([]string, 0, 1)
+	for _, statement := range assertion.AuthnStatement {
+		for _, authority := range statement.AuthnContext.AuthenticatingAuthority {
+			if !slices.Contains(authorities, authority) {
+				authorities = append(authorities, authority)
+			}
+		}
+	}
+	if !slices.Contains(authorities, upstreamEntityID) {
+		authorities = append(authorities, upstreamEntityID)
+	}
+	return authorities
+}
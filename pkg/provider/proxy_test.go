@@ -0,0 +1,445 @@
+package provider
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zitadel/saml/pkg/provider/key"
+	"github.com/zitadel/saml/pkg/provider/mock"
+	"github.com/zitadel/saml/pkg/provider/serviceprovider"
+	"github.com/zitadel/saml/pkg/provider/signature"
+	"github.com/zitadel/saml/pkg/provider/xml"
+	"github.com/zitadel/saml/pkg/provider/xml/md"
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
+	"github.com/zitadel/saml/pkg/provider/xml/samlp"
+)
+
+const upstreamEntityID = "https://upstream.example.com/metadata"
+
+type proxyStorage struct {
+	*mock.MockIDPStorage
+	upstream         *UpstreamIdentityProvider
+	completed        string
+	authorities      []string
+	proxyRestriction *saml.ProxyRestrictionType
+}
+
+func (s *proxyStorage) GetUpstreamIdentityProvider(_ context.Context, entityID string) (*UpstreamIdentityProvider, error) {
+	if s.upstream != nil && entityID == s.upstream.EntityID {
+		return s.upstream, nil
+	}
+	return nil, nil
+}
+
+func (s *proxyStorage) CompleteProxiedAuthRequest(_ context.Context, authRequestID string, _ *saml.AssertionType, authenticatingAuthority []string, proxyRestriction *saml.ProxyRestrictionType) error {
+	s.completed = authRequestID
+	s.authorities = authenticatingAuthority
+	s.proxyRestriction = proxyRestriction
+	return nil
+}
+
+func scopingWithIDPList(proxyCount *int, providerIDs ...string) *samlp.ScopingType {
+	entries := make([]samlp.IDPEntryType, len(providerIDs))
+	for i, providerID := range providerIDs {
+		entries[i] = samlp.IDPEntryType{ProviderID: providerID}
+	}
+	return &samlp.ScopingType{ProxyCount: proxyCount, IDPList: &samlp.IDPListType{IDPEntry: entries}}
+}
+
+func TestProxy_upstreamIdentityProvider(t *testing.T) {
+	zero := 0
+	one := 1
+	type args struct {
+		storage   bool
+		discovery ProxyDiscovery
+		scoping   *samlp.ScopingType
+	}
+	type res struct {
+		upstream bool
+		err      string
+	}
+	tests := []struct {
+		name string
+		args args
+		res  res
+	}{
+		{
+			"no proxy storage",
+			args{false, nil, scopingWithIDPList(nil, upstreamEntityID)},
+			res{},
+		},
+		{
+			"no scoping",
+			args{true, nil, nil},
+			res{},
+		},
+		{
+			"upstream in IDPList",
+			args{true, nil, scopingWithIDPList(&one, "unknown", upstreamEntityID)},
+			res{upstream: true},
+		},
+		{
+			"identity provider in IDPList",
+			args{true, nil, scopingWithIDPList(nil, "https://idp.example.com/metadata", upstreamEntityID)},
+			res{},
+		},
+		{
+			"unknown identity providers in IDPList",
+			args{true, nil, scopingWithIDPList(nil, "unknown")},
+			res{err: StatusCodeNoSupportedIDP},
+		},
+		{
+			"proxy count exceeded",
+			args{true, nil, scopingWithIDPList(&zero, upstreamEntityID)},
+			res{err: StatusCodeProxyCountExceeded},
+		},
+		{
+			"discovery",
+			args{true, func(context.Context, *serviceprovider.ServiceProvider, *samlp.AuthnRequestType) (string, error) {
+				return upstreamEntityID, nil
+			}, nil},
+			res{upstream: true},
+		},
+		{
+			"discovery local",
+			args{true, func(context.Context, *serviceprovider.ServiceProvider, *samlp.AuthnRequestType) (string, error) {
+				return "", nil
+			}, scopingWithIDPList(nil, upstreamEntityID)},
+			res{},
+		},
+		{
+			"discovery failed",
+			args{true, func(context.Context, *serviceprovider.ServiceProvider, *samlp.AuthnRequestType) (string, error) {
+				return "", errors.New("failed")
+			}, nil},
+			res{err: StatusCodeResponder},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStorage := mock.NewMockIDPStorage(gomock.NewController(t))
+			var storage IDPStorage = mockStorage
+			if tt.args.storage {
+				storage = &proxyStorage{MockIDPStorage: mockStorage, upstream: &UpstreamIdentityProvider{EntityID: upstreamEntityID}}
+			}
+			idp, err := newTestIdentityProvider(NewEndpoint("metadata"), &IdentityProviderConfig{}, storage)
+			require.NoError(t, err)
+			idp.proxyDiscovery = tt.args.discovery
+
+			upstream, err := idp.upstreamIdentityProvider(
+				ContextWithIssuer(context.Background(), "https://idp.example.com"),
+				&serviceprovider.ServiceProvider{Metadata: &md.EntityDescriptorType{EntityID: "sp"}},
+				&samlp.AuthnRequestType{Scoping: tt.args.scoping},
+			)
+			if tt.res.err != "" {
+				require.Error(t, err)
+				assert.Equal(t, tt.res.err, err.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.res.upstream, upstream != nil)
+		})
+	}
+}
+
+func TestProxy_makeUpstreamAuthnRequest(t *testing.T) {
+	two := 2
+	idp, err := newTestIdentityProvider(NewEndpoint("metadata"), &IdentityProviderConfig{}, mock.NewMockIDPStorage(gomock.NewController(t)))
+	require.NoError(t, err)
+	scoping := scopingWithIDPList(&two, upstreamEntityID)
+	scoping.RequesterID = []string{"requester"}
+
+	request := idp.makeUpstreamAuthnRequest(
+		ContextWithIssuer(context.Background(), "https://idp.example.com"),
+		&UpstreamIdentityProvider{EntityID: upstreamEntityID, SingleSignOnURL: "https://upstream.example.com/SSO"},
+		&serviceprovider.ServiceProvider{Metadata: &md.EntityDescriptorType{EntityID: "sp"}},
+		&samlp.AuthnRequestType{Id: "request", IsPassive: "true", Scoping: scoping},
+		"authRequest",
+	)
+	assert.Equal(t, "_authRequest", request.Id)
+	assert.Equal(t, "https://upstream.example.com/SSO", request.Destination)
+	assert.Equal(t, "https://idp.example.com/acs", request.AssertionConsumerServiceURL)
+	assert.Equal(t, "https://idp.example.com/metadata", request.Issuer.Text)
+	assert.Equal(t, "true", request.IsPassive)
+	require.NotNil(t, request.Scoping)
+	require.NotNil(t, request.Scoping.ProxyCount)
+	assert.Equal(t, 1, *request.Scoping.ProxyCount)
+	assert.Equal(t, []string{"requester", "sp"}, request.Scoping.RequesterID)
+	assert.Equal(t, scoping.IDPList, request.Scoping.IDPList)
+	assert.Equal(t, 2, *scoping.ProxyCount)
+}
+
+func upstreamResponse(t *testing.T, signingKey *rsa.PrivateKey, signingCert *x509.Certificate, inResponseTo string, status string, sign bool, proxyRestriction ...saml.ProxyRestrictionType) string {
+	now := time.Now().UTC()
+	response := &samlp.ResponseType{
+		Id:           NewID(),
+		InResponseTo: inResponseTo,
+		Version:      "2.0",
+		IssueInstant: now.Format(DefaultTimeFormat),
+		Issuer:       &saml.NameIDType{Text: upstreamEntityID},
+		Status:       samlp.StatusType{StatusCode: samlp.StatusCodeType{Value: status}},
+	}
+	if status == StatusCodeSuccess {
+		response.Assertion = &saml.AssertionType{
+			Version:      "2.0",
+			Id:           NewID(),
+			IssueInstant: now.Format(DefaultTimeFormat),
+			Issuer:       saml.NameIDType{Text: upstreamEntityID},
+			Subject: &saml.SubjectType{
+				NameID: &saml.NameIDType{Text: "user"},
+				SubjectConfirmation: []saml.SubjectConfirmationType{{
+					Method: SubjectConfirmationMethodBearer,
+					SubjectConfirmationData: &saml.SubjectConfirmationDataType{
+						InResponseTo: inResponseTo,
+						Recipient:    "https://idp.example.com/acs",
+						NotOnOrAfter: now.Add(time.Minute).Format(DefaultTimeFormat),
+					},
+				}},
+			},
+			Conditions: &saml.ConditionsType{
+				NotBefore:           now.Add(-time.Minute).Format(DefaultTimeFormat),
+				NotOnOrAfter:        now.Add(time.Minute).Format(DefaultTimeFormat),
+				AudienceRestriction: []saml.AudienceRestrictionType{{Audience: []string{"https://idp.example.com/metadata"}}},
+				ProxyRestriction:    proxyRestriction,
+			},
+			AuthnStatement: []saml.AuthnStatementType{{
+				AuthnInstant: now.Format(DefaultTimeFormat),
+				AuthnContext: saml.AuthnContextType{
+					AuthnContextClassRef:    defaultAuthnContextClassRef,
+					AuthenticatingAuthority: []string{"https://home.example.com/metadata"},
+				},
+			}},
+		}
+		if sign {
+			signer, err := signature.GetSigner(signingCert.Raw, signingKey, dsig.RSASHA256SignatureMethod)
+			require.NoError(t, err)
+			response.Assertion.Signature, err = signature.Create(signer, response.Assertion)
+			require.NoError(t, err)
+		}
+	}
+	data, err := xml.Marshal(response)
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func TestProxy_proxyAssertionConsumerHandleFunc(t *testing.T) {
+	upstreamKey, upstreamCert := newKeyAndCertificate(t)
+	otherKey, otherCert := newKeyAndCertificate(t)
+
+	type args struct {
+		response string
+	}
+	type res struct {
+		code             int
+		completed        bool
+		authorities      []string
+		proxyRestriction *saml.ProxyRestrictionType
+	}
+	zero, one, two := 0, 1, 2
+	tests := []struct {
+		name string
+		args args
+		res  res
+	}{
+		{
+			"proxied authentication",
+			args{upstreamResponse(t, upstreamKey, upstreamCert, "_authRequest", StatusCodeSuccess, true)},
+			res{http.StatusSeeOther, true, []string{"https://home.example.com/metadata", upstreamEntityID}, nil},
+		},
+		{
+			"proxy restriction",
+			args{upstreamResponse(t, upstreamKey, upstreamCert, "_authRequest", StatusCodeSuccess, true,
+				saml.ProxyRestrictionType{Count: &two, Audience: []string{"https://sp.example.com/metadata", "https://other.example.com/metadata"}},
+				saml.ProxyRestrictionType{Count: &one},
+			)},
+			res{http.StatusSeeOther, true, []string{"https://home.example.com/metadata", upstreamEntityID}, &saml.ProxyRestrictionType{
+				Count:    &zero,
+				Audience: []string{"https://sp.example.com/metadata", "https://other.example.com/metadata"},
+			}},
+		},
+		{
+			"proxy restriction excludes service provider",
+			args{upstreamResponse(t, upstreamKey, upstreamCert, "_authRequest", StatusCodeSuccess, true,
+				saml.ProxyRestrictionType{Audience: []string{"https://other.example.com/metadata"}},
+			)},
+			res{code: http.StatusBadRequest},
+		},
+		{
+			"proxy restriction without count left",
+			args{upstreamResponse(t, upstreamKey, upstreamCert, "_authRequest", StatusCodeSuccess, true, saml.ProxyRestrictionType{Count: &zero})},
+			res{code: http.StatusBadRequest},
+		},
+		{
+			"failed upstream authentication",
+			args{upstreamResponse(t, upstreamKey, upstreamCert, "_authRequest", StatusCodeAuthNFailed, false)},
+			res{code: http.StatusSeeOther},
+		},
+		{
+			"response to other request",
+			args{upstreamResponse(t, upstreamKey, upstreamCert, "_other", StatusCodeSuccess, true)},
+			res{code: http.StatusBadRequest},
+		},
+		{
+			"unsigned assertion",
+			args{upstreamResponse(t, upstreamKey, upstreamCert, "_authRequest", StatusCodeSuccess, false)},
+			res{code: http.StatusBadRequest},
+		},
+		{
+			"unknown signing certificate",
+			args{upstreamResponse(t, otherKey, otherCert, "_authRequest", StatusCodeSuccess, true)},
+			res{code: http.StatusBadRequest},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			authRequest := mock.NewMockAuthRequestInt(ctrl)
+			authRequest.EXPECT().GetID().Return("authRequest").AnyTimes()
+			authRequest.EXPECT().GetIssuer().Return("https://sp.example.com/metadata").AnyTimes()
+			mockStorage := mock.NewMockIDPStorage(ctrl)
+			mockStorage.EXPECT().AuthRequestByID(gomock.Any(), "authRequest").Return(authRequest, nil)
+			storage := &proxyStorage{
+				MockIDPStorage: mockStorage,
+				upstream:       &UpstreamIdentityProvider{EntityID: upstreamEntityID, Certificates: []*x509.Certificate{upstreamCert}},
+			}
+			idp, err := newTestIdentityProvider(NewEndpoint("metadata"), &IdentityProviderConfig{}, storage)
+			require.NoError(t, err)
+
+			form := url.Values{"SAMLResponse": {tt.args.response}, "RelayState": {"authRequest"}}
+			req := httptest.NewRequest(http.MethodPost, "/acs", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			callHandlerFuncWithIssuerInterceptor("https://idp.example.com", w, req, idp.proxyAssertionConsumerHandleFunc)
+
+			res := w.Result()
+			defer res.Body.Close()
+			require.Equal(t, tt.res.code, res.StatusCode)
+			if tt.res.code == http.StatusSeeOther {
+				assert.Equal(t, "https://idp.example.com/login?id=authRequest", res.Header.Get("Location"))
+			}
+			assert.Equal(t, tt.res.completed, storage.completed == "authRequest")
+			assert.Equal(t, tt.res.authorities, storage.authorities)
+			assert.Equal(t, tt.res.proxyRestriction, storage.proxyRestriction)
+		})
+	}
+}
+
+func TestProxy_ssoHandleFunc(t *testing.T) {
+	idpKey, idpCert := newKeyAndCertificate(t)
+	ctrl := gomock.NewController(t)
+	authRequest := mock.NewMockAuthRequestInt(ctrl)
+	authRequest.EXPECT().GetID().Return("authRequest").AnyTimes()
+	sp := &serviceprovider.ServiceProvider{
+		ID: "app",
+		Metadata: &md.EntityDescriptorType{
+			EntityID: "https://sp.example.com/metadata",
+			SPSSODescriptor: &md.SPSSODescriptorType{
+				AssertionConsumerService: []md.IndexedEndpointType{{Binding: PostBinding, Location: "https://sp.example.com/acs", Index: "0"}},
+			},
+		},
+	}
+	mockStorage := mock.NewMockIDPStorage(ctrl)
+	mockStorage.EXPECT().GetEntityByID(gomock.Any(), "https://sp.example.com/metadata").Return(sp, nil)
+	mockStorage.EXPECT().CreateAuthRequest(gomock.Any(), gomock.Any(), "https://sp.example.com/acs", PostBinding, "state", "app").Return(authRequest, nil)
+	mockStorage.EXPECT().GetResponseSigningKey(gomock.Any()).Return(&key.CertificateAndKey{Certificate: idpCert.Raw, Key: idpKey}, nil).AnyTimes()
+	storage := &proxyStorage{
+		MockIDPStorage: mockStorage,
+		upstream:       &UpstreamIdentityProvider{EntityID: upstreamEntityID, SingleSignOnURL: "https://upstream.example.com/SSO"},
+	}
+	idp, err := newTestIdentityProvider(NewEndpoint("metadata"), &IdentityProviderConfig{SignatureAlgorithm: dsig.RSASHA256SignatureMethod}, storage)
+	require.NoError(t, err)
+
+	one := 1
+	request, err := xml.Marshal(&samlp.AuthnRequestType{
+		Id:           "request",
+		Version:      "2.0",
+		IssueInstant: time.Now().UTC().Format(DefaultTimeFormat),
+		Issuer:       &saml.NameIDType{Text: "https://sp.example.com/metadata"},
+		Scoping:      scopingWithIDPList(&one, upstreamEntityID),
+	})
+	require.NoError(t, err)
+	form := url.Values{"SAMLRequest": {base64.StdEncoding.EncodeToString(request)}, "RelayState": {"state"}}
+	req := httptest.NewRequest(http.MethodPost, "/SSO", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	callHandlerFuncWithIssuerInterceptor("https://idp.example.com", w, req, idp.ssoHandleFunc)
+
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, http.StatusSeeOther, res.StatusCode)
+	location, err := url.Parse(res.Header.Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "upstream.example.com", location.Host)
+	assert.Equal(t, "authRequest", location.Query().Get("RelayState"))
+	assert.Equal(t, dsig.RSASHA256SignatureMethod, location.Query().Get("SigAlg"))
+	assert.NotEmpty(t, location.Query().Get("Signature"))
+
+	upstreamRequest, err := xml.DecodeAuthNRequest(xml.EncodingDeflate, location.Query().Get("SAMLRequest"))
+	require.NoError(t, err)
+	assert.Equal(t, "_authRequest", upstreamRequest.Id)
+	require.NotNil(t, upstreamRequest.Scoping)
+	require.NotNil(t, upstreamRequest.Scoping.ProxyCount)
+	assert.Equal(t, 0, *upstreamRequest.Scoping.ProxyCount)
+	assert.Equal(t, []string{"https://sp.example.com/metadata"}, upstreamRequest.Scoping.RequesterID)
+}
+
+// proxiedAuthRequest is an auth request completed by the ProxyStorage with the authenticating authorities
+type proxiedAuthRequest struct {
+	*mock.MockAuthRequestInt
+	authorities      []string
+	proxyRestriction *saml.ProxyRestrictionType
+}
+
+func (a *proxiedAuthRequest) GetAuthenticatingAuthority() []string {
+	return a.authorities
+}
+
+func (a *proxiedAuthRequest) GetProxyRestriction() *saml.ProxyRestrictionType {
+	return a.proxyRestriction
+}
+
+func TestProxy_loginResponse(t *testing.T) {
+	idpKey, idpCert := newKeyAndCertificate(t)
+	mockStorage := mock.NewMockIDPStorage(gomock.NewController(t))
+	mockStorage.EXPECT().GetEntityByID(gomock.Any(), "sp").Return(&serviceprovider.ServiceProvider{
+		Metadata: &md.EntityDescriptorType{EntityID: "sp", SPSSODescriptor: &md.SPSSODescriptorType{}},
+	}, nil)
+	mockStorage.EXPECT().SetUserinfoWithUserID(gomock.Any(), "app", gomock.Any(), "user", gomock.Any()).Return(nil)
+	// the storage implements no SessionStorage, the authorities are carried by the auth request
+	idp, err := newTestIdentityProvider(NewEndpoint("metadata"), &IdentityProviderConfig{SignatureAlgorithm: dsig.RSASHA256SignatureMethod}, &proxyStorage{MockIDPStorage: mockStorage})
+	require.NoError(t, err)
+	idp.responseSigningKey = &key.CertificateAndKey{Certificate: idpCert.Raw, Key: idpKey}
+
+	authRequest := mock.NewMockAuthRequestInt(gomock.NewController(t))
+	authRequest.EXPECT().Done().Return(true)
+	authRequest.EXPECT().GetApplicationID().Return("app")
+	authRequest.EXPECT().GetUserID().Return("user")
+	zero := 0
+	proxyRestriction := &saml.ProxyRestrictionType{Count: &zero, Audience: []string{"sp"}}
+	response, err := idp.loginResponse(context.Background(), &proxiedAuthRequest{MockAuthRequestInt: authRequest, authorities: []string{upstreamEntityID}, proxyRestriction: proxyRestriction}, &Response{
+		RequestID: "request",
+		Issuer:    "https://idp.example.com/metadata",
+		Audience:  "sp",
+		AcsUrl:    "https://sp.example.com/acs",
+	})
+	require.NoError(t, err)
+	require.NotNil(t, response.Assertion)
+	require.Len(t, response.Assertion.AuthnStatement, 1)
+	assert.Equal(t, []string{upstreamEntityID}, response.Assertion.AuthnStatement[0].AuthnContext.AuthenticatingAuthority)
+	require.NotNil(t, response.Assertion.Conditions)
+	assert.Equal(t, []saml.ProxyRestrictionType{*proxyRestriction}, response.Assertion.Conditions.ProxyRestriction)
+}
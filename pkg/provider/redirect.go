@@ -5,12 +5,12 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net/url"
+	"strings"
 
 	"github.com/zitadel/saml/pkg/provider/serviceprovider"
 	"github.com/zitadel/saml/pkg/provider/signature"
 	"github.com/zitadel/saml/pkg/provider/xml"
 	"github.com/zitadel/saml/pkg/provider/xml/md"
-	"github.com/zitadel/saml/pkg/provider/xml/samlp"
 )
 
 func signatureRedirectVerificationNecessary(
@@ -66,7 +66,7 @@ func verifyRedirectSignature(
 }
 
 func createRedirectSignature(
-	samlResponse *samlp.ResponseType,
+	samlResponse interface{},
 	key *rsa.PrivateKey,
 	cert []byte,
 	signatureAlgorithm string,
@@ -100,6 +100,40 @@ func createRedirectSignature(
 	return url.QueryEscape(base64.StdEncoding.EncodeToString(sig)), url.QueryEscape(base64.StdEncoding.EncodeToString([]byte(signatureAlgorithm))), nil
 }
 
+// redirectRequestURL returns the location with the deflated and signed request of the HTTP-Redirect binding
+func redirectRequestURL(
+	location string,
+	request interface{},
+	relayState string,
+	key *rsa.PrivateKey,
+	cert []byte,
+	signatureAlgorithm string,
+) (string, error) {
+	req, err := xml.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	reqData, err := xml.DeflateAndBase64(req)
+	if err != nil {
+		return "", err
+	}
+
+	query := "SAMLRequest=" + url.QueryEscape(string(reqData))
+	if relayState != "" {
+		query += "&RelayState=" + url.QueryEscape(relayState)
+	}
+	query, err = signature.CreateRedirectQuery(cert, key, signatureAlgorithm, query)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.Contains(location, "?") {
+		return location + "&" + query, nil
+	}
+	return location + "?" + query, nil
+}
+
 func BuildRedirectQuery(
 	response string,
 	relayState string,
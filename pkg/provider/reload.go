@@ -0,0 +1,47 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// reloadable holds the Provider built by the last Reload, which serves the requests and the calls of the Provider
+type reloadable struct {
+	newProvider func(conf *Config, opts []Option) (*Provider, error)
+	current     atomic.Pointer[Provider]
+}
+
+// Reload rebuilds the Provider with the configuration and atomically swaps it in,
+// e.g. to apply changed templates, algorithms, endpoints or branding of the metadata without a restart.
+// The options of NewProvider are applied followed by opts, e.g. WithSigningKeys with renewed keys.
+// The storage and the issuer are kept, the cached metadata is discarded and
+// requests in flight finish with the previous configuration.
+// The previous configuration stays active if the new one is invalid.
+func (p *Provider) Reload(conf *Config, opts ...Option) error {
+	if p.reload == nil {
+		return errors.New("provider does not support reload")
+	}
+	next, err := p.reload.newProvider(conf, opts)
+	if err != nil {
+		return fmt.Errorf("failed to reload provider: %w", err)
+	}
+	next.reload = nil
+	p.reload.current.Store(next)
+	return nil
+}
+
+// current returns the Provider of the last Reload, the Provider itself if it was never reloaded
+func (p *Provider) current() *Provider {
+	if p.reload == nil {
+		return p
+	}
+	return p.reload.current.Load()
+}
+
+// reloadHandle dispatches the request to the router of the current Provider,
+// which serves it to the end even if the Provider is reloaded in the meantime
+func (p *Provider) reloadHandle(w http.ResponseWriter, r *http.Request) {
+	p.current().httpHandler.ServeHTTP(w, r)
+}
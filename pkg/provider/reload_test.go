@@ -0,0 +1,62 @@
+package provider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zitadel/saml/pkg/provider/key"
+	"github.com/zitadel/saml/pkg/provider/mock"
+	"github.com/zitadel/saml/pkg/provider/xml"
+)
+
+func TestReload_Reload(t *testing.T) {
+	idpKey, idpCert := newKeyAndCertificate(t)
+	renewedKey, renewedCert := newKeyAndCertificate(t)
+	signingKey := &key.CertificateAndKey{Certificate: idpCert.Raw, Key: idpKey}
+
+	provider, err := NewProvider(mock.NewMockStorage(gomock.NewController(t)), IssuerFromHost(""), &Config{
+		IDPConfig:    &IdentityProviderConfig{},
+		Organisation: &Organisation{Name: "before"},
+	}, WithSigningKeys(signingKey, nil))
+	require.NoError(t, err)
+	handler := provider.HttpHandler()
+
+	getMetadata := func(path string) (int, string, string) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://idp.example.com/"+path, nil))
+		if w.Code != http.StatusOK {
+			return w.Code, "", ""
+		}
+		metadata, err := xml.ParseMetadataXmlIntoStruct(w.Body.Bytes())
+		require.NoError(t, err)
+		return w.Code, metadata.Organization.OrganizationName[0].Text, metadata.IDPSSODescriptor.KeyDescriptor[0].KeyInfo.X509Data[0].X509Certificate
+	}
+	code, name, before := getMetadata("metadata")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "before", name)
+
+	// an invalid reload keeps the previous configuration
+	assert.Error(t, provider.Reload(&Config{IDPConfig: &IdentityProviderConfig{}}, WithSigningKeys(nil, nil)))
+	code, name, _ = getMetadata("metadata")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "before", name)
+
+	require.NoError(t, provider.Reload(&Config{
+		IDPConfig:      &IdentityProviderConfig{},
+		MetadataConfig: &MetadataConfig{Path: "saml/metadata"},
+		Organisation:   &Organisation{Name: "after"},
+	}, WithSigningKeys(&key.CertificateAndKey{Certificate: renewedCert.Raw, Key: renewedKey}, nil)))
+
+	code, _, _ = getMetadata("metadata")
+	assert.Equal(t, http.StatusNotFound, code)
+	code, name, after := getMetadata("saml/metadata")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "after", name)
+	assert.NotEqual(t, before, after)
+	assert.Equal(t, "https://idp.example.com/saml/metadata", provider.GetEntityID(ContextWithIssuer(t.Context(), "https://idp.example.com")))
+}
@@ -2,12 +2,14 @@ package provider
 
 import (
 	"crypto/rsa"
+	"crypto/x509"
 	"encoding/base64"
 	"fmt"
 	"html/template"
 	"net/http"
 	"time"
 
+	"github.com/zitadel/saml/pkg/provider/serviceprovider"
 	"github.com/zitadel/saml/pkg/provider/xml"
 	"github.com/zitadel/saml/pkg/provider/xml/saml"
 	"github.com/zitadel/saml/pkg/provider/xml/samlp"
@@ -20,12 +22,19 @@ const (
 	StatusCodeInvalidAttrNameOrValue = "urn:oasis:names:tc:SAML:2.0:status:InvalidAttrNameOrValue"
 	StatusCodeInvalidNameIDPolicy    = "urn:oasis:names:tc:SAML:2.0:status:InvalidNameIDPolicy"
 	StatusCodeRequestDenied          = "urn:oasis:names:tc:SAML:2.0:status:RequestDenied"
+	StatusCodeRequester              = "urn:oasis:names:tc:SAML:2.0:status:Requester"
 	StatusCodeRequestUnsupported     = "urn:oasis:names:tc:SAML:2.0:status:RequestUnsupported"
 	StatusCodeUnsupportedBinding     = "urn:oasis:names:tc:SAML:2.0:status:UnsupportedBinding"
+	StatusCodeUnknownPrincipal       = "urn:oasis:names:tc:SAML:2.0:status:UnknownPrincipal"
 	StatusCodeResponder              = "urn:oasis:names:tc:SAML:2.0:status:Responder"
 	StatusCodePartialLogout          = "urn:oasis:names:tc:SAML:2.0:status:PartialLogout"
+	StatusCodeNoSupportedIDP         = "urn:oasis:names:tc:SAML:2.0:status:NoSupportedIDP"
+	StatusCodeProxyCountExceeded     = "urn:oasis:names:tc:SAML:2.0:status:ProxyCountExceeded"
 )
 
+// defaultAuthnContextClassRef is used for AuthnStatements if the session provides no class
+const defaultAuthnContextClassRef = "urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport"
+
 type Response struct {
 	PostTemplate    *template.Template
 	ProtocolBinding string
@@ -39,6 +48,18 @@ type Response struct {
 	Issuer    string
 	Audience  string
 	SendIP    string
+	// ClientAddress of the user agent, which is added as SubjectLocality of the AuthnStatement
+	ClientAddress string
+	// ClientCertificate of the user agent, which is used for holder-of-key subject confirmation
+	ClientCertificate *x509.Certificate
+
+	assertionConfig *serviceprovider.AssertionConfig
+	session         *Session
+	sessionIndex    string
+	// authenticatingAuthority of the auth request completed in the proxy mode, see models.AuthenticatingAuthorityGetter
+	authenticatingAuthority []string
+	// proxyRestriction of the auth request completed in the proxy mode, see models.ProxyRestrictionGetter
+	proxyRestriction *saml.ProxyRestrictionType
 }
 
 type authResponseForm struct {
@@ -96,7 +117,7 @@ func (r *Response) sendBackResponse(
 
 func createSignature(response *Response, samlResponse *samlp.ResponseType, key *rsa.PrivateKey, cert []byte, signatureAlgorithm string) error {
 	switch response.ProtocolBinding {
-	case PostBinding:
+	case PostBinding, PAOSBinding:
 		if err := createPostSignature(samlResponse, key, cert, signatureAlgorithm); err != nil {
 			return fmt.Errorf("failed to sign response: %w", err)
 		}
@@ -134,11 +155,24 @@ func (r *Response) makeSuccessfulResponse(
 	expiration time.Duration,
 ) *samlp.ResponseType {
 	now := time.Now().UTC()
-	return r.makeAssertionResponse(
+	response := r.makeAssertionResponse(
 		now.Format(timeFormat),
-		now.Add(expiration).Format(timeFormat),
+		now.Add(assertionExpiration(r.assertionConfig, expiration)).Format(timeFormat),
 		attributes,
 	)
+	authInstant := now
+	if r.session != nil && !r.session.AuthInstant.IsZero() {
+		authInstant = r.session.AuthInstant.UTC()
+	}
+	applySession(response.Assertion, r.session, r.sessionIndex, timeFormat)
+	if len(r.authenticatingAuthority) > 0 {
+		for i := range response.Assertion.AuthnStatement {
+			response.Assertion.AuthnStatement[i].AuthnContext.AuthenticatingAuthority = r.authenticatingAuthority
+		}
+	}
+	applyAssertionConfig(response.Assertion, r.assertionConfig, authInstant, timeFormat)
+	applyProxyRestriction(response.Assertion, r.proxyRestriction)
+	return response
 }
 
 func (r *Response) makeAssertionResponse(
@@ -148,8 +182,20 @@ func (r *Response) makeAssertionResponse(
 ) *samlp.ResponseType {
 
 	response := makeResponse(NewID(), r.RequestID, r.AcsUrl, issueInstant, StatusCodeSuccess, "", r.Issuer)
-	assertion := makeAssertion(r.RequestID, r.AcsUrl, r.SendIP, issueInstant, untilInstant, r.Issuer, attributes.GetNameID(), attributes.GetSAML(), r.Audience, true)
-	response.Assertion = *assertion
+	sendIP := r.SendIP
+	if sendIP == "" && r.assertionConfig != nil && r.assertionConfig.BindClientAddress {
+		sendIP = r.ClientAddress
+	}
+	assertion := makeAssertion(r.RequestID, r.AcsUrl, sendIP, issueInstant, untilInstant, r.Issuer, attributes.GetNameID(), attributes.getSAMLStatements(), r.Audience, true)
+	if r.ClientAddress != "" {
+		for i := range assertion.AuthnStatement {
+			assertion.AuthnStatement[i].SubjectLocality = &saml.SubjectLocalityType{Address: r.ClientAddress}
+		}
+	}
+	if r.assertionConfig != nil && r.assertionConfig.HolderOfKey {
+		applyHolderOfKey(assertion, r.ClientCertificate)
+	}
+	response.Assertion = assertion
 	return response
 }
 
@@ -168,6 +214,7 @@ func makeAttributeQueryResponse(
 	queriedAttrs []saml.AttributeType,
 	timeFormat string,
 	expiration time.Duration,
+	assertionConfig *serviceprovider.AssertionConfig,
 ) *samlp.ResponseType {
 	now := time.Now().UTC()
 	providedAttrs := []*saml.AttributeType{}
@@ -186,9 +233,15 @@ func makeAttributeQueryResponse(
 		}
 	}
 
+	statements := make([]saml.AttributeStatementType, 0, 1)
+	if len(providedAttrs) > 0 {
+		statements = append(statements, saml.AttributeStatementType{Attribute: providedAttrs})
+	}
+
 	response := makeResponse(NewID(), requestID, "", now.Format(timeFormat), StatusCodeSuccess, "", issuer)
-	assertion := makeAssertion(requestID, "", "", now.Format(timeFormat), now.Add(expiration).Format(timeFormat), issuer, attributes.GetNameID(), providedAttrs, entityID, false)
-	response.Assertion = *assertion
+	assertion := makeAssertion(requestID, "", "", now.Format(timeFormat), now.Add(assertionExpiration(assertionConfig, expiration)).Format(timeFormat), issuer, attributes.GetNameID(), statements, entityID, false)
+	applyAssertionConfig(assertion, assertionConfig, now, timeFormat)
+	response.Assertion = assertion
 	return response
 }
 
@@ -200,7 +253,7 @@ func makeAssertion(
 	untilInstant string,
 	issuer string,
 	nameID *saml.NameIDType,
-	attributes []*saml.AttributeType,
+	attributeStatements []saml.AttributeStatementType,
 	audience string,
 	authN bool,
 ) *saml.AssertionType {
@@ -216,7 +269,7 @@ func makeAssertion(
 			NameID: nameID,
 			SubjectConfirmation: []saml.SubjectConfirmationType{
 				{
-					Method: "urn:oasis:names:tc:SAML:2.0:cm:bearer",
+					Method: SubjectConfirmationMethodBearer,
 					SubjectConfirmationData: &saml.SubjectConfirmationDataType{
 						InResponseTo: requestID,
 						NotOnOrAfter: untilInstant,
@@ -231,9 +284,7 @@ func makeAssertion(
 				{Audience: []string{audience}},
 			},
 		},
-		AttributeStatement: []saml.AttributeStatementType{
-			{Attribute: attributes},
-		},
+		AttributeStatement: attributeStatements,
 	}
 	if acsURL != "" {
 		ret.Subject.SubjectConfirmation[0].SubjectConfirmationData.Recipient = acsURL
@@ -247,7 +298,7 @@ func makeAssertion(
 				AuthnInstant: issueInstant,
 				SessionIndex: id,
 				AuthnContext: saml.AuthnContextType{
-					AuthnContextClassRef: "urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport",
+					AuthnContextClassRef: defaultAuthnContextClassRef,
 				},
 			},
 		}
@@ -0,0 +1,120 @@
+package provider
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/zitadel/saml/pkg/provider/serviceprovider"
+)
+
+// WithoutHealthRoutes disables the health and readiness endpoints,
+// e.g. if the Provider is embedded into a server serving its own /healthz and /ready
+func WithoutHealthRoutes() Option {
+	return func(p *Provider) error {
+		p.withoutHealthRoutes = true
+		return nil
+	}
+}
+
+// routes returns the endpoints of the Provider without interceptors,
+// all requests besides the health and readiness are dispatched to the tenants if the Provider has tenants
+func (p *Provider) routes() []*Route {
+	get := []string{http.MethodGet}
+	var routes []*Route
+	if !p.withoutHealthRoutes {
+		routes = append(routes,
+			&Route{Name: "Health", Endpoint: healthEndpoint, Methods: get, HandleFunc: healthHandler},
+			&Route{Name: "Ready", Endpoint: readinessEndpoint, Methods: get, HandleFunc: readyHandler(p.Probes())},
+		)
+	}
+	if p.tenants != nil {
+		return append(routes, &Route{Name: "Tenant", Endpoint: "/", Prefix: true, HandleFunc: p.tenantHandle})
+	}
+	routes = append(routes,
+		&Route{Name: "Metadata", Endpoint: p.metadataEndpoint.Relative(), Methods: get, HandleFunc: p.metadataHandle},
+		&Route{
+			Name:       "MetadataQuery",
+			Endpoint:   strings.TrimSuffix(p.metadataQueryEndpoint.Relative(), "/") + serviceprovider.MetadataQueryPath,
+			Prefix:     true,
+			Methods:    get,
+			HandleFunc: p.metadataQueryHandle,
+		},
+	)
+	if p.identityProvider != nil {
+		routes = append(routes, p.identityProvider.GetRoutes()...)
+	}
+	return routes
+}
+
+// Routes returns the endpoints of the Provider to mount them on any router, e.g. chi or echo.
+// The handlers include the interceptors of the Provider and serve the requests with the configuration of the last Reload,
+// the endpoints are the ones of the current configuration.
+func (p *Provider) Routes() []*Route {
+	current := p.current()
+	wrap := intercept(current.issuerInterceptor(), current.interceptors...)
+	if current.tenants != nil {
+		wrap = current.issuerInterceptor().Handler
+	}
+	routes := current.routes()
+	for _, route := range routes {
+		name := route.Name
+		route.HandleFunc = wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p.current().routeHandle(name, w, r)
+		})).ServeHTTP
+	}
+	return routes
+}
+
+// routeHandlers returns the handlers of the routes by their names, built once per Provider
+func routeHandlers(routes []*Route) map[string]http.HandlerFunc {
+	handlers := make(map[string]http.HandlerFunc, len(routes))
+	for _, route := range routes {
+		handlers[route.Name] = route.HandleFunc
+	}
+	return handlers
+}
+
+// routeHandle serves the request with the handler of the route with the name, 404 Not Found if the route was removed
+func (p *Provider) routeHandle(name string, w http.ResponseWriter, r *http.Request) {
+	if handle, ok := p.routeHandlers[name]; ok {
+		handle(w, r)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// RegisterRoutes mounts the Routes on the http.ServeMux with a pattern per allowed method, e.g. "GET /metadata"
+func (p *Provider) RegisterRoutes(mux *http.ServeMux) {
+	for _, route := range p.Routes() {
+		pattern := serveMuxPattern(route)
+		methods := routeMethods(route)
+		if len(methods) == 0 {
+			mux.HandleFunc(pattern, route.HandleFunc)
+			continue
+		}
+		for _, method := range methods {
+			mux.HandleFunc(method+" "+pattern, route.HandleFunc)
+		}
+	}
+}
+
+// routeMethods returns the allowed methods of the route and OPTIONS for the CORS preflight requests,
+// which are answered by the interceptors of the Provider. All methods are allowed if empty.
+func routeMethods(route *Route) []string {
+	if len(route.Methods) == 0 || slices.Contains(route.Methods, http.MethodOptions) {
+		return route.Methods
+	}
+	return append(slices.Clone(route.Methods), http.MethodOptions)
+}
+
+// serveMuxPattern returns the path pattern of the route, patterns ending with a slash match all paths below
+func serveMuxPattern(route *Route) string {
+	switch {
+	case route.Prefix && !strings.HasSuffix(route.Endpoint, "/"):
+		return route.Endpoint + "/"
+	case !route.Prefix && strings.HasSuffix(route.Endpoint, "/"):
+		return route.Endpoint + "{$}"
+	}
+	return route.Endpoint
+}
@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zitadel/saml/pkg/provider/key"
+	"github.com/zitadel/saml/pkg/provider/mock"
+)
+
+func TestRoutes_RegisterRoutes(t *testing.T) {
+	idpKey, idpCert := newKeyAndCertificate(t)
+	provider, err := NewProvider(mock.NewMockStorage(gomock.NewController(t)), IssuerFromHost(""), &Config{
+		IDPConfig: &IdentityProviderConfig{},
+	}, WithSigningKeys(&key.CertificateAndKey{Certificate: idpCert.Raw, Key: idpKey}, nil), WithoutHealthRoutes())
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	provider.RegisterRoutes(mux)
+
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		preflight bool
+		status    int
+	}{
+		{"own health", http.MethodGet, "/healthz", false, http.StatusTeapot},
+		{"metadata", http.MethodGet, "/metadata", false, http.StatusOK},
+		{"metadata head", http.MethodHead, "/metadata", false, http.StatusOK},
+		{"metadata method not allowed", http.MethodPost, "/metadata", false, http.StatusMethodNotAllowed},
+		{"metadata query", http.MethodGet, "/entities/" + url.PathEscape("https://idp.example.com/metadata"), false, http.StatusOK},
+		{"metadata query unknown", http.MethodGet, "/entities/unknown", false, http.StatusNotFound},
+		{"certificate", http.MethodGet, "/certificate", false, http.StatusOK},
+		{"attribute query method not allowed", http.MethodGet, "/attribute", false, http.StatusMethodNotAllowed},
+		{"attribute query preflight", http.MethodOptions, "/attribute", true, http.StatusOK},
+		{"unknown", http.MethodGet, "/unknown", false, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		for name, handler := range map[string]http.Handler{"serve mux": mux, "router": provider.HttpHandler()} {
+			if tt.name == "own health" && name == "router" {
+				continue
+			}
+			t.Run(tt.name+" "+name, func(t *testing.T) {
+				r := httptest.NewRequest(tt.method, "https://idp.example.com"+tt.path, nil)
+				if tt.preflight {
+					r.Header.Set("Origin", "https://sp.example.com")
+					r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+				}
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				assert.Equal(t, tt.status, w.Code)
+				if tt.preflight {
+					assert.Equal(t, "https://sp.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+				}
+			})
+		}
+	}
+}
+
+func TestRoutes_Routes(t *testing.T) {
+	provider, err := NewProvider(mock.NewMockStorage(gomock.NewController(t)), IssuerFromHost(""), &Config{
+		IDPConfig: &IdentityProviderConfig{Endpoints: &EndpointConfig{SingleSignOn: &Endpoint{path: "saml/sso"}}},
+	})
+	require.NoError(t, err)
+
+	routes := make(map[string]*Route)
+	for _, route := range provider.Routes() {
+		routes[route.Name] = route
+	}
+	require.Contains(t, routes, "Health")
+	require.Contains(t, routes, "SingleSignOn")
+	assert.Equal(t, "/saml/sso", routes["SingleSignOn"].Endpoint)
+	assert.Equal(t, []string{http.MethodGet, http.MethodPost}, routes["SingleSignOn"].Methods)
+	assert.Equal(t, []string{RedirectBinding, PostBinding, PAOSBinding}, routes["SingleSignOn"].Bindings)
+	assert.True(t, routes["MetadataQuery"].Prefix)
+
+	// the health routes of the built-in router are disabled by the option
+	provider, err = NewProvider(mock.NewMockStorage(gomock.NewController(t)), IssuerFromHost(""), &Config{
+		IDPConfig: &IdentityProviderConfig{},
+	}, WithoutHealthRoutes())
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	provider.HttpHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://idp.example.com/healthz", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,144 @@
+package serviceprovider
+
+import (
+	"crypto/x509"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/beevik/etree"
+
+	"github.com/zitadel/saml/pkg/provider/signature"
+	"github.com/zitadel/saml/pkg/provider/xml"
+	"github.com/zitadel/saml/pkg/provider/xml/md"
+)
+
+// AggregateConfig configures the import of the service providers of a metadata aggregate (EntitiesDescriptor),
+// as published by federations like InCommon or eduGAIN
+type AggregateConfig struct {
+	// Certificates are the pinned certificates, one of which the aggregate has to be signed with
+	Certificates []*x509.Certificate
+	// EntityCategories filters the service providers to those with at least one of the entity categories,
+	// all service providers are imported if empty
+	EntityCategories []string
+	// Config is used for all imported service providers, its Metadata is ignored
+	Config *Config
+	// ID returns the ID of the service provider, defaults to the entityID
+	ID func(entityID string) string
+}
+
+// Aggregate contains the service providers imported from a metadata aggregate
+type Aggregate struct {
+	Name             string
+	ValidUntil       time.Time
+	ServiceProviders []*ServiceProvider
+	// Skipped are the errors of the service providers which could not be imported, by their entityIDs
+	Skipped map[string]error
+}
+
+// ImportAggregate verifies the signature and the validity of the metadata aggregate
+// and returns the service providers it contains, filtered by their entity categories.
+// Entities whose own validity has expired are skipped.
+func ImportAggregate(data []byte, config *AggregateConfig, loginURL func(string) string) (*Aggregate, error) {
+	if len(config.Certificates) == 0 {
+		return nil, fmt.Errorf("a certificate to verify the aggregate is required")
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, fmt.Errorf("failed to parse aggregate: %w", err)
+	}
+	if doc.Root() == nil || doc.Root().SelectElement("Signature") == nil {
+		return nil, fmt.Errorf("aggregate is not signed")
+	}
+	verified, err := signature.ValidatePostElement(config.Certificates, doc.Root())
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify signature of aggregate: %w", err)
+	}
+
+	// the entities are only taken from the verified element, content outside the signed reference is ignored
+	verifiedDoc := etree.NewDocument()
+	verifiedDoc.SetRoot(verified)
+	verifiedData, err := verifiedDoc.WriteToBytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode verified aggregate: %w", err)
+	}
+	metadata, err := xml.ParseMetadataAggregateIntoStruct(verifiedData)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if metadata.ValidUntil == "" {
+		return nil, fmt.Errorf("aggregate has no validUntil")
+	}
+	validUntil, err := time.Parse(time.RFC3339, metadata.ValidUntil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse validUntil of aggregate: %w", err)
+	}
+	if !now.Before(validUntil) {
+		return nil, fmt.Errorf("aggregate expired at %s", metadata.ValidUntil)
+	}
+
+	spConfig := config.Config
+	if spConfig == nil {
+		spConfig = &Config{}
+	}
+	id := config.ID
+	if id == nil {
+		id = func(entityID string) string { return entityID }
+	}
+	aggregate := &Aggregate{
+		Name:       metadata.Name,
+		ValidUntil: validUntil,
+		Skipped:    make(map[string]error),
+	}
+	for _, entity := range aggregateEntities(metadata, now) {
+		if entity.SPSSODescriptor == nil || !hasEntityCategory(entity, config.EntityCategories) {
+			continue
+		}
+		if !isValid(entity.ValidUntil, now) {
+			aggregate.Skipped[string(entity.EntityID)] = fmt.Errorf("metadata expired at %s", entity.ValidUntil)
+			continue
+		}
+		sp, err := newServiceProvider(id(string(entity.EntityID)), entity, spConfig, loginURL)
+		if err != nil {
+			aggregate.Skipped[string(entity.EntityID)] = err
+			continue
+		}
+		aggregate.ServiceProviders = append(aggregate.ServiceProviders, sp)
+	}
+	return aggregate, nil
+}
+
+// aggregateEntities returns the entities of the aggregate and of its nested aggregates which are still valid
+func aggregateEntities(metadata *md.EntitiesDescriptorType, now time.Time) []*md.EntityDescriptorType {
+	entities := make([]*md.EntityDescriptorType, 0, len(metadata.EntityDescriptor))
+	for i := range metadata.EntityDescriptor {
+		entities = append(entities, &metadata.EntityDescriptor[i])
+	}
+	for i := range metadata.EntitiesDescriptor {
+		nested := &metadata.EntitiesDescriptor[i]
+		if !isValid(nested.ValidUntil, now) {
+			continue
+		}
+		entities = append(entities, aggregateEntities(nested, now)...)
+	}
+	return entities
+}
+
+// hasEntityCategory checks if the entity has one of the categories, always true if no categories are required
+func hasEntityCategory(entity *md.EntityDescriptorType, categories []string) bool {
+	if len(categories) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(EntityCategories(entity), func(category string) bool {
+		return slices.Contains(categories, category)
+	})
+}
+
+func isValid(validUntil string, now time.Time) bool {
+	if validUntil == "" {
+		return true
+	}
+	t, err := time.Parse(time.RFC3339, validUntil)
+	return err == nil && now.Before(t)
+}
@@ -0,0 +1,176 @@
+package serviceprovider
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zitadel/saml/pkg/provider/signature"
+	"github.com/zitadel/saml/pkg/provider/xml"
+	"github.com/zitadel/saml/pkg/provider/xml/md"
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
+	"github.com/zitadel/saml/pkg/provider/xml/xml_dsig"
+)
+
+const testEntityCategory = "http://refeds.org/category/research-and-scholarship"
+
+func testAggregateEntity(entityID string, validUntil time.Time, categories ...string) md.EntityDescriptorType {
+	entity := md.EntityDescriptorType{
+		EntityID: md.EntityIDType(entityID),
+		SPSSODescriptor: &md.SPSSODescriptorType{
+			ProtocolSupportEnumeration: "urn:oasis:names:tc:SAML:2.0:protocol",
+			AssertionConsumerService:   []md.IndexedEndpointType{{Index: "0", Binding: PostBinding, Location: entityID + "/acs"}},
+		},
+	}
+	if !validUntil.IsZero() {
+		entity.ValidUntil = validUntil.UTC().Format(DefaultTimeFormat)
+	}
+	if len(categories) > 0 {
+		entity.Extensions = &md.ExtensionsType{
+			EntityAttributes: &md.EntityAttributesType{
+				Attribute: []saml.AttributeType{{
+					Name:           EntityCategoryAttributeName,
+					NameFormat:     "urn:oasis:names:tc:SAML:2.0:attrname-format:uri",
+					AttributeValue: saml.StringAttributeValues(categories...),
+				}},
+			},
+		}
+	}
+	return entity
+}
+
+func testAggregate(t *testing.T, signingKey *rsa.PrivateKey, signingCert *x509.Certificate, validUntil time.Time) []byte {
+	_, spCert := newKeyAndCertificate(t)
+	twoCerts := testAggregateEntity("https://two-certs.example.com", time.Time{})
+	for i := 0; i < 2; i++ {
+		twoCerts.SPSSODescriptor.KeyDescriptor = append(twoCerts.SPSSODescriptor.KeyDescriptor, md.KeyDescriptorType{
+			Use:     md.KeyTypesSigning,
+			KeyInfo: xml_dsig.KeyInfoType{X509Data: []xml_dsig.X509DataType{{X509Certificate: base64.StdEncoding.EncodeToString(spCert.Raw)}}},
+		})
+	}
+	aggregate := &md.EntitiesDescriptorType{
+		Id:         "_aggregate",
+		Name:       "federation",
+		ValidUntil: validUntil.UTC().Format(DefaultTimeFormat),
+		EntityDescriptor: []md.EntityDescriptorType{
+			testAggregateEntity("https://rs.example.com", time.Time{}, testEntityCategory),
+			testAggregateEntity("https://other.example.com", time.Time{}),
+			testAggregateEntity("https://expired.example.com", time.Now().Add(-time.Hour), testEntityCategory),
+			twoCerts,
+			{
+				EntityID: "https://idp.example.com",
+				IDPSSODescriptor: &md.IDPSSODescriptorType{
+					ProtocolSupportEnumeration: "urn:oasis:names:tc:SAML:2.0:protocol",
+				},
+			},
+		},
+		EntitiesDescriptor: []md.EntitiesDescriptorType{
+			{
+				Name:             "nested",
+				EntityDescriptor: []md.EntityDescriptorType{testAggregateEntity("https://nested.example.com", time.Time{}, testEntityCategory)},
+			},
+			{
+				Name:             "nested expired",
+				ValidUntil:       time.Now().Add(-time.Hour).UTC().Format(DefaultTimeFormat),
+				EntityDescriptor: []md.EntityDescriptorType{testAggregateEntity("https://nested-expired.example.com", time.Time{}, testEntityCategory)},
+			},
+		},
+	}
+	if signingKey != nil {
+		signer, err := signature.GetSigner(signingCert.Raw, signingKey, dsig.RSASHA256SignatureMethod)
+		require.NoError(t, err)
+		aggregate.Signature, err = signature.Create(signer, aggregate)
+		require.NoError(t, err)
+	}
+	data, err := xml.Marshal(aggregate)
+	require.NoError(t, err)
+	return data
+}
+
+func entityIDs(sps []*ServiceProvider) []string {
+	ids := make([]string, len(sps))
+	for i, sp := range sps {
+		ids[i] = sp.GetEntityID()
+	}
+	return ids
+}
+
+func TestAggregate_ImportAggregate(t *testing.T) {
+	federationKey, federationCert := newKeyAndCertificate(t)
+	otherKey, otherCert := newKeyAndCertificate(t)
+	valid := time.Now().Add(time.Hour)
+
+	type args struct {
+		data       []byte
+		categories []string
+	}
+	type res struct {
+		err     bool
+		sps     []string
+		skipped []string
+	}
+	tests := []struct {
+		name string
+		args args
+		res  res
+	}{
+		{
+			"unsigned",
+			args{data: testAggregate(t, nil, nil, valid)},
+			res{err: true},
+		},
+		{
+			"signed by other certificate",
+			args{data: testAggregate(t, otherKey, otherCert, valid)},
+			res{err: true},
+		},
+		{
+			"expired",
+			args{data: testAggregate(t, federationKey, federationCert, time.Now().Add(-time.Minute))},
+			res{err: true},
+		},
+		{
+			"all service providers",
+			args{data: testAggregate(t, federationKey, federationCert, valid)},
+			res{
+				sps:     []string{"https://rs.example.com", "https://other.example.com", "https://nested.example.com"},
+				skipped: []string{"https://expired.example.com", "https://two-certs.example.com"},
+			},
+		},
+		{
+			"filtered by entity category",
+			args{data: testAggregate(t, federationKey, federationCert, valid), categories: []string{testEntityCategory}},
+			res{
+				sps:     []string{"https://rs.example.com", "https://nested.example.com"},
+				skipped: []string{"https://expired.example.com"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aggregate, err := ImportAggregate(tt.args.data, &AggregateConfig{
+				Certificates:     []*x509.Certificate{federationCert},
+				EntityCategories: tt.args.categories,
+			}, func(id string) string { return "/login?id=" + id })
+			if tt.res.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "federation", aggregate.Name)
+			assert.Equal(t, tt.res.sps, entityIDs(aggregate.ServiceProviders))
+			skipped := make([]string, 0, len(aggregate.Skipped))
+			for entityID := range aggregate.Skipped {
+				skipped = append(skipped, entityID)
+			}
+			assert.ElementsMatch(t, tt.res.skipped, skipped)
+			assert.Equal(t, "https://rs.example.com", aggregate.ServiceProviders[0].ID)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package serviceprovider
+
+import "time"
+
+// AssertionConfig customizes the assertions issued to a service provider,
+// zero values keep the defaults of the identity provider
+type AssertionConfig struct {
+	// Lifetime of the assertion, used for NotOnOrAfter of the conditions and the subject confirmation
+	Lifetime time.Duration
+	// SessionLifetime sets SessionNotOnOrAfter of the AuthnStatement relative to the authentication
+	SessionLifetime time.Duration
+	// AdditionalAudiences are added to the AudienceRestriction next to the entityID of the service provider
+	AdditionalAudiences []string
+	// OneTimeUse adds the OneTimeUse condition
+	OneTimeUse bool
+	// ProxyRestriction adds the ProxyRestriction condition
+	ProxyRestriction *ProxyRestriction
+	// BindClientAddress adds the address of the client as Address of the SubjectConfirmationData,
+	// which is the remote address of the request unless the identity provider trusts forwarded headers
+	BindClientAddress bool
+	// HolderOfKey confirms the subject with the TLS client certificate of the user agent (Holder-of-Key Web Browser SSO profile)
+	// instead of bearer, the response fails if no client certificate is presented
+	HolderOfKey bool
+}
+
+// ProxyRestriction limits the use of the assertion by proxies
+type ProxyRestriction struct {
+	// Count is the maximum number of proxies, nil for no limit
+	Count *int
+	// Audiences are the only ones allowed to receive assertions issued by a proxy based on this assertion
+	Audiences []string
+}
+
+// Copy returns a deep copy of the config, nil if the config is nil
+func (c *AssertionConfig) Copy() *AssertionConfig {
+	if c == nil {
+		return nil
+	}
+	ret := *c
+	ret.AdditionalAudiences = append([]string(nil), c.AdditionalAudiences...)
+	if c.ProxyRestriction != nil {
+		proxyRestriction := *c.ProxyRestriction
+		if c.ProxyRestriction.Count != nil {
+			count := *c.ProxyRestriction.Count
+			proxyRestriction.Count = &count
+		}
+		proxyRestriction.Audiences = append([]string(nil), c.ProxyRestriction.Audiences...)
+		ret.ProxyRestriction = &proxyRestriction
+	}
+	return &ret
+}
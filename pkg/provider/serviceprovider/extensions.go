@@ -0,0 +1,73 @@
+package serviceprovider
+
+import (
+	"github.com/zitadel/saml/pkg/provider/xml/md"
+)
+
+// EntityCategoryAttributeName is the name of the entity attribute listing the entity categories of an entity
+const EntityCategoryAttributeName = "http://macedir.org/entity-category"
+
+// EntityAttributeValues returns the values of the entity attribute with the name, declared in the extensions of the entity
+func EntityAttributeValues(entity *md.EntityDescriptorType, name string) []string {
+	if entity.Extensions == nil || entity.Extensions.EntityAttributes == nil {
+		return nil
+	}
+	var values []string
+	for _, attribute := range entity.Extensions.EntityAttributes.Attribute {
+		if attribute.Name != name {
+			continue
+		}
+		for _, value := range attribute.AttributeValue {
+			values = append(values, value.Text)
+		}
+	}
+	return values
+}
+
+// EntityCategories returns the entity categories of the entity, declared in its entity attributes
+func EntityCategories(entity *md.EntityDescriptorType) []string {
+	return EntityAttributeValues(entity, EntityCategoryAttributeName)
+}
+
+// EntityAttributeValues returns the values of the entity attribute with the name from the metadata of the service provider
+func (sp *ServiceProvider) EntityAttributeValues(name string) []string {
+	return EntityAttributeValues(sp.Metadata, name)
+}
+
+// EntityCategories returns the entity categories of the service provider, e.g. for attribute release policies
+func (sp *ServiceProvider) EntityCategories() []string {
+	return EntityCategories(sp.Metadata)
+}
+
+// UIInfo returns the user interface information of the SPSSODescriptor, nil if not declared
+func (sp *ServiceProvider) UIInfo() *md.UIInfoType {
+	if sp.Metadata.SPSSODescriptor == nil || sp.Metadata.SPSSODescriptor.Extensions == nil {
+		return nil
+	}
+	return sp.Metadata.SPSSODescriptor.Extensions.UIInfo
+}
+
+// DisplayName returns the display name of the service provider in the language, or else in english or the first declared,
+// empty if none is declared
+func (sp *ServiceProvider) DisplayName(lang string) string {
+	info := sp.UIInfo()
+	if info == nil || len(info.DisplayName) == 0 {
+		return ""
+	}
+	for _, preferred := range []string{lang, "en"} {
+		for _, name := range info.DisplayName {
+			if name.XmlLang == preferred {
+				return name.Text
+			}
+		}
+	}
+	return info.DisplayName[0].Text
+}
+
+// RegistrationAuthority returns the federation which registered the service provider, empty if not declared
+func (sp *ServiceProvider) RegistrationAuthority() string {
+	if sp.Metadata.Extensions == nil || sp.Metadata.Extensions.RegistrationInfo == nil {
+		return ""
+	}
+	return sp.Metadata.Extensions.RegistrationInfo.RegistrationAuthority
+}
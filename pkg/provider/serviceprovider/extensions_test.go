@@ -0,0 +1,71 @@
+package serviceprovider
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zitadel/saml/pkg/provider/xml"
+)
+
+const testExtensionsMetadata = `<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" xmlns:mdattr="urn:oasis:names:tc:SAML:metadata:attribute" xmlns:mdrpi="urn:oasis:names:tc:SAML:metadata:rpi" xmlns:mdui="urn:oasis:names:tc:SAML:metadata:ui" xmlns:alg="urn:oasis:names:tc:SAML:metadata:algsupport" entityID="https://sp.example.com/metadata">
+  <md:Extensions>
+    <mdrpi:RegistrationInfo registrationAuthority="https://federation.example.org" registrationInstant="2020-01-01T00:00:00Z">
+      <mdrpi:RegistrationPolicy xml:lang="en">https://federation.example.org/policy</mdrpi:RegistrationPolicy>
+    </mdrpi:RegistrationInfo>
+    <mdattr:EntityAttributes>
+      <saml:Attribute Name="http://macedir.org/entity-category" NameFormat="urn:oasis:names:tc:SAML:2.0:attrname-format:uri">
+        <saml:AttributeValue>http://refeds.org/category/research-and-scholarship</saml:AttributeValue>
+        <saml:AttributeValue>http://www.geant.net/uri/dataprotection-code-of-conduct/v1</saml:AttributeValue>
+      </saml:Attribute>
+      <saml:Attribute Name="urn:oasis:names:tc:SAML:attribute:assurance-certification" NameFormat="urn:oasis:names:tc:SAML:2.0:attrname-format:uri">
+        <saml:AttributeValue>https://refeds.org/sirtfi</saml:AttributeValue>
+      </saml:Attribute>
+    </mdattr:EntityAttributes>
+    <alg:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"/>
+    <alg:SigningMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256" MinKeySize="2048"/>
+  </md:Extensions>
+  <md:SPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <md:Extensions>
+      <mdui:UIInfo>
+        <mdui:DisplayName xml:lang="de">Dienst</mdui:DisplayName>
+        <mdui:DisplayName xml:lang="en">Service</mdui:DisplayName>
+        <mdui:Logo height="16" width="16">https://sp.example.com/logo.png</mdui:Logo>
+        <mdui:PrivacyStatementURL xml:lang="en">https://sp.example.com/privacy</mdui:PrivacyStatementURL>
+      </mdui:UIInfo>
+    </md:Extensions>
+    <md:AssertionConsumerService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" Location="https://sp.example.com/acs" index="0"/>
+  </md:SPSSODescriptor>
+</md:EntityDescriptor>`
+
+func TestServiceProvider_extensions(t *testing.T) {
+	sp, err := NewServiceProvider("sp", &Config{Metadata: []byte(testExtensionsMetadata)}, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"http://refeds.org/category/research-and-scholarship", "http://www.geant.net/uri/dataprotection-code-of-conduct/v1"}, sp.EntityCategories())
+	assert.Equal(t, []string{"https://refeds.org/sirtfi"}, sp.EntityAttributeValues("urn:oasis:names:tc:SAML:attribute:assurance-certification"))
+	assert.Equal(t, "https://federation.example.org", sp.RegistrationAuthority())
+	assert.Equal(t, "Dienst", sp.DisplayName("de"))
+	assert.Equal(t, "Service", sp.DisplayName("fr"))
+
+	info := sp.UIInfo()
+	require.NotNil(t, info)
+	require.Len(t, info.Logo, 1)
+	assert.Equal(t, 16, info.Logo[0].Height)
+	assert.Equal(t, "https://sp.example.com/logo.png", info.Logo[0].Text)
+	assert.Equal(t, "https://sp.example.com/privacy", info.PrivacyStatementURL[0].Text)
+
+	extensions := sp.Metadata.Extensions
+	assert.Equal(t, "https://federation.example.org/policy", extensions.RegistrationInfo.RegistrationPolicy[0].Text)
+	assert.Equal(t, "http://www.w3.org/2001/04/xmlenc#sha256", extensions.DigestMethod[0].Algorithm)
+	assert.Equal(t, 2048, extensions.SigningMethod[0].MinKeySize)
+
+	// the extensions survive a roundtrip
+	data, err := xml.Marshal(sp.Metadata)
+	require.NoError(t, err)
+	metadata, err := xml.ParseMetadataXmlIntoStruct(data)
+	require.NoError(t, err)
+	assert.Equal(t, sp.EntityCategories(), EntityCategories(metadata))
+	assert.Equal(t, "Service", metadata.SPSSODescriptor.Extensions.UIInfo.DisplayName[1].Text)
+}
@@ -0,0 +1,159 @@
+package serviceprovider
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zitadel/saml/pkg/provider/xml"
+)
+
+const (
+	// MetadataQueryPath is the path of the entities below the base URL of a metadata query (MDQ) server
+	MetadataQueryPath = "/entities/"
+
+	DefaultMetadataQueryMinCacheDuration = time.Minute
+	DefaultMetadataQueryMaxCacheDuration = 6 * time.Hour
+)
+
+// SHA1Identifier returns the transformed identifier of the entityID for the metadata query protocol, {sha1} and the hex encoded hash
+func SHA1Identifier(entityID string) string {
+	hash := sha1.Sum([]byte(entityID))
+	return "{sha1}" + hex.EncodeToString(hash[:])
+}
+
+// MetadataQueryConfig configures the client of a metadata query (MDQ) server
+type MetadataQueryConfig struct {
+	// BaseURL of the server, the entities are requested at BaseURL/entities/{identifier}
+	BaseURL string
+	// Client requests the metadata, defaults to http.DefaultClient
+	Client *http.Client
+	// Certificates verify the signature of the metadata, unsigned metadata is accepted if empty
+	Certificates []*x509.Certificate
+	// SHA1Identifiers requests the entities by the SHA1Identifier instead of the url encoded entityID
+	SHA1Identifiers bool
+	// MinCacheDuration and MaxCacheDuration bound the caching given by the cacheDuration and validUntil of the metadata,
+	// unknown entities are cached for the MinCacheDuration
+	MinCacheDuration time.Duration
+	MaxCacheDuration time.Duration
+	// Config is used for all service providers, its Metadata is ignored
+	Config   *Config
+	LoginURL func(string) string
+}
+
+// MetadataQueryClient fetches the metadata of service providers lazily from a metadata query server and caches it,
+// e.g. to be used by the GetEntityByID of the storage
+type MetadataQueryClient struct {
+	config *MetadataQueryConfig
+
+	mutex sync.Mutex
+	cache map[string]*cachedServiceProvider
+}
+
+type cachedServiceProvider struct {
+	// sp is nil for entities unknown to the server
+	sp           *ServiceProvider
+	etag         string
+	lastModified string
+	expiration   time.Time
+}
+
+func NewMetadataQueryClient(config *MetadataQueryConfig) *MetadataQueryClient {
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	if config.MinCacheDuration == 0 {
+		config.MinCacheDuration = DefaultMetadataQueryMinCacheDuration
+	}
+	if config.MaxCacheDuration == 0 {
+		config.MaxCacheDuration = DefaultMetadataQueryMaxCacheDuration
+	}
+	if config.Config == nil {
+		config.Config = &Config{}
+	}
+	return &MetadataQueryClient{config: config, cache: make(map[string]*cachedServiceProvider)}
+}
+
+// GetServiceProvider returns the service provider with the entityID, nil if the server knows no such entity,
+// which is cached for the MinCacheDuration. Expired entries are revalidated with a conditional request, the cached service provider is kept if that fails
+// as long as its metadata is valid.
+func (c *MetadataQueryClient) GetServiceProvider(ctx context.Context, entityID string) (*ServiceProvider, error) {
+	c.mutex.Lock()
+	cached := c.cache[entityID]
+	c.mutex.Unlock()
+	now := time.Now()
+	if cached != nil && now.Before(cached.expiration) {
+		return cached.sp, nil
+	}
+
+	if cached != nil && cached.sp == nil {
+		cached = nil
+	}
+	var etag, lastModified string
+	if cached != nil {
+		etag, lastModified = cached.etag, cached.lastModified
+	}
+	response, err := xml.ReadMetadataFromURLIfModified(ctx, c.config.Client, c.entityURL(entityID), etag, lastModified)
+	if errors.Is(err, xml.ErrMetadataNotFound) {
+		c.mutex.Lock()
+		c.cache[entityID] = &cachedServiceProvider{expiration: now.Add(c.config.MinCacheDuration)}
+		c.mutex.Unlock()
+		return nil, nil
+	}
+	if err != nil {
+		return c.fallback(cached, now, err)
+	}
+
+	if response.NotModified {
+		if cached == nil {
+			return nil, errors.New("metadata not modified, but not cached")
+		}
+		cached = &cachedServiceProvider{sp: cached.sp, etag: etag, lastModified: lastModified}
+	} else {
+		sp, err := c.newServiceProvider(entityID, response.Metadata, now)
+		if err != nil {
+			return c.fallback(cached, now, err)
+		}
+		cached = &cachedServiceProvider{sp: sp, etag: response.ETag, lastModified: response.LastModified}
+	}
+	cached.expiration = now.Add(cacheInterval(cached.sp.Metadata, now, c.config.MinCacheDuration, c.config.MaxCacheDuration))
+
+	c.mutex.Lock()
+	c.cache[entityID] = cached
+	c.mutex.Unlock()
+	return cached.sp, nil
+}
+
+func (c *MetadataQueryClient) entityURL(entityID string) string {
+	identifier := url.PathEscape(entityID)
+	if c.config.SHA1Identifiers {
+		identifier = url.PathEscape(SHA1Identifier(entityID))
+	}
+	return strings.TrimSuffix(c.config.BaseURL, "/") + MetadataQueryPath + identifier
+}
+
+func (c *MetadataQueryClient) newServiceProvider(entityID string, data []byte, now time.Time) (*ServiceProvider, error) {
+	metadata, err := parseVerifiedMetadata(data, c.config.Certificates, now)
+	if err != nil {
+		return nil, err
+	}
+	if string(metadata.EntityID) != entityID {
+		return nil, errors.New("entityID of metadata not equal to requested entityID")
+	}
+	return newServiceProvider(entityID, metadata, c.config.Config, c.config.LoginURL)
+}
+
+// fallback returns the cached service provider if its metadata is still valid, otherwise the error
+func (c *MetadataQueryClient) fallback(cached *cachedServiceProvider, now time.Time, err error) (*ServiceProvider, error) {
+	if cached == nil || !isValid(cached.sp.Metadata.ValidUntil, now) {
+		return nil, err
+	}
+	return cached.sp, nil
+}
@@ -0,0 +1,106 @@
+package serviceprovider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zitadel/saml/pkg/provider/xml"
+)
+
+func TestMetadataQueryClient_GetServiceProvider(t *testing.T) {
+	_, spCert := newKeyAndCertificate(t)
+	entity, err := NewMetadata(&MetadataConfig{
+		EntityID:                  testEntityID,
+		AssertionConsumerServices: []AssertionConsumerService{{Binding: PostBinding, Location: testACSURL}},
+		SigningCertificates:       [][]byte{spCert.Raw},
+	})
+	require.NoError(t, err)
+	entity.CacheDuration = "PT1H"
+	metadata, err := xml.Marshal(entity)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		sha1Identifiers bool
+		path            string
+	}{
+		{"url encoded", false, "/mdq/entities/https:%2F%2Fsp.example.com%2Fmetadata"},
+		{"sha1", true, "/mdq/entities/%7Bsha1%7D" + SHA1Identifier(testEntityID)[6:]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var paths []string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				paths = append(paths, r.URL.EscapedPath())
+				if r.URL.EscapedPath() != tt.path {
+					http.NotFound(w, r)
+					return
+				}
+				_, _ = w.Write(metadata)
+			}))
+			defer ts.Close()
+			client := NewMetadataQueryClient(&MetadataQueryConfig{BaseURL: ts.URL + "/mdq/", Client: ts.Client(), SHA1Identifiers: tt.sha1Identifiers})
+
+			sp, err := client.GetServiceProvider(context.Background(), testEntityID)
+			require.NoError(t, err)
+			require.NotNil(t, sp)
+			assert.Equal(t, testEntityID, sp.GetEntityID())
+
+			cached, err := client.GetServiceProvider(context.Background(), testEntityID)
+			require.NoError(t, err)
+			assert.Same(t, sp, cached)
+			assert.Len(t, paths, 1)
+
+			unknown, err := client.GetServiceProvider(context.Background(), "https://unknown.example.com")
+			require.NoError(t, err)
+			assert.Nil(t, unknown)
+		})
+	}
+}
+
+func TestMetadataQueryClient_GetServiceProvider_unknownCached(t *testing.T) {
+	tests := []struct {
+		name             string
+		minCacheDuration time.Duration
+		requests         int
+	}{
+		{"cached", time.Hour, 1},
+		{"expired", time.Nanosecond, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				http.NotFound(w, r)
+			}))
+			defer ts.Close()
+			client := NewMetadataQueryClient(&MetadataQueryConfig{BaseURL: ts.URL, Client: ts.Client(), MinCacheDuration: tt.minCacheDuration})
+
+			for range 2 {
+				sp, err := client.GetServiceProvider(context.Background(), testEntityID)
+				require.NoError(t, err)
+				assert.Nil(t, sp)
+			}
+			assert.Equal(t, tt.requests, requests)
+		})
+	}
+}
+
+func TestMetadataQueryClient_GetServiceProvider_notModifiedWithoutCache(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer ts.Close()
+	client := NewMetadataQueryClient(&MetadataQueryConfig{BaseURL: ts.URL, Client: ts.Client()})
+
+	sp, err := client.GetServiceProvider(context.Background(), testEntityID)
+	assert.Error(t, err)
+	assert.Nil(t, sp)
+}
@@ -0,0 +1,240 @@
+package serviceprovider
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zitadel/saml/pkg/provider/key"
+	"github.com/zitadel/saml/pkg/provider/signature"
+	"github.com/zitadel/saml/pkg/provider/xml"
+	"github.com/zitadel/saml/pkg/provider/xml/md"
+	"github.com/zitadel/saml/pkg/provider/xml/xenc"
+	"github.com/zitadel/saml/pkg/provider/xml/xml_dsig"
+)
+
+// AssertionConsumerService is an endpoint of the service provider receiving the responses,
+// indexed in the order of the MetadataConfig
+type AssertionConsumerService struct {
+	Binding   string
+	Location  string
+	IsDefault bool
+}
+
+// MetadataConfig describes the metadata published by a service provider
+type MetadataConfig struct {
+	EntityID                   string
+	AssertionConsumerServices  []AssertionConsumerService
+	SingleLogoutServices       []md.EndpointType
+	AttributeConsumingServices []md.AttributeConsumingServiceType
+	NameIDFormats              []string
+	// SigningCertificates are the DER encoded certificates the service provider signs its requests with
+	SigningCertificates [][]byte
+	// EncryptionCertificates are the DER encoded certificates the assertions are encrypted for
+	EncryptionCertificates [][]byte
+	// EncryptionAlgorithms are the supported encryption algorithms of the service provider (optional)
+	EncryptionAlgorithms []string
+	AuthnRequestsSigned  bool
+	WantAssertionsSigned bool
+	// ValidUntil is the validity of the metadata from the time it is built, unlimited if 0
+	ValidUntil time.Duration
+	// RefreshInterval is the interval the MetadataHandler rebuilds the cached metadata in,
+	// half of ValidUntil if 0, so that the served metadata is always valid, and built only once if both are 0
+	RefreshInterval time.Duration
+	// Signing signs the metadata if set
+	Signing            *key.CertificateAndKey
+	SignatureAlgorithm string
+}
+
+// NewMetadata builds the EntityDescriptor of the service provider, signed if configured
+func NewMetadata(config *MetadataConfig) (*md.EntityDescriptorType, error) {
+	if config.EntityID == "" {
+		return nil, fmt.Errorf("entityID is required")
+	}
+	acs, err := assertionConsumerServices(config.AssertionConsumerServices)
+	if err != nil {
+		return nil, err
+	}
+
+	keyDescriptors := make([]md.KeyDescriptorType, 0, len(config.SigningCertificates)+len(config.EncryptionCertificates))
+	for _, cert := range config.SigningCertificates {
+		keyDescriptors = append(keyDescriptors, keyDescriptor(md.KeyTypesSigning, cert, nil))
+	}
+	for _, cert := range config.EncryptionCertificates {
+		keyDescriptors = append(keyDescriptors, keyDescriptor(md.KeyTypesEncryption, cert, config.EncryptionAlgorithms))
+	}
+
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	var validUntil string
+	if config.ValidUntil != 0 {
+		validUntil = time.Now().Add(config.ValidUntil).UTC().Format(DefaultTimeFormat)
+	}
+	entity := &md.EntityDescriptorType{
+		EntityID:   md.EntityIDType(config.EntityID),
+		Id:         id,
+		ValidUntil: validUntil,
+		SPSSODescriptor: &md.SPSSODescriptorType{
+			AuthnRequestsSigned:        strconv.FormatBool(config.AuthnRequestsSigned),
+			WantAssertionsSigned:       strconv.FormatBool(config.WantAssertionsSigned),
+			ProtocolSupportEnumeration: "urn:oasis:names:tc:SAML:2.0:protocol",
+			KeyDescriptor:              keyDescriptors,
+			SingleLogoutService:        config.SingleLogoutServices,
+			NameIDFormat:               config.NameIDFormats,
+			AssertionConsumerService:   acs,
+			AttributeConsumingService:  config.AttributeConsumingServices,
+		},
+	}
+
+	if config.Signing != nil {
+		signer, err := signature.GetSigner(config.Signing.Certificate, config.Signing.Key, config.SignatureAlgorithm)
+		if err != nil {
+			return nil, err
+		}
+		entity.Signature, err = signature.Create(signer, entity)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entity, nil
+}
+
+// MetadataHandler returns the handler publishing the metadata of the service provider,
+// which is built once per MetadataConfig.RefreshInterval and served with ETag and Last-Modified,
+// answering conditional requests with 304 Not Modified
+func MetadataHandler(config *MetadataConfig) http.Handler {
+	return &metadataHandler{config: config}
+}
+
+type metadataHandler struct {
+	config *MetadataConfig
+	mutex  sync.Mutex
+	cached *cachedMetadata
+}
+
+type cachedMetadata struct {
+	data  []byte
+	etag  string
+	built time.Time
+	// expires is the time the metadata is rebuilt, never if zero
+	expires time.Time
+}
+
+func (h *metadataHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cached, err := h.metadata()
+	if err != nil {
+		http.Error(w, fmt.Errorf("failed to build metadata: %w", err).Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.Header().Set("ETag", cached.etag)
+	if !cached.expires.IsZero() {
+		w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(int(time.Until(cached.expires).Seconds())))
+	}
+	http.ServeContent(w, r, "", cached.built, bytes.NewReader(cached.data))
+}
+
+// metadata returns the cached metadata or builds it, if there is none yet or the refresh interval is over
+func (h *metadataHandler) metadata() (*cachedMetadata, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	now := time.Now().UTC()
+	if h.cached != nil && (h.cached.expires.IsZero() || now.Before(h.cached.expires)) {
+		return h.cached, nil
+	}
+
+	metadata, err := NewMetadata(h.config)
+	if err != nil {
+		return nil, err
+	}
+	data, err := xml.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	cached := &cachedMetadata{
+		data:  data,
+		etag:  `"` + hex.EncodeToString(sum[:]) + `"`,
+		built: now,
+	}
+	interval := h.config.RefreshInterval
+	if interval == 0 {
+		interval = h.config.ValidUntil / 2
+	}
+	if interval > 0 {
+		cached.expires = now.Add(interval)
+	}
+	h.cached = cached
+	return cached, nil
+}
+
+// MetadataConfig returns the description of the relying party for its metadata,
+// with the AssertionConsumerService, the NameIDFormat and the signing certificate
+func (rp *RelyingParty) MetadataConfig() *MetadataConfig {
+	config := &MetadataConfig{
+		EntityID: rp.config.EntityID,
+		AssertionConsumerServices: []AssertionConsumerService{{
+			Binding:   PostBinding,
+			Location:  rp.config.AssertionConsumerServiceURL,
+			IsDefault: true,
+		}},
+		WantAssertionsSigned: true,
+	}
+	if rp.config.NameIDFormat != "" {
+		config.NameIDFormats = []string{rp.config.NameIDFormat}
+	}
+	if rp.config.Signing != nil {
+		config.SigningCertificates = [][]byte{rp.config.Signing.Certificate}
+		config.AuthnRequestsSigned = true
+	}
+	return config
+}
+
+func assertionConsumerServices(services []AssertionConsumerService) ([]md.IndexedEndpointType, error) {
+	if len(services) == 0 {
+		return nil, fmt.Errorf("at least one assertion consumer service is required")
+	}
+	endpoints := make([]md.IndexedEndpointType, len(services))
+	defaults := 0
+	for i, service := range services {
+		if service.Binding == "" || service.Location == "" {
+			return nil, fmt.Errorf("binding and location of assertion consumer service %d are required", i)
+		}
+		endpoints[i] = md.IndexedEndpointType{
+			Index:    strconv.Itoa(i),
+			Binding:  service.Binding,
+			Location: service.Location,
+		}
+		if service.IsDefault {
+			endpoints[i].IsDefault = "true"
+			defaults++
+		}
+	}
+	if defaults > 1 {
+		return nil, fmt.Errorf("only one assertion consumer service can be the default")
+	}
+	return endpoints, nil
+}
+
+func keyDescriptor(use md.KeyTypes, cert []byte, encryptionAlgorithms []string) md.KeyDescriptorType {
+	descriptor := md.KeyDescriptorType{
+		Use: use,
+		KeyInfo: xml_dsig.KeyInfoType{
+			X509Data: []xml_dsig.X509DataType{{
+				X509Certificate: base64.StdEncoding.EncodeToString(cert),
+			}},
+		},
+	}
+	for _, algorithm := range encryptionAlgorithms {
+		descriptor.EncryptionMethod = append(descriptor.EncryptionMethod, xenc.EncryptionMethodType{Algorithm: algorithm})
+	}
+	return descriptor
+}
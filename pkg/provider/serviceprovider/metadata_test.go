@@ -0,0 +1,153 @@
+package serviceprovider
+
+import (
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zitadel/saml/pkg/provider/key"
+	"github.com/zitadel/saml/pkg/provider/signature"
+	"github.com/zitadel/saml/pkg/provider/xml"
+	"github.com/zitadel/saml/pkg/provider/xml/md"
+)
+
+func TestMetadata_NewMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		acs     []AssertionConsumerService
+		wantErr bool
+	}{
+		{
+			"no assertion consumer service",
+			nil,
+			true,
+		},
+		{
+			"missing location",
+			[]AssertionConsumerService{{Binding: PostBinding}},
+			true,
+		},
+		{
+			"multiple defaults",
+			[]AssertionConsumerService{{Binding: PostBinding, Location: testACSURL, IsDefault: true}, {Binding: RedirectBinding, Location: testACSURL, IsDefault: true}},
+			true,
+		},
+		{
+			"indexed",
+			[]AssertionConsumerService{{Binding: PostBinding, Location: testACSURL}, {Binding: RedirectBinding, Location: testACSURL, IsDefault: true}},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata, err := NewMetadata(&MetadataConfig{EntityID: testEntityID, AssertionConsumerServices: tt.acs})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			acs := metadata.SPSSODescriptor.AssertionConsumerService
+			require.Len(t, acs, 2)
+			assert.Equal(t, "0", acs[0].Index)
+			assert.Equal(t, "", acs[0].IsDefault)
+			assert.Equal(t, "1", acs[1].Index)
+			assert.Equal(t, "true", acs[1].IsDefault)
+		})
+	}
+}
+
+func TestMetadata_MetadataHandler(t *testing.T) {
+	spKey, spCert := newKeyAndCertificate(t)
+	_, encryptionCert := newKeyAndCertificate(t)
+	config := &MetadataConfig{
+		EntityID:                  testEntityID,
+		AssertionConsumerServices: []AssertionConsumerService{{Binding: PostBinding, Location: testACSURL, IsDefault: true}},
+		SingleLogoutServices:      []md.EndpointType{{Binding: RedirectBinding, Location: "https://sp.example.com/slo"}},
+		AttributeConsumingServices: []md.AttributeConsumingServiceType{{
+			Index:              0,
+			ServiceName:        []md.LocalizedNameType{{Text: "service"}},
+			RequestedAttribute: []md.RequestedAttributeType{{Name: "urn:oid:0.9.2342.19200300.100.1.3"}},
+		}},
+		NameIDFormats:          []string{"urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"},
+		SigningCertificates:    [][]byte{spCert.Raw},
+		EncryptionCertificates: [][]byte{encryptionCert.Raw},
+		EncryptionAlgorithms:   []string{"http://www.w3.org/2009/xmlenc11#aes256-gcm"},
+		AuthnRequestsSigned:    true,
+		WantAssertionsSigned:   true,
+		Signing:                &key.CertificateAndKey{Certificate: spCert.Raw, Key: spKey},
+		SignatureAlgorithm:     dsig.RSASHA256SignatureMethod,
+	}
+
+	w := httptest.NewRecorder()
+	MetadataHandler(config).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metadata", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	data := w.Body.Bytes()
+
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromBytes(data))
+	require.NoError(t, signature.ValidatePost([]*x509.Certificate{spCert}, doc.Root()))
+
+	metadata, err := xml.ParseMetadataXmlIntoStruct(data)
+	require.NoError(t, err)
+	assert.Equal(t, testEntityID, string(metadata.EntityID))
+	sp := metadata.SPSSODescriptor
+	require.NotNil(t, sp)
+	assert.Equal(t, "true", sp.AuthnRequestsSigned)
+	assert.Equal(t, "true", sp.WantAssertionsSigned)
+	assert.Equal(t, testACSURL, sp.AssertionConsumerService[0].Location)
+	assert.Equal(t, "https://sp.example.com/slo", sp.SingleLogoutService[0].Location)
+	assert.Equal(t, config.NameIDFormats, sp.NameIDFormat)
+	require.Len(t, sp.AttributeConsumingService, 1)
+	assert.Equal(t, "urn:oid:0.9.2342.19200300.100.1.3", sp.AttributeConsumingService[0].RequestedAttribute[0].Name)
+	assert.Len(t, xml.GetCertsFromKeyDescriptors(sp.KeyDescriptor), 1)
+	assert.Len(t, xml.GetEncryptionCertsFromKeyDescriptors(sp.KeyDescriptor), 1)
+}
+
+func TestMetadata_MetadataHandler_cached(t *testing.T) {
+	spKey, spCert := newKeyAndCertificate(t)
+	config := &MetadataConfig{
+		EntityID:                  testEntityID,
+		AssertionConsumerServices: []AssertionConsumerService{{Binding: PostBinding, Location: testACSURL, IsDefault: true}},
+		ValidUntil:                time.Hour,
+		Signing:                   &key.CertificateAndKey{Certificate: spCert.Raw, Key: spKey},
+		SignatureAlgorithm:        dsig.RSASHA256SignatureMethod,
+	}
+	serve := func(handler http.Handler, etag string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/metadata", nil)
+		if etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	handler := MetadataHandler(config)
+	first := serve(handler, "")
+	require.Equal(t, http.StatusOK, first.Code)
+	etag := first.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.Regexp(t, `^max-age=(1799|1800)$`, first.Header().Get("Cache-Control"))
+
+	second := serve(handler, "")
+	require.Equal(t, http.StatusOK, second.Code)
+	assert.Equal(t, etag, second.Header().Get("ETag"))
+	assert.Equal(t, first.Body.Bytes(), second.Body.Bytes())
+
+	notModified := serve(handler, etag)
+	assert.Equal(t, http.StatusNotModified, notModified.Code)
+	assert.Empty(t, notModified.Body.Bytes())
+
+	config.RefreshInterval = time.Nanosecond
+	refreshing := MetadataHandler(config)
+	refreshed := serve(refreshing, "")
+	require.Equal(t, http.StatusOK, refreshed.Code)
+	assert.NotEqual(t, refreshed.Header().Get("ETag"), serve(refreshing, "").Header().Get("ETag"))
+}
@@ -0,0 +1,17 @@
+package serviceprovider
+
+import "slices"
+
+// NameIDMappingConfig authorizes a service provider to request the identifiers of its users
+// at other service providers with the NameID mapping service
+type NameIDMappingConfig struct {
+	// ServiceProviders are the entityIDs of the service providers the identifiers can be requested for
+	ServiceProviders []string
+	// Encrypt returns the identifiers as EncryptedID, encrypted for the service provider they are issued for
+	Encrypt bool
+}
+
+// Allowed checks if the identifiers for the service provider can be requested
+func (c *NameIDMappingConfig) Allowed(entityID string) bool {
+	return c != nil && slices.Contains(c.ServiceProviders, entityID)
+}
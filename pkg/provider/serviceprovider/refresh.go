@@ -0,0 +1,250 @@
+package serviceprovider
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/beevik/etree"
+
+	"github.com/zitadel/saml/pkg/provider/signature"
+	"github.com/zitadel/saml/pkg/provider/xml"
+	"github.com/zitadel/saml/pkg/provider/xml/md"
+)
+
+const (
+	DefaultMinRefreshInterval = 5 * time.Minute
+	DefaultMaxRefreshInterval = 24 * time.Hour
+)
+
+// MetadataSource is the URL the metadata of a service provider is published at
+type MetadataSource struct {
+	// ID of the service provider, defaults to the entityID
+	ID  string
+	URL string
+	// EntityID is expected in the metadata if set, otherwise the entityID of the first loaded metadata
+	EntityID string
+	// Config is used for the service provider, its Metadata is ignored
+	Config *Config
+	// Certificates verify the signature of the metadata, unsigned metadata is accepted if empty
+	Certificates []*x509.Certificate
+}
+
+// RefresherConfig configures the periodic refresh of the metadata of the service providers
+type RefresherConfig struct {
+	// Client reads the metadata, defaults to http.DefaultClient
+	Client *http.Client
+	// MinRefreshInterval and MaxRefreshInterval bound the interval given by the cacheDuration and validUntil of the metadata,
+	// the metadata is refreshed after the MinRefreshInterval after a failure
+	MinRefreshInterval time.Duration
+	MaxRefreshInterval time.Duration
+	LoginURL           func(string) string
+	// OnError is called with the errors of failed refreshes, after which the last good metadata stays in use until its validUntil
+	OnError func(source *MetadataSource, err error)
+}
+
+// MetadataRefresher keeps the metadata of service providers up to date by polling the URLs they publish it at
+type MetadataRefresher struct {
+	config  *RefresherConfig
+	sources []*refreshedSource
+}
+
+type refreshedSource struct {
+	source *MetadataSource
+	sp     atomic.Pointer[ServiceProvider]
+
+	mutex        sync.Mutex
+	etag         string
+	lastModified string
+	nextRefresh  time.Time
+}
+
+func NewMetadataRefresher(config *RefresherConfig, sources ...*MetadataSource) *MetadataRefresher {
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	if config.MinRefreshInterval == 0 {
+		config.MinRefreshInterval = DefaultMinRefreshInterval
+	}
+	if config.MaxRefreshInterval == 0 {
+		config.MaxRefreshInterval = DefaultMaxRefreshInterval
+	}
+	refresher := &MetadataRefresher{config: config, sources: make([]*refreshedSource, len(sources))}
+	for i, source := range sources {
+		refresher.sources[i] = &refreshedSource{source: source}
+	}
+	return refresher
+}
+
+// ServiceProvider returns the service provider with the entityID from the last good metadata,
+// nil if not loaded or its metadata is expired
+func (r *MetadataRefresher) ServiceProvider(entityID string) *ServiceProvider {
+	now := time.Now()
+	for _, source := range r.sources {
+		if sp := source.sp.Load(); sp != nil && sp.GetEntityID() == entityID && isValid(sp.Metadata.ValidUntil, now) {
+			return sp
+		}
+	}
+	return nil
+}
+
+// Refresh reads the metadata of all sources due for a refresh and swaps in the valid ones,
+// the errors of the failed sources are returned joined
+func (r *MetadataRefresher) Refresh(ctx context.Context) error {
+	now := time.Now()
+	var errs []error
+	for _, source := range r.sources {
+		if err := r.refresh(ctx, source, now); err != nil {
+			if r.config.OnError != nil {
+				r.config.OnError(source.source, err)
+			}
+			errs = append(errs, fmt.Errorf("failed to refresh metadata from %s: %w", source.source.URL, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run refreshes the metadata whenever a source is due until the context is done
+func (r *MetadataRefresher) Run(ctx context.Context) {
+	for {
+		_ = r.Refresh(ctx)
+		timer := time.NewTimer(time.Until(r.nextRefresh()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func (r *MetadataRefresher) nextRefresh() time.Time {
+	next := time.Now().Add(r.config.MaxRefreshInterval)
+	for _, source := range r.sources {
+		source.mutex.Lock()
+		if source.nextRefresh.Before(next) {
+			next = source.nextRefresh
+		}
+		source.mutex.Unlock()
+	}
+	return next
+}
+
+func (r *MetadataRefresher) refresh(ctx context.Context, source *refreshedSource, now time.Time) error {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+	if now.Before(source.nextRefresh) {
+		return nil
+	}
+	source.nextRefresh = now.Add(r.config.MinRefreshInterval)
+
+	etag, lastModified := source.etag, source.lastModified
+	if source.sp.Load() == nil {
+		etag, lastModified = "", ""
+	}
+	response, err := xml.ReadMetadataFromURLIfModified(ctx, r.config.Client, source.source.URL, etag, lastModified)
+	if err != nil {
+		return err
+	}
+	if response.NotModified {
+		source.nextRefresh = now.Add(r.refreshInterval(source.sp.Load(), now))
+		return nil
+	}
+
+	sp, err := r.newServiceProvider(source, response.Metadata, now)
+	if err != nil {
+		return err
+	}
+	source.sp.Store(sp)
+	source.etag, source.lastModified = response.ETag, response.LastModified
+	source.nextRefresh = now.Add(r.refreshInterval(sp, now))
+	return nil
+}
+
+// newServiceProvider validates the metadata and verifies its signature if certificates are configured
+func (r *MetadataRefresher) newServiceProvider(source *refreshedSource, data []byte, now time.Time) (*ServiceProvider, error) {
+	metadata, err := parseVerifiedMetadata(data, source.source.Certificates, now)
+	if err != nil {
+		return nil, err
+	}
+
+	entityID := source.source.EntityID
+	if previous := source.sp.Load(); entityID == "" && previous != nil {
+		entityID = previous.GetEntityID()
+	}
+	if entityID != "" && string(metadata.EntityID) != entityID {
+		return nil, fmt.Errorf("entityID %s of metadata not equal to %s", metadata.EntityID, entityID)
+	}
+
+	id := source.source.ID
+	if id == "" {
+		id = string(metadata.EntityID)
+	}
+	config := source.source.Config
+	if config == nil {
+		config = &Config{}
+	}
+	return newServiceProvider(id, metadata, config, r.config.LoginURL)
+}
+
+// refreshInterval is the cacheDuration of the metadata, at most until its validUntil,
+// bounded by the configured intervals
+func (r *MetadataRefresher) refreshInterval(sp *ServiceProvider, now time.Time) time.Duration {
+	if sp == nil {
+		return r.config.MinRefreshInterval
+	}
+	return cacheInterval(sp.Metadata, now, r.config.MinRefreshInterval, r.config.MaxRefreshInterval)
+}
+
+// parseVerifiedMetadata parses the metadata of an entity, verifies its signature if certificates are given
+// and checks that it is not expired
+func parseVerifiedMetadata(data []byte, certs []*x509.Certificate, now time.Time) (*md.EntityDescriptorType, error) {
+	if len(certs) > 0 {
+		doc := etree.NewDocument()
+		if err := doc.ReadFromBytes(data); err != nil {
+			return nil, fmt.Errorf("failed to parse metadata: %w", err)
+		}
+		if doc.Root() == nil || doc.Root().SelectElement("Signature") == nil {
+			return nil, fmt.Errorf("metadata is not signed")
+		}
+		verified, err := signature.ValidatePostElement(certs, doc.Root())
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify signature of metadata: %w", err)
+		}
+		// the metadata is only taken from the verified element
+		verifiedDoc := etree.NewDocument()
+		verifiedDoc.SetRoot(verified)
+		if data, err = verifiedDoc.WriteToBytes(); err != nil {
+			return nil, fmt.Errorf("failed to encode verified metadata: %w", err)
+		}
+	}
+	metadata, err := xml.ParseMetadataXmlIntoStruct(data)
+	if err != nil {
+		return nil, err
+	}
+	if !isValid(metadata.ValidUntil, now) {
+		return nil, fmt.Errorf("metadata expired at %s", metadata.ValidUntil)
+	}
+	return metadata, nil
+}
+
+// cacheInterval is the cacheDuration of the metadata, at most until its validUntil, bounded by minInterval and maxInterval
+func cacheInterval(metadata *md.EntityDescriptorType, now time.Time, minInterval, maxInterval time.Duration) time.Duration {
+	interval := maxInterval
+	if metadata.CacheDuration != "" {
+		if cacheDuration, err := xml.ParseDuration(metadata.CacheDuration); err == nil {
+			interval = cacheDuration
+		}
+	}
+	if metadata.ValidUntil != "" {
+		if validUntil, err := time.Parse(time.RFC3339, metadata.ValidUntil); err == nil && validUntil.Sub(now) < interval {
+			interval = validUntil.Sub(now)
+		}
+	}
+	return min(max(interval, minInterval), maxInterval)
+}
@@ -0,0 +1,163 @@
+package serviceprovider
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zitadel/saml/pkg/provider/key"
+	"github.com/zitadel/saml/pkg/provider/xml"
+	"github.com/zitadel/saml/pkg/provider/xml/md"
+)
+
+type testMetadataServer struct {
+	mutex    sync.Mutex
+	metadata []byte
+	etag     string
+	status   int
+	requests int
+}
+
+func (s *testMetadataServer) set(metadata []byte, etag string, status int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.metadata, s.etag, s.status = metadata, etag, status
+}
+
+func (s *testMetadataServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.requests++
+	if s.status != http.StatusOK {
+		w.WriteHeader(s.status)
+		return
+	}
+	if r.Header.Get("If-None-Match") == s.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", s.etag)
+	_, _ = w.Write(s.metadata)
+}
+
+func TestMetadataRefresher_Refresh(t *testing.T) {
+	federationKey, federationCert := newKeyAndCertificate(t)
+	otherKey, otherCert := newKeyAndCertificate(t)
+	_, firstCert := newKeyAndCertificate(t)
+	_, rotatedCert := newKeyAndCertificate(t)
+	metadata := func(entityID string, spCert, signingCert *x509.Certificate, signingKey *rsa.PrivateKey) []byte {
+		config := &MetadataConfig{
+			EntityID:                  entityID,
+			AssertionConsumerServices: []AssertionConsumerService{{Binding: PostBinding, Location: testACSURL}},
+			SigningCertificates:       [][]byte{spCert.Raw},
+			SignatureAlgorithm:        dsig.RSASHA256SignatureMethod,
+		}
+		if signingKey != nil {
+			config.Signing = &key.CertificateAndKey{Certificate: signingCert.Raw, Key: signingKey}
+		}
+		entity, err := NewMetadata(config)
+		require.NoError(t, err)
+		data, err := xml.Marshal(entity)
+		require.NoError(t, err)
+		return data
+	}
+
+	server := &testMetadataServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	var errs []error
+	refresher := NewMetadataRefresher(&RefresherConfig{
+		Client:  ts.Client(),
+		OnError: func(_ *MetadataSource, err error) { errs = append(errs, err) },
+	}, &MetadataSource{URL: ts.URL, Certificates: []*x509.Certificate{federationCert}})
+	source := refresher.sources[0]
+	refresh := func() error {
+		source.nextRefresh = time.Time{}
+		return refresher.Refresh(context.Background())
+	}
+	signingCert := func() *x509.Certificate {
+		sp := refresher.ServiceProvider(testEntityID)
+		require.NotNil(t, sp)
+		certs, err := getSigningCertsFromMetadata(sp.Metadata)
+		require.NoError(t, err)
+		return certs[0]
+	}
+
+	server.set(metadata(testEntityID, firstCert, federationCert, federationKey), `"1"`, http.StatusOK)
+	require.NoError(t, refresher.Refresh(context.Background()))
+	assert.Equal(t, firstCert, signingCert())
+	assert.Equal(t, testEntityID, refresher.ServiceProvider(testEntityID).ID)
+	assert.Nil(t, refresher.ServiceProvider("unknown"))
+
+	t.Run("not due", func(t *testing.T) {
+		require.NoError(t, refresher.Refresh(context.Background()))
+		assert.Equal(t, 1, server.requests)
+		assert.True(t, source.nextRefresh.After(time.Now().Add(DefaultMaxRefreshInterval-time.Minute)))
+	})
+	t.Run("not modified", func(t *testing.T) {
+		require.NoError(t, refresh())
+		assert.Equal(t, 2, server.requests)
+		assert.Equal(t, firstCert, signingCert())
+	})
+	t.Run("server error keeps last good metadata", func(t *testing.T) {
+		server.set(nil, "", http.StatusInternalServerError)
+		assert.Error(t, refresh())
+		assert.Equal(t, firstCert, signingCert())
+		assert.True(t, source.nextRefresh.Before(time.Now().Add(DefaultMinRefreshInterval+time.Minute)))
+	})
+	t.Run("invalid signature keeps last good metadata", func(t *testing.T) {
+		server.set(metadata(testEntityID, rotatedCert, otherCert, otherKey), `"2"`, http.StatusOK)
+		assert.Error(t, refresh())
+		assert.Equal(t, firstCert, signingCert())
+	})
+	t.Run("other entityID keeps last good metadata", func(t *testing.T) {
+		server.set(metadata("https://other.example.com", rotatedCert, federationCert, federationKey), `"3"`, http.StatusOK)
+		assert.Error(t, refresh())
+		assert.Equal(t, firstCert, signingCert())
+	})
+	t.Run("rotated certificate", func(t *testing.T) {
+		server.set(metadata(testEntityID, rotatedCert, federationCert, federationKey), `"4"`, http.StatusOK)
+		require.NoError(t, refresh())
+		assert.Equal(t, rotatedCert, signingCert())
+	})
+	t.Run("expired last good metadata", func(t *testing.T) {
+		refresher.ServiceProvider(testEntityID).Metadata.ValidUntil = time.Now().Add(-time.Minute).Format(DefaultTimeFormat)
+		assert.Nil(t, refresher.ServiceProvider(testEntityID))
+	})
+	assert.Len(t, errs, 3)
+}
+
+func TestMetadataRefresher_refreshInterval(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	tests := []struct {
+		name          string
+		cacheDuration string
+		validUntil    time.Time
+		want          time.Duration
+	}{
+		{"default", "", time.Time{}, DefaultMaxRefreshInterval},
+		{"cache duration", "PT6H", time.Time{}, 6 * time.Hour},
+		{"valid until before cache duration", "PT6H", now.Add(time.Hour), time.Hour},
+		{"bounded by min", "PT10S", time.Time{}, DefaultMinRefreshInterval},
+		{"bounded by max", "P7D", time.Time{}, DefaultMaxRefreshInterval},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refresher := NewMetadataRefresher(&RefresherConfig{})
+			sp := &ServiceProvider{Metadata: &md.EntityDescriptorType{CacheDuration: tt.cacheDuration}}
+			if !tt.validUntil.IsZero() {
+				sp.Metadata.ValidUntil = tt.validUntil.Format(DefaultTimeFormat)
+			}
+			assert.Equal(t, tt.want, refresher.refreshInterval(sp, now))
+		})
+	}
+}
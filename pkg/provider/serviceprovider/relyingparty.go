@@ -0,0 +1,319 @@
+package serviceprovider
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zitadel/saml/pkg/provider/key"
+	"github.com/zitadel/saml/pkg/provider/signature"
+	"github.com/zitadel/saml/pkg/provider/xml"
+	"github.com/zitadel/saml/pkg/provider/xml/md"
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
+	"github.com/zitadel/saml/pkg/provider/xml/samlp"
+)
+
+const (
+	RedirectBinding = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	PostBinding     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+
+	DefaultTimeFormat    = "2006-01-02T15:04:05.999999Z"
+	DefaultClockSkew     = 30 * time.Second
+	DefaultRequestMaxAge = 10 * time.Minute
+)
+
+// RelyingPartyConfig configures a service provider authenticating its users at an identity provider
+type RelyingPartyConfig struct {
+	EntityID string
+	// AssertionConsumerServiceURL is the location of the AssertionConsumerHandler receiving the responses with the HTTP-POST binding
+	AssertionConsumerServiceURL string
+	// IdentityProviderMetadata is the metadata of the identity provider
+	IdentityProviderMetadata []byte
+	// Signing signs the AuthnRequests if set
+	Signing            *key.CertificateAndKey
+	SignatureAlgorithm string
+	// NameIDFormat is requested in the NameIDPolicy of the AuthnRequests (optional)
+	NameIDFormat string
+	// AllowIDPInitiated accepts responses which are not answers to AuthnRequests of the service provider
+	AllowIDPInitiated bool
+	// ClockSkew is tolerated when validating the times of the assertions, defaults to DefaultClockSkew
+	ClockSkew time.Duration
+	// RequestStorage remembers the sent AuthnRequests, defaults to an in-memory storage
+	RequestStorage RequestStorage
+	// AssertionCache remembers the consumed assertions to reject replayed responses, defaults to an in-memory cache
+	AssertionCache AssertionCache
+}
+
+// RequestStorage remembers the IDs of the sent AuthnRequests, so that the responses can be matched to them
+type RequestStorage interface {
+	StoreRequest(ctx context.Context, requestID string) error
+	// ConsumeRequest returns false if the request was not sent or already answered
+	ConsumeRequest(ctx context.Context, requestID string) (bool, error)
+}
+
+// AssertionCache remembers the IDs of the consumed assertions until they expire, so that an assertion is only accepted once
+type AssertionCache interface {
+	// ConsumeAssertion returns false if the assertion was already consumed before
+	ConsumeAssertion(ctx context.Context, assertionID string, expiration time.Time) (bool, error)
+}
+
+// RelyingParty is a service provider creating AuthnRequests for an identity provider and consuming its responses
+type RelyingParty struct {
+	config       *RelyingPartyConfig
+	idpMetadata  *md.EntityDescriptorType
+	idpCerts     []*x509.Certificate
+	postTemplate *template.Template
+}
+
+func NewRelyingParty(config *RelyingPartyConfig) (*RelyingParty, error) {
+	if config.EntityID == "" || config.AssertionConsumerServiceURL == "" {
+		return nil, fmt.Errorf("entityID and assertion consumer service url are required")
+	}
+	metadata, err := xml.ParseMetadataXmlIntoStruct(config.IdentityProviderMetadata)
+	if err != nil {
+		return nil, err
+	}
+	if metadata.IDPSSODescriptor == nil {
+		return nil, fmt.Errorf("no IDPSSODescriptor in metadata of identity provider")
+	}
+	certs, err := signature.ParseCertificates(xml.GetCertsFromKeyDescriptors(metadata.IDPSSODescriptor.KeyDescriptor))
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no signing certificate in metadata of identity provider")
+	}
+	postTemplate, err := template.New("post").Parse(requestPostTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	// the defaults are applied to a copy, so that a config reused for another RelyingParty does not share its storages
+	copied := *config
+	config = &copied
+	if config.ClockSkew == 0 {
+		config.ClockSkew = DefaultClockSkew
+	}
+	if config.RequestStorage == nil {
+		config.RequestStorage = NewMemoryRequestStorage(DefaultRequestMaxAge)
+	}
+	if config.AssertionCache == nil {
+		config.AssertionCache = NewMemoryAssertionCache()
+	}
+	return &RelyingParty{
+		config:       config,
+		idpMetadata:  metadata,
+		idpCerts:     certs,
+		postTemplate: postTemplate,
+	}, nil
+}
+
+// GetEntityID returns the entityID of the service provider
+func (rp *RelyingParty) GetEntityID() string {
+	return rp.config.EntityID
+}
+
+// IdentityProviderEntityID returns the entityID of the identity provider
+func (rp *RelyingParty) IdentityProviderEntityID() string {
+	return string(rp.idpMetadata.EntityID)
+}
+
+// singleSignOnURL returns the location of the SingleSignOnService of the identity provider with the binding
+func (rp *RelyingParty) singleSignOnURL(binding string) (string, error) {
+	for _, service := range rp.idpMetadata.IDPSSODescriptor.SingleSignOnService {
+		if service.Binding == binding {
+			return service.Location, nil
+		}
+	}
+	return "", fmt.Errorf("no single sign-on service of identity provider with binding %s", binding)
+}
+
+func (rp *RelyingParty) makeAuthnRequest(ctx context.Context, destination string) (*samlp.AuthnRequestType, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.config.RequestStorage.StoreRequest(ctx, id); err != nil {
+		return nil, err
+	}
+	request := &samlp.AuthnRequestType{
+		Id:                          id,
+		Version:                     "2.0",
+		IssueInstant:                time.Now().UTC().Format(DefaultTimeFormat),
+		Destination:                 destination,
+		ProtocolBinding:             PostBinding,
+		AssertionConsumerServiceURL: rp.config.AssertionConsumerServiceURL,
+		Issuer: &saml.NameIDType{
+			Format: "urn:oasis:names:tc:SAML:2.0:nameid-format:entity",
+			Text:   rp.config.EntityID,
+		},
+	}
+	if rp.config.NameIDFormat != "" {
+		request.NameIDPolicy = &samlp.NameIDPolicyType{Format: rp.config.NameIDFormat, AllowCreate: true}
+	}
+	return request, nil
+}
+
+// RedirectURL returns the location of the AuthnRequest to the identity provider with the HTTP-Redirect binding
+func (rp *RelyingParty) RedirectURL(ctx context.Context, relayState string) (string, error) {
+	location, err := rp.singleSignOnURL(RedirectBinding)
+	if err != nil {
+		return "", err
+	}
+	request, err := rp.makeAuthnRequest(ctx, location)
+	if err != nil {
+		return "", err
+	}
+	data, err := xml.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	encoded, err := xml.DeflateAndBase64(data)
+	if err != nil {
+		return "", err
+	}
+
+	query := "SAMLRequest=" + url.QueryEscape(string(encoded))
+	if relayState != "" {
+		query += "&RelayState=" + url.QueryEscape(relayState)
+	}
+	if rp.config.Signing != nil {
+		query, err = signature.CreateRedirectQuery(rp.config.Signing.Certificate, rp.config.Signing.Key, rp.config.SignatureAlgorithm, query)
+		if err != nil {
+			return "", err
+		}
+	}
+	if strings.Contains(location, "?") {
+		return location + "&" + query, nil
+	}
+	return location + "?" + query, nil
+}
+
+// WritePostForm writes the auto-submitting form posting the AuthnRequest to the identity provider with the HTTP-POST binding
+func (rp *RelyingParty) WritePostForm(ctx context.Context, w http.ResponseWriter, relayState string) error {
+	location, err := rp.singleSignOnURL(PostBinding)
+	if err != nil {
+		return err
+	}
+	request, err := rp.makeAuthnRequest(ctx, location)
+	if err != nil {
+		return err
+	}
+	if rp.config.Signing != nil {
+		signer, err := signature.GetSigner(rp.config.Signing.Certificate, rp.config.Signing.Key, rp.config.SignatureAlgorithm)
+		if err != nil {
+			return err
+		}
+		request.Signature, err = signature.Create(signer, request)
+		if err != nil {
+			return err
+		}
+	}
+	data, err := xml.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return rp.postTemplate.Execute(w, &requestPostForm{
+		URL:         location,
+		SAMLRequest: base64.StdEncoding.EncodeToString(data),
+		RelayState:  relayState,
+	})
+}
+
+type requestPostForm struct {
+	URL         string
+	SAMLRequest string
+	RelayState  string
+}
+
+const requestPostTemplate = `<!DOCTYPE html>
+<html>
+<body onload="document.getElementById('samlpost').submit()">
+<form action="{{ .URL }}" method="post" id="samlpost">
+<input type="hidden" name="SAMLRequest" value="{{ .SAMLRequest }}"/>
+<input type="hidden" name="RelayState" value="{{ .RelayState }}"/>
+<noscript><input type="submit" value="Continue"/></noscript>
+</form>
+</body>
+</html>`
+
+func newID() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "_" + hex.EncodeToString(b), nil
+}
+
+// memoryRequestStorage remembers the sent AuthnRequests in memory until they are answered or expired
+type memoryRequestStorage struct {
+	mutex    sync.Mutex
+	maxAge   time.Duration
+	requests map[string]time.Time
+}
+
+// NewMemoryRequestStorage returns a RequestStorage keeping the requests in memory for the maxAge,
+// which is only usable if all responses are received by the same instance
+func NewMemoryRequestStorage(maxAge time.Duration) RequestStorage {
+	return &memoryRequestStorage{maxAge: maxAge, requests: make(map[string]time.Time)}
+}
+
+func (s *memoryRequestStorage) StoreRequest(_ context.Context, requestID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	for id, expiration := range s.requests {
+		if now.After(expiration) {
+			delete(s.requests, id)
+		}
+	}
+	s.requests[requestID] = now.Add(s.maxAge)
+	return nil
+}
+
+func (s *memoryRequestStorage) ConsumeRequest(_ context.Context, requestID string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	expiration, ok := s.requests[requestID]
+	delete(s.requests, requestID)
+	return ok && time.Now().Before(expiration), nil
+}
+
+// memoryAssertionCache remembers the consumed assertions in memory until they expire
+type memoryAssertionCache struct {
+	mutex      sync.Mutex
+	assertions map[string]time.Time
+}
+
+// NewMemoryAssertionCache returns an AssertionCache keeping the assertions in memory,
+// which is only usable if all responses are received by the same instance
+func NewMemoryAssertionCache() AssertionCache {
+	return &memoryAssertionCache{assertions: make(map[string]time.Time)}
+}
+
+func (c *memoryAssertionCache) ConsumeAssertion(_ context.Context, assertionID string, expiration time.Time) (bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := time.Now()
+	for id, until := range c.assertions {
+		if now.After(until) {
+			delete(c.assertions, id)
+		}
+	}
+	if _, ok := c.assertions[assertionID]; ok {
+		return false, nil
+	}
+	c.assertions[assertionID] = expiration
+	return true, nil
+}
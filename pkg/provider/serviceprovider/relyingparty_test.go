@@ -0,0 +1,377 @@
+package serviceprovider
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zitadel/saml/pkg/provider/key"
+	"github.com/zitadel/saml/pkg/provider/signature"
+	"github.com/zitadel/saml/pkg/provider/xml"
+	"github.com/zitadel/saml/pkg/provider/xml/md"
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
+	"github.com/zitadel/saml/pkg/provider/xml/samlp"
+	"github.com/zitadel/saml/pkg/provider/xml/xml_dsig"
+)
+
+const (
+	testIDPEntityID = "https://idp.example.com/metadata"
+	testEntityID    = "https://sp.example.com/metadata"
+	testACSURL      = "https://sp.example.com/acs"
+)
+
+func newKeyAndCertificate(t *testing.T) (*rsa.PrivateKey, *x509.Certificate) {
+	return newKeyAndCertificateWith(t, 2048, time.Now(), time.Now().Add(time.Hour))
+}
+
+// newKeyAndCertificateWith returns a key of the size and its self-signed certificate valid in the period
+func newKeyAndCertificateWith(t *testing.T, bits int, notBefore, notAfter time.Time) (*rsa.PrivateKey, *x509.Certificate) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, bits)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return privateKey, cert
+}
+
+func newTestRelyingParty(t *testing.T, idpCert *x509.Certificate, config *RelyingPartyConfig) *RelyingParty {
+	metadata, err := xml.Marshal(&md.EntityDescriptorType{
+		EntityID: testIDPEntityID,
+		IDPSSODescriptor: &md.IDPSSODescriptorType{
+			ProtocolSupportEnumeration: "urn:oasis:names:tc:SAML:2.0:protocol",
+			KeyDescriptor: []md.KeyDescriptorType{{
+				Use: md.KeyTypesSigning,
+				KeyInfo: xml_dsig.KeyInfoType{
+					X509Data: []xml_dsig.X509DataType{{X509Certificate: base64.StdEncoding.EncodeToString(idpCert.Raw)}},
+				},
+			}},
+			SingleSignOnService: []md.EndpointType{
+				{Binding: RedirectBinding, Location: "https://idp.example.com/SSO"},
+				{Binding: PostBinding, Location: "https://idp.example.com/SSO"},
+			},
+		},
+	})
+	require.NoError(t, err)
+	config.EntityID = testEntityID
+	config.AssertionConsumerServiceURL = testACSURL
+	config.IdentityProviderMetadata = metadata
+	rp, err := NewRelyingParty(config)
+	require.NoError(t, err)
+	return rp
+}
+
+func TestRelyingParty_RedirectURL(t *testing.T) {
+	_, idpCert := newKeyAndCertificate(t)
+	spKey, spCert := newKeyAndCertificate(t)
+	rp := newTestRelyingParty(t, idpCert, &RelyingPartyConfig{
+		Signing:            &key.CertificateAndKey{Certificate: spCert.Raw, Key: spKey},
+		SignatureAlgorithm: dsig.RSASHA256SignatureMethod,
+	})
+
+	location, err := rp.RedirectURL(context.Background(), "state")
+	require.NoError(t, err)
+	parsed, err := url.Parse(location)
+	require.NoError(t, err)
+	assert.Equal(t, "idp.example.com", parsed.Host)
+	assert.Equal(t, "state", parsed.Query().Get("RelayState"))
+	assert.Equal(t, dsig.RSASHA256SignatureMethod, parsed.Query().Get("SigAlg"))
+
+	sp := &ServiceProvider{signerPublicKey: spCert.PublicKey}
+	require.NoError(t, sp.ValidateRedirectSignature(parsed.Query().Get("SAMLRequest"), "state", dsig.RSASHA256SignatureMethod, parsed.Query().Get("Signature")))
+
+	request, err := xml.DecodeAuthNRequest(xml.EncodingDeflate, parsed.Query().Get("SAMLRequest"))
+	require.NoError(t, err)
+	assert.Equal(t, testEntityID, request.Issuer.Text)
+	assert.Equal(t, testACSURL, request.AssertionConsumerServiceURL)
+	assert.Equal(t, PostBinding, request.ProtocolBinding)
+	ok, err := rp.config.RequestStorage.ConsumeRequest(context.Background(), request.Id)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestRelyingParty_WritePostForm(t *testing.T) {
+	_, idpCert := newKeyAndCertificate(t)
+	rp := newTestRelyingParty(t, idpCert, &RelyingPartyConfig{})
+
+	w := httptest.NewRecorder()
+	require.NoError(t, rp.WritePostForm(context.Background(), w, "state"))
+	body := w.Body.String()
+	assert.Contains(t, body, `action="https://idp.example.com/SSO"`)
+	assert.Contains(t, body, `name="SAMLRequest"`)
+	assert.Contains(t, body, `value="state"`)
+}
+
+type testResponse struct {
+	inResponseTo string
+	status       string
+	audience     string
+	notOnOrAfter time.Time
+	sign         bool
+	// withoutAudienceRestriction omits the AudienceRestriction of the conditions
+	withoutAudienceRestriction bool
+}
+
+func signedResponse(t *testing.T, idpKey *rsa.PrivateKey, idpCert *x509.Certificate, tr testResponse) string {
+	now := time.Now().UTC()
+	response := &samlp.ResponseType{
+		Id:           "_response",
+		InResponseTo: tr.inResponseTo,
+		Version:      "2.0",
+		IssueInstant: now.Format(DefaultTimeFormat),
+		Destination:  testACSURL,
+		Issuer:       &saml.NameIDType{Text: testIDPEntityID},
+		Status:       samlp.StatusType{StatusCode: samlp.StatusCodeType{Value: tr.status}},
+	}
+	if tr.status == statusCodeSuccess {
+		response.Assertion = &saml.AssertionType{
+			Version:      "2.0",
+			Id:           "_assertion",
+			IssueInstant: now.Format(DefaultTimeFormat),
+			Issuer:       saml.NameIDType{Text: testIDPEntityID},
+			Subject: &saml.SubjectType{
+				NameID: &saml.NameIDType{Text: "user", Format: "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"},
+				SubjectConfirmation: []saml.SubjectConfirmationType{{
+					Method: subjectConfirmationMethodBearer,
+					SubjectConfirmationData: &saml.SubjectConfirmationDataType{
+						InResponseTo: tr.inResponseTo,
+						Recipient:    testACSURL,
+						NotOnOrAfter: tr.notOnOrAfter.Format(DefaultTimeFormat),
+					},
+				}},
+			},
+			Conditions: &saml.ConditionsType{
+				NotBefore:           now.Add(-time.Minute).Format(DefaultTimeFormat),
+				NotOnOrAfter:        tr.notOnOrAfter.Format(DefaultTimeFormat),
+				AudienceRestriction: []saml.AudienceRestrictionType{{Audience: []string{tr.audience}}},
+			},
+			AuthnStatement: []saml.AuthnStatementType{{
+				AuthnInstant: now.Format(DefaultTimeFormat),
+				SessionIndex: "session",
+				AuthnContext: saml.AuthnContextType{AuthnContextClassRef: "urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport"},
+			}},
+			AttributeStatement: []saml.AttributeStatementType{{
+				Attribute: []*saml.AttributeType{{
+					Name:           "urn:oid:0.9.2342.19200300.100.1.3",
+					FriendlyName:   "mail",
+					AttributeValue: saml.StringAttributeValues("user@example.com"),
+				}},
+			}},
+		}
+	}
+	if response.Assertion != nil && tr.withoutAudienceRestriction {
+		response.Assertion.Conditions.AudienceRestriction = nil
+	}
+	if tr.sign {
+		signer, err := signature.GetSigner(idpCert.Raw, idpKey, dsig.RSASHA256SignatureMethod)
+		require.NoError(t, err)
+		response.Signature, err = signature.Create(signer, response)
+		require.NoError(t, err)
+	}
+	data, err := xml.Marshal(response)
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func TestRelyingParty_ParseResponse(t *testing.T) {
+	idpKey, idpCert := newKeyAndCertificate(t)
+	otherKey, otherCert := newKeyAndCertificate(t)
+	valid := testResponse{
+		inResponseTo: "_request",
+		status:       statusCodeSuccess,
+		audience:     testEntityID,
+		notOnOrAfter: time.Now().Add(time.Minute),
+		sign:         true,
+	}
+	with := func(change func(*testResponse)) testResponse {
+		tr := valid
+		change(&tr)
+		return tr
+	}
+
+	type args struct {
+		response          string
+		allowIDPInitiated bool
+	}
+	type res struct {
+		err    bool
+		status string
+	}
+	tests := []struct {
+		name string
+		args args
+		res  res
+	}{
+		{
+			"valid response",
+			args{response: signedResponse(t, idpKey, idpCert, valid)},
+			res{},
+		},
+		{
+			"unknown request",
+			args{response: signedResponse(t, idpKey, idpCert, with(func(tr *testResponse) { tr.inResponseTo = "_unknown" }))},
+			res{err: true},
+		},
+		{
+			"unsolicited response",
+			args{response: signedResponse(t, idpKey, idpCert, with(func(tr *testResponse) { tr.inResponseTo = "" }))},
+			res{err: true},
+		},
+		{
+			"unsolicited response allowed",
+			args{response: signedResponse(t, idpKey, idpCert, with(func(tr *testResponse) { tr.inResponseTo = "" })), allowIDPInitiated: true},
+			res{},
+		},
+		{
+			"other audience",
+			args{response: signedResponse(t, idpKey, idpCert, with(func(tr *testResponse) { tr.audience = "other" }))},
+			res{err: true},
+		},
+		{
+			"no audience restriction",
+			args{response: signedResponse(t, idpKey, idpCert, with(func(tr *testResponse) { tr.withoutAudienceRestriction = true }))},
+			res{err: true},
+		},
+		{
+			"expired",
+			args{response: signedResponse(t, idpKey, idpCert, with(func(tr *testResponse) { tr.notOnOrAfter = time.Now().Add(-time.Hour) }))},
+			res{err: true},
+		},
+		{
+			"unsigned",
+			args{response: signedResponse(t, idpKey, idpCert, with(func(tr *testResponse) { tr.sign = false }))},
+			res{err: true},
+		},
+		{
+			"unknown signing certificate",
+			args{response: signedResponse(t, otherKey, otherCert, valid)},
+			res{err: true},
+		},
+		{
+			"failed status",
+			args{response: signedResponse(t, idpKey, idpCert, with(func(tr *testResponse) { tr.status = "urn:oasis:names:tc:SAML:2.0:status:Responder" }))},
+			res{err: true, status: "urn:oasis:names:tc:SAML:2.0:status:Responder"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := newTestRelyingParty(t, idpCert, &RelyingPartyConfig{AllowIDPInitiated: tt.args.allowIDPInitiated})
+			require.NoError(t, rp.config.RequestStorage.StoreRequest(context.Background(), "_request"))
+
+			form := url.Values{"SAMLResponse": {tt.args.response}, "RelayState": {"state"}}
+			req := httptest.NewRequest(http.MethodPost, "/acs", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			var session *Session
+			var relayState string
+			var err error
+			rp.AssertionConsumerHandler(func(_ http.ResponseWriter, _ *http.Request, s *Session, rs string, e error) {
+				session, relayState, err = s, rs, e
+			}).ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, "state", relayState)
+			if tt.res.err {
+				require.Error(t, err)
+				if tt.res.status != "" {
+					statusErr, ok := err.(*StatusError)
+					require.True(t, ok)
+					assert.Equal(t, tt.res.status, statusErr.StatusCode)
+				}
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "user", session.NameID)
+			assert.Equal(t, "session", session.SessionIndex)
+			assert.Equal(t, testIDPEntityID, session.Issuer)
+			assert.Equal(t, "user@example.com", session.Attribute("mail"))
+			assert.Equal(t, []string{"user@example.com"}, session.AttributeValues("urn:oid:0.9.2342.19200300.100.1.3"))
+		})
+	}
+}
+
+func TestRelyingParty_ParseResponse_replay(t *testing.T) {
+	idpKey, idpCert := newKeyAndCertificate(t)
+	rp := newTestRelyingParty(t, idpCert, &RelyingPartyConfig{AllowIDPInitiated: true})
+	response := signedResponse(t, idpKey, idpCert, testResponse{
+		status:       statusCodeSuccess,
+		audience:     testEntityID,
+		notOnOrAfter: time.Now().Add(time.Minute),
+		sign:         true,
+	})
+	parse := func() error {
+		form := url.Values{"SAMLResponse": {response}}
+		req := httptest.NewRequest(http.MethodPost, "/acs", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		_, err := rp.ParseResponse(req)
+		return err
+	}
+
+	require.NoError(t, parse())
+	// an unsolicited response is not bound to a request, only the cached assertion ID prevents the replay
+	assert.ErrorContains(t, parse(), "already consumed")
+}
+
+func TestRelyingParty_DecodeVerifiedResponse(t *testing.T) {
+	idpKey, idpCert := newKeyAndCertificate(t)
+	data, err := base64.StdEncoding.DecodeString(signedResponse(t, idpKey, idpCert, testResponse{
+		inResponseTo: "_request",
+		status:       statusCodeSuccess,
+		audience:     testEntityID,
+		notOnOrAfter: time.Now().Add(time.Minute),
+		sign:         true,
+	}))
+	require.NoError(t, err)
+
+	// the enveloped signature is not covered by its own reference, a forged assertion inside of it keeps the signature valid
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromBytes(data))
+	object := doc.Root().SelectElement("Signature").CreateElement("ds:Object")
+	forged := object.CreateElement("saml:Assertion")
+	forged.CreateAttr("xmlns:saml", "urn:oasis:names:tc:SAML:2.0:assertion")
+	forged.CreateElement("saml:Subject").CreateElement("saml:NameID").SetText("admin")
+	data, err = doc.WriteToBytes()
+	require.NoError(t, err)
+
+	response, err := DecodeVerifiedResponse([]*x509.Certificate{idpCert}, data)
+	require.NoError(t, err)
+	assert.Nil(t, response.Signature)
+	require.NotNil(t, response.Assertion)
+	assert.Equal(t, "user", response.Assertion.Subject.NameID.Text)
+
+	_, otherCert := newKeyAndCertificate(t)
+	_, err = DecodeVerifiedResponse([]*x509.Certificate{otherCert}, data)
+	assert.Error(t, err)
+}
+
+func TestRelyingParty_NewRelyingParty_configNotShared(t *testing.T) {
+	_, idpCert := newKeyAndCertificate(t)
+	config := &RelyingPartyConfig{}
+	first := newTestRelyingParty(t, idpCert, config)
+	second := newTestRelyingParty(t, idpCert, config)
+
+	assert.Nil(t, config.AssertionCache)
+	assert.Nil(t, config.RequestStorage)
+	assert.Zero(t, config.ClockSkew)
+	assert.NotSame(t, first.config.AssertionCache, second.config.AssertionCache)
+	assert.NotSame(t, first.config.RequestStorage, second.config.RequestStorage)
+}
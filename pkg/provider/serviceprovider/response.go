@@ -0,0 +1,309 @@
+package serviceprovider
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/beevik/etree"
+
+	"github.com/zitadel/saml/pkg/provider/signature"
+	"github.com/zitadel/saml/pkg/provider/xml"
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
+	"github.com/zitadel/saml/pkg/provider/xml/samlp"
+)
+
+const (
+	statusCodeSuccess               = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	subjectConfirmationMethodBearer = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+)
+
+// Session is the authentication of a user asserted by the identity provider
+type Session struct {
+	Issuer       string
+	NameID       string
+	NameIDFormat string
+	// SessionIndex identifies the session at the identity provider, e.g. for the single logout
+	SessionIndex         string
+	AuthnInstant         time.Time
+	SessionNotOnOrAfter  time.Time
+	AuthnContextClassRef string
+	// Attributes are the values of the released attributes by their names
+	Attributes map[string][]string
+	// FriendlyNames are the names of the released attributes by their friendly names
+	FriendlyNames map[string]string
+	Assertion     *saml.AssertionType
+}
+
+// Attribute returns the first value of the attribute with the name or friendly name, empty if not released
+func (s *Session) Attribute(name string) string {
+	values := s.AttributeValues(name)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// AttributeValues returns the values of the attribute with the name or friendly name
+func (s *Session) AttributeValues(name string) []string {
+	if values, ok := s.Attributes[name]; ok {
+		return values
+	}
+	return s.Attributes[s.FriendlyNames[name]]
+}
+
+// StatusError is returned for responses of the identity provider without success
+type StatusError struct {
+	StatusCode string
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("identity provider responded with status %s: %s", e.StatusCode, e.Message)
+}
+
+// SessionHandler is called by the AssertionConsumerHandler with the session of a successful response and its RelayState,
+// or with the error of an invalid or failed response
+type SessionHandler func(w http.ResponseWriter, r *http.Request, session *Session, relayState string, err error)
+
+// AssertionConsumerHandler returns the handler of the AssertionConsumerService with the HTTP-POST binding
+func (rp *RelyingParty) AssertionConsumerHandler(handler SessionHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, err := rp.ParseResponse(r)
+		handler(w, r, session, r.PostFormValue("RelayState"), err)
+	})
+}
+
+// ParseResponse decodes the response of the identity provider posted to the AssertionConsumerService,
+// verifies its signature and validates the assertion
+func (rp *RelyingParty) ParseResponse(r *http.Request) (*Session, error) {
+	if r.Method != http.MethodPost {
+		return nil, fmt.Errorf("method %s not allowed", r.Method)
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("failed to parse form: %w", err)
+	}
+	rawResponse, err := xml.InflateAndDecode("", true, r.PostFormValue("SAMLResponse"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	response, err := DecodeVerifiedResponse(rp.idpCerts, rawResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Issuer != nil && response.Issuer.Text != rp.IdentityProviderEntityID() {
+		return nil, fmt.Errorf("issuer of response not equal to identity provider")
+	}
+	if response.Destination != "" && response.Destination != rp.config.AssertionConsumerServiceURL {
+		return nil, fmt.Errorf("destination of response not equal to assertion consumer service url")
+	}
+	if response.InResponseTo != "" {
+		ok, err := rp.config.RequestStorage.ConsumeRequest(r.Context(), response.InResponseTo)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("response to unknown request %s", response.InResponseTo)
+		}
+	} else if !rp.config.AllowIDPInitiated {
+		return nil, fmt.Errorf("unsolicited responses are not allowed")
+	}
+	if response.Status.StatusCode.Value != statusCodeSuccess {
+		return nil, &StatusError{StatusCode: response.Status.StatusCode.Value, Message: response.Status.StatusMessage}
+	}
+
+	if err := ValidateAssertion(response.Assertion, &AssertionRequirements{
+		Issuer:       rp.IdentityProviderEntityID(),
+		Audience:     rp.config.EntityID,
+		Recipient:    rp.config.AssertionConsumerServiceURL,
+		InResponseTo: response.InResponseTo,
+		ClockSkew:    rp.config.ClockSkew,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to validate assertion: %w", err)
+	}
+	// the assertion is cached until it expires, a replay afterwards is rejected by the validation
+	ok, err := rp.config.AssertionCache.ConsumeAssertion(r.Context(), response.Assertion.Id, assertionExpiration(response.Assertion).Add(rp.config.ClockSkew))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("assertion %s was already consumed", response.Assertion.Id)
+	}
+	return newSession(response.Assertion), nil
+}
+
+// DecodeVerifiedResponse verifies the signature of the response or its assertion (see signature.ValidateResponse)
+// and decodes the signed content from the verified element, so that unsigned content next to it is ignored.
+// The other elements of a response with a signed assertion are taken as sent.
+func DecodeVerifiedResponse(certs []*x509.Certificate, rawResponse []byte) (*samlp.ResponseType, error) {
+	verified, err := signature.ValidateResponseElement(certs, rawResponse)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify signature: %w", err)
+	}
+	if verified == nil {
+		response, err := xml.DecodeResponse("", false, string(rawResponse))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+		return response, nil
+	}
+	doc := etree.NewDocument()
+	doc.SetRoot(verified)
+	data, err := doc.WriteToBytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode verified element: %w", err)
+	}
+	if verified.Tag == "Response" {
+		response, err := xml.DecodeResponse("", false, string(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+		return response, nil
+	}
+	response, err := xml.DecodeResponse("", false, string(rawResponse))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	response.Assertion, err = xml.DecodeAssertion(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode assertion: %w", err)
+	}
+	return response, nil
+}
+
+// AssertionRequirements are the values an assertion has to match to be accepted
+type AssertionRequirements struct {
+	Issuer   string
+	Audience string
+	// Recipient is the assertion consumer service url the bearer subject confirmation is for
+	Recipient string
+	// InResponseTo is the ID of the request the bearer subject confirmation is for, empty for unsolicited responses
+	InResponseTo string
+	ClockSkew    time.Duration
+}
+
+// ValidateAssertion checks the issuer, conditions and bearer subject confirmation of the assertion,
+// the service provider has to be an audience of the assertion
+func ValidateAssertion(assertion *saml.AssertionType, requirements *AssertionRequirements) error {
+	if assertion == nil {
+		return fmt.Errorf("no assertion in response")
+	}
+	if assertion.Id == "" {
+		return fmt.Errorf("no ID of assertion")
+	}
+	if assertion.Issuer.Text != requirements.Issuer {
+		return fmt.Errorf("issuer of assertion not equal to identity provider")
+	}
+	if assertion.Subject == nil || assertion.Subject.NameID == nil {
+		return fmt.Errorf("no subject in assertion")
+	}
+	if len(assertion.AuthnStatement) == 0 {
+		return fmt.Errorf("no authn statement in assertion")
+	}
+
+	// the Web Browser SSO profile requires an AudienceRestriction with the service provider
+	if assertion.Conditions == nil || len(assertion.Conditions.AudienceRestriction) == 0 {
+		return fmt.Errorf("no audience restriction in assertion")
+	}
+	now := time.Now().UTC()
+	if err := checkValidity(now, assertion.Conditions.NotBefore, assertion.Conditions.NotOnOrAfter, requirements.ClockSkew); err != nil {
+		return err
+	}
+	for _, restriction := range assertion.Conditions.AudienceRestriction {
+		if !slices.Contains(restriction.Audience, requirements.Audience) {
+			return fmt.Errorf("service provider is not an audience of the assertion")
+		}
+	}
+
+	for _, confirmation := range assertion.Subject.SubjectConfirmation {
+		data := confirmation.SubjectConfirmationData
+		if confirmation.Method != subjectConfirmationMethodBearer || data == nil {
+			continue
+		}
+		if data.InResponseTo != requirements.InResponseTo || data.Recipient != requirements.Recipient {
+			continue
+		}
+		if data.NotOnOrAfter == "" || checkValidity(now, data.NotBefore, data.NotOnOrAfter, requirements.ClockSkew) != nil {
+			continue
+		}
+		return nil
+	}
+	return fmt.Errorf("no valid bearer subject confirmation in assertion")
+}
+
+// assertionExpiration returns the latest NotOnOrAfter of the bearer subject confirmations of a validated assertion
+func assertionExpiration(assertion *saml.AssertionType) time.Time {
+	var expiration time.Time
+	for _, confirmation := range assertion.Subject.SubjectConfirmation {
+		if confirmation.Method != subjectConfirmationMethodBearer || confirmation.SubjectConfirmationData == nil {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339, confirmation.SubjectConfirmationData.NotOnOrAfter); err == nil && t.After(expiration) {
+			expiration = t
+		}
+	}
+	return expiration
+}
+
+// checkValidity checks that the time is in the validity period, tolerating the clock skew
+func checkValidity(now time.Time, notBefore, notOnOrAfter string, clockSkew time.Duration) error {
+	if notBefore != "" {
+		t, err := time.Parse(time.RFC3339, notBefore)
+		if err != nil {
+			return fmt.Errorf("failed to parse NotBefore: %w", err)
+		}
+		if now.Add(clockSkew).Before(t) {
+			return fmt.Errorf("before time given by NotBefore")
+		}
+	}
+	if notOnOrAfter != "" {
+		t, err := time.Parse(time.RFC3339, notOnOrAfter)
+		if err != nil {
+			return fmt.Errorf("failed to parse NotOnOrAfter: %w", err)
+		}
+		if !now.Add(-clockSkew).Before(t) {
+			return fmt.Errorf("on or after time given by NotOnOrAfter")
+		}
+	}
+	return nil
+}
+
+func newSession(assertion *saml.AssertionType) *Session {
+	session := &Session{
+		Issuer:        assertion.Issuer.Text,
+		NameID:        assertion.Subject.NameID.Text,
+		NameIDFormat:  assertion.Subject.NameID.Format,
+		Attributes:    make(map[string][]string),
+		FriendlyNames: make(map[string]string),
+		Assertion:     assertion,
+	}
+	statement := assertion.AuthnStatement[0]
+	session.SessionIndex = statement.SessionIndex
+	session.AuthnContextClassRef = statement.AuthnContext.AuthnContextClassRef
+	session.AuthnInstant, _ = time.Parse(time.RFC3339, statement.AuthnInstant)
+	if statement.SessionNotOnOrAfter != "" {
+		session.SessionNotOnOrAfter, _ = time.Parse(time.RFC3339, statement.SessionNotOnOrAfter)
+	}
+
+	for _, attributeStatement := range assertion.AttributeStatement {
+		for _, attribute := range attributeStatement.Attribute {
+			for _, value := range attribute.AttributeValue {
+				if value.Nil {
+					continue
+				}
+				text := value.Text
+				if value.NameID != nil {
+					text = value.NameID.Text
+				}
+				session.Attributes[attribute.Name] = append(session.Attributes[attribute.Name], text)
+			}
+			if attribute.FriendlyName != "" {
+				session.FriendlyNames[attribute.FriendlyName] = attribute.Name
+			}
+		}
+	}
+	return session
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/beevik/etree"
 
+	"github.com/zitadel/saml/pkg/provider/attribute"
 	"github.com/zitadel/saml/pkg/provider/signature"
 	"github.com/zitadel/saml/pkg/provider/xml"
 	"github.com/zitadel/saml/pkg/provider/xml/md"
@@ -15,13 +16,23 @@ import (
 
 type Config struct {
 	Metadata []byte
+	// AttributeProfile names the attributes released to the service provider,
+	// if nil the profile of the identity provider is used
+	AttributeProfile *attribute.Profile
+	// Assertion customizes the assertions issued to the service provider
+	Assertion *AssertionConfig
+	// NameIDMapping authorizes the service provider to use the NameID mapping service
+	NameIDMapping *NameIDMappingConfig
 }
 
 type ServiceProvider struct {
-	ID              string
-	Metadata        *md.EntityDescriptorType
-	signerPublicKey interface{}
-	loginURL        func(string) string
+	ID               string
+	Metadata         *md.EntityDescriptorType
+	AttributeProfile *attribute.Profile
+	Assertion        *AssertionConfig
+	NameIDMapping    *NameIDMappingConfig
+	signerPublicKey  interface{}
+	loginURL         func(string) string
 }
 
 func (sp *ServiceProvider) GetEntityID() string {
@@ -32,11 +43,44 @@ func (sp *ServiceProvider) LoginURL(id string) string {
 	return sp.loginURL(id)
 }
 
+// AttributeConsumingService returns the AttributeConsumingService of the service provider with the provided index.
+// If no index is provided or no service with the index exists, the default service is returned,
+// which is the one marked with isDefault, or else the first one declared in the metadata.
+// If the service provider declares no AttributeConsumingService, nil is returned.
+func (sp *ServiceProvider) AttributeConsumingService(index *int) *md.AttributeConsumingServiceType {
+	if sp.Metadata == nil || sp.Metadata.SPSSODescriptor == nil || len(sp.Metadata.SPSSODescriptor.AttributeConsumingService) == 0 {
+		return nil
+	}
+	services := sp.Metadata.SPSSODescriptor.AttributeConsumingService
+
+	if index != nil && *index >= 0 {
+		for i := range services {
+			if services[i].Index == uint64(*index) {
+				return &services[i]
+			}
+		}
+	}
+
+	for i := range services {
+		if services[i].IsDefault {
+			return &services[i]
+		}
+	}
+	return &services[0]
+}
+
 func NewServiceProvider(id string, config *Config, loginURL func(string) string) (*ServiceProvider, error) {
 	metadata, err := xml.ParseMetadataXmlIntoStruct(config.Metadata)
 	if err != nil {
 		return nil, err
 	}
+	return newServiceProvider(id, metadata, config, loginURL)
+}
+
+func newServiceProvider(id string, metadata *md.EntityDescriptorType, config *Config, loginURL func(string) string) (*ServiceProvider, error) {
+	if metadata.SPSSODescriptor == nil {
+		return nil, fmt.Errorf("no SPSSODescriptor in metadata of service provider")
+	}
 
 	var signerPublicKey interface{}
 	certs, err := getSigningCertsFromMetadata(metadata)
@@ -51,10 +95,13 @@ func NewServiceProvider(id string, config *Config, loginURL func(string) string)
 	}
 
 	return &ServiceProvider{
-		ID:              id,
-		Metadata:        metadata,
-		signerPublicKey: signerPublicKey,
-		loginURL:        loginURL,
+		ID:               id,
+		Metadata:         metadata,
+		AttributeProfile: config.AttributeProfile,
+		Assertion:        config.Assertion,
+		NameIDMapping:    config.NameIDMapping,
+		signerPublicKey:  signerPublicKey,
+		loginURL:         loginURL,
 	}, nil
 }
 
@@ -62,6 +109,21 @@ func getSigningCertsFromMetadata(metadata *md.EntityDescriptorType) ([]*x509.Cer
 	return signature.ParseCertificates(xml.GetCertsFromKeyDescriptors(metadata.SPSSODescriptor.KeyDescriptor))
 }
 
+// EncryptionCertificate returns the first certificate of the metadata usable for encryption
+func (sp *ServiceProvider) EncryptionCertificate() (*x509.Certificate, error) {
+	if sp.Metadata == nil || sp.Metadata.SPSSODescriptor == nil {
+		return nil, fmt.Errorf("no metadata of service provider")
+	}
+	certs, err := signature.ParseCertificates(xml.GetEncryptionCertsFromKeyDescriptors(sp.Metadata.SPSSODescriptor.KeyDescriptor))
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no encryption certificate of service provider")
+	}
+	return certs[0], nil
+}
+
 func (sp *ServiceProvider) ValidatePostSignature(authRequest string) error {
 	doc := etree.NewDocument()
 	if err := doc.ReadFromBytes([]byte(authRequest)); err != nil {
@@ -80,6 +142,26 @@ func (sp *ServiceProvider) ValidatePostSignature(authRequest string) error {
 	return signature.ValidatePost(certs, doc.Root())
 }
 
+// ValidateSOAPSignature validates the enveloped signature of the request in the body of the SOAP envelope
+func (sp *ServiceProvider) ValidateSOAPSignature(envelope string) error {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes([]byte(envelope)); err != nil {
+		return err
+	}
+
+	body := doc.FindElement("/Envelope/Body")
+	if body == nil || len(body.ChildElements()) == 0 {
+		return fmt.Errorf("error while parsing request")
+	}
+
+	certs, err := getSigningCertsFromMetadata(sp.Metadata)
+	if err != nil {
+		return err
+	}
+
+	return signature.ValidatePost(certs, body.ChildElements()[0])
+}
+
 func (sp *ServiceProvider) ValidateRedirectSignature(request, relayState, sigAlg, expectedSig string) error {
 	if sp.signerPublicKey == nil {
 		return fmt.Errorf("error can not validate signature if no certificate is present for this service provider")
@@ -0,0 +1,77 @@
+package serviceprovider
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zitadel/saml/pkg/provider/xml/md"
+)
+
+func TestServiceProvider_AttributeConsumingService(t *testing.T) {
+	intPointer := func(i int) *int { return &i }
+	type args struct {
+		services []md.AttributeConsumingServiceType
+		index    *int
+	}
+	tests := []struct {
+		name string
+		args args
+		res  *uint64
+	}{
+		{
+			"no services",
+			args{},
+			nil,
+		},
+		{
+			"index found",
+			args{
+				services: []md.AttributeConsumingServiceType{{Index: 1, IsDefault: true}, {Index: 2}},
+				index:    intPointer(2),
+			},
+			uint64Pointer(2),
+		},
+		{
+			"index not found, default",
+			args{
+				services: []md.AttributeConsumingServiceType{{Index: 1}, {Index: 2, IsDefault: true}},
+				index:    intPointer(3),
+			},
+			uint64Pointer(2),
+		},
+		{
+			"no index, default",
+			args{
+				services: []md.AttributeConsumingServiceType{{Index: 1}, {Index: 2, IsDefault: true}},
+			},
+			uint64Pointer(2),
+		},
+		{
+			"no index, no default, first",
+			args{
+				services: []md.AttributeConsumingServiceType{{Index: 3}, {Index: 2}},
+			},
+			uint64Pointer(3),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp := &ServiceProvider{
+				Metadata: &md.EntityDescriptorType{
+					SPSSODescriptor: &md.SPSSODescriptorType{AttributeConsumingService: tt.args.services},
+				},
+			}
+			got := sp.AttributeConsumingService(tt.args.index)
+			if tt.res == nil {
+				assert.Nil(t, got)
+				return
+			}
+			assert.Equal(t, *tt.res, got.Index)
+		})
+	}
+}
+
+func uint64Pointer(i uint64) *uint64 {
+	return &i
+}
@@ -0,0 +1,249 @@
+package serviceprovider
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/zitadel/saml/pkg/provider/signature"
+	"github.com/zitadel/saml/pkg/provider/xml"
+	"github.com/zitadel/saml/pkg/provider/xml/md"
+)
+
+const (
+	// MinRSAKeySize is the minimal size of the RSA keys of the certificates, smaller keys are reported as weak
+	MinRSAKeySize = 2048
+	// CertificateExpiryWarning is the time before the expiry of a certificate from which on it is reported
+	CertificateExpiryWarning = 30 * 24 * time.Hour
+)
+
+// Severity of a Finding, errors prevent the service provider from working, warnings don't
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Finding is an issue of the metadata, Path names the affected element, e.g. AssertionConsumerService[1]
+type Finding struct {
+	Severity Severity
+	Path     string
+	Message  string
+}
+
+func (f Finding) String() string {
+	if f.Path == "" {
+		return fmt.Sprintf("%s: %s", f.Severity, f.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", f.Severity, f.Path, f.Message)
+}
+
+// Report contains the findings of the validation of the metadata of a service provider
+type Report struct {
+	EntityID string
+	Findings []Finding
+}
+
+// Valid checks that the report contains no errors
+func (r *Report) Valid() bool {
+	return len(r.Errors()) == 0
+}
+
+func (r *Report) Errors() []Finding {
+	return r.filter(SeverityError)
+}
+
+func (r *Report) Warnings() []Finding {
+	return r.filter(SeverityWarning)
+}
+
+func (r *Report) filter(severity Severity) []Finding {
+	var findings []Finding
+	for _, finding := range r.Findings {
+		if finding.Severity == severity {
+			findings = append(findings, finding)
+		}
+	}
+	return findings
+}
+
+func (r *Report) add(severity Severity, path, format string, args ...any) {
+	r.Findings = append(r.Findings, Finding{Severity: severity, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// supportedACSBindings are the bindings the identity provider sends its responses with
+var supportedACSBindings = []string{PostBinding, RedirectBinding, "urn:oasis:names:tc:SAML:2.0:bindings:PAOS"}
+
+// supportedSLOBindings are the bindings of the SingleLogoutService used by the identity provider
+var supportedSLOBindings = []string{PostBinding, RedirectBinding, "urn:oasis:names:tc:SAML:2.0:bindings:SOAP"}
+
+var knownNameIDFormats = []string{
+	"urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified",
+	"urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress",
+	"urn:oasis:names:tc:SAML:1.1:nameid-format:X509SubjectName",
+	"urn:oasis:names:tc:SAML:1.1:nameid-format:WindowsDomainQualifiedName",
+	"urn:oasis:names:tc:SAML:2.0:nameid-format:kerberos",
+	"urn:oasis:names:tc:SAML:2.0:nameid-format:entity",
+	"urn:oasis:names:tc:SAML:2.0:nameid-format:persistent",
+	"urn:oasis:names:tc:SAML:2.0:nameid-format:transient",
+	"urn:oasis:names:tc:SAML:2.0:nameid-format:encrypted",
+}
+
+// Validate lints the metadata of a service provider, e.g. uploaded by an administrator,
+// and reports the issues which would make NewServiceProvider or the SSO fail as errors
+// and questionable settings as warnings
+func Validate(metadata []byte) *Report {
+	entity, err := xml.ParseMetadataXmlIntoStruct(metadata)
+	if err != nil {
+		report := &Report{}
+		report.add(SeverityError, "", "failed to parse metadata: %v", err)
+		return report
+	}
+	return ValidateEntity(entity)
+}
+
+// ValidateEntity lints the parsed metadata of a service provider, see Validate
+func ValidateEntity(entity *md.EntityDescriptorType) *Report {
+	return validateEntity(entity, time.Now())
+}
+
+func validateEntity(entity *md.EntityDescriptorType, now time.Time) *Report {
+	report := &Report{EntityID: string(entity.EntityID)}
+	if entity.EntityID == "" {
+		report.add(SeverityError, "entityID", "entityID is missing")
+	}
+	if entity.ValidUntil != "" && !isValid(entity.ValidUntil, now) {
+		report.add(SeverityError, "validUntil", "metadata expired at %s", entity.ValidUntil)
+	}
+	descriptor := entity.SPSSODescriptor
+	if descriptor == nil {
+		report.add(SeverityError, "SPSSODescriptor", "SPSSODescriptor is missing")
+		return report
+	}
+	if descriptor.ValidUntil != "" && !isValid(descriptor.ValidUntil, now) {
+		report.add(SeverityError, "SPSSODescriptor.validUntil", "SPSSODescriptor expired at %s", descriptor.ValidUntil)
+	}
+	validateAssertionConsumerServices(report, descriptor.AssertionConsumerService)
+	validateSingleLogoutServices(report, descriptor.SingleLogoutService)
+	validateKeyDescriptors(report, descriptor, now)
+	for i, format := range descriptor.NameIDFormat {
+		if !slices.Contains(knownNameIDFormats, format) {
+			report.add(SeverityWarning, fmt.Sprintf("NameIDFormat[%d]", i), "unknown NameID format %s", format)
+		}
+	}
+	return report
+}
+
+func validateAssertionConsumerServices(report *Report, services []md.IndexedEndpointType) {
+	if len(services) == 0 {
+		report.add(SeverityError, "AssertionConsumerService", "no AssertionConsumerService")
+		return
+	}
+	indexes := make(map[uint64]bool, len(services))
+	defaults := 0
+	for i, service := range services {
+		path := fmt.Sprintf("AssertionConsumerService[%d]", i)
+		if !slices.Contains(supportedACSBindings, service.Binding) {
+			report.add(SeverityError, path, "unsupported binding %s", service.Binding)
+		}
+		validateLocation(report, path, service.Location)
+		switch index, err := strconv.ParseUint(service.Index, 10, 16); {
+		case service.Index == "":
+			report.add(SeverityError, path, "index is missing")
+		case err != nil:
+			report.add(SeverityError, path, "index %s is not an unsigned short", service.Index)
+		case indexes[index]:
+			report.add(SeverityError, path, "duplicate index %s", service.Index)
+		default:
+			indexes[index] = true
+		}
+		if service.IsDefault == "true" || service.IsDefault == "1" {
+			defaults++
+		}
+	}
+	if defaults > 1 {
+		report.add(SeverityWarning, "AssertionConsumerService", "%d services are marked as default, the first one is used", defaults)
+	}
+}
+
+func validateSingleLogoutServices(report *Report, services []md.EndpointType) {
+	for i, service := range services {
+		path := fmt.Sprintf("SingleLogoutService[%d]", i)
+		if !slices.Contains(supportedSLOBindings, service.Binding) {
+			report.add(SeverityWarning, path, "unsupported binding %s", service.Binding)
+		}
+		validateLocation(report, path, service.Location)
+	}
+}
+
+func validateLocation(report *Report, path, location string) {
+	if location == "" {
+		report.add(SeverityError, path, "location is missing")
+		return
+	}
+	locationURL, err := url.Parse(location)
+	if err != nil || !locationURL.IsAbs() {
+		report.add(SeverityError, path, "location %s is no absolute URL", location)
+		return
+	}
+	if locationURL.Scheme != "https" {
+		report.add(SeverityWarning, path, "location %s does not use https", location)
+	}
+}
+
+func validateKeyDescriptors(report *Report, descriptor *md.SPSSODescriptorType, now time.Time) {
+	signing := 0
+	for i, keyDescriptor := range descriptor.KeyDescriptor {
+		path := fmt.Sprintf("KeyDescriptor[%d]", i)
+		for _, x509Data := range keyDescriptor.KeyInfo.X509Data {
+			if x509Data.X509Certificate == "" {
+				continue
+			}
+			certs, err := signature.ParseCertificates([]string{x509Data.X509Certificate})
+			if err != nil {
+				report.add(SeverityError, path, "%v", err)
+				continue
+			}
+			if keyDescriptor.Use == "" || keyDescriptor.Use == md.KeyTypesSigning {
+				signing++
+			}
+			validateCertificate(report, path, certs[0], now)
+		}
+	}
+	if signing > 1 {
+		report.add(SeverityError, "KeyDescriptor", "more than one signing certificate is not supported")
+	}
+	if signing == 0 && (descriptor.AuthnRequestsSigned == "true" || descriptor.AuthnRequestsSigned == "1") {
+		report.add(SeverityError, "KeyDescriptor", "AuthnRequestsSigned without a signing certificate")
+	}
+}
+
+func validateCertificate(report *Report, path string, cert *x509.Certificate, now time.Time) {
+	switch {
+	case now.After(cert.NotAfter):
+		report.add(SeverityError, path, "certificate expired at %s", cert.NotAfter.UTC().Format(time.RFC3339))
+	case now.Before(cert.NotBefore):
+		report.add(SeverityWarning, path, "certificate is not valid before %s", cert.NotBefore.UTC().Format(time.RFC3339))
+	case cert.NotAfter.Sub(now) < CertificateExpiryWarning:
+		report.add(SeverityWarning, path, "certificate expires at %s", cert.NotAfter.UTC().Format(time.RFC3339))
+	}
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < MinRSAKeySize {
+			report.add(SeverityWarning, path, "weak RSA key of %d bits", key.N.BitLen())
+		}
+	case *ecdsa.PublicKey:
+	default:
+		report.add(SeverityWarning, path, "unsupported key type %T", key)
+	}
+	switch cert.SignatureAlgorithm {
+	case x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+		report.add(SeverityWarning, path, "weak certificate signature algorithm %s", cert.SignatureAlgorithm)
+	}
+}
@@ -0,0 +1,173 @@
+package serviceprovider
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zitadel/saml/pkg/provider/xml"
+	"github.com/zitadel/saml/pkg/provider/xml/md"
+	"github.com/zitadel/saml/pkg/provider/xml/xml_dsig"
+)
+
+func signingKeyDescriptor(cert *x509.Certificate) md.KeyDescriptorType {
+	return md.KeyDescriptorType{
+		Use:     md.KeyTypesSigning,
+		KeyInfo: xml_dsig.KeyInfoType{X509Data: []xml_dsig.X509DataType{{X509Certificate: base64.StdEncoding.EncodeToString(cert.Raw)}}},
+	}
+}
+
+func TestValidate_validateEntity(t *testing.T) {
+	now := time.Now()
+	newCertificate := func(bits int, notBefore, notAfter time.Time) *x509.Certificate {
+		_, cert := newKeyAndCertificateWith(t, bits, notBefore, notAfter)
+		return cert
+	}
+	validCert := newCertificate(2048, now.Add(-time.Hour), now.Add(365*24*time.Hour))
+	validEntity := func() *md.EntityDescriptorType {
+		return &md.EntityDescriptorType{
+			EntityID: testEntityID,
+			SPSSODescriptor: &md.SPSSODescriptorType{
+				AuthnRequestsSigned:      "true",
+				AssertionConsumerService: []md.IndexedEndpointType{{Index: "0", Binding: PostBinding, Location: testACSURL}},
+				KeyDescriptor:            []md.KeyDescriptorType{signingKeyDescriptor(validCert)},
+				NameIDFormat:             []string{"urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"},
+			},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(entity *md.EntityDescriptorType)
+		errors   []string
+		warnings []string
+	}{
+		{
+			"valid",
+			func(*md.EntityDescriptorType) {},
+			nil,
+			nil,
+		},
+		{
+			"missing SPSSODescriptor",
+			func(entity *md.EntityDescriptorType) { entity.SPSSODescriptor = nil },
+			[]string{"SPSSODescriptor"},
+			nil,
+		},
+		{
+			"expired metadata",
+			func(entity *md.EntityDescriptorType) {
+				entity.ValidUntil = now.Add(-time.Minute).UTC().Format(DefaultTimeFormat)
+			},
+			[]string{"validUntil"},
+			nil,
+		},
+		{
+			"no assertion consumer service",
+			func(entity *md.EntityDescriptorType) { entity.SPSSODescriptor.AssertionConsumerService = nil },
+			[]string{"AssertionConsumerService"},
+			nil,
+		},
+		{
+			"assertion consumer services",
+			func(entity *md.EntityDescriptorType) {
+				entity.SPSSODescriptor.AssertionConsumerService = []md.IndexedEndpointType{
+					{Index: "0", Binding: PostBinding, Location: testACSURL, IsDefault: "true"},
+					{Index: "0", Binding: "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Artifact", Location: testACSURL, IsDefault: "true"},
+					{Binding: PostBinding, Location: "http://sp.example.com/acs"},
+					{Index: "x", Binding: PostBinding, Location: "/acs"},
+				}
+			},
+			[]string{"AssertionConsumerService[1]", "AssertionConsumerService[1]", "AssertionConsumerService[2]", "AssertionConsumerService[3]", "AssertionConsumerService[3]"},
+			[]string{"AssertionConsumerService[2]", "AssertionConsumerService"},
+		},
+		{
+			"single logout service",
+			func(entity *md.EntityDescriptorType) {
+				entity.SPSSODescriptor.SingleLogoutService = []md.EndpointType{{Binding: "urn:example", Location: "https://sp.example.com/slo"}}
+			},
+			nil,
+			[]string{"SingleLogoutService[0]"},
+		},
+		{
+			"expired certificate",
+			func(entity *md.EntityDescriptorType) {
+				entity.SPSSODescriptor.KeyDescriptor = []md.KeyDescriptorType{signingKeyDescriptor(newCertificate(2048, now.Add(-2*time.Hour), now.Add(-time.Hour)))}
+			},
+			[]string{"KeyDescriptor[0]"},
+			nil,
+		},
+		{
+			"weak and expiring certificate",
+			func(entity *md.EntityDescriptorType) {
+				entity.SPSSODescriptor.KeyDescriptor = []md.KeyDescriptorType{signingKeyDescriptor(newCertificate(1024, now.Add(-time.Hour), now.Add(24*time.Hour)))}
+			},
+			nil,
+			[]string{"KeyDescriptor[0]", "KeyDescriptor[0]"},
+		},
+		{
+			"multiple signing certificates",
+			func(entity *md.EntityDescriptorType) {
+				entity.SPSSODescriptor.KeyDescriptor = append(entity.SPSSODescriptor.KeyDescriptor, signingKeyDescriptor(validCert))
+			},
+			[]string{"KeyDescriptor"},
+			nil,
+		},
+		{
+			"signed requests without certificate",
+			func(entity *md.EntityDescriptorType) { entity.SPSSODescriptor.KeyDescriptor = nil },
+			[]string{"KeyDescriptor"},
+			nil,
+		},
+		{
+			"unknown NameID format",
+			func(entity *md.EntityDescriptorType) {
+				entity.SPSSODescriptor.NameIDFormat = append(entity.SPSSODescriptor.NameIDFormat, "urn:example:nameid")
+			},
+			nil,
+			[]string{"NameIDFormat[1]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entity := validEntity()
+			tt.modify(entity)
+			report := validateEntity(entity, now)
+			assert.Equal(t, tt.errors, findingPaths(report.Errors()), report.Findings)
+			assert.Equal(t, tt.warnings, findingPaths(report.Warnings()), report.Findings)
+			assert.Equal(t, len(tt.errors) == 0, report.Valid())
+		})
+	}
+}
+
+func TestValidate_Validate(t *testing.T) {
+	report := Validate([]byte("<EntityDescriptor"))
+	assert.False(t, report.Valid())
+
+	_, cert := newKeyAndCertificate(t)
+	metadata, err := xml.Marshal(&md.EntityDescriptorType{
+		EntityID: testEntityID,
+		SPSSODescriptor: &md.SPSSODescriptorType{
+			AssertionConsumerService: []md.IndexedEndpointType{{Index: "1", Binding: PostBinding, Location: testACSURL}},
+			KeyDescriptor:            []md.KeyDescriptorType{signingKeyDescriptor(cert)},
+		},
+	})
+	require.NoError(t, err)
+	report = Validate(metadata)
+	assert.True(t, report.Valid(), report.Findings)
+	assert.Equal(t, testEntityID, report.EntityID)
+	// the test certificate expires within an hour
+	assert.Len(t, report.Warnings(), 1)
+}
+
+func findingPaths(findings []Finding) []string {
+	var paths []string
+	for _, finding := range findings {
+		paths = append(paths, finding.Path)
+	}
+	return paths
+}
@@ -0,0 +1,76 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/zitadel/saml/pkg/provider/models"
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
+)
+
+// Session is the session of the user at the identity provider, an authentication request was authenticated in
+type Session struct {
+	// ID identifies the session and is used as SessionIndex
+	ID string
+	// AuthInstant is the time the user authenticated, used as AuthnInstant
+	AuthInstant time.Time
+	// Expiration is the time the session ends, used as SessionNotOnOrAfter (optional)
+	Expiration time.Time
+	// AuthnContextClassRef is the class of the authentication (optional)
+	AuthnContextClassRef string
+	// AuthenticatingAuthority are the entityIDs of the upstream identity providers which authenticated the user
+	// in the proxy mode (optional)
+	AuthenticatingAuthority []string
+}
+
+// SessionIndex returns the SessionIndex used in the assertions for the session,
+// which is derived per service provider if configured with SessionIndexPerServiceProvider,
+// so that the service providers can not correlate their sessions
+func (p *IdentityProvider) SessionIndex(sessionID, entityID string) string {
+	if !p.conf.SessionIndexPerServiceProvider {
+		return sessionID
+	}
+	return DeriveSessionIndex(sessionID, entityID)
+}
+
+// DeriveSessionIndex derives the SessionIndex of the session for the service provider
+func DeriveSessionIndex(sessionID, entityID string) string {
+	hash := sha256.Sum256([]byte(sessionID + "|" + entityID))
+	return "_" + hex.EncodeToString(hash[:])
+}
+
+// session returns the session of the authentication request, if the storage implements the SessionStorage
+func (p *IdentityProvider) session(ctx context.Context, authRequest models.AuthRequestInt) (*Session, error) {
+	sessionStorage, ok := p.storage.(SessionStorage)
+	if !ok {
+		return nil, nil
+	}
+	return sessionStorage.GetSession(ctx, authRequest)
+}
+
+// applySession sets the SessionIndex, AuthnInstant, SessionNotOnOrAfter and AuthnContext of the AuthnStatements from the session
+func applySession(assertion *saml.AssertionType, session *Session, sessionIndex string, timeFormat string) {
+	if session == nil {
+		return
+	}
+	for i := range assertion.AuthnStatement {
+		statement := &assertion.AuthnStatement[i]
+		if sessionIndex != "" {
+			statement.SessionIndex = sessionIndex
+		}
+		if !session.AuthInstant.IsZero() {
+			statement.AuthnInstant = session.AuthInstant.UTC().Format(timeFormat)
+		}
+		if !session.Expiration.IsZero() {
+			statement.SessionNotOnOrAfter = session.Expiration.UTC().Format(timeFormat)
+		}
+		if session.AuthnContextClassRef != "" {
+			statement.AuthnContext.AuthnContextClassRef = session.AuthnContextClassRef
+		}
+		if len(session.AuthenticatingAuthority) > 0 {
+			statement.AuthnContext.AuthenticatingAuthority = session.AuthenticatingAuthority
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
+)
+
+func TestSession_applySession(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	type res struct {
+		sessionIndex        string
+		authnInstant        string
+		sessionNotOnOrAfter string
+	}
+	tests := []struct {
+		name         string
+		session      *Session
+		sessionIndex string
+		res          res
+	}{
+		{
+			"no session",
+			nil,
+			"",
+			res{
+				sessionIndex: "assertion",
+				authnInstant: "2024-01-01T00:00:00Z",
+			},
+		},
+		{
+			"session",
+			&Session{ID: "session", AuthInstant: now.Add(-time.Hour), Expiration: now.Add(time.Hour)},
+			"session",
+			res{
+				sessionIndex:        "session",
+				authnInstant:        "2023-12-31T23:00:00Z",
+				sessionNotOnOrAfter: "2024-01-01T01:00:00Z",
+			},
+		},
+		{
+			"session without expiration",
+			&Session{ID: "session"},
+			DeriveSessionIndex("session", "sp"),
+			res{
+				sessionIndex: DeriveSessionIndex("session", "sp"),
+				authnInstant: "2024-01-01T00:00:00Z",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertion := &saml.AssertionType{
+				AuthnStatement: []saml.AuthnStatementType{{AuthnInstant: now.Format(DefaultTimeFormat), SessionIndex: "assertion"}},
+			}
+			applySession(assertion, tt.session, tt.sessionIndex, DefaultTimeFormat)
+			assert.Equal(t, tt.res.sessionIndex, assertion.AuthnStatement[0].SessionIndex)
+			assert.Equal(t, tt.res.authnInstant, assertion.AuthnStatement[0].AuthnInstant)
+			assert.Equal(t, tt.res.sessionNotOnOrAfter, assertion.AuthnStatement[0].SessionNotOnOrAfter)
+		})
+	}
+}
+
+func TestSession_SessionIndex(t *testing.T) {
+	idp := &IdentityProvider{conf: &IdentityProviderConfig{}}
+	assert.Equal(t, "session", idp.SessionIndex("session", "sp1"))
+
+	idp.conf.SessionIndexPerServiceProvider = true
+	assert.Equal(t, DeriveSessionIndex("session", "sp1"), idp.SessionIndex("session", "sp1"))
+	assert.NotEqual(t, idp.SessionIndex("session", "sp1"), idp.SessionIndex("session", "sp2"))
+}
@@ -1,6 +1,7 @@
 package signature
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/dsa"
 	"crypto/rsa"
@@ -8,9 +9,12 @@ import (
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/asn1"
+	"encoding/base64"
 	"encoding/xml"
 	"fmt"
+	"io"
 	"math/big"
+	"net/url"
 
 	"github.com/amdonov/xmlsig"
 	"github.com/beevik/etree"
@@ -81,7 +85,7 @@ func Create(signingContext *dsig.SigningContext, element interface{}) (*xml_dsig
 }*/
 
 func Create(signer xmlsig.Signer, data interface{}) (*xml_dsig.SignatureType, error) {
-	sig, err := signer.CreateSignature(data)
+	sig, err := signer.CreateSignature(&exclusiveNamespaces{data: data})
 	if err != nil {
 		return nil, err
 	}
@@ -129,7 +133,76 @@ func Create(signer xmlsig.Signer, data interface{}) (*xml_dsig.SignatureType, er
 	}, nil
 }
 
+// exclusiveNamespaces marshals the data without the namespace declarations,
+// which are not visibly utilized by the element they are declared on (e.g. xmlns:xs used only in xsi:type values),
+// as the exclusive canonicalization of the verifier removes them and the digest would not match otherwise
+type exclusiveNamespaces struct {
+	data interface{}
+}
+
+func (n *exclusiveNamespaces) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	data, err := xml.Marshal(n.data)
+	if err != nil {
+		return err
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if err := e.EncodeToken(rawStartElement(t)); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			if err := e.EncodeToken(xml.EndElement{Name: rawName(t.Name)}); err != nil {
+				return err
+			}
+		case xml.CharData:
+			if err := e.EncodeToken(t); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func rawStartElement(start xml.StartElement) xml.StartElement {
+	utilized := map[string]bool{start.Name.Space: true}
+	for _, attr := range start.Attr {
+		if attr.Name.Space != "xmlns" {
+			utilized[attr.Name.Space] = true
+		}
+	}
+	raw := xml.StartElement{Name: rawName(start.Name)}
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "xmlns" && !utilized[attr.Name.Local] {
+			continue
+		}
+		raw.Attr = append(raw.Attr, xml.Attr{Name: rawName(attr.Name), Value: attr.Value})
+	}
+	return raw
+}
+
+func rawName(name xml.Name) xml.Name {
+	if name.Space == "" {
+		return name
+	}
+	return xml.Name{Local: name.Space + ":" + name.Local}
+}
+
 func ValidatePost(certs []*x509.Certificate, el *etree.Element) error {
+	_, err := ValidatePostElement(certs, el)
+	return err
+}
+
+// ValidatePostElement verifies the enveloped signature of the element and returns the verified element,
+// which has to be used instead of the element itself, as only the signed content is verified
+func ValidatePostElement(certs []*x509.Certificate, el *etree.Element) (*etree.Element, error) {
 	certificateStore := dsig.MemoryX509CertificateStore{
 		Roots: certs,
 	}
@@ -147,25 +220,80 @@ func ValidatePost(certs []*x509.Certificate, el *etree.Element) error {
 
 	ctx, err := etreeutils.NSBuildParentContext(el)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	ctx, err = ctx.SubContext(el)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	el, err = etreeutils.NSDetatch(ctx, el)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = validationContext.Validate(el)
+	return validationContext.Validate(el)
+}
+
+// ValidateResponse validates the signature of the response or, if the response is not signed, of its single assertion;
+// responses without assertion are not required to be signed
+func ValidateResponse(certs []*x509.Certificate, response []byte) error {
+	_, err := ValidateResponseElement(certs, response)
 	return err
 }
 
+// ValidateResponseElement validates the response like ValidateResponse and returns the verified element,
+// which is the response if it is signed, else its assertion, nil for responses without assertion
+func ValidateResponseElement(certs []*x509.Certificate, response []byte) (*etree.Element, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(response); err != nil {
+		return nil, err
+	}
+	root := doc.Root()
+	if root == nil {
+		return nil, fmt.Errorf("empty response")
+	}
+	if len(root.FindElements("./EncryptedAssertion")) > 0 {
+		return nil, fmt.Errorf("encrypted assertions are not supported")
+	}
+	assertions := root.FindElements("./Assertion")
+	if len(assertions) > 1 {
+		return nil, fmt.Errorf("multiple assertions in response")
+	}
+	if root.FindElement("./Signature") != nil {
+		return ValidatePostElement(certs, root)
+	}
+	if len(assertions) == 0 {
+		return nil, nil
+	}
+	if assertions[0].FindElement("./Signature") == nil {
+		return nil, fmt.Errorf("neither response nor assertion is signed")
+	}
+	return ValidatePostElement(certs, assertions[0])
+}
+
 func CreateRedirect(signingContext *dsig.SigningContext, query string) ([]byte, error) {
 	return signingContext.SignString(query)
 }
 
+// CreateRedirectQuery appends the SigAlg and the Signature of the HTTP-Redirect binding to the query
+func CreateRedirectQuery(cert []byte, key *rsa.PrivateKey, signatureAlgorithm string, query string) (string, error) {
+	tlsCert, err := ParseTlsKeyPair(cert, key)
+	if err != nil {
+		return "", err
+	}
+	signingContext, err := GetSigningContext(tlsCert, signatureAlgorithm)
+	if err != nil {
+		return "", err
+	}
+
+	query += "&SigAlg=" + url.QueryEscape(signatureAlgorithm)
+	sig, err := CreateRedirect(signingContext, query)
+	if err != nil {
+		return "", err
+	}
+	return query + "&Signature=" + url.QueryEscape(base64.StdEncoding.EncodeToString(sig)), nil
+}
+
 func ValidateRedirect(sigAlg string, elementToSign []byte, signature []byte, pubKey interface{}) error {
 	switch sigAlg {
 	case "http://www.w3.org/2009/xmldsig11#dsa-sha256":
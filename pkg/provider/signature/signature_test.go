@@ -22,6 +22,7 @@ import (
 
 	"github.com/zitadel/saml/pkg/provider/signature"
 	saml_xml "github.com/zitadel/saml/pkg/provider/xml"
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
 	"github.com/zitadel/saml/pkg/provider/xml/samlp"
 	"github.com/zitadel/saml/pkg/provider/xml/xml_dsig"
 )
@@ -546,6 +547,84 @@ func TestSignature_CreatePost(t *testing.T) {
 	}
 }
 
+func TestSignature_CreatePost_typedAttributeValues(t *testing.T) {
+	caKeyGen, caCertGen, err := newCACertAndKey()
+	if err != nil {
+		t.Fatal("Create() failed to create ca cert")
+	}
+	blockCaCertGen, _ := pem.Decode(caCertGen)
+	if blockCaCertGen == nil || blockCaCertGen.Type != "CERTIFICATE" {
+		t.Fatal("Create() failed to decode ca cert")
+	}
+	keyGen, certGen, err := newCertAndKey(caKeyGen, blockCaCertGen.Bytes)
+	if err != nil {
+		t.Fatal("Create() failed to create cert")
+	}
+	blockCertGen, _ := pem.Decode(certGen)
+	if blockCertGen == nil || blockCertGen.Type != "CERTIFICATE" {
+		t.Fatal("Create() failed to decode cert")
+	}
+	certStr := strings.ReplaceAll(strings.ReplaceAll(strings.ReplaceAll(string(certGen), "-----BEGIN CERTIFICATE-----", ""), "-----END CERTIFICATE-----", ""), "\n", "")
+	certs, err := signature.ParseCertificates([]string{certStr})
+	if err != nil {
+		t.Fatal("Create() failed to parse certificate")
+	}
+
+	resp := &samlp.ResponseType{
+		Id:           "_response",
+		Version:      "2.0",
+		IssueInstant: "2014-07-17T01:01:48Z",
+		Issuer:       &saml.NameIDType{Text: "http://idp.example.com/metadata.php"},
+		Status:       samlp.StatusType{StatusCode: samlp.StatusCodeType{Value: "urn:oasis:names:tc:SAML:2.0:status:Success"}},
+		Assertion: &saml.AssertionType{
+			Version:      "2.0",
+			Id:           "_assertion",
+			IssueInstant: "2014-07-17T01:01:48Z",
+			Issuer:       saml.NameIDType{Text: "http://idp.example.com/metadata.php"},
+			AttributeStatement: []saml.AttributeStatementType{{
+				Attribute: []*saml.AttributeType{
+					{Name: "mail", AttributeValue: []saml.AttributeValueType{saml.NewStringAttributeValue("test@example.com")}},
+					{Name: "verified", AttributeValue: []saml.AttributeValueType{saml.NewBooleanAttributeValue(true)}},
+					{Name: "age", AttributeValue: []saml.AttributeValueType{saml.NewIntegerAttributeValue(42)}},
+					{Name: "updated", AttributeValue: []saml.AttributeValueType{saml.NewDateTimeAttributeValue(time.Date(2014, 7, 17, 1, 1, 48, 0, time.UTC))}},
+					{Name: "targetedID", AttributeValue: []saml.AttributeValueType{saml.NewNameIDAttributeValue(&saml.NameIDType{Format: "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent", Text: "id"})}},
+					{Name: "untyped", AttributeValue: saml.StringAttributeValues("users", "examplerole1")},
+				},
+			}},
+		},
+	}
+
+	signer, err := signature.GetSigner(blockCertGen.Bytes, keyGen, dsig.RSASHA256SignatureMethod)
+	if err != nil {
+		t.Fatal("Create() failed to create signer")
+	}
+	resp.Assertion.Signature, err = signature.Create(signer, resp.Assertion)
+	if err != nil {
+		t.Fatalf("Create() assertion error = %v", err)
+	}
+	resp.Signature, err = signature.Create(signer, resp)
+	if err != nil {
+		t.Fatalf("Create() response error = %v", err)
+	}
+
+	respData, err := saml_xml.Marshal(resp)
+	if err != nil {
+		t.Fatal("Create() failed to marshal response")
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(respData); err != nil {
+		t.Fatal("Create() failed to read response")
+	}
+	// the relying party verifies the assertion detached from the response, after it verified the response
+	assertion := doc.Root().FindElement("./Assertion").Copy()
+	if err := signature.ValidatePost(certs, doc.Root()); err != nil {
+		t.Errorf("Create() failed to validate response signature: %v", err)
+	}
+	if err := signature.ValidatePost(certs, assertion); err != nil {
+		t.Errorf("Create() failed to validate assertion signature: %v", err)
+	}
+}
+
 func newCertAndKey(
 	caPrivateKey *rsa.PrivateKey,
 	caCertificate []byte,
@@ -26,11 +26,18 @@ type AuthRequestForm struct {
 }
 
 func (p *IdentityProvider) ssoHandleFunc(w http.ResponseWriter, r *http.Request) {
+	// SOAP-wrapped AuthnRequests of the ECP profile are authenticated without a browser
+	if isSOAPRequest(r) {
+		p.ecpHandleFunc(w, r)
+		return
+	}
+
 	checkerInstance := checker.Checker{}
 	var authRequestForm *AuthRequestForm
 	var authNRequest *samlp.AuthnRequestType
 	var sp *serviceprovider.ServiceProvider
 	var authRequest models.AuthRequestInt
+	var upstream *UpstreamIdentityProvider
 	var err error
 	var acsIndex *int
 
@@ -234,6 +241,17 @@ func (p *IdentityProvider) ssoHandleFunc(w http.ResponseWriter, r *http.Request)
 		},
 	)
 
+	// choose the upstream identity provider the authentication is delegated to in the proxy mode
+	checkerInstance.WithLogicStep(
+		func() error {
+			upstream, err = p.upstreamIdentityProvider(r.Context(), sp, authNRequest)
+			return err
+		},
+		func() {
+			response.sendBackResponse(r, w, response.makeFailedResponse(err.Error(), "failed to choose upstream identity provider", p.TimeFormat))
+		},
+	)
+
 	//check and log errors if necessary
 	if checkerInstance.CheckFailed() {
 		return
@@ -241,7 +259,17 @@ func (p *IdentityProvider) ssoHandleFunc(w http.ResponseWriter, r *http.Request)
 
 	switch response.ProtocolBinding {
 	case RedirectBinding, PostBinding:
-		http.Redirect(w, r, sp.LoginURL(authRequest.GetID()), http.StatusSeeOther)
+		if upstream == nil {
+			http.Redirect(w, r, sp.LoginURL(authRequest.GetID()), http.StatusSeeOther)
+			return
+		}
+		location, err := p.upstreamRedirectURL(r.Context(), upstream, sp, authNRequest, authRequest.GetID())
+		if err != nil {
+			logging.Error(err)
+			response.sendBackResponse(r, w, response.makeFailedResponse(StatusCodeResponder, fmt.Errorf("failed to create upstream request: %w", err).Error(), p.TimeFormat))
+			return
+		}
+		http.Redirect(w, r, location, http.StatusSeeOther)
 	default:
 		logging.Error(err)
 		response.sendBackResponse(r, w, response.makeFailedResponse(StatusCodeUnsupportedBinding, fmt.Errorf("unsupported binding: %s", response.ProtocolBinding).Error(), p.TimeFormat))
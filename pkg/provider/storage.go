@@ -6,6 +6,7 @@ import (
 	"github.com/zitadel/saml/pkg/provider/key"
 	"github.com/zitadel/saml/pkg/provider/models"
 	"github.com/zitadel/saml/pkg/provider/serviceprovider"
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
 	"github.com/zitadel/saml/pkg/provider/xml/samlp"
 )
 
@@ -25,7 +26,79 @@ type AuthStorage interface {
 	AuthRequestByID(context.Context, string) (models.AuthRequestInt, error)
 }
 
+// SessionStorage can optionally be implemented by the IDPStorage to provide the session of the user at the identity provider,
+// which is used for the SessionIndex, AuthnInstant and SessionNotOnOrAfter of the AuthnStatement.
+// If not implemented, the ID of the assertion is used as SessionIndex.
+type SessionStorage interface {
+	GetSession(ctx context.Context, authRequest models.AuthRequestInt) (*Session, error)
+}
+
+// AssertionStorage can optionally be implemented by the IDPStorage to store the issued assertions,
+// so that they can be requested by their ID with an AssertionIDRequest.
+type AssertionStorage interface {
+	StoreAssertion(ctx context.Context, entityID string, assertion *saml.AssertionType) error
+	GetAssertionByID(ctx context.Context, entityID string, assertionID string) (*saml.AssertionType, error)
+}
+
+// AuthnQueryStorage can optionally be implemented by the IDPStorage to provide the sessions of a subject,
+// which are returned as AuthnStatements to an AuthnQuery.
+type AuthnQueryStorage interface {
+	GetSessionsBySubject(ctx context.Context, entityID string, nameID string) ([]*Session, error)
+}
+
+// NameIDMappingStorage can optionally be implemented by the IDPStorage to map the identifier of a user at one service provider
+// to the identifier of the same user at another service provider with NameIDMappingRequests.
+type NameIDMappingStorage interface {
+	// MapNameID returns the identifier of the user, identified by the nameID issued to the requester,
+	// for the service provider spNameQualifier in the format, or an empty identifier if the user is unknown
+	MapNameID(ctx context.Context, requesterID string, nameID *saml.NameIDType, spNameQualifier string, format string) (string, error)
+}
+
+// ManageNameIDStorage can optionally be implemented by the IDPStorage to persist the identifiers service providers
+// register for users with ManageNameIDRequests, which are issued as SPProvidedID of subsequent persistent NameIDs.
+type ManageNameIDStorage interface {
+	// ChangeNameID registers the newID of the service provider for the user identified by the nameID,
+	// it returns false if the user is unknown
+	ChangeNameID(ctx context.Context, entityID string, nameID *saml.NameIDType, newID string) (bool, error)
+	// TerminateNameID terminates the federation of the service provider with the user identified by the nameID,
+	// it returns false if the user is unknown
+	TerminateNameID(ctx context.Context, entityID string, nameID *saml.NameIDType) (bool, error)
+	// GetSPProvidedID returns the identifier registered by the service provider for the user,
+	// empty if none is registered or the federation is terminated
+	GetSPProvidedID(ctx context.Context, entityID string, userID string) (string, error)
+}
+
+// ProxyStorage can optionally be implemented by the IDPStorage to delegate the authentication to upstream identity providers
+// in the proxy mode, chosen from the IDPList of the AuthnRequests or by the ProxyDiscovery.
+// The authenticating authorities are added to the assertions if the completed auth request implements
+// the models.AuthenticatingAuthorityGetter, or else if they are returned in the Session of the SessionStorage.
+// The ProxyRestriction of the upstream assertion is added to the assertions if the completed auth request implements
+// the models.ProxyRestrictionGetter.
+type ProxyStorage interface {
+	// GetUpstreamIdentityProvider returns the upstream identity provider with the entityID,
+	// or nil if it is unknown
+	GetUpstreamIdentityProvider(ctx context.Context, entityID string) (*UpstreamIdentityProvider, error)
+	// CompleteProxiedAuthRequest completes the auth request with the user of the assertion of the upstream identity provider,
+	// the authenticating authorities, ending with the entityID of the upstream identity provider,
+	// and the ProxyRestriction of the issued assertions, nil if the upstream assertion is not restricted
+	CompleteProxiedAuthRequest(ctx context.Context, authRequestID string, assertion *saml.AssertionType, authenticatingAuthority []string, proxyRestriction *saml.ProxyRestrictionType) error
+}
+
+// UserStorage sets the attributes of the users, the userinfo passed by the identity provider additionally implements
+// models.AttributeValuesSetter, models.AttributeStatementSetter and models.AttributeOrderSetter
 type UserStorage interface {
 	SetUserinfoWithUserID(ctx context.Context, applicationID string, userinfo models.AttributeSetter, userID string, attributes []int) (err error)
 	SetUserinfoWithLoginName(ctx context.Context, userinfo models.AttributeSetter, loginName string, attributes []int) (err error)
 }
+
+// MetadataQueryStorage can optionally be implemented by the Storage to publish the metadata of the registered service providers
+// with the metadata query protocol (MDQ), besides the metadata of the identity provider.
+// The service providers are requested by their url encoded entityID with the GetEntityByID of the storage,
+// which has to return nil without error for unknown entities, errors are answered with 500 Internal Server Error.
+// The published metadata is marshalled from the parsed EntityDescriptor, elements of the original metadata unknown to this package
+// are not included. It is only signed with the metadata signing key if MetadataConfig.SignServiceProviderMetadata is set.
+type MetadataQueryStorage interface {
+	// GetEntityIDBySHA1 returns the entityID of the service provider, whose SHA1Identifier is the identifier,
+	// or an empty entityID if it is unknown
+	GetEntityIDBySHA1(ctx context.Context, identifier string) (string, error)
+}
@@ -0,0 +1,150 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/zitadel/logging"
+
+	"github.com/zitadel/saml/pkg/provider/key"
+)
+
+var ErrUnknownTenant = errors.New("unknown tenant")
+
+// Tenant is an identity provider hosted by the Provider, e.g. one per customer on a custom domain.
+// Every tenant is served by an own Provider, built with the options of the hosting Provider.
+type Tenant struct {
+	// ID identifies the tenant, its Provider is built once per ID and Version
+	ID string
+	// Version of the configuration of the tenant, e.g. its revision in the database,
+	// the Provider of the tenant is rebuilt if the resolver returns another Version for the ID
+	Version string
+	// Config is the configuration of the tenant, e.g. its metadata organisation, algorithms and endpoints,
+	// the configuration of the hosting Provider is used if nil
+	Config *Config
+	// ResponseSigningKey and MetadataSigningKey are used instead of the keys of the storage if set
+	ResponseSigningKey *key.CertificateAndKey
+	MetadataSigningKey *key.CertificateAndKey
+	// Expiration of the issued assertions and responses, DefaultExpiration if 0,
+	// the Provider of the tenant is rebuilt if it changes
+	Expiration time.Duration
+}
+
+// TenantResolver returns the tenant of the issuer, nil if the issuer is unknown
+type TenantResolver func(ctx context.Context, issuer string) (*Tenant, error)
+
+// WithTenants hosts an identity provider per tenant resolved from the issuer of the request,
+// requests of unknown issuers are answered with 404 Not Found.
+// The tenant is provided to the storage in the context, see TenantFromContext.
+func WithTenants(resolver TenantResolver) Option {
+	return func(p *Provider) error {
+		p.tenantResolver = resolver
+		return nil
+	}
+}
+
+// withoutTenants is applied to the providers of the tenants, which don't host tenants themselves
+func withoutTenants() Option {
+	return func(p *Provider) error {
+		p.tenantResolver = nil
+		return nil
+	}
+}
+
+// TenantFromContext returns the tenant of the request, nil if the Provider has no tenants
+func TenantFromContext(ctx context.Context) *Tenant {
+	tenant, _ := ctx.Value(tenantKey).(*Tenant)
+	return tenant
+}
+
+// ContextWithTenant returns a new context with the tenant set to it
+func ContextWithTenant(ctx context.Context, tenant *Tenant) context.Context {
+	return context.WithValue(ctx, tenantKey, tenant)
+}
+
+type tenantProvider struct {
+	version    string
+	expiration time.Duration
+	provider   *Provider
+}
+
+// tenants builds and holds the providers of the tenants
+type tenants struct {
+	resolver    TenantResolver
+	newProvider func(conf *Config) (*Provider, error)
+
+	mu        sync.Mutex
+	providers map[string]*tenantProvider
+}
+
+// TenantProvider resolves the tenant of the issuer in the context and returns its Provider
+// and the context with the tenant, e.g. to get the metadata of the tenant.
+// The Provider itself is returned if it has no tenants.
+func (p *Provider) TenantProvider(ctx context.Context) (context.Context, *Provider, error) {
+	p = p.current()
+	if p.tenants == nil {
+		return ctx, p, nil
+	}
+	tenant, err := p.tenants.resolver(ctx, IssuerFromContext(ctx))
+	if err != nil {
+		return ctx, nil, err
+	}
+	if tenant == nil {
+		return ctx, nil, fmt.Errorf("%w of issuer %s", ErrUnknownTenant, IssuerFromContext(ctx))
+	}
+	provider, err := p.tenants.provider(tenant, p.conf)
+	if err != nil {
+		return ctx, nil, err
+	}
+	return ContextWithTenant(ctx, tenant), provider, nil
+}
+
+func (t *tenants) provider(tenant *Tenant, defaultConfig *Config) (*Provider, error) {
+	config := tenant.Config
+	if config == nil {
+		config = defaultConfig
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if cached, ok := t.providers[tenant.ID]; ok && cached.version == tenant.Version && cached.expiration == tenant.Expiration {
+		return cached.provider, nil
+	}
+	provider, err := t.newProvider(config)
+	if err != nil {
+		return nil, err
+	}
+	if tenant.Expiration != 0 {
+		provider.identityProvider.Expiration = tenant.Expiration
+	}
+	t.providers[tenant.ID] = &tenantProvider{version: tenant.Version, expiration: tenant.Expiration, provider: provider}
+	return provider, nil
+}
+
+// createTenantRouter serves the health and readiness independent of the tenants
+// and dispatches all other requests to the provider of the tenant
+func createTenantRouter(p *Provider) http.Handler {
+	router := mux.NewRouter()
+	router.UseEncodedPath()
+	registerMuxRoutes(router, p.routes())
+	return p.issuerInterceptor().Handler(router)
+}
+
+func (p *Provider) tenantHandle(w http.ResponseWriter, r *http.Request) {
+	ctx, provider, err := p.TenantProvider(r.Context())
+	if errors.Is(err, ErrUnknownTenant) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		err := fmt.Errorf("failed to resolve tenant: %w", err)
+		logging.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	provider.HttpHandler().ServeHTTP(w, r.WithContext(ctx))
+}
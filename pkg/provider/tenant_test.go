@@ -0,0 +1,122 @@
+package provider
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/golang/mock/gomock"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zitadel/saml/pkg/provider/key"
+	"github.com/zitadel/saml/pkg/provider/mock"
+	"github.com/zitadel/saml/pkg/provider/signature"
+	"github.com/zitadel/saml/pkg/provider/xml"
+)
+
+func TestTenant_tenantHandle(t *testing.T) {
+	storageKey, storageCert := newKeyAndCertificate(t)
+	tenantKey, tenantCert := newKeyAndCertificate(t)
+	storageSigningKey := &key.CertificateAndKey{Certificate: storageCert.Raw, Key: storageKey}
+	tenantSigningKey := &key.CertificateAndKey{Certificate: tenantCert.Raw, Key: tenantKey}
+
+	mockStorage := mock.NewMockStorage(gomock.NewController(t))
+	mockStorage.EXPECT().GetResponseSigningKey(gomock.Any()).Return(storageSigningKey, nil).AnyTimes()
+	mockStorage.EXPECT().GetMetadataSigningKey(gomock.Any()).DoAndReturn(func(ctx context.Context) (*key.CertificateAndKey, error) {
+		require.NotNil(t, TenantFromContext(ctx))
+		return storageSigningKey, nil
+	}).AnyTimes()
+	mockStorage.EXPECT().Health(gomock.Any()).Return(nil).AnyTimes()
+
+	tenantMetadataEndpoint := NewEndpoint("/saml/metadata")
+	tenants := map[string]*Tenant{
+		"https://a.example.com": {
+			ID: "a",
+			Config: &Config{
+				MetadataConfig: &MetadataConfig{SignatureAlgorithm: dsig.RSASHA256SignatureMethod},
+				IDPConfig:      &IdentityProviderConfig{},
+				Organisation:   &Organisation{Name: "A"},
+			},
+		},
+		"https://b.example.com": {
+			ID: "b",
+			Config: &Config{
+				MetadataConfig: &MetadataConfig{SignatureAlgorithm: dsig.RSASHA256SignatureMethod},
+				IDPConfig:      &IdentityProviderConfig{},
+				Metadata:       &tenantMetadataEndpoint,
+				Organisation:   &Organisation{Name: "B"},
+			},
+			MetadataSigningKey: tenantSigningKey,
+			ResponseSigningKey: tenantSigningKey,
+		},
+	}
+	provider, err := NewProvider(mockStorage, IssuerFromHost(""), &Config{IDPConfig: &IdentityProviderConfig{}},
+		WithTenants(func(_ context.Context, issuer string) (*Tenant, error) {
+			return tenants[issuer], nil
+		}),
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		url          string
+		status       int
+		entityID     string
+		organisation string
+		cert         *x509.Certificate
+	}{
+		{"tenant a", "https://a.example.com/metadata", http.StatusOK, "https://a.example.com/metadata", "A", storageCert},
+		{"tenant b", "https://b.example.com/saml/metadata", http.StatusOK, "https://b.example.com/saml/metadata", "B", tenantCert},
+		{"tenant b default endpoint", "https://b.example.com/metadata", http.StatusNotFound, "", "", nil},
+		{"unknown tenant", "https://unknown.example.com/metadata", http.StatusNotFound, "", "", nil},
+		{"health of unknown tenant", "https://10.0.0.1/healthz", http.StatusOK, "", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			provider.HttpHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			require.Equal(t, tt.status, w.Code)
+			if tt.entityID == "" {
+				return
+			}
+			doc := etree.NewDocument()
+			require.NoError(t, doc.ReadFromBytes(w.Body.Bytes()))
+			require.NoError(t, signature.ValidatePost([]*x509.Certificate{tt.cert}, doc.Root()))
+			metadata, err := xml.ParseMetadataXmlIntoStruct(w.Body.Bytes())
+			require.NoError(t, err)
+			assert.Equal(t, tt.entityID, string(metadata.EntityID))
+			assert.Equal(t, tt.organisation, metadata.Organization.OrganizationName[0].Text)
+			assert.Equal(t, base64.StdEncoding.EncodeToString(tt.cert.Raw), metadata.IDPSSODescriptor.KeyDescriptor[0].KeyInfo.X509Data[0].X509Certificate)
+		})
+	}
+
+	ctx, tenantProvider, err := provider.TenantProvider(ContextWithIssuer(context.Background(), "https://a.example.com"))
+	require.NoError(t, err)
+	assert.Equal(t, "a", TenantFromContext(ctx).ID)
+	_, again, err := provider.TenantProvider(ContextWithIssuer(context.Background(), "https://a.example.com"))
+	require.NoError(t, err)
+	assert.Same(t, tenantProvider, again)
+
+	// a changed configuration is only applied with a new version, a changed expiration on every lookup
+	tenants["https://a.example.com"] = &Tenant{ID: "a", Config: &Config{IDPConfig: &IdentityProviderConfig{}}, Expiration: time.Hour}
+	_, again, err = provider.TenantProvider(ContextWithIssuer(context.Background(), "https://a.example.com"))
+	require.NoError(t, err)
+	assert.NotSame(t, tenantProvider, again)
+	assert.Equal(t, time.Hour, again.identityProvider.Expiration)
+	tenantProvider = again
+	tenants["https://a.example.com"] = &Tenant{ID: "a", Config: &Config{IDPConfig: &IdentityProviderConfig{}}, Expiration: time.Hour}
+	_, again, err = provider.TenantProvider(ContextWithIssuer(context.Background(), "https://a.example.com"))
+	require.NoError(t, err)
+	assert.Same(t, tenantProvider, again)
+	tenants["https://a.example.com"].Version = "2"
+	_, again, err = provider.TenantProvider(ContextWithIssuer(context.Background(), "https://a.example.com"))
+	require.NoError(t, err)
+	assert.NotSame(t, tenantProvider, again)
+}
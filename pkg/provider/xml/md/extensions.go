@@ -0,0 +1,102 @@
+package md
+
+import (
+	"encoding/xml"
+
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
+)
+
+// EntityAttributesType (mdattr) contains the attributes of an entity, e.g. its entity categories
+type EntityAttributesType struct {
+	XMLName   xml.Name             `xml:"urn:oasis:names:tc:SAML:metadata:attribute EntityAttributes"`
+	Attribute []saml.AttributeType `xml:"urn:oasis:names:tc:SAML:2.0:assertion Attribute"`
+}
+
+// RegistrationInfoType (mdrpi) describes the registration of an entity by a federation
+type RegistrationInfoType struct {
+	XMLName               xml.Name           `xml:"urn:oasis:names:tc:SAML:metadata:rpi RegistrationInfo"`
+	RegistrationAuthority string             `xml:"registrationAuthority,attr"`
+	RegistrationInstant   string             `xml:"registrationInstant,attr,omitempty"`
+	RegistrationPolicy    []LocalizedURIType `xml:"urn:oasis:names:tc:SAML:metadata:rpi RegistrationPolicy"`
+}
+
+// PublicationInfoType (mdrpi) describes the publication of an aggregate
+type PublicationInfoType struct {
+	XMLName         xml.Name           `xml:"urn:oasis:names:tc:SAML:metadata:rpi PublicationInfo"`
+	Publisher       string             `xml:"publisher,attr"`
+	CreationInstant string             `xml:"creationInstant,attr,omitempty"`
+	PublicationId   string             `xml:"publicationId,attr,omitempty"`
+	UsagePolicy     []LocalizedURIType `xml:"urn:oasis:names:tc:SAML:metadata:rpi UsagePolicy"`
+}
+
+// UIInfoType (mdui) describes a role of an entity for user interfaces, e.g. discovery services
+type UIInfoType struct {
+	XMLName             xml.Name            `xml:"urn:oasis:names:tc:SAML:metadata:ui UIInfo"`
+	DisplayName         []LocalizedNameType `xml:"urn:oasis:names:tc:SAML:metadata:ui DisplayName"`
+	Description         []LocalizedNameType `xml:"urn:oasis:names:tc:SAML:metadata:ui Description"`
+	Keywords            []KeywordsType      `xml:"urn:oasis:names:tc:SAML:metadata:ui Keywords"`
+	Logo                []LogoType          `xml:"urn:oasis:names:tc:SAML:metadata:ui Logo"`
+	InformationURL      []LocalizedURIType  `xml:"urn:oasis:names:tc:SAML:metadata:ui InformationURL"`
+	PrivacyStatementURL []LocalizedURIType  `xml:"urn:oasis:names:tc:SAML:metadata:ui PrivacyStatementURL"`
+}
+
+// KeywordsType (mdui) is a space separated list of keywords in a language
+type KeywordsType struct {
+	XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:metadata:ui Keywords"`
+	XmlLang string   `xml:"lang,attr"`
+	Text    string   `xml:",chardata"`
+}
+
+// LogoType (mdui) is the URL of a logo with its size in pixels
+type LogoType struct {
+	XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:metadata:ui Logo"`
+	Height  int      `xml:"height,attr"`
+	Width   int      `xml:"width,attr"`
+	XmlLang string   `xml:"lang,attr,omitempty"`
+	Text    string   `xml:",chardata"`
+}
+
+// ScopeType (shibmd) is a scope of the scoped attributes released by an identity provider
+type ScopeType struct {
+	XMLName xml.Name `xml:"urn:mace:shibboleth:metadata:1.0 Scope"`
+	Regexp  bool     `xml:"regexp,attr,omitempty"`
+	Text    string   `xml:",chardata"`
+}
+
+// DigestMethodType (alg) is a supported digest algorithm
+type DigestMethodType struct {
+	XMLName   xml.Name `xml:"urn:oasis:names:tc:SAML:metadata:algsupport DigestMethod"`
+	Algorithm string   `xml:"Algorithm,attr"`
+}
+
+// SigningMethodType (alg) is a supported signing algorithm, optionally with the supported key sizes
+type SigningMethodType struct {
+	XMLName    xml.Name `xml:"urn:oasis:names:tc:SAML:metadata:algsupport SigningMethod"`
+	Algorithm  string   `xml:"Algorithm,attr"`
+	MinKeySize int      `xml:"MinKeySize,attr,omitempty"`
+	MaxKeySize int      `xml:"MaxKeySize,attr,omitempty"`
+}
+
+// NamespaceREFEDS is the namespace of the REFEDS metadata extensions (remd)
+const NamespaceREFEDS = "http://refeds.org/metadata"
+
+// UnmarshalXML separates the remd:contactType from the contactType,
+// as encoding/xml assigns both attributes to the ContactType otherwise
+func (c *ContactType) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type contactType ContactType
+	var remdContactType string
+	attrs := make([]xml.Attr, 0, len(start.Attr))
+	for _, attr := range start.Attr {
+		if attr.Name.Space == NamespaceREFEDS && attr.Name.Local == "contactType" {
+			remdContactType = attr.Value
+			continue
+		}
+		attrs = append(attrs, attr)
+	}
+	start.Attr = attrs
+	if err := d.DecodeElement((*contactType)(c), &start); err != nil {
+		return err
+	}
+	c.RemdContactType = remdContactType
+	return nil
+}
@@ -22,8 +22,16 @@ type LocalizedURIType struct {
 	//InnerXml string `xml:",innerxml"`
 }
 
+// ExtensionsType contains the supported extensions of the entities and roles, see extensions.go
 type ExtensionsType struct {
-	XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:metadata Extensions"`
+	XMLName          xml.Name              `xml:"urn:oasis:names:tc:SAML:2.0:metadata Extensions"`
+	EntityAttributes *EntityAttributesType `xml:"urn:oasis:names:tc:SAML:metadata:attribute EntityAttributes"`
+	RegistrationInfo *RegistrationInfoType `xml:"urn:oasis:names:tc:SAML:metadata:rpi RegistrationInfo"`
+	PublicationInfo  *PublicationInfoType  `xml:"urn:oasis:names:tc:SAML:metadata:rpi PublicationInfo"`
+	UIInfo           *UIInfoType           `xml:"urn:oasis:names:tc:SAML:metadata:ui UIInfo"`
+	Scope            []ScopeType           `xml:"urn:mace:shibboleth:metadata:1.0 Scope"`
+	DigestMethod     []DigestMethodType    `xml:"urn:oasis:names:tc:SAML:metadata:algsupport DigestMethod"`
+	SigningMethod    []SigningMethodType   `xml:"urn:oasis:names:tc:SAML:metadata:algsupport SigningMethod"`
 	//InnerXml string   `xml:",innerxml"`
 }
 
@@ -66,9 +74,6 @@ type EntityDescriptorType struct {
 	Id                           string                            `xml:"ID,attr,omitempty"`
 	Signature                    *xml_dsig.SignatureType           `xml:"Signature"`
 	Extensions                   *ExtensionsType                   `xml:"Extensions"`
-	Organization                 *OrganizationType                 `xml:"Organization"`
-	ContactPerson                []ContactType                     `xml:"ContactPerson"`
-	AdditionalMetadataLocation   []AdditionalMetadataLocationType  `xml:"AdditionalMetadataLocation"`
 	RoleDescriptor               *RoleDescriptorType               `xml:"RoleDescriptor,omitempty"`
 	IDPSSODescriptor             *IDPSSODescriptorType             `xml:"IDPSSODescriptor,omitempty"`
 	SPSSODescriptor              *SPSSODescriptorType              `xml:"SPSSODescriptor,omitempty"`
@@ -76,6 +81,9 @@ type EntityDescriptorType struct {
 	AttributeAuthorityDescriptor *AttributeAuthorityDescriptorType `xml:"AttributeAuthorityDescriptor,omitempty"`
 	PDPDescriptor                *PDPDescriptorType                `xml:"PDPDescriptor,omitempty"`
 	AffiliationDescriptor        *AffiliationDescriptorType        `xml:"AffiliationDescriptor"`
+	Organization                 *OrganizationType                 `xml:"Organization"`
+	ContactPerson                []ContactType                     `xml:"ContactPerson"`
+	AdditionalMetadataLocation   []AdditionalMetadataLocationType  `xml:"AdditionalMetadataLocation"`
 	//InnerXml                     string                            `xml:",innerxml"`
 }
 
@@ -89,8 +97,10 @@ type OrganizationType struct {
 }
 
 type ContactType struct {
-	XMLName         xml.Name        `xml:"urn:oasis:names:tc:SAML:2.0:metadata ContactPerson"`
-	ContactType     ContactTypeType `xml:"contactType,attr"`
+	XMLName     xml.Name        `xml:"urn:oasis:names:tc:SAML:2.0:metadata ContactPerson"`
+	ContactType ContactTypeType `xml:"contactType,attr"`
+	// RemdContactType is the REFEDS contact type (remd:contactType), e.g. of the security contact
+	RemdContactType string          `xml:"http://refeds.org/metadata contactType,attr,omitempty"`
 	Extensions      *ExtensionsType `xml:"Extensions"`
 	Company         string          `xml:"Company,omitempty"`
 	GivenName       string          `xml:"GivenName,omitempty"`
@@ -160,23 +170,23 @@ type IDPSSODescriptorType struct {
 
 	// DO NOT CHANGE THE ORDER OF THESE PARAMS.
 	// See https://groups.oasis-open.org/higherlogic/ws/public/download/51890/SAML%20MD%20simplified%20overview.pdf/latest chapter 2.10
-	Extensions                *ExtensionsType       `xml:"Extensions"`
-	KeyDescriptor             []KeyDescriptorType   `xml:"KeyDescriptor"`
-	ArtifactResolutionService []IndexedEndpointType `xml:"urn:oasis:names:tc:SAML:2.0:metadata ArtifactResolutionService"`
-	SingleLogoutService       []EndpointType        `xml:"urn:oasis:names:tc:SAML:2.0:metadata SingleLogoutService"`
-	NameIDFormat              []string              `xml:"NameIDFormat"`
-	SingleSignOnService       []EndpointType        `xml:"urn:oasis:names:tc:SAML:2.0:metadata SingleSignOnService"`
+	Signature                 *xml_dsig.SignatureType `xml:"Signature"`
+	Extensions                *ExtensionsType         `xml:"Extensions"`
+	KeyDescriptor             []KeyDescriptorType     `xml:"KeyDescriptor"`
+	Organization              *OrganizationType       `xml:"Organization"`
+	ContactPerson             []ContactType           `xml:"ContactPerson"`
+	ArtifactResolutionService []IndexedEndpointType   `xml:"urn:oasis:names:tc:SAML:2.0:metadata ArtifactResolutionService"`
+	SingleLogoutService       []EndpointType          `xml:"urn:oasis:names:tc:SAML:2.0:metadata SingleLogoutService"`
+	ManageNameIDService       []EndpointType          `xml:"urn:oasis:names:tc:SAML:2.0:metadata ManageNameIDService"`
+	NameIDFormat              []string                `xml:"NameIDFormat"`
+	SingleSignOnService       []EndpointType          `xml:"urn:oasis:names:tc:SAML:2.0:metadata SingleSignOnService"`
 
 	NameIDMappingService      []EndpointType `xml:"urn:oasis:names:tc:SAML:2.0:metadata NameIDMappingService"`
 	AssertionIDRequestService []EndpointType `xml:"urn:oasis:names:tc:SAML:2.0:metadata AssertionIDRequestService"`
 
 	// AttributeProfile MUST be before Attribute
-	AttributeProfile    []string                `xml:"AttributeProfile"`
-	Attribute           []*saml.AttributeType   `xml:"Attribute"`
-	ManageNameIDService []EndpointType          `xml:"urn:oasis:names:tc:SAML:2.0:metadata ManageNameIDService"`
-	Signature           *xml_dsig.SignatureType `xml:"Signature"`
-	Organization        *OrganizationType       `xml:"Organization"`
-	ContactPerson       []ContactType           `xml:"ContactPerson"`
+	AttributeProfile []string              `xml:"AttributeProfile"`
+	Attribute        []*saml.AttributeType `xml:"Attribute"`
 	//InnerXml                   string                  `xml:",innerxml"`
 }
 
@@ -189,17 +199,17 @@ type SPSSODescriptorType struct {
 	CacheDuration              string                          `xml:"cacheDuration,attr,omitempty"`
 	ProtocolSupportEnumeration AnyURIListType                  `xml:"protocolSupportEnumeration,attr"`
 	ErrorURL                   string                          `xml:"errorURL,attr,omitempty"`
-	AssertionConsumerService   []IndexedEndpointType           `xml:"urn:oasis:names:tc:SAML:2.0:metadata AssertionConsumerService"`
-	AttributeConsumingService  []AttributeConsumingServiceType `xml:"AttributeConsumingService"`
-	ArtifactResolutionService  []IndexedEndpointType           `xml:"urn:oasis:names:tc:SAML:2.0:metadata ArtifactResolutionService"`
-	SingleLogoutService        []EndpointType                  `xml:"urn:oasis:names:tc:SAML:2.0:metadata SingleLogoutService"`
-	ManageNameIDService        []EndpointType                  `xml:"urn:oasis:names:tc:SAML:2.0:metadata ManageNameIDService"`
-	NameIDFormat               []string                        `xml:"NameIDFormat"`
 	Signature                  *xml_dsig.SignatureType         `xml:"Signature"`
 	Extensions                 *ExtensionsType                 `xml:"Extensions"`
 	KeyDescriptor              []KeyDescriptorType             `xml:"KeyDescriptor"`
 	Organization               *OrganizationType               `xml:"Organization"`
 	ContactPerson              []ContactType                   `xml:"ContactPerson"`
+	ArtifactResolutionService  []IndexedEndpointType           `xml:"urn:oasis:names:tc:SAML:2.0:metadata ArtifactResolutionService"`
+	SingleLogoutService        []EndpointType                  `xml:"urn:oasis:names:tc:SAML:2.0:metadata SingleLogoutService"`
+	ManageNameIDService        []EndpointType                  `xml:"urn:oasis:names:tc:SAML:2.0:metadata ManageNameIDService"`
+	NameIDFormat               []string                        `xml:"NameIDFormat"`
+	AssertionConsumerService   []IndexedEndpointType           `xml:"urn:oasis:names:tc:SAML:2.0:metadata AssertionConsumerService"`
+	AttributeConsumingService  []AttributeConsumingServiceType `xml:"AttributeConsumingService"`
 	//	InnerXml                   string                          `xml:",innerxml"`
 }
 
@@ -269,18 +279,18 @@ type AttributeAuthorityDescriptorType struct {
 
 	// DO NOT CHANGE THE ORDER OF THESE PARAMS.
 	// See https://groups.oasis-open.org/higherlogic/ws/public/download/51890/SAML%20MD%20simplified%20overview.pdf/latest chapter 2.1
-	KeyDescriptor    []KeyDescriptorType `xml:"KeyDescriptor"`
-	AttributeService []EndpointType      `xml:"urn:oasis:names:tc:SAML:2.0:metadata AttributeService"`
-	NameIDFormat     []string            `xml:"NameIDFormat"`
-
-	AssertionIDRequestService []EndpointType `xml:"urn:oasis:names:tc:SAML:2.0:metadata AssertionIDRequestService"`
-	// AttributeProfile MUST be before Attribute
-	AttributeProfile []string                `xml:"AttributeProfile"`
-	Attribute        []*saml.AttributeType   `xml:"Attribute"`
 	Signature        *xml_dsig.SignatureType `xml:"Signature"`
 	Extensions       *ExtensionsType         `xml:"Extensions"`
+	KeyDescriptor    []KeyDescriptorType     `xml:"KeyDescriptor"`
 	Organization     *OrganizationType       `xml:"Organization"`
 	ContactPerson    []ContactType           `xml:"ContactPerson"`
+	AttributeService []EndpointType          `xml:"urn:oasis:names:tc:SAML:2.0:metadata AttributeService"`
+	NameIDFormat     []string                `xml:"NameIDFormat"`
+
+	AssertionIDRequestService []EndpointType `xml:"urn:oasis:names:tc:SAML:2.0:metadata AssertionIDRequestService"`
+	// AttributeProfile MUST be before Attribute
+	AttributeProfile []string              `xml:"AttributeProfile"`
+	Attribute        []*saml.AttributeType `xml:"Attribute"`
 	//InnerXml                   string                  `xml:",innerxml"`
 }
 
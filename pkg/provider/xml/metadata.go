@@ -1,10 +1,15 @@
 package xml
 
 import (
+	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/zitadel/saml/pkg/provider/xml/md"
 )
@@ -23,6 +28,133 @@ func ReadMetadataFromURL(client *http.Client, url string) ([]byte, error) {
 	return io.ReadAll(resp.Body)
 }
 
+// ErrMetadataNotFound is returned if no metadata is published at the URL
+var ErrMetadataNotFound = errors.New("metadata not found")
+
+// MetadataResponse is the metadata read from a URL, with the validators of the response for conditional requests
+type MetadataResponse struct {
+	Metadata     []byte
+	ETag         string
+	LastModified string
+	// NotModified is true if the metadata did not change since the response with the validators, Metadata is empty then
+	NotModified bool
+}
+
+// ReadMetadataFromURLIfModified reads the metadata from the url with a conditional request,
+// using the ETag and Last-Modified validators of the previous response if not empty
+func ReadMetadataFromURLIfModified(ctx context.Context, client *http.Client, url, etag, lastModified string) (*MetadataResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return &MetadataResponse{ETag: etag, LastModified: lastModified, NotModified: true}, nil
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrMetadataNotFound
+	default:
+		return nil, fmt.Errorf("error while reading metadata with statusCode: %d", resp.StatusCode)
+	}
+	metadata, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &MetadataResponse{
+		Metadata:     metadata,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}, nil
+}
+
+// ParseDuration parses a duration of XML schema (xs:duration), e.g. the cacheDuration of metadata,
+// counting a year as 365 and a month as 30 days
+func ParseDuration(value string) (time.Duration, error) {
+	s := value
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	if !strings.HasPrefix(s, "P") || len(s) < 2 || strings.HasSuffix(s, "T") {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	s = s[1:]
+
+	day := 24 * time.Hour
+	units := map[byte]time.Duration{'Y': 365 * day, 'M': 30 * day, 'D': day}
+	var duration time.Duration
+	for s != "" {
+		if s[0] == 'T' {
+			units = map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+			s = s[1:]
+			continue
+		}
+		i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+		if i <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		unit, ok := units[s[i]]
+		if !ok {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		number, err := strconv.ParseFloat(s[:i], 64)
+		if err != nil || (strings.Contains(s[:i], ".") && s[i] != 'S') {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		duration += time.Duration(number * float64(unit))
+		delete(units, s[i])
+		s = s[i+1:]
+	}
+	if negative {
+		return -duration, nil
+	}
+	return duration, nil
+}
+
+// FormatDuration formats the duration as duration of XML schema (xs:duration), e.g. PT1H30M,
+// with days as largest unit as months and years vary in length
+func FormatDuration(duration time.Duration) string {
+	var b strings.Builder
+	if duration < 0 {
+		b.WriteString("-")
+		duration = -duration
+	}
+	b.WriteString("P")
+	if days := duration / (24 * time.Hour); days > 0 {
+		b.WriteString(strconv.FormatInt(int64(days), 10) + "D")
+		duration -= days * 24 * time.Hour
+	}
+	if duration == 0 {
+		if b.Len() <= 2 {
+			return "PT0S"
+		}
+		return b.String()
+	}
+	b.WriteString("T")
+	if hours := duration / time.Hour; hours > 0 {
+		b.WriteString(strconv.FormatInt(int64(hours), 10) + "H")
+		duration -= hours * time.Hour
+	}
+	if minutes := duration / time.Minute; minutes > 0 {
+		b.WriteString(strconv.FormatInt(int64(minutes), 10) + "M")
+		duration -= minutes * time.Minute
+	}
+	if duration > 0 {
+		b.WriteString(strconv.FormatFloat(duration.Seconds(), 'f', -1, 64) + "S")
+	}
+	return b.String()
+}
+
 func ParseMetadataXmlIntoStruct(xmlData []byte) (*md.EntityDescriptorType, error) {
 	metadata := &md.EntityDescriptorType{}
 	if err := xml.Unmarshal(xmlData, metadata); err != nil {
@@ -31,6 +163,15 @@ func ParseMetadataXmlIntoStruct(xmlData []byte) (*md.EntityDescriptorType, error
 	return metadata, nil
 }
 
+// ParseMetadataAggregateIntoStruct parses an aggregate of metadata (EntitiesDescriptor), as published by federations
+func ParseMetadataAggregateIntoStruct(xmlData []byte) (*md.EntitiesDescriptorType, error) {
+	metadata := &md.EntitiesDescriptorType{}
+	if err := xml.Unmarshal(xmlData, metadata); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
 func GetCertsFromKeyDescriptors(keyDescs []md.KeyDescriptorType) []string {
 	certStrs := []string{}
 	if keyDescs == nil {
@@ -48,3 +189,18 @@ func GetCertsFromKeyDescriptors(keyDescs []md.KeyDescriptorType) []string {
 	}
 	return certStrs
 }
+
+func GetEncryptionCertsFromKeyDescriptors(keyDescs []md.KeyDescriptorType) []string {
+	certStrs := []string{}
+	for _, keyDescriptor := range keyDescs {
+		for _, x509Data := range keyDescriptor.KeyInfo.X509Data {
+			if len(x509Data.X509Certificate) != 0 {
+				switch keyDescriptor.Use {
+				case "", md.KeyTypesEncryption:
+					certStrs = append(certStrs, x509Data.X509Certificate)
+				}
+			}
+		}
+	}
+	return certStrs
+}
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/zitadel/saml/pkg/provider/xml"
 )
@@ -159,3 +160,59 @@ func newTestClient(httpStatus int, metadata []byte) *http.Client {
 		Transport: fn,
 	}
 }
+
+func Test_XmlParseDuration(t *testing.T) {
+	tests := []struct {
+		value    string
+		duration time.Duration
+		err      bool
+	}{
+		{"PT6H", 6 * time.Hour, false},
+		{"PT1H30M", 90 * time.Minute, false},
+		{"P1D", 24 * time.Hour, false},
+		{"P1Y2M3DT4H5M6.5S", (365+60+3)*24*time.Hour + 4*time.Hour + 5*time.Minute + 6500*time.Millisecond, false},
+		{"-PT10S", -10 * time.Second, false},
+		{"PT1650531489S", 1650531489 * time.Second, false},
+		{"P", 0, true},
+		{"PT", 0, true},
+		{"6H", 0, true},
+		{"PT1.5H", 0, true},
+		{"PT1H1H", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			duration, err := xml.ParseDuration(tt.value)
+			if (err != nil) != tt.err {
+				t.Errorf("ParseDuration() error = %v, wantErr %v", err, tt.err)
+				return
+			}
+			if duration != tt.duration {
+				t.Errorf("ParseDuration() = %v, want %v", duration, tt.duration)
+			}
+		})
+	}
+}
+
+func Test_XmlFormatDuration(t *testing.T) {
+	tests := []struct {
+		duration time.Duration
+		value    string
+	}{
+		{0, "PT0S"},
+		{6 * time.Hour, "PT6H"},
+		{90 * time.Minute, "PT1H30M"},
+		{24 * time.Hour, "P1D"},
+		{26*time.Hour + 1500*time.Millisecond, "P1DT2H1.5S"},
+		{-10 * time.Second, "-PT10S"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if value := xml.FormatDuration(tt.duration); value != tt.value {
+				t.Errorf("FormatDuration() = %v, want %v", value, tt.value)
+			}
+			if duration, err := xml.ParseDuration(tt.value); err != nil || duration != tt.duration {
+				t.Errorf("ParseDuration() = %v, %v, want %v", duration, err, tt.duration)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package saml
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	NamespaceXS  = "http://www.w3.org/2001/XMLSchema"
+	NamespaceXSI = "http://www.w3.org/2001/XMLSchema-instance"
+)
+
+// xsi:type values of attribute values, using the xs prefix which is declared on the AttributeValue element
+const (
+	XSString       = "xs:string"
+	XSBoolean      = "xs:boolean"
+	XSInteger      = "xs:integer"
+	XSDateTime     = "xs:dateTime"
+	XSDate         = "xs:date"
+	XSAnyURI       = "xs:anyURI"
+	XSBase64Binary = "xs:base64Binary"
+)
+
+// AttributeValueType is the value of an attribute, which is either simple content typed with xsi:type
+// or a nested NameID (e.g. for eduPersonTargetedID).
+type AttributeValueType struct {
+	// Type is the xsi:type of the value (e.g. XSBoolean), empty for untyped values
+	Type   string
+	Text   string
+	NameID *NameIDType
+	// Nil marks the value with xsi:nil
+	Nil bool
+}
+
+// StringAttributeValues returns untyped attribute values for the provided strings
+func StringAttributeValues(values ...string) []AttributeValueType {
+	attributeValues := make([]AttributeValueType, len(values))
+	for i, value := range values {
+		attributeValues[i] = AttributeValueType{Text: value}
+	}
+	return attributeValues
+}
+
+func NewStringAttributeValue(value string) AttributeValueType {
+	return AttributeValueType{Type: XSString, Text: value}
+}
+
+func NewBooleanAttributeValue(value bool) AttributeValueType {
+	return AttributeValueType{Type: XSBoolean, Text: strconv.FormatBool(value)}
+}
+
+func NewIntegerAttributeValue(value int64) AttributeValueType {
+	return AttributeValueType{Type: XSInteger, Text: strconv.FormatInt(value, 10)}
+}
+
+func NewDateTimeAttributeValue(value time.Time) AttributeValueType {
+	return AttributeValueType{Type: XSDateTime, Text: value.UTC().Format(time.RFC3339)}
+}
+
+func NewNameIDAttributeValue(nameID *NameIDType) AttributeValueType {
+	return AttributeValueType{NameID: nameID}
+}
+
+// Values returns the text content of all values of the attribute
+func (a *AttributeType) Values() []string {
+	values := make([]string, len(a.AttributeValue))
+	for i, value := range a.AttributeValue {
+		values[i] = value.Text
+	}
+	return values
+}
+
+func (v AttributeValueType) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start = xml.StartElement{Name: xml.Name{Local: "AttributeValue"}}
+	if v.Type != "" || v.Nil {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "xmlns:xsi"}, Value: NamespaceXSI})
+	}
+	if v.Type != "" {
+		if strings.HasPrefix(v.Type, "xs:") {
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "xmlns:xs"}, Value: NamespaceXS})
+		}
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "xsi:type"}, Value: v.Type})
+	}
+	if v.Nil {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "xsi:nil"}, Value: "true"})
+	}
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	if v.NameID != nil {
+		if err := e.EncodeElement(v.NameID, xml.StartElement{Name: xml.Name{Local: "NameID"}}); err != nil {
+			return err
+		}
+	} else if v.Text != "" {
+		if err := e.EncodeToken(xml.CharData(v.Text)); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+func (v *AttributeValueType) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	*v = AttributeValueType{}
+	for _, attr := range start.Attr {
+		if attr.Name.Space != NamespaceXSI && attr.Name.Space != "xsi" {
+			continue
+		}
+		switch attr.Name.Local {
+		case "type":
+			v.Type = attr.Value
+		case "nil":
+			v.Nil = attr.Value == "true" || attr.Value == "1"
+		}
+	}
+
+	var text strings.Builder
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.CharData:
+			text.Write(t)
+		case xml.StartElement:
+			if t.Name.Local != "NameID" {
+				if err := d.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			nameID := new(NameIDType)
+			if err := d.DecodeElement(nameID, &t); err != nil {
+				return err
+			}
+			v.NameID = nameID
+		case xml.EndElement:
+			if v.NameID == nil {
+				v.Text = text.String()
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package saml
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttributeValueType_Marshal(t *testing.T) {
+	tests := []struct {
+		name  string
+		value AttributeValueType
+		want  string
+	}{
+		{
+			"untyped",
+			AttributeValueType{Text: "value"},
+			`<AttributeValue>value</AttributeValue>`,
+		},
+		{
+			"boolean",
+			NewBooleanAttributeValue(true),
+			`<AttributeValue xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:xs="http://www.w3.org/2001/XMLSchema" xsi:type="xs:boolean">true</AttributeValue>`,
+		},
+		{
+			"nil",
+			AttributeValueType{Nil: true},
+			`<AttributeValue xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:nil="true"></AttributeValue>`,
+		},
+		{
+			"nameID",
+			NewNameIDAttributeValue(&NameIDType{Format: "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent", Text: "id"}),
+			`<AttributeValue><NameID Format="urn:oasis:names:tc:SAML:2.0:nameid-format:persistent">id</NameID></AttributeValue>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := xml.Marshal(tt.value)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestAttributeType_Unmarshal(t *testing.T) {
+	data := `<saml:Attribute xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:xs="http://www.w3.org/2001/XMLSchema" Name="attr">
+	<saml:AttributeValue xsi:type="xs:integer">42</saml:AttributeValue>
+	<saml:AttributeValue>untyped</saml:AttributeValue>
+	<saml:AttributeValue xsi:nil="true"/>
+	<saml:AttributeValue>
+		<saml:NameID Format="urn:oasis:names:tc:SAML:2.0:nameid-format:persistent">id</saml:NameID>
+	</saml:AttributeValue>
+</saml:Attribute>`
+
+	attr := new(AttributeType)
+	require.NoError(t, xml.Unmarshal([]byte(data), attr))
+	require.Len(t, attr.AttributeValue, 4)
+
+	assert.Equal(t, AttributeValueType{Type: XSInteger, Text: "42"}, attr.AttributeValue[0])
+	assert.Equal(t, AttributeValueType{Text: "untyped"}, attr.AttributeValue[1])
+	assert.Equal(t, AttributeValueType{Nil: true}, attr.AttributeValue[2])
+	require.NotNil(t, attr.AttributeValue[3].NameID)
+	assert.Equal(t, "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent", attr.AttributeValue[3].NameID.Format)
+	assert.Equal(t, "id", attr.AttributeValue[3].NameID.Text)
+}
@@ -67,13 +67,27 @@ type SubjectConfirmationType struct {
 
 type SubjectConfirmationDataType struct {
 	XMLName      xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmationData"`
+	XMLNSXSI     string   `xml:"xmlns:xsi,attr,omitempty"`
+	XMLNSSAML    string   `xml:"xmlns:saml,attr,omitempty"`
+	Type         string   `xml:"xsi:type,attr,omitempty"`
+	NotBefore    string   `xml:"NotBefore,attr,omitempty"`
 	NotOnOrAfter string   `xml:"NotOnOrAfter,attr,omitempty"`
 	Recipient    string   `xml:"Recipient,attr,omitempty"`
 	InResponseTo string   `xml:"InResponseTo,attr,omitempty"`
 	Address      string   `xml:"Address,attr,omitempty"`
+	// KeyInfo is only used with the xsi:type KeyInfoConfirmationDataType (holder-of-key)
+	KeyInfo []xml_dsig.KeyInfoType `xml:"http://www.w3.org/2000/09/xmldsig# KeyInfo"`
 	//InnerXml     string   `xml:",innerxml"`
 }
 
+// SetKeyInfoConfirmationDataType types the SubjectConfirmationData as KeyInfoConfirmationDataType,
+// declaring the used prefixes on the element itself
+func (s *SubjectConfirmationDataType) SetKeyInfoConfirmationDataType() {
+	s.XMLNSXSI = NamespaceXSI
+	s.XMLNSSAML = "urn:oasis:names:tc:SAML:2.0:assertion"
+	s.Type = "saml:KeyInfoConfirmationDataType"
+}
+
 type KeyInfoConfirmationDataType struct {
 	XMLName      xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion KeyInfoConfirmationData"`
 	NotBefore    string   `xml:"NotBefore,attr,omitempty"`
@@ -113,7 +127,7 @@ type OneTimeUseType struct {
 
 type ProxyRestrictionType struct {
 	XMLName  xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion ProxyRestriction"`
-	Count    int      `xml:"Count,attr,omitempty"`
+	Count    *int     `xml:"Count,attr,omitempty"`
 	Audience []string `xml:",any"`
 	//InnerXml string   `xml:",innerxml"`
 }
@@ -190,11 +204,11 @@ type AttributeStatementType struct {
 }
 
 type AttributeType struct {
-	XMLName        xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion Attribute"`
-	Name           string   `xml:"Name,attr"`
-	NameFormat     string   `xml:"NameFormat,attr,omitempty"`
-	FriendlyName   string   `xml:"FriendlyName,attr,omitempty"`
-	AttributeValue []string `xml:",any"`
+	XMLName        xml.Name             `xml:"urn:oasis:names:tc:SAML:2.0:assertion Attribute"`
+	Name           string               `xml:"Name,attr"`
+	NameFormat     string               `xml:"NameFormat,attr,omitempty"`
+	FriendlyName   string               `xml:"FriendlyName,attr,omitempty"`
+	AttributeValue []AttributeValueType `xml:",any"`
 	//InnerXml       string   `xml:",innerxml"`
 }
 
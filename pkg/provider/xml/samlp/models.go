@@ -158,14 +158,14 @@ type AuthnRequestType struct {
 	IssueInstant                   string                     `xml:"IssueInstant,attr"`
 	Destination                    string                     `xml:"Destination,attr,omitempty"`
 	Consent                        string                     `xml:"Consent,attr,omitempty"`
+	Issuer                         *saml.NameIDType           `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Signature                      *xml_dsig.SignatureType    `xml:"Signature"`
+	Extensions                     *ExtensionsType            `xml:"Extensions"`
 	Subject                        *saml.SubjectType          `xml:"Subject"`
 	NameIDPolicy                   *NameIDPolicyType          `xml:"NameIDPolicy"`
 	Conditions                     *saml.ConditionsType       `xml:"Conditions"`
 	RequestedAuthnContext          *RequestedAuthnContextType `xml:"RequestedAuthnContext"`
 	Scoping                        *ScopingType               `xml:"Scoping"`
-	Issuer                         *saml.NameIDType           `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
-	Signature                      *xml_dsig.SignatureType    `xml:"Signature"`
-	Extensions                     *ExtensionsType            `xml:"Extensions"`
 	//InnerXml                       string                     `xml:",innerxml"`
 }
 
@@ -179,7 +179,7 @@ type NameIDPolicyType struct {
 
 type ScopingType struct {
 	XMLName     xml.Name     `xml:"urn:oasis:names:tc:SAML:2.0:protocol Scoping"`
-	ProxyCount  int          `xml:"ProxyCount,attr,omitempty"`
+	ProxyCount  *int         `xml:"ProxyCount,attr"`
 	IDPList     *IDPListType `xml:"IDPList"`
 	RequesterID []string     `xml:"RequesterID"`
 	//InnerXml    string       `xml:",innerxml"`
@@ -188,7 +188,7 @@ type ScopingType struct {
 type IDPListType struct {
 	XMLName     xml.Name       `xml:"urn:oasis:names:tc:SAML:2.0:protocol IDPList"`
 	IDPEntry    []IDPEntryType `xml:"IDPEntry"`
-	GetComplete string         `xml:"GetComplete"`
+	GetComplete string         `xml:"GetComplete,omitempty"`
 	//InnerXml    string         `xml:",innerxml"`
 }
 
@@ -212,7 +212,7 @@ type ResponseType struct {
 	Signature    *xml_dsig.SignatureType `xml:"Signature"`
 	Extensions   *ExtensionsType         `xml:"Extensions"`
 	Status       StatusType              `xml:"Status"`
-	Assertion    saml.AssertionType      `xml:"Assertion"`
+	Assertion    *saml.AssertionType     `xml:"Assertion"`
 	//InnerXml     string                  `xml:",innerxml"`
 }
 
@@ -252,17 +252,32 @@ type ManageNameIDRequestType struct {
 	IssueInstant   string                     `xml:"IssueInstant,attr"`
 	Destination    string                     `xml:"Destination,attr,omitempty"`
 	Consent        string                     `xml:"Consent,attr,omitempty"`
-	NameID         *saml.NameIDType           `xml:"urn:oasis:names:tc:SAML:2.0:assertion NameID"`
-	EncryptedID    *saml.EncryptedElementType `xml:"EncryptedID"`
-	NewID          string                     `xml:"NewID"`
-	NewEncryptedID *saml.EncryptedElementType `xml:"NewEncryptedID"`
-	Terminate      *TerminateType             `xml:"Terminate"`
 	Issuer         *saml.NameIDType           `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
 	Signature      *xml_dsig.SignatureType    `xml:"Signature"`
 	Extensions     *ExtensionsType            `xml:"Extensions"`
+	NameID         *saml.NameIDType           `xml:"urn:oasis:names:tc:SAML:2.0:assertion NameID"`
+	EncryptedID    *saml.EncryptedElementType `xml:"urn:oasis:names:tc:SAML:2.0:assertion EncryptedID"`
+	NewID          string                     `xml:"NewID,omitempty"`
+	NewEncryptedID *saml.EncryptedElementType `xml:"NewEncryptedID"`
+	Terminate      *TerminateType             `xml:"Terminate"`
 	//InnerXml       string                     `xml:",innerxml"`
 }
 
+type ManageNameIDResponseType struct {
+	XMLName      xml.Name                `xml:"urn:oasis:names:tc:SAML:2.0:protocol ManageNameIDResponse"`
+	Id           string                  `xml:"ID,attr"`
+	InResponseTo string                  `xml:"InResponseTo,attr,omitempty"`
+	Version      string                  `xml:"Version,attr"`
+	IssueInstant string                  `xml:"IssueInstant,attr"`
+	Destination  string                  `xml:"Destination,attr,omitempty"`
+	Consent      string                  `xml:"Consent,attr,omitempty"`
+	Issuer       *saml.NameIDType        `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Signature    *xml_dsig.SignatureType `xml:"Signature"`
+	Extensions   *ExtensionsType         `xml:"Extensions"`
+	Status       StatusType              `xml:"Status"`
+	//InnerXml     string                  `xml:",innerxml"`
+}
+
 type TerminateType struct {
 	XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol Terminate"`
 	//InnerXml string   `xml:",innerxml"`
@@ -320,17 +335,19 @@ type NameIDMappingRequestType struct {
 }
 
 type NameIDMappingResponseType struct {
-	XMLName      xml.Name                `xml:"NameIDMappingResponse"`
-	Id           string                  `xml:"ID,attr"`
-	InResponseTo string                  `xml:"InResponseTo,attr,omitempty"`
-	Version      string                  `xml:"Version,attr"`
-	IssueInstant string                  `xml:"IssueInstant,attr"`
-	Destination  string                  `xml:"Destination,attr,omitempty"`
-	Consent      string                  `xml:"Consent,attr,omitempty"`
-	Issuer       *saml.NameIDType        `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
-	Signature    *xml_dsig.SignatureType `xml:"Signature"`
-	Extensions   *ExtensionsType         `xml:"Extensions"`
-	Status       StatusType              `xml:"Status"`
+	XMLName      xml.Name                   `xml:"urn:oasis:names:tc:SAML:2.0:protocol NameIDMappingResponse"`
+	Id           string                     `xml:"ID,attr"`
+	InResponseTo string                     `xml:"InResponseTo,attr,omitempty"`
+	Version      string                     `xml:"Version,attr"`
+	IssueInstant string                     `xml:"IssueInstant,attr"`
+	Destination  string                     `xml:"Destination,attr,omitempty"`
+	Consent      string                     `xml:"Consent,attr,omitempty"`
+	Issuer       *saml.NameIDType           `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Signature    *xml_dsig.SignatureType    `xml:"Signature"`
+	Extensions   *ExtensionsType            `xml:"Extensions"`
+	Status       StatusType                 `xml:"Status"`
+	NameID       *saml.NameIDType           `xml:"urn:oasis:names:tc:SAML:2.0:assertion NameID"`
+	EncryptedID  *saml.EncryptedElementType `xml:"urn:oasis:names:tc:SAML:2.0:assertion EncryptedID"`
 	//InnerXml     string                  `xml:",innerxml"`
 }
 
@@ -45,3 +45,86 @@ type ResponseBody struct {
 	XMLName  xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
 	Response *samlp.ResponseType
 }
+
+type AssertionQueryEnvelope struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+	Body    AssertionQueryBody
+}
+
+// AssertionQueryBody contains one of the requests of the assertion query/request protocol
+type AssertionQueryBody struct {
+	XMLName            xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+	AssertionIDRequest *samlp.AssertionIDRequestType
+	AuthnQuery         *samlp.AuthnQueryType
+	AuthzDecisionQuery *samlp.AuthzDecisionQueryType
+}
+
+type NameIDMappingRequestEnvelope struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+	Body    NameIDMappingRequestBody
+}
+
+type NameIDMappingRequestBody struct {
+	XMLName              xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+	NameIDMappingRequest *samlp.NameIDMappingRequestType
+}
+
+type NameIDMappingResponseEnvelope struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+	Body    NameIDMappingResponseBody
+}
+
+type NameIDMappingResponseBody struct {
+	XMLName               xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+	NameIDMappingResponse *samlp.NameIDMappingResponseType
+}
+
+type ManageNameIDRequestEnvelope struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+	Body    ManageNameIDRequestBody
+}
+
+type ManageNameIDRequestBody struct {
+	XMLName             xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+	ManageNameIDRequest *samlp.ManageNameIDRequestType
+}
+
+type ManageNameIDResponseEnvelope struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+	Body    ManageNameIDResponseBody
+}
+
+type ManageNameIDResponseBody struct {
+	XMLName              xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+	ManageNameIDResponse *samlp.ManageNameIDResponseType
+}
+
+type AuthnRequestEnvelope struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+	Body    AuthnRequestBody
+}
+
+type AuthnRequestBody struct {
+	XMLName      xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+	AuthnRequest *samlp.AuthnRequestType
+}
+
+// ECPResponseEnvelope is the response of the identity provider to the enhanced client or proxy (ECP)
+type ECPResponseEnvelope struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+	Header  ECPResponseHeader
+	Body    ResponseBody
+}
+
+type ECPResponseHeader struct {
+	XMLName  xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Header"`
+	Response *ECPResponseType
+}
+
+// ECPResponseType tells the ECP the AssertionConsumerServiceURL the response has to be sent to
+type ECPResponseType struct {
+	XMLName                     xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:profiles:SSO:ecp Response"`
+	MustUnderstand              string   `xml:"http://schemas.xmlsoap.org/soap/envelope/ mustUnderstand,attr"`
+	Actor                       string   `xml:"http://schemas.xmlsoap.org/soap/envelope/ actor,attr"`
+	AssertionConsumerServiceURL string   `xml:"AssertionConsumerServiceURL,attr"`
+}
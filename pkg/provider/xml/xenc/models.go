@@ -23,7 +23,7 @@ type EncryptionMethodType struct {
 	XMLName    xml.Name
 	Algorithm  string       `xml:"Algorithm,attr"`
 	KeySize    *KeySizeType `xml:"KeySize"`
-	OAEPparams string       `xml:"OAEPparams"`
+	OAEPparams string       `xml:"OAEPparams,omitempty"`
 	//InnerXml   string       `xml:",innerxml"`
 }
 
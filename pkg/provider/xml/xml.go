@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/zitadel/saml/pkg/provider/xml/saml"
 	"github.com/zitadel/saml/pkg/provider/xml/samlp"
 	"github.com/zitadel/saml/pkg/provider/xml/soap"
 	"github.com/zitadel/saml/pkg/provider/xml/xml_dsig"
@@ -93,6 +94,17 @@ func DecodeAuthNRequest(encoding string, message string) (*samlp.AuthnRequestTyp
 	return req, nil
 }
 
+func DecodeAuthNRequestEnvelope(request string) (*samlp.AuthnRequestType, error) {
+	decoder := xml.NewDecoder(strings.NewReader(request))
+	var authnEnv soap.AuthnRequestEnvelope
+	err := decoder.Decode(&authnEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	return authnEnv.Body.AuthnRequest, nil
+}
+
 func DecodeSignature(encoding string, b64 bool, message string) (*xml_dsig.SignatureType, error) {
 	data, err := InflateAndDecode(encoding, b64, message)
 	if err != nil {
@@ -116,6 +128,62 @@ func DecodeAttributeQuery(request string) (*samlp.AttributeQueryType, error) {
 	return attrEnv.Body.AttributeQuery, nil
 }
 
+func DecodeAssertionQuery(request string) (*soap.AssertionQueryBody, error) {
+	decoder := xml.NewDecoder(strings.NewReader(request))
+	var queryEnv soap.AssertionQueryEnvelope
+	err := decoder.Decode(&queryEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	return &queryEnv.Body, nil
+}
+
+func DecodeNameIDMappingRequest(request string) (*samlp.NameIDMappingRequestType, error) {
+	decoder := xml.NewDecoder(strings.NewReader(request))
+	var mappingEnv soap.NameIDMappingRequestEnvelope
+	err := decoder.Decode(&mappingEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	return mappingEnv.Body.NameIDMappingRequest, nil
+}
+
+func DecodeManageNameIDRequest(encoding string, message string) (*samlp.ManageNameIDRequestType, error) {
+	data, err := InflateAndDecode(encoding, true, message)
+	if err != nil {
+		return nil, err
+	}
+	req := &samlp.ManageNameIDRequestType{}
+	if err := xml.Unmarshal(data, req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func DecodeManageNameIDRequestEnvelope(request string) (*samlp.ManageNameIDRequestType, error) {
+	decoder := xml.NewDecoder(strings.NewReader(request))
+	var manageEnv soap.ManageNameIDRequestEnvelope
+	err := decoder.Decode(&manageEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	return manageEnv.Body.ManageNameIDRequest, nil
+}
+
+func DecodeManageNameIDResponseEnvelope(response string) (*samlp.ManageNameIDResponseType, error) {
+	decoder := xml.NewDecoder(strings.NewReader(response))
+	var manageEnv soap.ManageNameIDResponseEnvelope
+	err := decoder.Decode(&manageEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	return manageEnv.Body.ManageNameIDResponse, nil
+}
+
 func DecodeLogoutRequest(encoding string, message string) (*samlp.LogoutRequestType, error) {
 	data, err := InflateAndDecode(encoding, true, message)
 	if err != nil {
@@ -140,6 +208,14 @@ func DecodeResponse(encoding string, b64 bool, message string) (*samlp.ResponseT
 	return req, nil
 }
 
+func DecodeAssertion(message string) (*saml.AssertionType, error) {
+	assertion := &saml.AssertionType{}
+	if err := xml.Unmarshal([]byte(message), assertion); err != nil {
+		return nil, err
+	}
+	return assertion, nil
+}
+
 func InflateAndDecode(encoding string, b64 bool, message string) (_ []byte, err error) {
 	data := []byte(message)
 	if b64 {